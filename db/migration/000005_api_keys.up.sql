@@ -0,0 +1,18 @@
+-- API ключи для систем телеметрии (machine-to-machine)
+CREATE TABLE api_keys (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    name TEXT NOT NULL,
+    prefix TEXT NOT NULL UNIQUE,            -- открытая часть ключа для поиска
+    key_hash TEXT NOT NULL,                 -- SHA-256 секретной части
+    scopes TEXT[] NOT NULL,                 -- разрешенные операции (ingest:hot_water, ...)
+    building_ids UUID[] NOT NULL DEFAULT '{}', -- ограничение по зданиям (пусто - без ограничения)
+    itp_ids UUID[] NOT NULL DEFAULT '{}',   -- ограничение по ИТП (пусто - без ограничения)
+    expires_at TIMESTAMPTZ,
+    last_used_at TIMESTAMPTZ,
+    revoked_at TIMESTAMPTZ,
+    rotated_from UUID REFERENCES api_keys(id) ON DELETE SET NULL,
+    created_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_api_keys_revoked_at ON api_keys(revoked_at);
@@ -0,0 +1,5 @@
+ALTER TABLE IF EXISTS api_keys DROP COLUMN IF EXISTS organization_id;
+ALTER TABLE IF EXISTS users DROP COLUMN IF EXISTS is_superuser;
+ALTER TABLE IF EXISTS users DROP COLUMN IF EXISTS organization_id;
+ALTER TABLE IF EXISTS buildings DROP COLUMN IF EXISTS organization_id;
+DROP TABLE IF EXISTS organizations;
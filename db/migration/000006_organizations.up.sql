@@ -0,0 +1,22 @@
+-- Управляющие компании (арендаторы сервиса)
+CREATE TABLE organizations (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    name TEXT NOT NULL UNIQUE,
+    inn TEXT UNIQUE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- Здание принадлежит одной управляющей компании (NULL - не распределено, видно только суперпользователю)
+ALTER TABLE buildings ADD COLUMN organization_id UUID REFERENCES organizations(id) ON DELETE SET NULL;
+CREATE INDEX idx_buildings_organization_id ON buildings(organization_id);
+
+-- Пользователь видит только здания своей компании; суперпользователь - все
+ALTER TABLE users ADD COLUMN organization_id UUID REFERENCES organizations(id) ON DELETE CASCADE;
+ALTER TABLE users ADD COLUMN is_superuser BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- API ключ компании может загружать показания только по ее зданиям
+ALTER TABLE api_keys ADD COLUMN organization_id UUID REFERENCES organizations(id) ON DELETE CASCADE;
+
+-- Уже созданные администраторы становятся суперпользователями
+UPDATE users SET is_superuser = TRUE WHERE role = 'admin';
@@ -0,0 +1,34 @@
+-- Журнал действий операторов и системы (только добавление)
+CREATE TABLE audit_log (
+    id BIGSERIAL PRIMARY KEY,
+    occurred_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    actor_type TEXT NOT NULL CHECK (actor_type IN ('user', 'api_key', 'system', 'anonymous')),
+    actor_id UUID,                     -- пользователь или API ключ
+    actor_name TEXT NOT NULL,
+    organization_id UUID,              -- компания, в рамках которой выполнено действие
+    action TEXT NOT NULL,              -- например generator.start, data.seed
+    target_type TEXT,
+    target_id TEXT,
+    before JSONB,                      -- состояние до изменения
+    after JSONB,                       -- состояние после изменения
+    status_code INTEGER,               -- HTTP статус для действий через API
+    ip TEXT,
+    user_agent TEXT
+);
+
+CREATE INDEX idx_audit_log_occurred_at ON audit_log(occurred_at);
+CREATE INDEX idx_audit_log_actor_id ON audit_log(actor_id);
+CREATE INDEX idx_audit_log_action ON audit_log(action);
+CREATE INDEX idx_audit_log_target ON audit_log(target_type, target_id);
+CREATE INDEX idx_audit_log_organization_id ON audit_log(organization_id);
+
+-- Записи журнала нельзя изменять или удалять
+CREATE FUNCTION audit_log_append_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'audit_log is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER audit_log_no_update_delete
+    BEFORE UPDATE OR DELETE ON audit_log
+    FOR EACH ROW EXECUTE PROCEDURE audit_log_append_only();
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS rollup_state;
+DROP TABLE IF EXISTS readings_daily;
+DROP TABLE IF EXISTS readings_hourly;
+DROP VIEW IF EXISTS readings_raw;
@@ -0,0 +1,53 @@
+-- Показания всех счетчиков в едином виде: здание, время, показатель, значение.
+-- Используется заданиями агрегации и запросами временных рядов
+CREATE VIEW readings_raw AS
+    SELECT building_id, timestamp, 'hot_water'::text AS metric, (flow_rate_ch1 + flow_rate_ch2)::double precision AS value
+    FROM hot_water_meters
+    UNION ALL
+    SELECT building_id, timestamp, 'hot_water_ch1', flow_rate_ch1::double precision FROM hot_water_meters
+    UNION ALL
+    SELECT building_id, timestamp, 'hot_water_ch2', flow_rate_ch2::double precision FROM hot_water_meters
+    UNION ALL
+    SELECT i.building_id, c.timestamp, 'cold_water', c.flow_rate::double precision
+    FROM cold_water_meters c JOIN itp i ON i.id = c.itp_id
+    UNION ALL
+    SELECT building_id, timestamp, 'supply_temp', supply_temp::double precision FROM temperature_readings
+    UNION ALL
+    SELECT building_id, timestamp, 'return_temp', return_temp::double precision FROM temperature_readings
+    UNION ALL
+    SELECT building_id, timestamp, 'delta_temp', delta_temp::double precision FROM temperature_readings;
+
+-- Почасовые агрегаты показаний
+CREATE TABLE readings_hourly (
+    building_id UUID NOT NULL REFERENCES buildings(id) ON DELETE CASCADE,
+    metric TEXT NOT NULL,
+    bucket TIMESTAMPTZ NOT NULL,       -- начало часа
+    sum DOUBLE PRECISION NOT NULL,
+    count INTEGER NOT NULL,
+    min DOUBLE PRECISION NOT NULL,
+    max DOUBLE PRECISION NOT NULL,
+    PRIMARY KEY (building_id, metric, bucket)
+);
+
+CREATE INDEX idx_readings_hourly_bucket ON readings_hourly(bucket);
+
+-- Суточные агрегаты (строятся из почасовых)
+CREATE TABLE readings_daily (
+    building_id UUID NOT NULL REFERENCES buildings(id) ON DELETE CASCADE,
+    metric TEXT NOT NULL,
+    bucket TIMESTAMPTZ NOT NULL,       -- начало суток (UTC)
+    sum DOUBLE PRECISION NOT NULL,
+    count INTEGER NOT NULL,
+    min DOUBLE PRECISION NOT NULL,
+    max DOUBLE PRECISION NOT NULL,
+    PRIMARY KEY (building_id, metric, bucket)
+);
+
+CREATE INDEX idx_readings_daily_bucket ON readings_daily(bucket);
+
+-- Граница агрегации: интервалы до watermark уже свернуты
+CREATE TABLE rollup_state (
+    resolution TEXT PRIMARY KEY CHECK (resolution IN ('hourly', 'daily')),
+    watermark TIMESTAMPTZ NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
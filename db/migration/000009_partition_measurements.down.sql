@@ -0,0 +1,119 @@
+-- Возврат к обычным таблицам. Выполняется, только если таблицы секционированы,
+-- поэтому повторный запуск (или запуск до up при инициализации контейнера) ничего не меняет
+DO $$
+BEGIN
+    IF (SELECT relkind FROM pg_class WHERE oid = to_regclass('hot_water_meters')) IS DISTINCT FROM 'p' THEN
+        RETURN;
+    END IF;
+
+    DROP VIEW IF EXISTS readings_raw;
+
+    ALTER TABLE cold_water_meters RENAME TO cold_water_meters_part;
+    ALTER TABLE cold_water_meters_part DROP CONSTRAINT cold_water_meters_pkey;
+    ALTER TABLE cold_water_meters_part DROP CONSTRAINT cold_water_meters_itp_id_timestamp_key;
+    DROP INDEX IF EXISTS idx_cold_water_meters_timestamp;
+    DROP INDEX IF EXISTS idx_cold_water_meters_itp_id;
+
+    ALTER TABLE hot_water_meters RENAME TO hot_water_meters_part;
+    ALTER TABLE hot_water_meters_part DROP CONSTRAINT hot_water_meters_pkey;
+    ALTER TABLE hot_water_meters_part DROP CONSTRAINT hot_water_meters_building_id_timestamp_key;
+    DROP INDEX IF EXISTS idx_hot_water_meters_timestamp;
+    DROP INDEX IF EXISTS idx_hot_water_meters_building_id;
+
+    ALTER TABLE temperature_readings RENAME TO temperature_readings_part;
+    ALTER TABLE temperature_readings_part DROP CONSTRAINT temperature_readings_pkey;
+    ALTER TABLE temperature_readings_part DROP CONSTRAINT temperature_readings_building_id_timestamp_key;
+    DROP INDEX IF EXISTS idx_temperature_readings_timestamp;
+    DROP INDEX IF EXISTS idx_temperature_readings_building_id;
+
+    ALTER TABLE pump_data RENAME TO pump_data_part;
+    ALTER TABLE pump_data_part DROP CONSTRAINT pump_data_pkey;
+    ALTER TABLE pump_data_part DROP CONSTRAINT pump_data_building_id_pump_number_timestamp_key;
+    DROP INDEX IF EXISTS idx_pump_data_timestamp;
+    DROP INDEX IF EXISTS idx_pump_data_building_id;
+    DROP INDEX IF EXISTS idx_pump_data_status;
+
+    CREATE TABLE cold_water_meters (
+        id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+        itp_id UUID NOT NULL REFERENCES itp(id) ON DELETE CASCADE,
+        flow_rate INTEGER NOT NULL,
+        timestamp TIMESTAMPTZ NOT NULL,
+        created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+        UNIQUE(itp_id, timestamp)
+    );
+
+    CREATE TABLE hot_water_meters (
+        id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+        building_id UUID NOT NULL REFERENCES buildings(id) ON DELETE CASCADE,
+        flow_rate_ch1 INTEGER NOT NULL,
+        flow_rate_ch2 INTEGER NOT NULL,
+        timestamp TIMESTAMPTZ NOT NULL,
+        created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+        UNIQUE(building_id, timestamp)
+    );
+
+    CREATE TABLE temperature_readings (
+        id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+        building_id UUID NOT NULL REFERENCES buildings(id) ON DELETE CASCADE,
+        supply_temp INTEGER NOT NULL,
+        return_temp INTEGER NOT NULL,
+        delta_temp INTEGER NOT NULL,
+        timestamp TIMESTAMPTZ NOT NULL,
+        created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+        UNIQUE(building_id, timestamp)
+    );
+
+    CREATE TABLE pump_data (
+        id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+        building_id UUID NOT NULL REFERENCES buildings(id) ON DELETE CASCADE,
+        pump_number TEXT NOT NULL,
+        status TEXT NOT NULL,
+        operating_hours INTEGER NOT NULL,
+        pressure_input INTEGER NOT NULL,
+        pressure_output INTEGER NOT NULL,
+        vibration_level INTEGER NOT NULL,
+        timestamp TIMESTAMPTZ NOT NULL,
+        created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+        UNIQUE(building_id, pump_number, timestamp)
+    );
+
+    INSERT INTO cold_water_meters SELECT * FROM cold_water_meters_part;
+    INSERT INTO hot_water_meters SELECT * FROM hot_water_meters_part;
+    INSERT INTO temperature_readings SELECT * FROM temperature_readings_part;
+    INSERT INTO pump_data SELECT * FROM pump_data_part;
+
+    DROP TABLE cold_water_meters_part;
+    DROP TABLE hot_water_meters_part;
+    DROP TABLE temperature_readings_part;
+    DROP TABLE pump_data_part;
+
+    CREATE INDEX idx_temperature_readings_timestamp ON temperature_readings(timestamp);
+    CREATE INDEX idx_temperature_readings_building_id ON temperature_readings(building_id);
+    CREATE INDEX idx_pump_data_timestamp ON pump_data(timestamp);
+    CREATE INDEX idx_pump_data_building_id ON pump_data(building_id);
+    CREATE INDEX idx_pump_data_status ON pump_data(status);
+    CREATE INDEX idx_cold_water_meters_timestamp ON cold_water_meters(timestamp);
+    CREATE INDEX idx_hot_water_meters_timestamp ON hot_water_meters(timestamp);
+    CREATE INDEX idx_cold_water_meters_itp_id ON cold_water_meters(itp_id);
+    CREATE INDEX idx_hot_water_meters_building_id ON hot_water_meters(building_id);
+
+    CREATE VIEW readings_raw AS
+        SELECT building_id, timestamp, 'hot_water'::text AS metric, (flow_rate_ch1 + flow_rate_ch2)::double precision AS value
+        FROM hot_water_meters
+        UNION ALL
+        SELECT building_id, timestamp, 'hot_water_ch1', flow_rate_ch1::double precision FROM hot_water_meters
+        UNION ALL
+        SELECT building_id, timestamp, 'hot_water_ch2', flow_rate_ch2::double precision FROM hot_water_meters
+        UNION ALL
+        SELECT i.building_id, c.timestamp, 'cold_water', c.flow_rate::double precision
+        FROM cold_water_meters c JOIN itp i ON i.id = c.itp_id
+        UNION ALL
+        SELECT building_id, timestamp, 'supply_temp', supply_temp::double precision FROM temperature_readings
+        UNION ALL
+        SELECT building_id, timestamp, 'return_temp', return_temp::double precision FROM temperature_readings
+        UNION ALL
+        SELECT building_id, timestamp, 'delta_temp', delta_temp::double precision FROM temperature_readings;
+END;
+$$;
+
+DROP FUNCTION IF EXISTS ensure_month_partition(TEXT, DATE);
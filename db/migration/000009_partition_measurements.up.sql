@@ -0,0 +1,170 @@
+-- Помесячное секционирование таблиц показаний по timestamp.
+-- Первичный ключ секционированной таблицы должен включать ключ секционирования, поэтому он становится (id, timestamp)
+
+-- Старые партиции при переводе в архив переносятся в эту схему
+CREATE SCHEMA IF NOT EXISTS archive;
+
+-- Создание партиции таблицы parent за месяц month_start (границы месяца по UTC).
+-- Показания этого месяца, попавшие ранее в партицию по умолчанию, переносятся в новую партицию.
+-- Возвращает false, если партиция уже существует
+CREATE OR REPLACE FUNCTION ensure_month_partition(parent TEXT, month_start DATE) RETURNS BOOLEAN AS $$
+DECLARE
+    month DATE := date_trunc('month', month_start)::date;
+    part TEXT := parent || '_p' || to_char(month, 'YYYYMM');
+    lo TIMESTAMPTZ := month::timestamp AT TIME ZONE 'UTC';
+    hi TIMESTAMPTZ := (month + INTERVAL '1 month')::timestamp AT TIME ZONE 'UTC';
+BEGIN
+    IF to_regclass(part) IS NOT NULL THEN
+        RETURN FALSE;
+    END IF;
+
+    EXECUTE format('CREATE TABLE %I (LIKE %I INCLUDING DEFAULTS INCLUDING CONSTRAINTS)', part, parent);
+    EXECUTE format('WITH moved AS (DELETE FROM %I WHERE timestamp >= $1 AND timestamp < $2 RETURNING *)
+                    INSERT INTO %I SELECT * FROM moved', parent || '_default', part)
+        USING lo, hi;
+    EXECUTE format('ALTER TABLE %I ATTACH PARTITION %I FOR VALUES FROM (%L) TO (%L)', parent, part, lo, hi);
+    RETURN TRUE;
+END;
+$$ LANGUAGE plpgsql;
+
+-- Представление ссылается на исходные таблицы, поэтому пересоздается после переноса
+DROP VIEW IF EXISTS readings_raw;
+
+-- Исходные таблицы переименовываются, их ограничения и индексы удаляются, чтобы освободить имена
+ALTER TABLE hot_water_meters RENAME TO hot_water_meters_old;
+ALTER TABLE hot_water_meters_old DROP CONSTRAINT hot_water_meters_pkey;
+ALTER TABLE hot_water_meters_old DROP CONSTRAINT hot_water_meters_building_id_timestamp_key;
+DROP INDEX IF EXISTS idx_hot_water_meters_timestamp;
+DROP INDEX IF EXISTS idx_hot_water_meters_building_id;
+
+ALTER TABLE cold_water_meters RENAME TO cold_water_meters_old;
+ALTER TABLE cold_water_meters_old DROP CONSTRAINT cold_water_meters_pkey;
+ALTER TABLE cold_water_meters_old DROP CONSTRAINT cold_water_meters_itp_id_timestamp_key;
+DROP INDEX IF EXISTS idx_cold_water_meters_timestamp;
+DROP INDEX IF EXISTS idx_cold_water_meters_itp_id;
+
+ALTER TABLE temperature_readings RENAME TO temperature_readings_old;
+ALTER TABLE temperature_readings_old DROP CONSTRAINT temperature_readings_pkey;
+ALTER TABLE temperature_readings_old DROP CONSTRAINT temperature_readings_building_id_timestamp_key;
+DROP INDEX IF EXISTS idx_temperature_readings_timestamp;
+DROP INDEX IF EXISTS idx_temperature_readings_building_id;
+
+ALTER TABLE pump_data RENAME TO pump_data_old;
+ALTER TABLE pump_data_old DROP CONSTRAINT pump_data_pkey;
+ALTER TABLE pump_data_old DROP CONSTRAINT pump_data_building_id_pump_number_timestamp_key;
+DROP INDEX IF EXISTS idx_pump_data_timestamp;
+DROP INDEX IF EXISTS idx_pump_data_building_id;
+DROP INDEX IF EXISTS idx_pump_data_status;
+
+-- Счетчики ХВС в ИТП
+CREATE TABLE cold_water_meters (
+    id UUID NOT NULL DEFAULT uuid_generate_v4(),
+    itp_id UUID NOT NULL REFERENCES itp(id) ON DELETE CASCADE,
+    flow_rate INTEGER NOT NULL,
+    timestamp TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+    PRIMARY KEY (id, timestamp),
+    UNIQUE(itp_id, timestamp)
+) PARTITION BY RANGE (timestamp);
+
+-- ОДПУ ГВС в МКД
+CREATE TABLE hot_water_meters (
+    id UUID NOT NULL DEFAULT uuid_generate_v4(),
+    building_id UUID NOT NULL REFERENCES buildings(id) ON DELETE CASCADE,
+    flow_rate_ch1 INTEGER NOT NULL,  -- канал 1
+    flow_rate_ch2 INTEGER NOT NULL,  -- канал 2
+    timestamp TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+    PRIMARY KEY (id, timestamp),
+    UNIQUE(building_id, timestamp)
+) PARTITION BY RANGE (timestamp);
+
+-- Температурные данные ГВС
+CREATE TABLE temperature_readings (
+    id UUID NOT NULL DEFAULT uuid_generate_v4(),
+    building_id UUID NOT NULL REFERENCES buildings(id) ON DELETE CASCADE,
+    supply_temp INTEGER NOT NULL,  -- температура подачи (°C)
+    return_temp INTEGER NOT NULL,  -- температура возврата (°C)
+    delta_temp INTEGER NOT NULL,   -- разница температур (°C)
+    timestamp TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+    PRIMARY KEY (id, timestamp),
+    UNIQUE(building_id, timestamp)
+) PARTITION BY RANGE (timestamp);
+
+-- Данные о насосах
+CREATE TABLE pump_data (
+    id UUID NOT NULL DEFAULT uuid_generate_v4(),
+    building_id UUID NOT NULL REFERENCES buildings(id) ON DELETE CASCADE,
+    pump_number TEXT NOT NULL,           -- номер насоса
+    status TEXT NOT NULL,                -- normal, warning, critical
+    operating_hours INTEGER NOT NULL,    -- наработка в часах
+    pressure_input INTEGER NOT NULL,     -- давление на входе (бар)
+    pressure_output INTEGER NOT NULL,    -- давление на выходе (бар)
+    vibration_level INTEGER NOT NULL,    -- уровень вибрации
+    timestamp TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+    PRIMARY KEY (id, timestamp),
+    UNIQUE(building_id, pump_number, timestamp)
+) PARTITION BY RANGE (timestamp);
+
+-- Индексы создаются на каждой партиции автоматически
+CREATE INDEX idx_cold_water_meters_timestamp ON cold_water_meters(timestamp);
+CREATE INDEX idx_cold_water_meters_itp_id ON cold_water_meters(itp_id);
+CREATE INDEX idx_hot_water_meters_timestamp ON hot_water_meters(timestamp);
+CREATE INDEX idx_hot_water_meters_building_id ON hot_water_meters(building_id);
+CREATE INDEX idx_temperature_readings_timestamp ON temperature_readings(timestamp);
+CREATE INDEX idx_temperature_readings_building_id ON temperature_readings(building_id);
+CREATE INDEX idx_pump_data_timestamp ON pump_data(timestamp);
+CREATE INDEX idx_pump_data_building_id ON pump_data(building_id);
+CREATE INDEX idx_pump_data_status ON pump_data(status);
+
+-- Партиции по умолчанию принимают показания за месяцы, для которых партиция еще не создана
+CREATE TABLE cold_water_meters_default PARTITION OF cold_water_meters DEFAULT;
+CREATE TABLE hot_water_meters_default PARTITION OF hot_water_meters DEFAULT;
+CREATE TABLE temperature_readings_default PARTITION OF temperature_readings DEFAULT;
+CREATE TABLE pump_data_default PARTITION OF pump_data DEFAULT;
+
+-- Партиции за месяцы с имеющимися показаниями и на три месяца вперед, затем перенос данных
+DO $$
+DECLARE
+    t TEXT;
+    m DATE;
+    first_month DATE;
+    last_month DATE := (date_trunc('month', NOW() AT TIME ZONE 'UTC') + INTERVAL '3 months')::date;
+BEGIN
+    FOREACH t IN ARRAY ARRAY['cold_water_meters', 'hot_water_meters', 'temperature_readings', 'pump_data'] LOOP
+        EXECUTE format('SELECT date_trunc(''month'', MIN(timestamp) AT TIME ZONE ''UTC'')::date FROM %I', t || '_old')
+            INTO first_month;
+        m := LEAST(COALESCE(first_month, CURRENT_DATE), date_trunc('month', NOW() AT TIME ZONE 'UTC')::date);
+        WHILE m <= last_month LOOP
+            PERFORM ensure_month_partition(t, m);
+            m := (m + INTERVAL '1 month')::date;
+        END LOOP;
+
+        EXECUTE format('INSERT INTO %I SELECT * FROM %I', t, t || '_old');
+        EXECUTE format('DROP TABLE %I', t || '_old');
+    END LOOP;
+END;
+$$;
+
+CREATE VIEW readings_raw AS
+    SELECT building_id, timestamp, 'hot_water'::text AS metric, (flow_rate_ch1 + flow_rate_ch2)::double precision AS value
+    FROM hot_water_meters
+    UNION ALL
+    SELECT building_id, timestamp, 'hot_water_ch1', flow_rate_ch1::double precision FROM hot_water_meters
+    UNION ALL
+    SELECT building_id, timestamp, 'hot_water_ch2', flow_rate_ch2::double precision FROM hot_water_meters
+    UNION ALL
+    SELECT i.building_id, c.timestamp, 'cold_water', c.flow_rate::double precision
+    FROM cold_water_meters c JOIN itp i ON i.id = c.itp_id
+    UNION ALL
+    SELECT building_id, timestamp, 'supply_temp', supply_temp::double precision FROM temperature_readings
+    UNION ALL
+    SELECT building_id, timestamp, 'return_temp', return_temp::double precision FROM temperature_readings
+    UNION ALL
+    SELECT building_id, timestamp, 'delta_temp', delta_temp::double precision FROM temperature_readings;
@@ -0,0 +1,8 @@
+DELETE FROM rollup_state WHERE resolution IN ('late', 'raw_expired', 'hourly_expired');
+ALTER TABLE rollup_state DROP CONSTRAINT IF EXISTS rollup_state_resolution_check;
+ALTER TABLE rollup_state ADD CONSTRAINT rollup_state_resolution_check
+    CHECK (resolution IN ('hourly', 'daily'));
+
+DROP INDEX IF EXISTS idx_temperature_readings_created_at;
+DROP INDEX IF EXISTS idx_cold_water_meters_created_at;
+DROP INDEX IF EXISTS idx_hot_water_meters_created_at;
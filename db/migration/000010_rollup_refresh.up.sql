@@ -0,0 +1,12 @@
+-- Поздние показания (timestamp в уже свернутом часе) находятся по времени записи created_at
+CREATE INDEX idx_hot_water_meters_created_at ON hot_water_meters(created_at);
+CREATE INDEX idx_cold_water_meters_created_at ON cold_water_meters(created_at);
+CREATE INDEX idx_temperature_readings_created_at ON temperature_readings(created_at);
+
+-- Дополнительные границы в rollup_state:
+-- late - до какого created_at проверены поздние показания,
+-- raw_expired - до какой границы удалены сырые показания,
+-- hourly_expired - до какой границы удалены почасовые агрегаты
+ALTER TABLE rollup_state DROP CONSTRAINT IF EXISTS rollup_state_resolution_check;
+ALTER TABLE rollup_state ADD CONSTRAINT rollup_state_resolution_check
+    CHECK (resolution IN ('hourly', 'daily', 'late', 'raw_expired', 'hourly_expired'));
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS building_status;
+DROP TABLE IF EXISTS incidents;
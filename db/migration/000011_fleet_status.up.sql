@@ -0,0 +1,35 @@
+-- Инциденты (ситуации) по зданиям: открываются и закрываются фоновой проверкой,
+-- диспетчер подтверждает их или закрывает вручную
+CREATE TABLE incidents (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    building_id UUID NOT NULL REFERENCES buildings(id) ON DELETE CASCADE,
+    kind TEXT NOT NULL,                -- water_balance, temperature, pump
+    severity TEXT NOT NULL CHECK (severity IN ('warning', 'critical')),
+    status TEXT NOT NULL DEFAULT 'open' CHECK (status IN ('open', 'acknowledged', 'resolved')),
+    title TEXT NOT NULL,
+    details JSONB,
+    opened_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    last_seen_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    acknowledged_at TIMESTAMPTZ,
+    acknowledged_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    resolved_at TIMESTAMPTZ
+);
+
+-- По зданию не больше одного незакрытого инцидента каждого вида
+CREATE UNIQUE INDEX idx_incidents_active ON incidents(building_id, kind) WHERE status <> 'resolved';
+CREATE INDEX idx_incidents_opened_at ON incidents(opened_at);
+
+-- Последнее состояние зданий для сводки по парку, обновляется фоновой задачей fleet
+CREATE TABLE building_status (
+    building_id UUID PRIMARY KEY REFERENCES buildings(id) ON DELETE CASCADE,
+    water_balance_status TEXT NOT NULL,
+    temperature_status TEXT NOT NULL,
+    pump_status TEXT NOT NULL,
+    hot_to_cold_ratio DOUBLE PRECISION NOT NULL,
+    anomaly_count INTEGER NOT NULL,
+    data_source TEXT NOT NULL,
+    risk_score INTEGER NOT NULL CHECK (risk_score BETWEEN 0 AND 100),
+    computed_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX idx_building_status_risk_score ON building_status(risk_score);
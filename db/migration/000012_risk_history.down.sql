@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS risk_history;
+ALTER TABLE IF EXISTS building_status DROP COLUMN IF EXISTS risk_factors;
@@ -0,0 +1,15 @@
+-- Разбивка оценки риска по факторам в текущем состоянии здания
+ALTER TABLE building_status ADD COLUMN risk_factors JSONB NOT NULL DEFAULT '[]';
+
+-- История оценки риска: одна запись на здание за час (последняя оценка в этом часе)
+CREATE TABLE risk_history (
+    building_id UUID NOT NULL REFERENCES buildings(id) ON DELETE CASCADE,
+    hour TIMESTAMPTZ NOT NULL,
+    score INTEGER NOT NULL CHECK (score BETWEEN 0 AND 100),
+    factors JSONB NOT NULL,            -- вклад факторов
+    weights JSONB NOT NULL,            -- веса, с которыми рассчитана оценка
+    computed_at TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (building_id, hour)
+);
+
+CREATE INDEX idx_risk_history_hour ON risk_history(hour);
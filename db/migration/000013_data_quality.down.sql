@@ -0,0 +1,9 @@
+DROP TABLE IF EXISTS ingest_duplicates;
+DROP TABLE IF EXISTS meter_quality;
+
+-- Без объекта неисправности счетчиков не отличить друг от друга
+DELETE FROM incidents WHERE kind = 'meter_fault';
+DROP INDEX IF EXISTS idx_incidents_active;
+ALTER TABLE IF EXISTS incidents DROP COLUMN IF EXISTS subject;
+ALTER TABLE IF EXISTS incidents DROP COLUMN IF EXISTS category;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_incidents_active ON incidents(building_id, kind) WHERE status <> 'resolved';
@@ -0,0 +1,38 @@
+-- Категория инцидента (процесс или неисправность счетчика) и объект внутри здания (например, счетчик)
+ALTER TABLE incidents ADD COLUMN category TEXT NOT NULL DEFAULT 'process' CHECK (category IN ('process', 'meter_fault'));
+ALTER TABLE incidents ADD COLUMN subject TEXT NOT NULL DEFAULT '';
+
+DROP INDEX IF EXISTS idx_incidents_active;
+CREATE UNIQUE INDEX idx_incidents_active ON incidents(building_id, kind, subject) WHERE status <> 'resolved';
+
+-- Качество данных счетчиков, обновляется фоновой задачей quality.
+-- Счетчик - поток показаний: ГВС и температура здания, ХВС ИТП (meter_key = id ИТП), насос (meter_key = номер)
+CREATE TABLE meter_quality (
+    building_id UUID NOT NULL REFERENCES buildings(id) ON DELETE CASCADE,
+    source TEXT NOT NULL CHECK (source IN ('hot_water', 'cold_water', 'temperature', 'pump')),
+    meter_key TEXT NOT NULL DEFAULT '',
+    last_reading_at TIMESTAMPTZ,
+    readings INTEGER NOT NULL,          -- показаний в окне проверки
+    stale BOOLEAN NOT NULL,
+    frozen BOOLEAN NOT NULL,
+    negative INTEGER NOT NULL,
+    out_of_range INTEGER NOT NULL,
+    gaps INTEGER NOT NULL,
+    gap_seconds DOUBLE PRECISION NOT NULL,
+    duplicates INTEGER NOT NULL,
+    future INTEGER NOT NULL,
+    score INTEGER NOT NULL CHECK (score BETWEEN 0 AND 100),
+    issues TEXT[] NOT NULL,
+    checked_at TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (building_id, source, meter_key)
+);
+
+-- Повторно присланные показания, отброшенные при приеме, по часам
+CREATE TABLE ingest_duplicates (
+    building_id UUID NOT NULL REFERENCES buildings(id) ON DELETE CASCADE,
+    source TEXT NOT NULL,
+    meter_key TEXT NOT NULL DEFAULT '',
+    hour TIMESTAMPTZ NOT NULL,
+    count INTEGER NOT NULL,
+    PRIMARY KEY (building_id, source, meter_key, hour)
+);
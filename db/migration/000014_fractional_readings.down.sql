@@ -0,0 +1,31 @@
+-- Возврат к целым показаниям (дробная часть округляется)
+DROP VIEW IF EXISTS readings_raw;
+
+ALTER TABLE IF EXISTS cold_water_meters
+    ALTER COLUMN flow_rate TYPE INTEGER USING ROUND(flow_rate)::integer;
+
+ALTER TABLE IF EXISTS hot_water_meters
+    ALTER COLUMN flow_rate_ch1 TYPE INTEGER USING ROUND(flow_rate_ch1)::integer,
+    ALTER COLUMN flow_rate_ch2 TYPE INTEGER USING ROUND(flow_rate_ch2)::integer;
+
+ALTER TABLE IF EXISTS temperature_readings
+    ALTER COLUMN supply_temp TYPE INTEGER USING ROUND(supply_temp)::integer,
+    ALTER COLUMN return_temp TYPE INTEGER USING ROUND(return_temp)::integer,
+    ALTER COLUMN delta_temp TYPE INTEGER USING ROUND(delta_temp)::integer;
+
+CREATE VIEW readings_raw AS
+    SELECT building_id, timestamp, 'hot_water'::text AS metric, (flow_rate_ch1 + flow_rate_ch2)::double precision AS value
+    FROM hot_water_meters
+    UNION ALL
+    SELECT building_id, timestamp, 'hot_water_ch1', flow_rate_ch1::double precision FROM hot_water_meters
+    UNION ALL
+    SELECT building_id, timestamp, 'hot_water_ch2', flow_rate_ch2::double precision FROM hot_water_meters
+    UNION ALL
+    SELECT i.building_id, c.timestamp, 'cold_water', c.flow_rate::double precision
+    FROM cold_water_meters c JOIN itp i ON i.id = c.itp_id
+    UNION ALL
+    SELECT building_id, timestamp, 'supply_temp', supply_temp::double precision FROM temperature_readings
+    UNION ALL
+    SELECT building_id, timestamp, 'return_temp', return_temp::double precision FROM temperature_readings
+    UNION ALL
+    SELECT building_id, timestamp, 'delta_temp', delta_temp::double precision FROM temperature_readings;
@@ -0,0 +1,33 @@
+-- Дробные показания: расход в м³ с точностью до 0.001, температура в °C с точностью до 0.1.
+-- Представление readings_raw зависит от столбцов, поэтому пересоздается.
+-- Тип столбцов секционированных таблиц меняется сразу во всех партициях
+DROP VIEW IF EXISTS readings_raw;
+
+ALTER TABLE cold_water_meters
+    ALTER COLUMN flow_rate TYPE NUMERIC(12, 3);
+
+ALTER TABLE hot_water_meters
+    ALTER COLUMN flow_rate_ch1 TYPE NUMERIC(12, 3),
+    ALTER COLUMN flow_rate_ch2 TYPE NUMERIC(12, 3);
+
+ALTER TABLE temperature_readings
+    ALTER COLUMN supply_temp TYPE NUMERIC(5, 1),
+    ALTER COLUMN return_temp TYPE NUMERIC(5, 1),
+    ALTER COLUMN delta_temp TYPE NUMERIC(5, 1);
+
+CREATE VIEW readings_raw AS
+    SELECT building_id, timestamp, 'hot_water'::text AS metric, (flow_rate_ch1 + flow_rate_ch2)::double precision AS value
+    FROM hot_water_meters
+    UNION ALL
+    SELECT building_id, timestamp, 'hot_water_ch1', flow_rate_ch1::double precision FROM hot_water_meters
+    UNION ALL
+    SELECT building_id, timestamp, 'hot_water_ch2', flow_rate_ch2::double precision FROM hot_water_meters
+    UNION ALL
+    SELECT i.building_id, c.timestamp, 'cold_water', c.flow_rate::double precision
+    FROM cold_water_meters c JOIN itp i ON i.id = c.itp_id
+    UNION ALL
+    SELECT building_id, timestamp, 'supply_temp', supply_temp::double precision FROM temperature_readings
+    UNION ALL
+    SELECT building_id, timestamp, 'return_temp', return_temp::double precision FROM temperature_readings
+    UNION ALL
+    SELECT building_id, timestamp, 'delta_temp', delta_temp::double precision FROM temperature_readings;
@@ -0,0 +1,23 @@
+-- Представление возвращается к виду без накопительных показаний
+DROP VIEW IF EXISTS readings_raw;
+
+DROP TABLE IF EXISTS meter_replacements;
+DROP TABLE IF EXISTS meter_totals;
+DROP TABLE IF EXISTS totalizers;
+
+CREATE VIEW readings_raw AS
+    SELECT building_id, timestamp, 'hot_water'::text AS metric, (flow_rate_ch1 + flow_rate_ch2)::double precision AS value
+    FROM hot_water_meters
+    UNION ALL
+    SELECT building_id, timestamp, 'hot_water_ch1', flow_rate_ch1::double precision FROM hot_water_meters
+    UNION ALL
+    SELECT building_id, timestamp, 'hot_water_ch2', flow_rate_ch2::double precision FROM hot_water_meters
+    UNION ALL
+    SELECT i.building_id, c.timestamp, 'cold_water', c.flow_rate::double precision
+    FROM cold_water_meters c JOIN itp i ON i.id = c.itp_id
+    UNION ALL
+    SELECT building_id, timestamp, 'supply_temp', supply_temp::double precision FROM temperature_readings
+    UNION ALL
+    SELECT building_id, timestamp, 'return_temp', return_temp::double precision FROM temperature_readings
+    UNION ALL
+    SELECT building_id, timestamp, 'delta_temp', delta_temp::double precision FROM temperature_readings;
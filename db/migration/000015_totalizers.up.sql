@@ -0,0 +1,106 @@
+-- Накопительные показания ОДПУ (тотализаторы): счетчик передает нарастающий итог по каналу,
+-- расход за интервал и средний расход вычисляются по разнице с предыдущим показанием
+
+-- Регистры счетчиков: здание, вид учета, ИТП (для ХВС) и канал
+CREATE TABLE totalizers (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    building_id UUID NOT NULL REFERENCES buildings(id) ON DELETE CASCADE,
+    source TEXT NOT NULL CHECK (source IN ('hot_water', 'cold_water')),
+    meter_key TEXT NOT NULL DEFAULT '',  -- ИТП для ХВС, пусто для ГВС
+    channel TEXT NOT NULL,               -- ch1, ch2
+    capacity NUMERIC(14, 3),             -- значение, на котором счетчик переходит через ноль; NULL - не задано
+    since TIMESTAMPTZ NOT NULL,          -- первое показание: с него мгновенные показания этого счетчика не учитываются
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+    UNIQUE (building_id, source, meter_key, channel)
+);
+
+-- Накопленные значения. delta и flow_rate вычисляются при записи и пересчитываются,
+-- если позже приходит показание между уже записанными или регистрируется замена счетчика
+CREATE TABLE meter_totals (
+    id UUID NOT NULL DEFAULT uuid_generate_v4(),
+    totalizer_id UUID NOT NULL REFERENCES totalizers(id) ON DELETE CASCADE,
+    total NUMERIC(14, 3) NOT NULL,       -- нарастающий итог, м³
+    delta NUMERIC(12, 3),                -- расход с предыдущего показания, м³; NULL - не определен
+    flow_rate NUMERIC(12, 3),            -- средний расход интервала, м³/ч
+    status TEXT NOT NULL DEFAULT 'first'
+        CHECK (status IN ('first', 'ok', 'rollover', 'replaced', 'negative')),
+    timestamp TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    derived_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),  -- время последнего расчета delta (для досчета агрегатов)
+
+    PRIMARY KEY (id, timestamp),
+    UNIQUE (totalizer_id, timestamp)
+) PARTITION BY RANGE (timestamp);
+
+CREATE INDEX idx_meter_totals_timestamp ON meter_totals(timestamp);
+CREATE INDEX idx_meter_totals_created_at ON meter_totals(created_at);
+CREATE INDEX idx_meter_totals_derived_at ON meter_totals(derived_at);
+CREATE INDEX idx_meter_totals_negative ON meter_totals(totalizer_id, timestamp) WHERE status = 'negative';
+
+CREATE TABLE meter_totals_default PARTITION OF meter_totals DEFAULT;
+
+DO $$
+DECLARE
+    m DATE := date_trunc('month', NOW() AT TIME ZONE 'UTC')::date;
+BEGIN
+    FOR i IN 0..3 LOOP
+        PERFORM ensure_month_partition('meter_totals', (m + i * INTERVAL '1 month')::date);
+    END LOOP;
+END;
+$$;
+
+-- Замены счетчика: показания после replaced_at отсчитываются от new_total,
+-- расход старого счетчика до замены - до old_total
+CREATE TABLE meter_replacements (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    totalizer_id UUID NOT NULL REFERENCES totalizers(id) ON DELETE CASCADE,
+    replaced_at TIMESTAMPTZ NOT NULL,
+    old_total NUMERIC(14, 3),            -- последнее значение снятого счетчика; NULL - неизвестно
+    new_total NUMERIC(14, 3) NOT NULL,   -- начальное значение нового счетчика
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+    UNIQUE (totalizer_id, replaced_at)
+);
+
+-- Расход по накопительным показаниям входит в readings_raw как средний расход интервала (м³/ч) - в тех же
+-- единицах, что и мгновенные показания, чтобы в одном показателе не смешивались расход и объем.
+-- Мгновенные показания счетчика, с которого поступают накопительные, начиная с since не учитываются,
+-- чтобы расход не считался дважды
+DROP VIEW IF EXISTS readings_raw;
+
+CREATE VIEW readings_raw AS
+    SELECT building_id, timestamp, 'hot_water'::text AS metric, (flow_rate_ch1 + flow_rate_ch2)::double precision AS value
+    FROM hot_water_meters h
+    WHERE NOT EXISTS (SELECT 1 FROM totalizers t
+                      WHERE t.building_id = h.building_id AND t.source = 'hot_water' AND h.timestamp >= t.since)
+    UNION ALL
+    SELECT building_id, timestamp, 'hot_water_ch1', flow_rate_ch1::double precision
+    FROM hot_water_meters h
+    WHERE NOT EXISTS (SELECT 1 FROM totalizers t
+                      WHERE t.building_id = h.building_id AND t.source = 'hot_water' AND h.timestamp >= t.since)
+    UNION ALL
+    SELECT building_id, timestamp, 'hot_water_ch2', flow_rate_ch2::double precision
+    FROM hot_water_meters h
+    WHERE NOT EXISTS (SELECT 1 FROM totalizers t
+                      WHERE t.building_id = h.building_id AND t.source = 'hot_water' AND h.timestamp >= t.since)
+    UNION ALL
+    SELECT i.building_id, c.timestamp, 'cold_water', c.flow_rate::double precision
+    FROM cold_water_meters c JOIN itp i ON i.id = c.itp_id
+    WHERE NOT EXISTS (SELECT 1 FROM totalizers t
+                      WHERE t.source = 'cold_water' AND t.meter_key = c.itp_id::text AND c.timestamp >= t.since)
+    UNION ALL
+    SELECT building_id, timestamp, 'supply_temp', supply_temp::double precision FROM temperature_readings
+    UNION ALL
+    SELECT building_id, timestamp, 'return_temp', return_temp::double precision FROM temperature_readings
+    UNION ALL
+    SELECT building_id, timestamp, 'delta_temp', delta_temp::double precision FROM temperature_readings
+    UNION ALL
+    SELECT t.building_id, m.timestamp, t.source, SUM(m.flow_rate)::double precision
+    FROM meter_totals m JOIN totalizers t ON t.id = m.totalizer_id
+    WHERE m.flow_rate IS NOT NULL
+    GROUP BY t.building_id, m.timestamp, t.source
+    UNION ALL
+    SELECT t.building_id, m.timestamp, 'hot_water_' || t.channel, m.flow_rate::double precision
+    FROM meter_totals m JOIN totalizers t ON t.id = m.totalizer_id
+    WHERE m.flow_rate IS NOT NULL AND t.source = 'hot_water';
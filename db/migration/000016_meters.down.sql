@@ -0,0 +1,12 @@
+DELETE FROM incidents WHERE category = 'maintenance';
+ALTER TABLE IF EXISTS incidents DROP CONSTRAINT IF EXISTS incidents_category_check;
+ALTER TABLE IF EXISTS incidents ADD CONSTRAINT incidents_category_check
+    CHECK (category IN ('process', 'meter_fault'));
+
+ALTER TABLE IF EXISTS meter_totals DROP COLUMN IF EXISTS meter_id;
+ALTER TABLE IF EXISTS temperature_readings DROP COLUMN IF EXISTS meter_id;
+ALTER TABLE IF EXISTS cold_water_meters DROP COLUMN IF EXISTS meter_id;
+ALTER TABLE IF EXISTS hot_water_meters DROP COLUMN IF EXISTS meter_id;
+
+DROP FUNCTION IF EXISTS reading_meter(UUID, UUID, TEXT, TIMESTAMPTZ);
+DROP TABLE IF EXISTS meters;
@@ -0,0 +1,106 @@
+-- Реестр приборов учета. Место установки счетчика - здание, вид учета и, для ХВС, ИТП;
+-- на одном месте в каждый момент действует один счетчик, при замене он переходит в состояние replaced
+CREATE TABLE meters (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    building_id UUID NOT NULL REFERENCES buildings(id) ON DELETE CASCADE,
+    itp_id UUID REFERENCES itp(id) ON DELETE CASCADE,   -- для счетчиков ХВС
+    type TEXT NOT NULL CHECK (type IN ('hot_water', 'cold_water', 'temperature')),
+    serial_number TEXT NOT NULL DEFAULT '',             -- пусто - счетчик заведен автоматически по показаниям
+    manufacturer TEXT NOT NULL DEFAULT '',
+    model TEXT NOT NULL DEFAULT '',
+    channels JSONB NOT NULL,                            -- канал счетчика -> поле показаний
+    unit TEXT NOT NULL,
+    installed_at TIMESTAMPTZ,                           -- NULL - неизвестно, счетчик действует с начала показаний
+    verified_at DATE,                                   -- дата последней поверки
+    verification_due DATE,                              -- поверка действительна до
+    status TEXT NOT NULL DEFAULT 'active' CHECK (status IN ('active', 'replaced')),
+    removed_at TIMESTAMPTZ,
+    replaced_by UUID REFERENCES meters(id) ON DELETE SET NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+    CHECK ((type = 'cold_water') = (itp_id IS NOT NULL)),
+    CHECK ((status = 'active') = (removed_at IS NULL))
+);
+
+CREATE UNIQUE INDEX idx_meters_active ON meters(building_id, type, COALESCE(itp_id, '00000000-0000-0000-0000-000000000000'::uuid))
+    WHERE status = 'active';
+CREATE INDEX idx_meters_itp_id ON meters(itp_id);
+CREATE INDEX idx_meters_verification_due ON meters(verification_due) WHERE status = 'active';
+
+-- Счетчик, действовавший на месте установки в момент ts. Если на месте еще нет ни одного счетчика,
+-- он заводится автоматически. NULL - показание раньше установки известных счетчиков
+CREATE OR REPLACE FUNCTION reading_meter(p_building UUID, p_itp UUID, p_type TEXT, p_ts TIMESTAMPTZ) RETURNS UUID AS $$
+DECLARE
+    m UUID;
+BEGIN
+    IF p_itp IS NOT NULL THEN
+        SELECT building_id INTO p_building FROM itp WHERE id = p_itp;
+    END IF;
+
+    SELECT id INTO m FROM meters
+    WHERE building_id = p_building AND type = p_type AND itp_id IS NOT DISTINCT FROM p_itp
+    AND (installed_at IS NULL OR installed_at <= p_ts)
+    AND (removed_at IS NULL OR removed_at > p_ts)
+    ORDER BY installed_at DESC NULLS LAST
+    LIMIT 1;
+    IF FOUND OR EXISTS (
+        SELECT 1 FROM meters
+        WHERE building_id = p_building AND type = p_type AND itp_id IS NOT DISTINCT FROM p_itp) THEN
+        RETURN m;
+    END IF;
+
+    -- Каналы по умолчанию совпадают с meter.DefaultChannels
+    INSERT INTO meters (building_id, itp_id, type, channels, unit)
+    VALUES (p_building, p_itp, p_type,
+            CASE p_type
+                WHEN 'hot_water' THEN '{"ch1": "flow_rate_ch1", "ch2": "flow_rate_ch2"}'::jsonb
+                WHEN 'cold_water' THEN '{"ch1": "flow_rate"}'::jsonb
+                ELSE '{"t1": "supply_temp", "t2": "return_temp"}'::jsonb
+            END,
+            CASE WHEN p_type = 'temperature' THEN '°C' ELSE 'm3/h' END)
+    ON CONFLICT DO NOTHING
+    RETURNING id INTO m;
+    IF m IS NULL THEN
+        -- Счетчик заведен параллельной вставкой
+        SELECT id INTO m FROM meters
+        WHERE building_id = p_building AND type = p_type AND itp_id IS NOT DISTINCT FROM p_itp AND status = 'active';
+    END IF;
+    RETURN m;
+END;
+$$ LANGUAGE plpgsql;
+
+-- Показания ссылаются на счетчик. Внешнего ключа нет: счетчики не удаляются отдельно от здания,
+-- а проверка ключа замедлила бы присоединение помесячных партиций
+ALTER TABLE hot_water_meters ADD COLUMN meter_id UUID;
+ALTER TABLE cold_water_meters ADD COLUMN meter_id UUID;
+ALTER TABLE temperature_readings ADD COLUMN meter_id UUID;
+ALTER TABLE meter_totals ADD COLUMN meter_id UUID;
+
+-- Счетчики для уже записанных показаний заводятся автоматически (без заводского номера)
+INSERT INTO meters (building_id, itp_id, type, channels, unit)
+SELECT b.id, NULL::uuid, t.type, t.channels, t.unit
+FROM buildings b
+CROSS JOIN (VALUES
+    ('hot_water', '{"ch1": "flow_rate_ch1", "ch2": "flow_rate_ch2"}'::jsonb, 'm3/h'),
+    ('temperature', '{"t1": "supply_temp", "t2": "return_temp"}'::jsonb, '°C')
+) AS t(type, channels, unit)
+UNION ALL
+SELECT i.building_id, i.id, 'cold_water', '{"ch1": "flow_rate"}'::jsonb, 'm3/h'
+FROM itp i;
+
+UPDATE hot_water_meters h SET meter_id = m.id
+FROM meters m WHERE m.building_id = h.building_id AND m.type = 'hot_water';
+UPDATE cold_water_meters c SET meter_id = m.id
+FROM meters m WHERE m.itp_id = c.itp_id AND m.type = 'cold_water';
+UPDATE temperature_readings r SET meter_id = m.id
+FROM meters m WHERE m.building_id = r.building_id AND m.type = 'temperature';
+UPDATE meter_totals mt SET meter_id = m.id
+FROM totalizers t, meters m
+WHERE t.id = mt.totalizer_id AND m.building_id = t.building_id AND m.type = t.source
+AND (t.source = 'hot_water' OR m.itp_id::text = t.meter_key);
+
+-- Инциденты обслуживания (истекающая поверка) не относятся ни к процессу, ни к неисправностям
+ALTER TABLE incidents DROP CONSTRAINT IF EXISTS incidents_category_check;
+ALTER TABLE incidents ADD CONSTRAINT incidents_category_check
+    CHECK (category IN ('process', 'meter_fault', 'maintenance'));
@@ -0,0 +1,74 @@
+-- Возврат к одному ОДПУ ГВС на здание. Выполняется, только если миграция применена,
+-- поэтому повторный запуск (или запуск до up при инициализации контейнера) ничего не меняет
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM information_schema.columns
+                   WHERE table_schema = current_schema() AND table_name = 'hot_water_meters'
+                   AND column_name = 'meter_key') THEN
+        RETURN;
+    END IF;
+
+    -- Представление возвращается к показателям одного счетчика на здание
+    DROP VIEW IF EXISTS readings_raw;
+
+    CREATE VIEW readings_raw AS
+        SELECT building_id, timestamp, 'hot_water'::text AS metric, (flow_rate_ch1 + flow_rate_ch2)::double precision AS value
+        FROM hot_water_meters h
+        WHERE NOT EXISTS (SELECT 1 FROM totalizers t
+                          WHERE t.building_id = h.building_id AND t.source = 'hot_water' AND h.timestamp >= t.since)
+        UNION ALL
+        SELECT building_id, timestamp, 'hot_water_ch1', flow_rate_ch1::double precision
+        FROM hot_water_meters h
+        WHERE NOT EXISTS (SELECT 1 FROM totalizers t
+                          WHERE t.building_id = h.building_id AND t.source = 'hot_water' AND h.timestamp >= t.since)
+        UNION ALL
+        SELECT building_id, timestamp, 'hot_water_ch2', flow_rate_ch2::double precision
+        FROM hot_water_meters h
+        WHERE NOT EXISTS (SELECT 1 FROM totalizers t
+                          WHERE t.building_id = h.building_id AND t.source = 'hot_water' AND h.timestamp >= t.since)
+        UNION ALL
+        SELECT i.building_id, c.timestamp, 'cold_water', c.flow_rate::double precision
+        FROM cold_water_meters c JOIN itp i ON i.id = c.itp_id
+        WHERE NOT EXISTS (SELECT 1 FROM totalizers t
+                          WHERE t.source = 'cold_water' AND t.meter_key = c.itp_id::text AND c.timestamp >= t.since)
+        UNION ALL
+        SELECT building_id, timestamp, 'supply_temp', supply_temp::double precision FROM temperature_readings
+        UNION ALL
+        SELECT building_id, timestamp, 'return_temp', return_temp::double precision FROM temperature_readings
+        UNION ALL
+        SELECT building_id, timestamp, 'delta_temp', delta_temp::double precision FROM temperature_readings
+        UNION ALL
+        SELECT t.building_id, m.timestamp, t.source, SUM(m.flow_rate)::double precision
+        FROM meter_totals m JOIN totalizers t ON t.id = m.totalizer_id
+        WHERE m.flow_rate IS NOT NULL
+        GROUP BY t.building_id, m.timestamp, t.source
+        UNION ALL
+        SELECT t.building_id, m.timestamp, 'hot_water_' || t.channel, m.flow_rate::double precision
+        FROM meter_totals m JOIN totalizers t ON t.id = m.totalizer_id
+        WHERE m.flow_rate IS NOT NULL AND t.source = 'hot_water';
+
+    DELETE FROM readings_hourly WHERE metric LIKE '%:%';
+    DELETE FROM readings_daily WHERE metric LIKE '%:%';
+
+    -- ОДПУ ГВС, привязанные к ИТП, удаляются из реестра; их показания остаются без счетчика
+    UPDATE hot_water_meters SET meter_id = NULL
+    WHERE meter_id IN (SELECT id FROM meters WHERE type = 'hot_water' AND itp_id IS NOT NULL);
+    UPDATE meter_totals SET meter_id = NULL
+    WHERE meter_id IN (SELECT id FROM meters WHERE type = 'hot_water' AND itp_id IS NOT NULL);
+    DELETE FROM meters WHERE type = 'hot_water' AND itp_id IS NOT NULL;
+    ALTER TABLE IF EXISTS meters DROP CONSTRAINT IF EXISTS meters_itp_check;
+    ALTER TABLE IF EXISTS meters DROP CONSTRAINT IF EXISTS meters_check;
+    ALTER TABLE IF EXISTS meters ADD CONSTRAINT meters_check
+        CHECK ((type = 'cold_water') = (itp_id IS NOT NULL));
+
+    -- Из одновременных показаний нескольких ОДПУ ГВС здания остается одно
+    DELETE FROM hot_water_meters h
+    WHERE EXISTS (SELECT 1 FROM hot_water_meters o
+                  WHERE o.building_id = h.building_id AND o.timestamp = h.timestamp AND o.meter_key < h.meter_key);
+    ALTER TABLE IF EXISTS hot_water_meters DROP CONSTRAINT IF EXISTS hot_water_meters_building_id_meter_key_timestamp_key;
+    ALTER TABLE IF EXISTS hot_water_meters DROP CONSTRAINT IF EXISTS hot_water_meters_building_id_timestamp_key;
+    ALTER TABLE IF EXISTS hot_water_meters ADD CONSTRAINT hot_water_meters_building_id_timestamp_key
+        UNIQUE (building_id, timestamp);
+    ALTER TABLE IF EXISTS hot_water_meters DROP COLUMN IF EXISTS meter_key;
+END;
+$$;
@@ -0,0 +1,97 @@
+-- Несколько ИТП и ОДПУ ГВС в здании. meter_key ОДПУ ГВС - ИТП, через который подается горячая вода
+-- (как у счетчиков ХВС и регистров накопительных показаний); пусто - ОДПУ здания без привязки к ИТП
+ALTER TABLE hot_water_meters ADD COLUMN meter_key TEXT NOT NULL DEFAULT '';
+ALTER TABLE hot_water_meters DROP CONSTRAINT hot_water_meters_building_id_timestamp_key;
+ALTER TABLE hot_water_meters ADD CONSTRAINT hot_water_meters_building_id_meter_key_timestamp_key
+    UNIQUE (building_id, meter_key, timestamp);
+
+-- ОДПУ ГВС может быть привязан к ИТП, датчики температуры - нет
+ALTER TABLE meters DROP CONSTRAINT IF EXISTS meters_check;
+ALTER TABLE meters ADD CONSTRAINT meters_itp_check
+    CHECK ((type <> 'cold_water' OR itp_id IS NOT NULL) AND (type <> 'temperature' OR itp_id IS NULL));
+
+-- Показатели здания суммируются по всем счетчикам в момент показания, поэтому среднее по зданию - расход
+-- всего здания, а не одного счетчика. Показатели ИТП называются '<показатель>:<id ИТП>'
+DROP VIEW IF EXISTS readings_raw;
+
+CREATE VIEW readings_raw AS
+    SELECT h.building_id, h.timestamp, 'hot_water'::text AS metric,
+           SUM(h.flow_rate_ch1 + h.flow_rate_ch2)::double precision AS value
+    FROM hot_water_meters h
+    WHERE NOT EXISTS (SELECT 1 FROM totalizers t
+                      WHERE t.building_id = h.building_id AND t.source = 'hot_water'
+                      AND t.meter_key = h.meter_key AND h.timestamp >= t.since)
+    GROUP BY h.building_id, h.timestamp
+    UNION ALL
+    SELECT h.building_id, h.timestamp, 'hot_water_ch1', SUM(h.flow_rate_ch1)::double precision
+    FROM hot_water_meters h
+    WHERE NOT EXISTS (SELECT 1 FROM totalizers t
+                      WHERE t.building_id = h.building_id AND t.source = 'hot_water'
+                      AND t.meter_key = h.meter_key AND h.timestamp >= t.since)
+    GROUP BY h.building_id, h.timestamp
+    UNION ALL
+    SELECT h.building_id, h.timestamp, 'hot_water_ch2', SUM(h.flow_rate_ch2)::double precision
+    FROM hot_water_meters h
+    WHERE NOT EXISTS (SELECT 1 FROM totalizers t
+                      WHERE t.building_id = h.building_id AND t.source = 'hot_water'
+                      AND t.meter_key = h.meter_key AND h.timestamp >= t.since)
+    GROUP BY h.building_id, h.timestamp
+    UNION ALL
+    SELECT h.building_id, h.timestamp, 'hot_water:' || h.meter_key, (h.flow_rate_ch1 + h.flow_rate_ch2)::double precision
+    FROM hot_water_meters h
+    WHERE NOT EXISTS (SELECT 1 FROM totalizers t
+                      WHERE t.building_id = h.building_id AND t.source = 'hot_water'
+                      AND t.meter_key = h.meter_key AND h.timestamp >= t.since)
+    AND h.meter_key <> ''
+    UNION ALL
+    SELECT i.building_id, c.timestamp, 'cold_water', SUM(c.flow_rate)::double precision
+    FROM cold_water_meters c JOIN itp i ON i.id = c.itp_id
+    WHERE NOT EXISTS (SELECT 1 FROM totalizers t
+                      WHERE t.source = 'cold_water' AND t.meter_key = c.itp_id::text AND c.timestamp >= t.since)
+    GROUP BY i.building_id, c.timestamp
+    UNION ALL
+    SELECT i.building_id, c.timestamp, 'cold_water:' || c.itp_id::text, c.flow_rate::double precision
+    FROM cold_water_meters c JOIN itp i ON i.id = c.itp_id
+    WHERE NOT EXISTS (SELECT 1 FROM totalizers t
+                      WHERE t.source = 'cold_water' AND t.meter_key = c.itp_id::text AND c.timestamp >= t.since)
+    UNION ALL
+    SELECT building_id, timestamp, 'supply_temp', supply_temp::double precision FROM temperature_readings
+    UNION ALL
+    SELECT building_id, timestamp, 'return_temp', return_temp::double precision FROM temperature_readings
+    UNION ALL
+    SELECT building_id, timestamp, 'delta_temp', delta_temp::double precision FROM temperature_readings
+    UNION ALL
+    SELECT t.building_id, m.timestamp, t.source, SUM(m.flow_rate)::double precision
+    FROM meter_totals m JOIN totalizers t ON t.id = m.totalizer_id
+    WHERE m.flow_rate IS NOT NULL
+    GROUP BY t.building_id, m.timestamp, t.source
+    UNION ALL
+    SELECT t.building_id, m.timestamp, t.source || ':' || t.meter_key, SUM(m.flow_rate)::double precision
+    FROM meter_totals m JOIN totalizers t ON t.id = m.totalizer_id
+    WHERE m.flow_rate IS NOT NULL AND t.meter_key <> ''
+    GROUP BY t.building_id, m.timestamp, t.source, t.meter_key
+    UNION ALL
+    SELECT t.building_id, m.timestamp, 'hot_water_' || t.channel, SUM(m.flow_rate)::double precision
+    FROM meter_totals m JOIN totalizers t ON t.id = m.totalizer_id
+    WHERE m.flow_rate IS NOT NULL AND t.source = 'hot_water'
+    GROUP BY t.building_id, m.timestamp, t.channel;
+
+-- Агрегаты показателей ИТП за уже свернутые интервалы строятся по сохранившимся сырым показаниям.
+-- Выполняется по всему представлению, на больших объемах долго
+INSERT INTO readings_hourly (building_id, metric, bucket, sum, count, min, max)
+SELECT building_id, metric, date_trunc('hour', timestamp AT TIME ZONE 'UTC') AT TIME ZONE 'UTC',
+       SUM(value), COUNT(*), MIN(value), MAX(value)
+FROM readings_raw
+WHERE metric LIKE '%:%'
+AND timestamp < COALESCE((SELECT watermark FROM rollup_state WHERE resolution = 'hourly'), '-infinity')
+GROUP BY 1, 2, 3
+ON CONFLICT (building_id, metric, bucket) DO NOTHING;
+
+INSERT INTO readings_daily (building_id, metric, bucket, sum, count, min, max)
+SELECT building_id, metric, date_trunc('day', bucket AT TIME ZONE 'UTC') AT TIME ZONE 'UTC',
+       SUM(sum), SUM(count), MIN(min), MAX(max)
+FROM readings_hourly
+WHERE metric LIKE '%:%'
+AND bucket < COALESCE((SELECT watermark FROM rollup_state WHERE resolution = 'daily'), '-infinity')
+GROUP BY 1, 2, 3
+ON CONFLICT (building_id, metric, bucket) DO NOTHING;
@@ -0,0 +1,4 @@
+ALTER TABLE IF EXISTS incidents DROP COLUMN IF EXISTS situation_id;
+DROP TABLE IF EXISTS situations;
+ALTER TABLE IF EXISTS itp DROP COLUMN IF EXISTS node_id;
+DROP TABLE IF EXISTS network_nodes;
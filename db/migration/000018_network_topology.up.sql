@@ -0,0 +1,42 @@
+-- Топология тепловой сети: источник -> ЦТП -> ИТП -> МКД. Узлы сети - общая инфраструктура,
+-- не принадлежат управляющей компании; ИТП подключается к ЦТП или напрямую к источнику
+CREATE TABLE network_nodes (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    type TEXT NOT NULL CHECK (type IN ('source', 'ctp')),
+    name TEXT NOT NULL,
+    address TEXT NOT NULL DEFAULT '',
+    parent_id UUID REFERENCES network_nodes(id) ON DELETE RESTRICT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    -- Источник - корень сети
+    CHECK (type = 'ctp' OR parent_id IS NULL)
+);
+
+CREATE INDEX idx_network_nodes_parent_id ON network_nodes(parent_id);
+
+ALTER TABLE itp ADD COLUMN node_id UUID REFERENCES network_nodes(id) ON DELETE SET NULL;
+CREATE INDEX idx_itp_node_id ON itp(node_id);
+
+-- Ситуация: одновременные аномалии зданий, питающихся от одного узла сети, отнесенные к этому узлу.
+-- Инциденты зданий остаются и ссылаются на ситуацию (situation_id)
+CREATE TABLE situations (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    node_id UUID NOT NULL REFERENCES network_nodes(id) ON DELETE CASCADE,
+    kind TEXT NOT NULL,
+    severity TEXT NOT NULL CHECK (severity IN ('warning', 'critical')),
+    status TEXT NOT NULL DEFAULT 'open' CHECK (status IN ('open', 'resolved')),
+    title TEXT NOT NULL,
+    details JSONB,
+    buildings_affected INTEGER NOT NULL,
+    buildings_total INTEGER NOT NULL,
+    opened_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    last_seen_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    resolved_at TIMESTAMPTZ
+);
+
+-- По узлу не больше одной незакрытой ситуации каждого вида
+CREATE UNIQUE INDEX idx_situations_active ON situations(node_id, kind) WHERE status <> 'resolved';
+CREATE INDEX idx_situations_opened_at ON situations(opened_at);
+
+ALTER TABLE incidents ADD COLUMN situation_id UUID REFERENCES situations(id) ON DELETE SET NULL;
+CREATE INDEX idx_incidents_situation_id ON incidents(situation_id);
@@ -0,0 +1,9 @@
+DROP INDEX IF EXISTS idx_situations_status_kind;
+DELETE FROM situations WHERE node_id IS NULL;
+ALTER TABLE situations DROP CONSTRAINT IF EXISTS situations_scope_check;
+ALTER TABLE situations ALTER COLUMN node_id SET NOT NULL;
+ALTER TABLE situations DROP COLUMN IF EXISTS scope;
+
+ALTER TABLE buildings DROP CONSTRAINT IF EXISTS buildings_location_check;
+ALTER TABLE buildings DROP COLUMN IF EXISTS longitude;
+ALTER TABLE buildings DROP COLUMN IF EXISTS latitude;
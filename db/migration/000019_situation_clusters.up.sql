@@ -0,0 +1,10 @@
+-- Координаты здания (WGS 84) для группировки аномалий соседних зданий
+ALTER TABLE buildings ADD COLUMN latitude DOUBLE PRECISION CHECK (latitude BETWEEN -90 AND 90);
+ALTER TABLE buildings ADD COLUMN longitude DOUBLE PRECISION CHECK (longitude BETWEEN -180 AND 180);
+ALTER TABLE buildings ADD CONSTRAINT buildings_location_check CHECK ((latitude IS NULL) = (longitude IS NULL));
+
+-- Ситуация относится к узлу сети (scope = node) или к группе соседних зданий без общего узла (scope = area)
+ALTER TABLE situations ADD COLUMN scope TEXT NOT NULL DEFAULT 'node' CHECK (scope IN ('node', 'area'));
+ALTER TABLE situations ALTER COLUMN node_id DROP NOT NULL;
+ALTER TABLE situations ADD CONSTRAINT situations_scope_check CHECK ((scope = 'node') = (node_id IS NOT NULL));
+CREATE INDEX idx_situations_status_kind ON situations(status, kind);
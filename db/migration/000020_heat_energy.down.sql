@@ -0,0 +1,66 @@
+DROP VIEW IF EXISTS readings_raw;
+
+CREATE VIEW readings_raw AS
+    SELECT h.building_id, h.timestamp, 'hot_water'::text AS metric,
+           SUM(h.flow_rate_ch1 + h.flow_rate_ch2)::double precision AS value
+    FROM hot_water_meters h
+    WHERE NOT EXISTS (SELECT 1 FROM totalizers t
+                      WHERE t.building_id = h.building_id AND t.source = 'hot_water'
+                      AND t.meter_key = h.meter_key AND h.timestamp >= t.since)
+    GROUP BY h.building_id, h.timestamp
+    UNION ALL
+    SELECT h.building_id, h.timestamp, 'hot_water_ch1', SUM(h.flow_rate_ch1)::double precision
+    FROM hot_water_meters h
+    WHERE NOT EXISTS (SELECT 1 FROM totalizers t
+                      WHERE t.building_id = h.building_id AND t.source = 'hot_water'
+                      AND t.meter_key = h.meter_key AND h.timestamp >= t.since)
+    GROUP BY h.building_id, h.timestamp
+    UNION ALL
+    SELECT h.building_id, h.timestamp, 'hot_water_ch2', SUM(h.flow_rate_ch2)::double precision
+    FROM hot_water_meters h
+    WHERE NOT EXISTS (SELECT 1 FROM totalizers t
+                      WHERE t.building_id = h.building_id AND t.source = 'hot_water'
+                      AND t.meter_key = h.meter_key AND h.timestamp >= t.since)
+    GROUP BY h.building_id, h.timestamp
+    UNION ALL
+    SELECT h.building_id, h.timestamp, 'hot_water:' || h.meter_key, (h.flow_rate_ch1 + h.flow_rate_ch2)::double precision
+    FROM hot_water_meters h
+    WHERE NOT EXISTS (SELECT 1 FROM totalizers t
+                      WHERE t.building_id = h.building_id AND t.source = 'hot_water'
+                      AND t.meter_key = h.meter_key AND h.timestamp >= t.since)
+    AND h.meter_key <> ''
+    UNION ALL
+    SELECT i.building_id, c.timestamp, 'cold_water', SUM(c.flow_rate)::double precision
+    FROM cold_water_meters c JOIN itp i ON i.id = c.itp_id
+    WHERE NOT EXISTS (SELECT 1 FROM totalizers t
+                      WHERE t.source = 'cold_water' AND t.meter_key = c.itp_id::text AND c.timestamp >= t.since)
+    GROUP BY i.building_id, c.timestamp
+    UNION ALL
+    SELECT i.building_id, c.timestamp, 'cold_water:' || c.itp_id::text, c.flow_rate::double precision
+    FROM cold_water_meters c JOIN itp i ON i.id = c.itp_id
+    WHERE NOT EXISTS (SELECT 1 FROM totalizers t
+                      WHERE t.source = 'cold_water' AND t.meter_key = c.itp_id::text AND c.timestamp >= t.since)
+    UNION ALL
+    SELECT building_id, timestamp, 'supply_temp', supply_temp::double precision FROM temperature_readings
+    UNION ALL
+    SELECT building_id, timestamp, 'return_temp', return_temp::double precision FROM temperature_readings
+    UNION ALL
+    SELECT building_id, timestamp, 'delta_temp', delta_temp::double precision FROM temperature_readings
+    UNION ALL
+    SELECT t.building_id, m.timestamp, t.source, SUM(m.flow_rate)::double precision
+    FROM meter_totals m JOIN totalizers t ON t.id = m.totalizer_id
+    WHERE m.flow_rate IS NOT NULL
+    GROUP BY t.building_id, m.timestamp, t.source
+    UNION ALL
+    SELECT t.building_id, m.timestamp, t.source || ':' || t.meter_key, SUM(m.flow_rate)::double precision
+    FROM meter_totals m JOIN totalizers t ON t.id = m.totalizer_id
+    WHERE m.flow_rate IS NOT NULL AND t.meter_key <> ''
+    GROUP BY t.building_id, m.timestamp, t.source, t.meter_key
+    UNION ALL
+    SELECT t.building_id, m.timestamp, 'hot_water_' || t.channel, SUM(m.flow_rate)::double precision
+    FROM meter_totals m JOIN totalizers t ON t.id = m.totalizer_id
+    WHERE m.flow_rate IS NOT NULL AND t.source = 'hot_water'
+    GROUP BY t.building_id, m.timestamp, t.channel;
+
+DELETE FROM readings_hourly WHERE metric IN ('heat_energy', 'hot_water_volume');
+DELETE FROM readings_daily WHERE metric IN ('heat_energy', 'hot_water_volume');
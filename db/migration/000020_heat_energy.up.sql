@@ -0,0 +1,146 @@
+-- Тепловая энергия ГВС, Гкал: Q = V * ΔT * ρ * c, где V - объем ГВС за интервал показания (м³),
+-- ρ = 983.2 кг/м³ (вода при 60°C), c = 1 ккал/(кг·°C): ρ * c = 0.0009832 Гкал/(м³·°C).
+-- Показания ОДПУ ГВС - мгновенный расход (м³/ч), поэтому объем интервала - расход, умноженный на время
+-- от предыдущего показания того же счетчика: V = (ch1 + ch2) * Δt / 3600. Интервал длиннее часа считается
+-- пропуском, такое показание (как и первое показание счетчика) в объем и энергию не входит.
+-- Для накопительных показаний V - приращение регистров за интервал.
+-- ΔT - разность температур подачи и обратки по последнему показанию температуры здания внутри интервала
+-- (для коротких интервалов - не раньше 15 минут до конца интервала) и в том же часе, что и показание ГВС
+-- (поздние показания температуры пересчитывают только свой час).
+-- Показания ГВС без температуры в энергию не входят, но входят в объем hot_water_volume
+DROP VIEW IF EXISTS readings_raw;
+
+CREATE VIEW readings_raw AS
+    SELECT h.building_id, h.timestamp, 'hot_water'::text AS metric,
+           SUM(h.flow_rate_ch1 + h.flow_rate_ch2)::double precision AS value
+    FROM hot_water_meters h
+    WHERE NOT EXISTS (SELECT 1 FROM totalizers t
+                      WHERE t.building_id = h.building_id AND t.source = 'hot_water'
+                      AND t.meter_key = h.meter_key AND h.timestamp >= t.since)
+    GROUP BY h.building_id, h.timestamp
+    UNION ALL
+    SELECT h.building_id, h.timestamp, 'hot_water_ch1', SUM(h.flow_rate_ch1)::double precision
+    FROM hot_water_meters h
+    WHERE NOT EXISTS (SELECT 1 FROM totalizers t
+                      WHERE t.building_id = h.building_id AND t.source = 'hot_water'
+                      AND t.meter_key = h.meter_key AND h.timestamp >= t.since)
+    GROUP BY h.building_id, h.timestamp
+    UNION ALL
+    SELECT h.building_id, h.timestamp, 'hot_water_ch2', SUM(h.flow_rate_ch2)::double precision
+    FROM hot_water_meters h
+    WHERE NOT EXISTS (SELECT 1 FROM totalizers t
+                      WHERE t.building_id = h.building_id AND t.source = 'hot_water'
+                      AND t.meter_key = h.meter_key AND h.timestamp >= t.since)
+    GROUP BY h.building_id, h.timestamp
+    UNION ALL
+    SELECT h.building_id, h.timestamp, 'hot_water:' || h.meter_key, (h.flow_rate_ch1 + h.flow_rate_ch2)::double precision
+    FROM hot_water_meters h
+    WHERE NOT EXISTS (SELECT 1 FROM totalizers t
+                      WHERE t.building_id = h.building_id AND t.source = 'hot_water'
+                      AND t.meter_key = h.meter_key AND h.timestamp >= t.since)
+    AND h.meter_key <> ''
+    UNION ALL
+    SELECT i.building_id, c.timestamp, 'cold_water', SUM(c.flow_rate)::double precision
+    FROM cold_water_meters c JOIN itp i ON i.id = c.itp_id
+    WHERE NOT EXISTS (SELECT 1 FROM totalizers t
+                      WHERE t.source = 'cold_water' AND t.meter_key = c.itp_id::text AND c.timestamp >= t.since)
+    GROUP BY i.building_id, c.timestamp
+    UNION ALL
+    SELECT i.building_id, c.timestamp, 'cold_water:' || c.itp_id::text, c.flow_rate::double precision
+    FROM cold_water_meters c JOIN itp i ON i.id = c.itp_id
+    WHERE NOT EXISTS (SELECT 1 FROM totalizers t
+                      WHERE t.source = 'cold_water' AND t.meter_key = c.itp_id::text AND c.timestamp >= t.since)
+    UNION ALL
+    SELECT building_id, timestamp, 'supply_temp', supply_temp::double precision FROM temperature_readings
+    UNION ALL
+    SELECT building_id, timestamp, 'return_temp', return_temp::double precision FROM temperature_readings
+    UNION ALL
+    SELECT building_id, timestamp, 'delta_temp', delta_temp::double precision FROM temperature_readings
+    UNION ALL
+    SELECT t.building_id, m.timestamp, t.source, SUM(m.flow_rate)::double precision
+    FROM meter_totals m JOIN totalizers t ON t.id = m.totalizer_id
+    WHERE m.flow_rate IS NOT NULL
+    GROUP BY t.building_id, m.timestamp, t.source
+    UNION ALL
+    SELECT t.building_id, m.timestamp, t.source || ':' || t.meter_key, SUM(m.flow_rate)::double precision
+    FROM meter_totals m JOIN totalizers t ON t.id = m.totalizer_id
+    WHERE m.flow_rate IS NOT NULL AND t.meter_key <> ''
+    GROUP BY t.building_id, m.timestamp, t.source, t.meter_key
+    UNION ALL
+    SELECT t.building_id, m.timestamp, 'hot_water_' || t.channel, SUM(m.flow_rate)::double precision
+    FROM meter_totals m JOIN totalizers t ON t.id = m.totalizer_id
+    WHERE m.flow_rate IS NOT NULL AND t.source = 'hot_water'
+    GROUP BY t.building_id, m.timestamp, t.channel
+    UNION ALL
+    SELECT h.building_id, h.timestamp, 'hot_water_volume', SUM((h.flow_rate_ch1 + h.flow_rate_ch2) * iv.hours)::double precision
+    FROM hot_water_meters h
+    CROSS JOIN LATERAL (
+        SELECT EXTRACT(EPOCH FROM h.timestamp - MAX(p.timestamp)) / 3600 AS hours
+        FROM hot_water_meters p
+        WHERE p.building_id = h.building_id AND p.meter_key = h.meter_key
+        AND p.timestamp < h.timestamp AND p.timestamp >= h.timestamp - INTERVAL '1 hour'
+    ) iv
+    WHERE iv.hours IS NOT NULL
+    AND NOT EXISTS (SELECT 1 FROM totalizers t
+                    WHERE t.building_id = h.building_id AND t.source = 'hot_water'
+                    AND t.meter_key = h.meter_key AND h.timestamp >= t.since)
+    GROUP BY h.building_id, h.timestamp
+    UNION ALL
+    SELECT t.building_id, m.timestamp, 'hot_water_volume', SUM(m.delta)::double precision
+    FROM meter_totals m JOIN totalizers t ON t.id = m.totalizer_id
+    WHERE m.delta IS NOT NULL AND t.source = 'hot_water'
+    GROUP BY t.building_id, m.timestamp
+    UNION ALL
+    SELECT h.building_id, h.timestamp, 'heat_energy',
+           SUM((h.flow_rate_ch1 + h.flow_rate_ch2) * iv.hours * tr.delta_temp * 0.0009832)::double precision
+    FROM hot_water_meters h
+    CROSS JOIN LATERAL (
+        SELECT MAX(p.timestamp) AS prev, EXTRACT(EPOCH FROM h.timestamp - MAX(p.timestamp)) / 3600 AS hours
+        FROM hot_water_meters p
+        WHERE p.building_id = h.building_id AND p.meter_key = h.meter_key
+        AND p.timestamp < h.timestamp AND p.timestamp >= h.timestamp - INTERVAL '1 hour'
+    ) iv
+    CROSS JOIN LATERAL (
+        SELECT t.delta_temp FROM temperature_readings t
+        WHERE t.building_id = h.building_id AND t.timestamp <= h.timestamp
+        AND t.timestamp >= GREATEST(LEAST(iv.prev, h.timestamp - INTERVAL '15 minutes'),
+                                    date_trunc('hour', h.timestamp AT TIME ZONE 'UTC') AT TIME ZONE 'UTC')
+        ORDER BY t.timestamp DESC
+        LIMIT 1
+    ) tr
+    WHERE iv.hours IS NOT NULL
+    AND NOT EXISTS (SELECT 1 FROM totalizers t
+                    WHERE t.building_id = h.building_id AND t.source = 'hot_water'
+                    AND t.meter_key = h.meter_key AND h.timestamp >= t.since)
+    GROUP BY h.building_id, h.timestamp
+    UNION ALL
+    SELECT t.building_id, m.timestamp, 'heat_energy', (SUM(m.delta) * MAX(tr.delta_temp) * 0.0009832)::double precision
+    FROM meter_totals m JOIN totalizers t ON t.id = m.totalizer_id
+    CROSS JOIN LATERAL (
+        SELECT r.delta_temp FROM temperature_readings r
+        WHERE r.building_id = t.building_id AND r.timestamp <= m.timestamp
+        AND r.timestamp >= GREATEST(m.timestamp - INTERVAL '15 minutes', date_trunc('hour', m.timestamp AT TIME ZONE 'UTC') AT TIME ZONE 'UTC')
+        ORDER BY r.timestamp DESC
+        LIMIT 1
+    ) tr
+    WHERE m.delta IS NOT NULL AND t.source = 'hot_water'
+    GROUP BY t.building_id, m.timestamp;
+
+-- Агрегаты энергии и объема ГВС за уже свернутые интервалы строятся по сохранившимся сырым показаниям
+INSERT INTO readings_hourly (building_id, metric, bucket, sum, count, min, max)
+SELECT building_id, metric, date_trunc('hour', timestamp AT TIME ZONE 'UTC') AT TIME ZONE 'UTC',
+       SUM(value), COUNT(*), MIN(value), MAX(value)
+FROM readings_raw
+WHERE metric IN ('heat_energy', 'hot_water_volume')
+AND timestamp < COALESCE((SELECT watermark FROM rollup_state WHERE resolution = 'hourly'), '-infinity')
+GROUP BY 1, 2, 3
+ON CONFLICT (building_id, metric, bucket) DO NOTHING;
+
+INSERT INTO readings_daily (building_id, metric, bucket, sum, count, min, max)
+SELECT building_id, metric, date_trunc('day', bucket AT TIME ZONE 'UTC') AT TIME ZONE 'UTC',
+       SUM(sum), SUM(count), MIN(min), MAX(max)
+FROM readings_hourly
+WHERE metric IN ('heat_energy', 'hot_water_volume')
+AND bucket < COALESCE((SELECT watermark FROM rollup_state WHERE resolution = 'daily'), '-infinity')
+GROUP BY 1, 2, 3
+ON CONFLICT (building_id, metric, bucket) DO NOTHING;
@@ -0,0 +1,3 @@
+ALTER TABLE incidents DROP COLUMN IF EXISTS loss_per_day;
+DROP TABLE IF EXISTS tariffs;
+ALTER TABLE buildings DROP COLUMN IF EXISTS region;
@@ -0,0 +1,22 @@
+-- Регион здания: тариф может быть установлен для региона
+ALTER TABLE buildings ADD COLUMN region TEXT CHECK (region <> '');
+
+-- Тарифы: ХВС и ГВС в ₽/м³, тепловая энергия в ₽/Гкал.
+-- Тариф компании (organization_id), региона (region) или общий (оба поля пусты) действует с effective_from
+-- до начала действия следующего тарифа того же уровня
+CREATE TABLE tariffs (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    organization_id UUID REFERENCES organizations(id) ON DELETE CASCADE,
+    region TEXT CHECK (region <> ''),
+    cold_water NUMERIC(12, 2) NOT NULL CHECK (cold_water >= 0),
+    hot_water NUMERIC(12, 2) NOT NULL CHECK (hot_water >= 0),
+    heat NUMERIC(12, 2) NOT NULL CHECK (heat >= 0),
+    effective_from DATE NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CONSTRAINT tariffs_level_check CHECK (organization_id IS NULL OR region IS NULL)
+);
+CREATE UNIQUE INDEX idx_tariffs_level_date ON tariffs(
+    COALESCE(organization_id, '00000000-0000-0000-0000-000000000000'::uuid), COALESCE(region, ''), effective_from);
+
+-- Оценка потерь инцидента в сутки по тарифу здания; NULL - не оценивается
+ALTER TABLE incidents ADD COLUMN loss_per_day NUMERIC(14, 2);
@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS idx_buildings_peer_group;
+ALTER TABLE buildings DROP COLUMN IF EXISTS peer_group;
+ALTER TABLE buildings DROP COLUMN IF EXISTS area;
+ALTER TABLE buildings DROP COLUMN IF EXISTS year_built;
+ALTER TABLE buildings DROP COLUMN IF EXISTS residents;
+ALTER TABLE buildings DROP COLUMN IF EXISTS floors;
+ALTER TABLE buildings DROP COLUMN IF EXISTS apartments;
@@ -0,0 +1,10 @@
+-- Характеристики здания для сравнения с сопоставимыми зданиями
+ALTER TABLE buildings ADD COLUMN apartments INT CHECK (apartments > 0);
+ALTER TABLE buildings ADD COLUMN floors INT CHECK (floors BETWEEN 1 AND 200);
+ALTER TABLE buildings ADD COLUMN residents INT CHECK (residents >= 0);
+ALTER TABLE buildings ADD COLUMN year_built INT CHECK (year_built BETWEEN 1800 AND 2100);
+ALTER TABLE buildings ADD COLUMN area NUMERIC(12, 2) CHECK (area > 0); -- общая площадь, м²
+
+-- Группа сопоставимых зданий (этажность и период постройки), рассчитывается сервисом при изменении характеристик
+ALTER TABLE buildings ADD COLUMN peer_group TEXT;
+CREATE INDEX idx_buildings_peer_group ON buildings(peer_group) WHERE peer_group IS NOT NULL;
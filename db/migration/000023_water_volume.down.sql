@@ -0,0 +1,120 @@
+DROP VIEW IF EXISTS readings_raw;
+
+CREATE VIEW readings_raw AS
+    SELECT h.building_id, h.timestamp, 'hot_water'::text AS metric,
+           SUM(h.flow_rate_ch1 + h.flow_rate_ch2)::double precision AS value
+    FROM hot_water_meters h
+    WHERE NOT EXISTS (SELECT 1 FROM totalizers t
+                      WHERE t.building_id = h.building_id AND t.source = 'hot_water'
+                      AND t.meter_key = h.meter_key AND h.timestamp >= t.since)
+    GROUP BY h.building_id, h.timestamp
+    UNION ALL
+    SELECT h.building_id, h.timestamp, 'hot_water_ch1', SUM(h.flow_rate_ch1)::double precision
+    FROM hot_water_meters h
+    WHERE NOT EXISTS (SELECT 1 FROM totalizers t
+                      WHERE t.building_id = h.building_id AND t.source = 'hot_water'
+                      AND t.meter_key = h.meter_key AND h.timestamp >= t.since)
+    GROUP BY h.building_id, h.timestamp
+    UNION ALL
+    SELECT h.building_id, h.timestamp, 'hot_water_ch2', SUM(h.flow_rate_ch2)::double precision
+    FROM hot_water_meters h
+    WHERE NOT EXISTS (SELECT 1 FROM totalizers t
+                      WHERE t.building_id = h.building_id AND t.source = 'hot_water'
+                      AND t.meter_key = h.meter_key AND h.timestamp >= t.since)
+    GROUP BY h.building_id, h.timestamp
+    UNION ALL
+    SELECT h.building_id, h.timestamp, 'hot_water:' || h.meter_key, (h.flow_rate_ch1 + h.flow_rate_ch2)::double precision
+    FROM hot_water_meters h
+    WHERE NOT EXISTS (SELECT 1 FROM totalizers t
+                      WHERE t.building_id = h.building_id AND t.source = 'hot_water'
+                      AND t.meter_key = h.meter_key AND h.timestamp >= t.since)
+    AND h.meter_key <> ''
+    UNION ALL
+    SELECT i.building_id, c.timestamp, 'cold_water', SUM(c.flow_rate)::double precision
+    FROM cold_water_meters c JOIN itp i ON i.id = c.itp_id
+    WHERE NOT EXISTS (SELECT 1 FROM totalizers t
+                      WHERE t.source = 'cold_water' AND t.meter_key = c.itp_id::text AND c.timestamp >= t.since)
+    GROUP BY i.building_id, c.timestamp
+    UNION ALL
+    SELECT i.building_id, c.timestamp, 'cold_water:' || c.itp_id::text, c.flow_rate::double precision
+    FROM cold_water_meters c JOIN itp i ON i.id = c.itp_id
+    WHERE NOT EXISTS (SELECT 1 FROM totalizers t
+                      WHERE t.source = 'cold_water' AND t.meter_key = c.itp_id::text AND c.timestamp >= t.since)
+    UNION ALL
+    SELECT building_id, timestamp, 'supply_temp', supply_temp::double precision FROM temperature_readings
+    UNION ALL
+    SELECT building_id, timestamp, 'return_temp', return_temp::double precision FROM temperature_readings
+    UNION ALL
+    SELECT building_id, timestamp, 'delta_temp', delta_temp::double precision FROM temperature_readings
+    UNION ALL
+    SELECT t.building_id, m.timestamp, t.source, SUM(m.flow_rate)::double precision
+    FROM meter_totals m JOIN totalizers t ON t.id = m.totalizer_id
+    WHERE m.flow_rate IS NOT NULL
+    GROUP BY t.building_id, m.timestamp, t.source
+    UNION ALL
+    SELECT t.building_id, m.timestamp, t.source || ':' || t.meter_key, SUM(m.flow_rate)::double precision
+    FROM meter_totals m JOIN totalizers t ON t.id = m.totalizer_id
+    WHERE m.flow_rate IS NOT NULL AND t.meter_key <> ''
+    GROUP BY t.building_id, m.timestamp, t.source, t.meter_key
+    UNION ALL
+    SELECT t.building_id, m.timestamp, 'hot_water_' || t.channel, SUM(m.flow_rate)::double precision
+    FROM meter_totals m JOIN totalizers t ON t.id = m.totalizer_id
+    WHERE m.flow_rate IS NOT NULL AND t.source = 'hot_water'
+    GROUP BY t.building_id, m.timestamp, t.channel
+    UNION ALL
+    SELECT h.building_id, h.timestamp, 'hot_water_volume', SUM((h.flow_rate_ch1 + h.flow_rate_ch2) * iv.hours)::double precision
+    FROM hot_water_meters h
+    CROSS JOIN LATERAL (
+        SELECT EXTRACT(EPOCH FROM h.timestamp - MAX(p.timestamp)) / 3600 AS hours
+        FROM hot_water_meters p
+        WHERE p.building_id = h.building_id AND p.meter_key = h.meter_key
+        AND p.timestamp < h.timestamp AND p.timestamp >= h.timestamp - INTERVAL '1 hour'
+    ) iv
+    WHERE iv.hours IS NOT NULL
+    AND NOT EXISTS (SELECT 1 FROM totalizers t
+                    WHERE t.building_id = h.building_id AND t.source = 'hot_water'
+                    AND t.meter_key = h.meter_key AND h.timestamp >= t.since)
+    GROUP BY h.building_id, h.timestamp
+    UNION ALL
+    SELECT t.building_id, m.timestamp, 'hot_water_volume', SUM(m.delta)::double precision
+    FROM meter_totals m JOIN totalizers t ON t.id = m.totalizer_id
+    WHERE m.delta IS NOT NULL AND t.source = 'hot_water'
+    GROUP BY t.building_id, m.timestamp
+    UNION ALL
+    SELECT h.building_id, h.timestamp, 'heat_energy',
+           SUM((h.flow_rate_ch1 + h.flow_rate_ch2) * iv.hours * tr.delta_temp * 0.0009832)::double precision
+    FROM hot_water_meters h
+    CROSS JOIN LATERAL (
+        SELECT MAX(p.timestamp) AS prev, EXTRACT(EPOCH FROM h.timestamp - MAX(p.timestamp)) / 3600 AS hours
+        FROM hot_water_meters p
+        WHERE p.building_id = h.building_id AND p.meter_key = h.meter_key
+        AND p.timestamp < h.timestamp AND p.timestamp >= h.timestamp - INTERVAL '1 hour'
+    ) iv
+    CROSS JOIN LATERAL (
+        SELECT t.delta_temp FROM temperature_readings t
+        WHERE t.building_id = h.building_id AND t.timestamp <= h.timestamp
+        AND t.timestamp >= GREATEST(LEAST(iv.prev, h.timestamp - INTERVAL '15 minutes'),
+                                    date_trunc('hour', h.timestamp AT TIME ZONE 'UTC') AT TIME ZONE 'UTC')
+        ORDER BY t.timestamp DESC
+        LIMIT 1
+    ) tr
+    WHERE iv.hours IS NOT NULL
+    AND NOT EXISTS (SELECT 1 FROM totalizers t
+                    WHERE t.building_id = h.building_id AND t.source = 'hot_water'
+                    AND t.meter_key = h.meter_key AND h.timestamp >= t.since)
+    GROUP BY h.building_id, h.timestamp
+    UNION ALL
+    SELECT t.building_id, m.timestamp, 'heat_energy', (SUM(m.delta) * MAX(tr.delta_temp) * 0.0009832)::double precision
+    FROM meter_totals m JOIN totalizers t ON t.id = m.totalizer_id
+    CROSS JOIN LATERAL (
+        SELECT r.delta_temp FROM temperature_readings r
+        WHERE r.building_id = t.building_id AND r.timestamp <= m.timestamp
+        AND r.timestamp >= GREATEST(m.timestamp - INTERVAL '15 minutes', date_trunc('hour', m.timestamp AT TIME ZONE 'UTC') AT TIME ZONE 'UTC')
+        ORDER BY r.timestamp DESC
+        LIMIT 1
+    ) tr
+    WHERE m.delta IS NOT NULL AND t.source = 'hot_water'
+    GROUP BY t.building_id, m.timestamp;
+
+DELETE FROM readings_hourly WHERE metric = 'cold_water_volume' OR metric LIKE 'cold_water_volume:%' OR metric LIKE 'hot_water_volume:%';
+DELETE FROM readings_daily WHERE metric = 'cold_water_volume' OR metric LIKE 'cold_water_volume:%' OR metric LIKE 'hot_water_volume:%';
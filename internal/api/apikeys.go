@@ -0,0 +1,190 @@
+package api
+
+import (
+    "errors"
+    "net/http"
+    "time"
+
+    "service/internal/audit"
+    "service/internal/auth"
+
+    "github.com/gin-gonic/gin"
+    "github.com/google/uuid"
+)
+
+// APIKeyHandler - управление API ключами (только для администратора)
+type APIKeyHandler struct {
+    keys *auth.APIKeyStore
+}
+
+func NewAPIKeyHandler(keys *auth.APIKeyStore) *APIKeyHandler {
+    return &APIKeyHandler{keys: keys}
+}
+
+type createAPIKeyRequest struct {
+    Name           string      `json:"name" binding:"required"`
+    Scopes         []string    `json:"scopes" binding:"required,min=1"`
+    BuildingIDs    []uuid.UUID `json:"building_ids"`
+    ITPIDs         []uuid.UUID `json:"itp_ids"`
+    ExpiresAt      *time.Time  `json:"expires_at"`
+    OrganizationID *uuid.UUID  `json:"organization_id"` // задается только суперпользователем
+}
+
+type rotateAPIKeyRequest struct {
+    GracePeriod string `json:"grace_period"` // например "24h"; пусто - старый ключ отзывается сразу
+}
+
+func currentUserID(c *gin.Context) *uuid.UUID {
+    if claims := auth.ClaimsFromContext(c); claims != nil {
+        return &claims.UserID
+    }
+    return nil
+}
+
+// Ответ с новым ключом: секрет показывается только один раз
+func newKeyResponse(c *gin.Context, status int, key *auth.APIKey, plain string) {
+    c.JSON(status, gin.H{
+        "api_key": key,
+        "key":     plain,
+        "message": "Store the key now, it cannot be retrieved later",
+    })
+}
+
+// Получение ключа с проверкой, что он принадлежит компании администратора
+func (h *APIKeyHandler) loadKey(c *gin.Context, id uuid.UUID) (*auth.APIKey, bool) {
+    key, err := h.keys.Get(c.Request.Context(), id)
+    if err != nil && !errors.Is(err, auth.ErrAPIKeyNotFound) {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return nil, false
+    }
+
+    org := adminOrganization(c)
+    if err != nil || (org != nil && (key.OrganizationID == nil || *key.OrganizationID != *org)) {
+        c.JSON(http.StatusNotFound, gin.H{"error": "api key not found"})
+        return nil, false
+    }
+    return key, true
+}
+
+// GET /api/api-keys
+func (h *APIKeyHandler) ListAPIKeys(c *gin.Context) {
+    keys, err := h.keys.List(c.Request.Context(), adminOrganization(c))
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error: " + err.Error()})
+        return
+    }
+    c.JSON(http.StatusOK, keys)
+}
+
+// POST /api/api-keys
+func (h *APIKeyHandler) CreateAPIKey(c *gin.Context) {
+    var req createAPIKeyRequest
+    if err := c.ShouldBindJSON(&req); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+    if req.ExpiresAt != nil && req.ExpiresAt.Before(time.Now()) {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "expires_at must be in the future"})
+        return
+    }
+
+    if org := adminOrganization(c); org != nil {
+        req.OrganizationID = org
+    }
+
+    key, plain, err := h.keys.Create(c.Request.Context(), auth.APIKeyParams{
+        Name:           req.Name,
+        Scopes:         req.Scopes,
+        BuildingIDs:    req.BuildingIDs,
+        ITPIDs:         req.ITPIDs,
+        OrganizationID: req.OrganizationID,
+        ExpiresAt:      req.ExpiresAt,
+    }, currentUserID(c))
+    if errors.Is(err, auth.ErrUnknownScope) {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+
+    audit.SetTarget(c, "api_key", key.ID.String())
+    audit.SetChange(c, nil, key)
+    newKeyResponse(c, http.StatusCreated, key, plain)
+}
+
+// POST /api/api-keys/:id/rotate
+func (h *APIKeyHandler) RotateAPIKey(c *gin.Context) {
+    id, err := uuid.Parse(c.Param("id"))
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "invalid api key ID"})
+        return
+    }
+
+    var req rotateAPIKeyRequest
+    if c.Request.ContentLength > 0 {
+        if err := c.ShouldBindJSON(&req); err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+            return
+        }
+    }
+
+    var grace time.Duration
+    if req.GracePeriod != "" {
+        grace, err = time.ParseDuration(req.GracePeriod)
+        if err != nil || grace < 0 {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "invalid grace_period"})
+            return
+        }
+    }
+
+    old, ok := h.loadKey(c, id)
+    if !ok {
+        return
+    }
+
+    key, plain, err := h.keys.Rotate(c.Request.Context(), id, grace, currentUserID(c))
+    if errors.Is(err, auth.ErrAPIKeyNotFound) {
+        c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+        return
+    }
+    if errors.Is(err, auth.ErrAPIKeyRevoked) {
+        c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+        return
+    }
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+
+    audit.SetChange(c, old, key)
+    newKeyResponse(c, http.StatusCreated, key, plain)
+}
+
+// DELETE /api/api-keys/:id
+func (h *APIKeyHandler) RevokeAPIKey(c *gin.Context) {
+    id, err := uuid.Parse(c.Param("id"))
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "invalid api key ID"})
+        return
+    }
+
+    old, ok := h.loadKey(c, id)
+    if !ok {
+        return
+    }
+
+    err = h.keys.Revoke(c.Request.Context(), id)
+    if errors.Is(err, auth.ErrAPIKeyNotFound) {
+        c.JSON(http.StatusNotFound, gin.H{"error": "api key not found or already revoked"})
+        return
+    }
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+
+    audit.SetChange(c, old, gin.H{"revoked": true})
+    c.JSON(http.StatusOK, gin.H{"message": "API key revoked", "id": id})
+}
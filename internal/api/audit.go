@@ -0,0 +1,70 @@
+package api
+
+import (
+    "net/http"
+    "strconv"
+    "time"
+
+    "service/internal/audit"
+
+    "github.com/gin-gonic/gin"
+    "github.com/google/uuid"
+)
+
+// AuditHandler - просмотр журнала действий
+type AuditHandler struct {
+    recorder *audit.Recorder
+}
+
+func NewAuditHandler(recorder *audit.Recorder) *AuditHandler {
+    return &AuditHandler{recorder: recorder}
+}
+
+// GET /api/audit?actor_id=&action=&target_type=&target_id=&from=&to=&limit=&offset=
+// Время from/to в формате RFC3339. Администратор компании видит только записи своей компании
+func (h *AuditHandler) ListAudit(c *gin.Context) {
+    filter := audit.Filter{
+        OrganizationID: adminOrganization(c),
+        Action:         c.Query("action"),
+        TargetType:     c.Query("target_type"),
+        TargetID:       c.Query("target_id"),
+    }
+
+    if v := c.Query("actor_id"); v != "" {
+        id, err := uuid.Parse(v)
+        if err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "invalid actor_id"})
+            return
+        }
+        filter.ActorID = &id
+    }
+
+    for param, dst := range map[string]**time.Time{"from": &filter.From, "to": &filter.To} {
+        if v := c.Query(param); v != "" {
+            t, err := time.Parse(time.RFC3339, v)
+            if err != nil {
+                c.JSON(http.StatusBadRequest, gin.H{"error": "invalid " + param + ", expected RFC3339"})
+                return
+            }
+            *dst = &t
+        }
+    }
+
+    filter.Limit, _ = strconv.Atoi(c.DefaultQuery("limit", "100"))
+    filter.Offset, _ = strconv.Atoi(c.DefaultQuery("offset", "0"))
+    if filter.Offset < 0 {
+        filter.Offset = 0
+    }
+
+    entries, err := h.recorder.List(c.Request.Context(), filter)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error: " + err.Error()})
+        return
+    }
+
+    c.JSON(http.StatusOK, gin.H{
+        "entries": entries,
+        "limit":   filter.Limit,
+        "offset":  filter.Offset,
+    })
+}
@@ -0,0 +1,148 @@
+package api
+
+import (
+    "errors"
+    "net/http"
+
+    "service/internal/audit"
+    "service/internal/auth"
+
+    "github.com/gin-gonic/gin"
+    "github.com/google/uuid"
+)
+
+type AuthHandler struct {
+    users  *auth.UserStore
+    tokens *auth.TokenManager
+}
+
+func NewAuthHandler(users *auth.UserStore, tokens *auth.TokenManager) *AuthHandler {
+    return &AuthHandler{users: users, tokens: tokens}
+}
+
+type loginRequest struct {
+    Username string `json:"username" binding:"required"`
+    Password string `json:"password" binding:"required"`
+}
+
+type createUserRequest struct {
+    Username       string     `json:"username" binding:"required"`
+    Password       string     `json:"password" binding:"required,min=8"`
+    Role           auth.Role  `json:"role" binding:"required"`
+    OrganizationID *uuid.UUID `json:"organization_id"`
+    Superuser      bool       `json:"is_superuser"`
+}
+
+// Вход по логину и паролю, выдача JWT
+func (h *AuthHandler) Login(c *gin.Context) {
+    var req loginRequest
+    if err := c.ShouldBindJSON(&req); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "username and password required"})
+        return
+    }
+
+    audit.SetActor(c, audit.Actor{Type: audit.ActorAnonymous, Name: req.Username})
+
+    user, err := h.users.Authenticate(c.Request.Context(), req.Username, req.Password)
+    if errors.Is(err, auth.ErrInvalidCredentials) {
+        c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+        return
+    }
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error: " + err.Error()})
+        return
+    }
+
+    audit.SetActor(c, audit.Actor{Type: audit.ActorUser, ID: &user.ID, Name: user.Username, OrganizationID: user.OrganizationID})
+    audit.SetTarget(c, "user", user.ID.String())
+
+    token, expiresAt, err := h.tokens.Issue(user)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+
+    c.JSON(http.StatusOK, gin.H{
+        "token":      token,
+        "expires_at": expiresAt,
+        "user":       user,
+    })
+}
+
+// Информация о текущем пользователе
+func (h *AuthHandler) Me(c *gin.Context) {
+    claims := auth.ClaimsFromContext(c)
+    c.JSON(http.StatusOK, gin.H{
+        "id":              claims.UserID,
+        "username":        claims.Username,
+        "role":            claims.Role,
+        "organization_id": claims.OrganizationID,
+        "is_superuser":    claims.Superuser,
+    })
+}
+
+// Компания, в пределах которой действует администратор (nil - суперпользователь)
+func adminOrganization(c *gin.Context) *uuid.UUID {
+    claims := auth.ClaimsFromContext(c)
+    if claims.Superuser {
+        return nil
+    }
+    if claims.OrganizationID == nil {
+        return &uuid.Nil
+    }
+    return claims.OrganizationID
+}
+
+// Список пользователей (только для администратора, в пределах его компании)
+func (h *AuthHandler) ListUsers(c *gin.Context) {
+    users, err := h.users.List(c.Request.Context(), adminOrganization(c))
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error: " + err.Error()})
+        return
+    }
+    c.JSON(http.StatusOK, users)
+}
+
+// Создание пользователя (только для администратора).
+// Администратор компании создает пользователей только в своей компании,
+// суперпользователя может создать только суперпользователь
+func (h *AuthHandler) CreateUser(c *gin.Context) {
+    var req createUserRequest
+    if err := c.ShouldBindJSON(&req); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+
+    if !req.Role.Valid() {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "unknown role: " + string(req.Role)})
+        return
+    }
+
+    if org := adminOrganization(c); org != nil {
+        if req.Superuser {
+            c.JSON(http.StatusForbidden, gin.H{"error": "only superuser can create superusers"})
+            return
+        }
+        req.OrganizationID = org
+    }
+    if req.OrganizationID == nil && !req.Superuser {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "organization_id required"})
+        return
+    }
+
+    user, err := h.users.Create(c.Request.Context(), auth.UserParams{
+        Username:       req.Username,
+        Password:       req.Password,
+        Role:           req.Role,
+        OrganizationID: req.OrganizationID,
+        Superuser:      req.Superuser,
+    })
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+
+    audit.SetTarget(c, "user", user.ID.String())
+    audit.SetChange(c, nil, user)
+    c.JSON(http.StatusCreated, user)
+}
@@ -0,0 +1,154 @@
+package api
+
+import (
+    "errors"
+    "net/http"
+    "strconv"
+
+    "service/internal/audit"
+    "service/internal/benchmark"
+    "service/internal/tenant"
+
+    "github.com/gin-gonic/gin"
+    "github.com/google/uuid"
+)
+
+// BenchmarkHandler - характеристики зданий и сравнение с сопоставимыми зданиями
+type BenchmarkHandler struct {
+    benchmarks *benchmark.Benchmarker
+    attributes *benchmark.Store
+    orgs       *tenant.OrganizationStore
+}
+
+func NewBenchmarkHandler(benchmarks *benchmark.Benchmarker, attributes *benchmark.Store, orgs *tenant.OrganizationStore) *BenchmarkHandler {
+    return &BenchmarkHandler{benchmarks: benchmarks, attributes: attributes, orgs: orgs}
+}
+
+// Характеристики здания: переданные значения заменяют все текущие, отсутствующие поля очищаются
+type attributesRequest struct {
+    Apartments *int     `json:"apartments" binding:"omitempty,min=1"`
+    Floors     *int     `json:"floors" binding:"omitempty,min=1,max=200"`
+    Residents  *int     `json:"residents" binding:"omitempty,min=0"`
+    YearBuilt  *int     `json:"year_built" binding:"omitempty,min=1800,max=2100"`
+    Area       *float64 `json:"area" binding:"omitempty,gt=0"`
+}
+
+// Параметры сравнения: период (по умолчанию 30 суток) и база удельного расхода
+func benchmarkParams(c *gin.Context) (days int, basis string, ok bool) {
+    days, err := strconv.Atoi(c.DefaultQuery("days", "30"))
+    if err != nil || days <= 0 {
+        days = 30
+    }
+    basis = c.DefaultQuery("basis", benchmark.BasisPerCapita)
+    if basis != benchmark.BasisPerCapita && basis != benchmark.BasisPerArea {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "invalid basis, expected per_capita or per_m2"})
+        return 0, "", false
+    }
+    return days, basis, true
+}
+
+// Ответ на ошибку сравнения: у здания не заданы этажность и год постройки - 422
+func respondBenchmarkError(c *gin.Context, err error) {
+    if errors.Is(err, benchmark.ErrNoAttributes) {
+        c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error(), "code": codeInsufficientData})
+        return
+    }
+    respondError(c, err)
+}
+
+// GET /api/benchmark?days=30&basis=per_capita|per_m2&outliers=true&limit=100 - здания компании по убыванию
+// наибольшего отклонения от сопоставимых зданий; outliers=true - только здания с выбросами
+func (h *BenchmarkHandler) Rank(c *gin.Context) {
+    days, basis, ok := benchmarkParams(c)
+    if !ok {
+        return
+    }
+    outliers, _ := strconv.ParseBool(c.DefaultQuery("outliers", "false"))
+    limit, err := strconv.Atoi(c.DefaultQuery("limit", "100"))
+    if err != nil || limit <= 0 || limit > 1000 {
+        limit = 100
+    }
+
+    entries, err := h.benchmarks.Rank(c.Request.Context(), tenant.FromContext(c), days, basis, outliers)
+    if err != nil {
+        respondError(c, err)
+        return
+    }
+    total := len(entries)
+    if len(entries) > limit {
+        entries = entries[:limit]
+    }
+
+    c.JSON(http.StatusOK, gin.H{
+        "days":          days,
+        "basis":         basis,
+        "outlier_score": benchmark.OutlierScore,
+        "total":         total,
+        "buildings":     entries,
+    })
+}
+
+// GET /api/benchmark/:id?days=30&basis=per_capita|per_m2 - показатели здания в сравнении с его группой
+func (h *BenchmarkHandler) Building(c *gin.Context) {
+    buildingID, err := uuid.Parse(c.Param("id"))
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "invalid building ID"})
+        return
+    }
+    days, basis, ok := benchmarkParams(c)
+    if !ok {
+        return
+    }
+
+    entry, err := h.benchmarks.Building(c.Request.Context(), tenant.FromContext(c), buildingID, days, basis)
+    if err != nil {
+        respondBenchmarkError(c, err)
+        return
+    }
+    c.JSON(http.StatusOK, gin.H{
+        "days":          days,
+        "basis":         basis,
+        "outlier_score": benchmark.OutlierScore,
+        "benchmark":     entry,
+    })
+}
+
+// PUT /api/buildings/:id/attributes - квартиры, этажность, жители, год постройки и площадь здания.
+// Этажность и год постройки определяют группу сопоставимых зданий
+func (h *BenchmarkHandler) SetAttributes(c *gin.Context) {
+    buildingID, err := uuid.Parse(c.Param("id"))
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "invalid building ID"})
+        return
+    }
+    var req attributesRequest
+    if err := c.ShouldBindJSON(&req); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "invalid attributes: " + err.Error()})
+        return
+    }
+
+    ctx := c.Request.Context()
+    if err := h.orgs.CheckBuilding(ctx, tenant.FromContext(c), buildingID); err != nil {
+        respondError(c, err)
+        return
+    }
+    after := benchmark.Attributes{
+        Apartments: req.Apartments,
+        Floors:     req.Floors,
+        Residents:  req.Residents,
+        YearBuilt:  req.YearBuilt,
+        Area:       req.Area,
+    }
+    before, err := h.attributes.SetAttributes(ctx, buildingID, after)
+    if err != nil {
+        respondError(c, err)
+        return
+    }
+
+    audit.SetChange(c, before, after)
+    c.JSON(http.StatusOK, gin.H{
+        "building_id": buildingID,
+        "attributes":  after,
+        "peer_group":  benchmark.PeerGroup(after),
+    })
+}
@@ -0,0 +1,52 @@
+package api
+
+import (
+    "errors"
+    "net/http"
+
+    "service/internal/incident"
+    "service/internal/meter"
+    "service/internal/network"
+    "service/internal/service"
+    "service/internal/tariff"
+    "service/internal/tenant"
+
+    "github.com/gin-gonic/gin"
+)
+
+// Коды ошибок в ответе (поле code)
+const (
+    codeNotFound         = "not_found"
+    codeInsufficientData = "insufficient_data"
+    codeUnavailable      = "db_unavailable"
+    codeInternal         = "internal"
+)
+
+// Через сколько секунд клиенту повторить запрос при недоступности БД
+const retryAfterSeconds = "5"
+
+// Ответ на ошибку по ее виду: объект не найден - 404, недостаточно данных - 422
+// со списком отсутствующих показаний, БД недоступна - 503, остальное - 500
+func respondError(c *gin.Context, err error) {
+    var insufficient *service.InsufficientDataError
+    switch {
+    case errors.Is(err, tenant.ErrBuildingNotFound), errors.Is(err, service.ErrITPNotFound),
+        errors.Is(err, incident.ErrNotFound), errors.Is(err, meter.ErrNotFound),
+        errors.Is(err, network.ErrNotFound), errors.Is(err, network.ErrITPNotFound),
+        errors.Is(err, incident.ErrSituationNotFound), errors.Is(err, tariff.ErrNotFound):
+        c.JSON(http.StatusNotFound, gin.H{"error": err.Error(), "code": codeNotFound})
+    case errors.As(err, &insufficient):
+        c.JSON(http.StatusUnprocessableEntity, gin.H{
+            "error":   err.Error(),
+            "code":    codeInsufficientData,
+            "missing": insufficient.Missing,
+        })
+    case errors.Is(err, service.ErrInsufficientData):
+        c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error(), "code": codeInsufficientData})
+    case service.IsUnavailable(err):
+        c.Header("Retry-After", retryAfterSeconds)
+        c.JSON(http.StatusServiceUnavailable, gin.H{"error": "database unavailable", "code": codeUnavailable})
+    default:
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error: " + err.Error(), "code": codeInternal})
+    }
+}
@@ -0,0 +1,244 @@
+package api
+
+import (
+    "errors"
+    "net/http"
+    "strconv"
+    "time"
+
+    "service/internal/audit"
+    "service/internal/auth"
+    "service/internal/fleet"
+    "service/internal/incident"
+    "service/internal/quality"
+    "service/internal/tenant"
+
+    "github.com/gin-gonic/gin"
+    "github.com/google/uuid"
+)
+
+// FleetHandler - сводка по парку зданий, качество данных и работа с инцидентами
+type FleetHandler struct {
+    monitor   *fleet.Monitor
+    incidents *incident.Store
+    quality   *quality.Checker
+}
+
+func NewFleetHandler(monitor *fleet.Monitor, incidents *incident.Store, checker *quality.Checker) *FleetHandler {
+    return &FleetHandler{monitor: monitor, incidents: incidents, quality: checker}
+}
+
+// GET /api/fleet/summary?sort=risk&order=desc&water_balance_status=&temperature_status=&pump_status=
+//     &min_risk=&has_incidents=true&stale=true&q=&limit=&offset=
+// Состояние всех зданий компании одним ответом: статусы, открытые инциденты, свежесть данных и риск
+func (h *FleetHandler) Summary(c *gin.Context) {
+    q := fleet.Query{
+        OrganizationID:     tenant.FromContext(c).Arg(),
+        WaterBalanceStatus: c.Query("water_balance_status"),
+        TemperatureStatus:  c.Query("temperature_status"),
+        PumpStatus:         c.Query("pump_status"),
+        Search:             c.Query("q"),
+        Sort:               c.DefaultQuery("sort", "risk"),
+        Order:              c.Query("order"),
+    }
+
+    if !fleet.ValidSort(q.Sort) {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "invalid sort, expected risk, incidents, freshness, ratio, quality or address"})
+        return
+    }
+    if q.Order != "" && q.Order != "asc" && q.Order != "desc" {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "invalid order, expected asc or desc"})
+        return
+    }
+
+    if v := c.Query("min_risk"); v != "" {
+        n, err := strconv.Atoi(v)
+        if err != nil || n < 0 || n > 100 {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "invalid min_risk, expected 0-100"})
+            return
+        }
+        q.MinRisk = n
+    }
+    if v := c.Query("has_incidents"); v != "" {
+        b, err := strconv.ParseBool(v)
+        if err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "invalid has_incidents"})
+            return
+        }
+        q.HasIncidents = b
+    }
+    if v := c.Query("stale"); v != "" {
+        b, err := strconv.ParseBool(v)
+        if err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "invalid stale"})
+            return
+        }
+        q.Stale = &b
+    }
+
+    q.Limit, _ = strconv.Atoi(c.DefaultQuery("limit", "1000"))
+    q.Offset, _ = strconv.Atoi(c.DefaultQuery("offset", "0"))
+
+    summary, err := h.monitor.Summary(c.Request.Context(), q)
+    if err != nil {
+        respondError(c, err)
+        return
+    }
+    c.JSON(http.StatusOK, summary)
+}
+
+// GET /api/risk/:id?from=&to= - текущая оценка риска с разбивкой по факторам и почасовая история.
+// По умолчанию история за последние 30 суток, время в формате RFC3339
+func (h *FleetHandler) RiskReport(c *gin.Context) {
+    buildingID, err := uuid.Parse(c.Param("id"))
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "invalid building ID"})
+        return
+    }
+
+    to := time.Now()
+    if v := c.Query("to"); v != "" {
+        if to, err = time.Parse(time.RFC3339, v); err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "invalid to, expected RFC3339"})
+            return
+        }
+    }
+    from := to.AddDate(0, 0, -30)
+    if v := c.Query("from"); v != "" {
+        if from, err = time.Parse(time.RFC3339, v); err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "invalid from, expected RFC3339"})
+            return
+        }
+    }
+    if !from.Before(to) {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "from must be before to"})
+        return
+    }
+
+    report, err := h.monitor.RiskReport(c.Request.Context(), tenant.FromContext(c).Arg(), buildingID, from, to)
+    if err != nil {
+        respondError(c, err)
+        return
+    }
+    c.JSON(http.StatusOK, report)
+}
+
+// GET /api/quality/:id - качество данных счетчиков здания по последней проверке
+func (h *FleetHandler) BuildingQuality(c *gin.Context) {
+    buildingID, err := uuid.Parse(c.Param("id"))
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "invalid building ID"})
+        return
+    }
+
+    report, err := h.quality.BuildingQuality(c.Request.Context(), tenant.FromContext(c).Arg(), buildingID)
+    if err != nil {
+        respondError(c, err)
+        return
+    }
+    c.JSON(http.StatusOK, report)
+}
+
+// GET /api/incidents?building_id=&status=active&category=&sort=&limit=&offset=
+// status: open, acknowledged, resolved, active (по умолчанию - незакрытые) или all;
+// category: process (аномалии процесса), meter_fault (неисправности счетчиков) или maintenance (поверка), по умолчанию все;
+// sort=cost - по убыванию оценки потерь по тарифу, по умолчанию новые первыми
+func (h *FleetHandler) ListIncidents(c *gin.Context) {
+    filter := incident.Filter{
+        OrganizationID: tenant.FromContext(c).Arg(),
+        Status:         c.DefaultQuery("status", "active"),
+        Category:       c.Query("category"),
+        Sort:           c.Query("sort"),
+    }
+
+    switch filter.Status {
+    case incident.StatusOpen, incident.StatusAcknowledged, incident.StatusResolved, "active", "all":
+    default:
+        c.JSON(http.StatusBadRequest, gin.H{"error": "invalid status"})
+        return
+    }
+    switch filter.Category {
+    case "", incident.CategoryProcess, incident.CategoryMeterFault, incident.CategoryMaintenance:
+    default:
+        c.JSON(http.StatusBadRequest, gin.H{"error": "invalid category, expected process, meter_fault or maintenance"})
+        return
+    }
+    switch filter.Sort {
+    case "", incident.SortCost:
+    default:
+        c.JSON(http.StatusBadRequest, gin.H{"error": "invalid sort, expected cost"})
+        return
+    }
+
+    if v := c.Query("building_id"); v != "" {
+        id, err := uuid.Parse(v)
+        if err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "invalid building ID"})
+            return
+        }
+        filter.BuildingID = &id
+    }
+
+    filter.Limit, _ = strconv.Atoi(c.DefaultQuery("limit", "100"))
+    filter.Offset, _ = strconv.Atoi(c.DefaultQuery("offset", "0"))
+    if filter.Offset < 0 {
+        filter.Offset = 0
+    }
+
+    incidents, err := h.incidents.List(c.Request.Context(), filter)
+    if err != nil {
+        respondError(c, err)
+        return
+    }
+    c.JSON(http.StatusOK, gin.H{
+        "incidents": incidents,
+        "limit":     filter.Limit,
+        "offset":    filter.Offset,
+    })
+}
+
+// POST /api/incidents/:id/acknowledge
+func (h *FleetHandler) AcknowledgeIncident(c *gin.Context) {
+    id, err := uuid.Parse(c.Param("id"))
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "invalid incident ID"})
+        return
+    }
+
+    claims := auth.ClaimsFromContext(c)
+    before, after, err := h.incidents.Acknowledge(c.Request.Context(), tenant.FromContext(c).Arg(), id, claims.UserID)
+    if !h.incidentResult(c, err) {
+        return
+    }
+    audit.SetChange(c, before, after)
+    c.JSON(http.StatusOK, after)
+}
+
+// POST /api/incidents/:id/resolve
+func (h *FleetHandler) ResolveIncident(c *gin.Context) {
+    id, err := uuid.Parse(c.Param("id"))
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "invalid incident ID"})
+        return
+    }
+
+    before, after, err := h.incidents.Resolve(c.Request.Context(), tenant.FromContext(c).Arg(), id)
+    if !h.incidentResult(c, err) {
+        return
+    }
+    audit.SetChange(c, before, after)
+    c.JSON(http.StatusOK, after)
+}
+
+// Ответ на ошибку изменения инцидента; false - ответ уже отправлен
+func (h *FleetHandler) incidentResult(c *gin.Context, err error) bool {
+    switch {
+    case err == nil:
+        return true
+    case errors.Is(err, incident.ErrResolved):
+        c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+    default:
+        respondError(c, err)
+    }
+    return false
+}
@@ -2,88 +2,113 @@ package api
 
 import (
     "context"
+    "errors"
     "fmt"
+    "log/slog"
     "math/rand"
     "net/http"
     "strconv"
     "time"
 
+    "service/internal/audit"
+    "service/internal/logging"
+    "service/internal/models"
     "service/internal/service"
+    "service/internal/tenant"
+    "service/internal/timeseries"
 
     "github.com/gin-gonic/gin"
+    "github.com/jackc/pgx/v5"
     "github.com/jackc/pgx/v5/pgxpool"
     "github.com/google/uuid"
 )
 
 type Building struct {
-    ID        uuid.UUID `json:"id"`
-    Address   string    `json:"address"`
-    FiasID    string    `json:"fias_id"`
-    UnomID    string    `json:"unom_id"`
-    CreatedAt time.Time `json:"created_at"`
-    UpdatedAt time.Time `json:"updated_at"`
+    ID             uuid.UUID  `json:"id"`
+    Address        string     `json:"address"`
+    FiasID         string     `json:"fias_id"`
+    UnomID         string     `json:"unom_id"`
+    OrganizationID *uuid.UUID `json:"organization_id,omitempty"`
+    Latitude       *float64   `json:"latitude,omitempty"`
+    Longitude      *float64   `json:"longitude,omitempty"`
+    Region         *string    `json:"region,omitempty"` // регион для выбора тарифа
+    Apartments     *int       `json:"apartments,omitempty"`
+    Floors         *int       `json:"floors,omitempty"`
+    Residents      *int       `json:"residents,omitempty"`
+    YearBuilt      *int       `json:"year_built,omitempty"`
+    Area           *float64   `json:"area,omitempty"`       // общая площадь, м²
+    PeerGroup      *string    `json:"peer_group,omitempty"` // группа сопоставимых зданий
+    CreatedAt      time.Time  `json:"created_at"`
+    UpdatedAt      time.Time  `json:"updated_at"`
 }
 
 type Handler struct {
-    pool *pgxpool.Pool
+    pool      *pgxpool.Pool
+    log       *slog.Logger
+    orgs      *tenant.OrganizationStore
+    analyzer  *service.Analyzer
+    readings  *timeseries.Reader
+    generator *service.DataGenerator
 }
 
-func NewHandler(pool *pgxpool.Pool) *Handler {
+func NewHandler(pool *pgxpool.Pool, generator *service.DataGenerator, readings *timeseries.Reader) *Handler {
     rand.Seed(time.Now().UnixNano())
-    return &Handler{pool: pool}
+    return &Handler{
+        pool:      pool,
+        log:       logging.Component("api"),
+        orgs:      tenant.NewOrganizationStore(pool),
+        analyzer:  service.NewAnalyzer(pool, readings),
+        readings:  readings,
+        generator: generator,
+    }
 }
 
-// Получение всех зданий
-func (h *Handler) GetBuildings(c *gin.Context) {
-    fmt.Println("=== GetBuildings handler called ===")
+// Проверка доступа текущего пользователя к зданию (здание другой компании - 404)
+func (h *Handler) checkBuildingAccess(c *gin.Context, buildingID uuid.UUID) bool {
+    if err := h.orgs.CheckBuilding(c.Request.Context(), tenant.FromContext(c), buildingID); err != nil {
+        respondError(c, err)
+        return false
+    }
+    return true
+}
 
-    rows, err := h.pool.Query(context.Background(), 
-        "SELECT id, address, fias_id, unom_id, created_at, updated_at FROM buildings ORDER BY address")
+// Получение всех зданий. Пустая база - пустой список
+func (h *Handler) GetBuildings(c *gin.Context) {
+    ctx := c.Request.Context()
+
+    rows, err := h.pool.Query(ctx, `
+        SELECT id, address, fias_id, unom_id, organization_id, latitude, longitude, region,
+            apartments, floors, residents, year_built, area::float8, peer_group, created_at, updated_at
+        FROM buildings
+        WHERE ($1::uuid IS NULL OR organization_id = $1)
+        ORDER BY address`, tenant.FromContext(c).Arg())
     
     if err != nil {
-        fmt.Printf("Database error: %v\n", err)
-        c.JSON(http.StatusInternalServerError, gin.H{
-            "error": "Database error: " + err.Error(),
-        })
+        h.log.ErrorContext(ctx, "load buildings failed", logging.Err(err))
+        respondError(c, err)
         return
     }
     defer rows.Close()
 
-    var buildings []Building
+    buildings := []Building{}
     for rows.Next() {
         var b Building
-        err := rows.Scan(&b.ID, &b.Address, &b.FiasID, &b.UnomID, &b.CreatedAt, &b.UpdatedAt)
+        err := rows.Scan(&b.ID, &b.Address, &b.FiasID, &b.UnomID, &b.OrganizationID, &b.Latitude, &b.Longitude, &b.Region,
+            &b.Apartments, &b.Floors, &b.Residents, &b.YearBuilt, &b.Area, &b.PeerGroup, &b.CreatedAt, &b.UpdatedAt)
         if err != nil {
-            fmt.Printf("Error scanning row: %v\n", err)
-            continue
+            h.log.ErrorContext(ctx, "scan building failed", logging.Err(err))
+            respondError(c, err)
+            return
         }
         buildings = append(buildings, b)
     }
-
-    fmt.Printf("Loaded %d buildings from database\n", len(buildings))
-
-    if len(buildings) == 0 {
-        buildings = []Building{
-            {
-                ID:        uuid.MustParse("11111111-1111-1111-1111-111111111111"),
-                Address:   "ул. Ленина, д. 10",
-                FiasID:    "fias_001",
-                UnomID:    "unom_001",
-                CreatedAt: time.Now(),
-                UpdatedAt: time.Now(),
-            },
-            {
-                ID:        uuid.MustParse("22222222-2222-2222-2222-222222222222"),
-                Address:   "пр. Мира, д. 25",
-                FiasID:    "fias_002",
-                UnomID:    "unom_002", 
-                CreatedAt: time.Now(),
-                UpdatedAt: time.Now(),
-            },
-        }
-        fmt.Println("Using test data")
+    if err := rows.Err(); err != nil {
+        h.log.ErrorContext(ctx, "load buildings failed", logging.Err(err))
+        respondError(c, err)
+        return
     }
 
+    h.log.DebugContext(ctx, "buildings loaded", "count", len(buildings))
     c.JSON(http.StatusOK, buildings)
 }
 
@@ -97,21 +122,27 @@ func (h *Handler) GetBuildingByID(c *gin.Context) {
     }
 
     var building Building
-    err = h.pool.QueryRow(context.Background(), `
-        SELECT id, address, fias_id, unom_id, created_at, updated_at 
-        FROM buildings WHERE id = $1`, buildingID).Scan(
+    err = h.pool.QueryRow(c.Request.Context(), `
+        SELECT id, address, fias_id, unom_id, organization_id, latitude, longitude, region,
+            apartments, floors, residents, year_built, area::float8, peer_group, created_at, updated_at 
+        FROM buildings WHERE id = $1 AND ($2::uuid IS NULL OR organization_id = $2)`,
+        buildingID, tenant.FromContext(c).Arg()).Scan(
         &building.ID, &building.Address, &building.FiasID, 
-        &building.UnomID, &building.CreatedAt, &building.UpdatedAt)
+        &building.UnomID, &building.OrganizationID, &building.Latitude, &building.Longitude, &building.Region,
+        &building.Apartments, &building.Floors, &building.Residents, &building.YearBuilt, &building.Area, &building.PeerGroup, &building.CreatedAt, &building.UpdatedAt)
 
+    if errors.Is(err, pgx.ErrNoRows) {
+        err = tenant.ErrBuildingNotFound
+    }
     if err != nil {
-        c.JSON(http.StatusNotFound, gin.H{"error": "building not found"})
+        respondError(c, err)
         return
     }
 
     c.JSON(http.StatusOK, building)
 }
 
-// Анализ потребления с интеллектуальными предсказаниями
+// Анализ потребления здания по показаниям из БД
 func (h *Handler) AnalyzeBuilding(c *gin.Context) {
     buildingIDStr := c.Param("id")
     buildingID, err := uuid.Parse(buildingIDStr)
@@ -120,6 +151,10 @@ func (h *Handler) AnalyzeBuilding(c *gin.Context) {
         return
     }
 
+    if !h.checkBuildingAccess(c, buildingID) {
+        return
+    }
+
     // Получаем параметр дней
     daysStr := c.DefaultQuery("days", "30")
     days, err := strconv.Atoi(daysStr)
@@ -127,150 +162,395 @@ func (h *Handler) AnalyzeBuilding(c *gin.Context) {
         days = 30
     }
 
-    // Используем реальный анализатор
-    analyzer := service.NewAnalyzer(h.pool)
-    result, err := analyzer.AnalyzeConsumption(context.Background(), buildingID, days)
+    // При недостатке показаний анализ возвращает результат insufficient_data со списком отсутствующих данных
+    result, err := h.analyzer.AnalyzeConsumption(c.Request.Context(), buildingID, days)
     if err != nil {
-        // Если анализ не работает, возвращаем тестовые данные с предсказаниями
-        result = &service.ConsumptionAnalysis{
-            BuildingID:         buildingID,
-            Period:             fmt.Sprintf("%s to %s", time.Now().AddDate(0, 0, -days).Format("2006-01-02"), time.Now().Format("2006-01-02")),
-            TotalColdWater:     1500 + rand.Intn(500),
-            TotalHotWater:      1200 + rand.Intn(400),
-            Difference:         300 + rand.Intn(100),
-            DifferencePercent:  20.0 + rand.Float64()*10,
-            HotToColdRatio:     60.0 + rand.Float64()*20, // 60-80%
-            HasAnomalies:       rand.Float32() > 0.3,
-            AnomalyCount:       rand.Intn(5),
-            WaterBalanceStatus: []string{"normal", "leak", "error"}[rand.Intn(3)],
-            TemperatureStatus:  []string{"normal", "warning", "critical"}[rand.Intn(3)],
-            PumpStatus:         []string{"normal", "maintenance_soon", "maintenance_required"}[rand.Intn(3)],
-            PumpOperatingHours: 5000 + rand.Intn(7000),
-            Recommendations:    []string{"Система работает нормально", "Рекомендуется проверить насосы"},
-        }
+        respondError(c, err)
+        return
     }
 
     c.JSON(http.StatusOK, result)
 }
 
-// Данные реального времени
-// handlers.go - замените метод GetRealtimeData
+// Максимальное число зданий в пакетном анализе
+const maxBatchAnalysis = 500
 
-// Получение реальных данных из БД за последние 5 минут
-func (h *Handler) GetRealtimeData(c *gin.Context) {
-    buildingIDStr := c.Param("id")
-    buildingID, err := uuid.Parse(buildingIDStr)
+// Пакетный анализ зданий для сводки по парку.
+// GET /api/analysis?days=30&building_id=...&building_id=...
+// Без building_id анализируются все здания, доступные пользователю
+func (h *Handler) AnalyzeBuildings(c *gin.Context) {
+    ctx := c.Request.Context()
+
+    days, err := strconv.Atoi(c.DefaultQuery("days", "30"))
+    if err != nil || days <= 0 {
+        days = 30
+    }
+
+    var requested []uuid.UUID
+    seen := make(map[uuid.UUID]bool)
+    for _, s := range c.QueryArray("building_id") {
+        id, err := uuid.Parse(s)
+        if err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "invalid building ID: " + s})
+            return
+        }
+        if !seen[id] {
+            seen[id] = true
+            requested = append(requested, id)
+        }
+    }
+    if len(requested) > maxBatchAnalysis {
+        c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("too many buildings, max %d", maxBatchAnalysis)})
+        return
+    }
+
+    // Здания вне компании пользователя отбрасываются тем же запросом
+    rows, err := h.pool.Query(ctx, `
+        SELECT id FROM buildings
+        WHERE ($1::uuid IS NULL OR organization_id = $1)
+          AND (cardinality($2::uuid[]) = 0 OR id = ANY($2))
+        ORDER BY address
+        LIMIT $3`, tenant.FromContext(c).Arg(), requested, maxBatchAnalysis+1)
+    if err != nil {
+        h.log.ErrorContext(ctx, "load buildings failed", logging.Err(err))
+        respondError(c, err)
+        return
+    }
+    buildingIDs, err := pgx.CollectRows(rows, pgx.RowTo[uuid.UUID])
+    if err != nil {
+        h.log.ErrorContext(ctx, "load buildings failed", logging.Err(err))
+        respondError(c, err)
+        return
+    }
+    if len(buildingIDs) > maxBatchAnalysis {
+        c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("too many buildings, max %d; use building_id", maxBatchAnalysis)})
+        return
+    }
+    if len(requested) > 0 && len(buildingIDs) < len(requested) {
+        c.JSON(http.StatusNotFound, gin.H{"error": "building not found"})
+        return
+    }
+
+    results, err := h.analyzer.AnalyzeBuildings(ctx, buildingIDs, days)
+    if err != nil {
+        respondError(c, err)
+        return
+    }
+
+    analyses := make([]*service.ConsumptionAnalysis, 0, len(buildingIDs))
+    for _, id := range buildingIDs {
+        analyses = append(analyses, results[id])
+    }
+    c.JSON(http.StatusOK, gin.H{
+        "days":      days,
+        "count":     len(analyses),
+        "buildings": analyses,
+    })
+}
+
+// Временной ряд показателя здания.
+// GET /api/timeseries/:id?metric=hot_water&itp_id=&from=&to=&resolution=auto
+// itp_id - ряд одного ИТП (для hot_water и cold_water). Разрешение auto выбирается по длине интервала: поминутное, почасовое или суточное
+func (h *Handler) GetTimeSeries(c *gin.Context) {
+    buildingID, err := uuid.Parse(c.Param("id"))
     if err != nil {
         c.JSON(http.StatusBadRequest, gin.H{"error": "invalid building ID"})
         return
     }
 
-    // Период для реального времени - последние 5 минут
-    timeFrom := time.Now().Add(-5 * time.Minute)
+    metric := c.DefaultQuery("metric", timeseries.MetricHotWater)
+    if !timeseries.ValidMetric(metric) {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "unknown metric"})
+        return
+    }
+    resolution := c.DefaultQuery("resolution", timeseries.ResolutionAuto)
+    if !timeseries.ValidResolution(resolution) {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "resolution must be one of auto, minute, hourly, daily, monthly"})
+        return
+    }
+
+    to := time.Now()
+    if v := c.Query("to"); v != "" {
+        if to, err = time.Parse(time.RFC3339, v); err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "invalid to, expected RFC3339"})
+            return
+        }
+    }
+    from := to.Add(-24 * time.Hour)
+    if v := c.Query("from"); v != "" {
+        if from, err = time.Parse(time.RFC3339, v); err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "invalid from, expected RFC3339"})
+            return
+        }
+    }
+    if !from.Before(to) {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "from must be before to"})
+        return
+    }
 
-    // Получаем последние данные ГВС
-    var hotWaterData struct {
-        FlowRateCh1 int       `json:"flow_rate_ch1"`
-        FlowRateCh2 int       `json:"flow_rate_ch2"`
-        TotalFlow   int       `json:"total_flow"`
-        Timestamp   time.Time `json:"timestamp"`
+    if !h.checkBuildingAccess(c, buildingID) {
+        return
     }
 
-    err = h.pool.QueryRow(context.Background(), `
-        SELECT flow_rate_ch1, flow_rate_ch2, (flow_rate_ch1 + flow_rate_ch2) as total_flow, timestamp 
-        FROM hot_water_meters 
-        WHERE building_id = $1 
-        AND timestamp >= $2
-        ORDER BY timestamp DESC 
-        LIMIT 1`, 
-        buildingID, timeFrom).Scan(
-        &hotWaterData.FlowRateCh1, &hotWaterData.FlowRateCh2, &hotWaterData.TotalFlow, &hotWaterData.Timestamp)
+    // Ряд одного ИТП здания: расход ГВС или ХВС через него
+    var itpID *uuid.UUID
+    series := metric
+    if v := c.Query("itp_id"); v != "" {
+        id, err := uuid.Parse(v)
+        if err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "invalid itp_id"})
+            return
+        }
+        if metric != timeseries.MetricHotWater && metric != timeseries.MetricColdWater {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "itp_id is supported for hot_water and cold_water only"})
+            return
+        }
+        var itpBuilding uuid.UUID
+        err = h.pool.QueryRow(c.Request.Context(), "SELECT building_id FROM itp WHERE id = $1", id).Scan(&itpBuilding)
+        if errors.Is(err, pgx.ErrNoRows) || (err == nil && itpBuilding != buildingID) {
+            respondError(c, service.ErrITPNotFound)
+            return
+        }
+        if err != nil {
+            respondError(c, err)
+            return
+        }
+        itpID = &id
+        series = timeseries.ITPMetric(metric, id)
+    }
 
+    points, resolution, err := h.readings.Series(c.Request.Context(), buildingID, series, resolution, from, to)
     if err != nil {
-        // Если нет свежих данных, берем последние доступные
-        h.pool.QueryRow(context.Background(), `
-            SELECT flow_rate_ch1, flow_rate_ch2, (flow_rate_ch1 + flow_rate_ch2) as total_flow, timestamp 
-            FROM hot_water_meters 
-            WHERE building_id = $1 
-            ORDER BY timestamp DESC 
-            LIMIT 1`, 
-            buildingID).Scan(
-            &hotWaterData.FlowRateCh1, &hotWaterData.FlowRateCh2, &hotWaterData.TotalFlow, &hotWaterData.Timestamp)
+        h.log.ErrorContext(c.Request.Context(), "load time series failed", "building_id", buildingID, logging.Err(err))
+        respondError(c, err)
+        return
     }
 
-    // Получаем последние данные ХВС
-    var coldWaterData struct {
-        TotalFlowRate int       `json:"total_flow_rate"`
-        Timestamp     time.Time `json:"timestamp"`
+    c.JSON(http.StatusOK, gin.H{
+        "building_id": buildingID,
+        "metric":      metric,
+        "itp_id":      itpID,
+        "resolution":  resolution,
+        "from":        from,
+        "to":          to,
+        "points":      points,
+    })
+}
+
+// Последние показания ГВС
+type realtimeHotWater struct {
+    FlowRateCh1 float64   `json:"flow_rate_ch1"`
+    FlowRateCh2 float64   `json:"flow_rate_ch2"`
+    TotalFlow   float64   `json:"total_flow"`
+    Timestamp   time.Time `json:"timestamp"`
+}
+
+// Последнее показание ХВС
+type realtimeColdWater struct {
+    TotalFlowRate float64   `json:"total_flow_rate"`
+    Timestamp     time.Time `json:"timestamp"`
+}
+
+// Последние показания ИТП здания
+type realtimeITP struct {
+    ITPID     uuid.UUID          `json:"itp_id"`
+    ITPNumber string             `json:"itp_number"`
+    HotWater  *realtimeHotWater  `json:"hot_water"`
+    ColdWater *realtimeColdWater `json:"cold_water"`
+}
+
+// ИТП здания с последним показанием ХВС каждого
+func (h *Handler) realtimeITPs(ctx context.Context, buildingID uuid.UUID) ([]realtimeITP, error) {
+    rows, err := h.pool.Query(ctx, `
+        SELECT i.id, i.itp_number, c.flow_rate, c.timestamp
+        FROM itp i
+        LEFT JOIN LATERAL (
+            SELECT flow_rate, timestamp FROM cold_water_meters
+            WHERE itp_id = i.id
+            ORDER BY timestamp DESC
+            LIMIT 1
+        ) c ON true
+        WHERE i.building_id = $1
+        ORDER BY i.itp_number`, buildingID)
+    if err != nil {
+        return nil, err
     }
+    defer rows.Close()
 
-    err = h.pool.QueryRow(context.Background(), `
-        SELECT cwm.flow_rate, cwm.timestamp
-        FROM cold_water_meters cwm
-        JOIN itp i ON cwm.itp_id = i.id
-        WHERE i.building_id = $1 
-        AND cwm.timestamp >= $2
-        ORDER BY cwm.timestamp DESC 
-        LIMIT 1`, 
-        buildingID, timeFrom).Scan(&coldWaterData.TotalFlowRate, &coldWaterData.Timestamp)
+    itps := []realtimeITP{}
+    for rows.Next() {
+        var itp realtimeITP
+        var flowRate *float64
+        var timestamp *time.Time
+        if err := rows.Scan(&itp.ITPID, &itp.ITPNumber, &flowRate, &timestamp); err != nil {
+            return nil, fmt.Errorf("scan itp: %w", err)
+        }
+        if flowRate != nil {
+            itp.ColdWater = &realtimeColdWater{TotalFlowRate: *flowRate, Timestamp: *timestamp}
+        }
+        itps = append(itps, itp)
+    }
+    return itps, rows.Err()
+}
 
+// Последние показания каждого ОДПУ ГВС здания (по meter_key) и их сумма; nil - показаний нет
+func (h *Handler) realtimeHotWater(ctx context.Context, buildingID uuid.UUID) (*realtimeHotWater, map[string]*realtimeHotWater, error) {
+    rows, err := h.pool.Query(ctx, `
+        SELECT k.meter_key, w.flow_rate_ch1, w.flow_rate_ch2, w.timestamp
+        FROM (SELECT ''::text AS meter_key UNION ALL SELECT id::text FROM itp WHERE building_id = $1) k
+        CROSS JOIN LATERAL (
+            SELECT flow_rate_ch1, flow_rate_ch2, timestamp FROM hot_water_meters
+            WHERE building_id = $1 AND meter_key = k.meter_key
+            ORDER BY timestamp DESC
+            LIMIT 1
+        ) w`, buildingID)
     if err != nil {
-        // Если нет свежих данных, берем последние доступные
-        h.pool.QueryRow(context.Background(), `
-            SELECT cwm.flow_rate, cwm.timestamp
-            FROM cold_water_meters cwm
-            JOIN itp i ON cwm.itp_id = i.id
-            WHERE i.building_id = $1 
-            ORDER BY cwm.timestamp DESC 
-            LIMIT 1`, 
-            buildingID).Scan(&coldWaterData.TotalFlowRate, &coldWaterData.Timestamp)
-    }
-
-    // Получаем температурные данные
-    var tempData struct {
-        SupplyTemp int       `json:"supply_temp"`
-        ReturnTemp int       `json:"return_temp"`
-        DeltaTemp  int       `json:"delta_temp"`
-        Timestamp  time.Time `json:"timestamp"`
-    }
-
-    h.pool.QueryRow(context.Background(), `
+        return nil, nil, err
+    }
+    defer rows.Close()
+
+    var total *realtimeHotWater
+    byKey := make(map[string]*realtimeHotWater)
+    for rows.Next() {
+        var key string
+        var hw realtimeHotWater
+        if err := rows.Scan(&key, &hw.FlowRateCh1, &hw.FlowRateCh2, &hw.Timestamp); err != nil {
+            return nil, nil, fmt.Errorf("scan hot water: %w", err)
+        }
+        hw.TotalFlow = models.RoundFlow(hw.FlowRateCh1 + hw.FlowRateCh2)
+        byKey[key] = &hw
+
+        if total == nil {
+            total = &realtimeHotWater{}
+        }
+        total.FlowRateCh1 = models.RoundFlow(total.FlowRateCh1 + hw.FlowRateCh1)
+        total.FlowRateCh2 = models.RoundFlow(total.FlowRateCh2 + hw.FlowRateCh2)
+        total.TotalFlow = models.RoundFlow(total.TotalFlow + hw.TotalFlow)
+        if hw.Timestamp.After(total.Timestamp) {
+            total.Timestamp = hw.Timestamp
+        }
+    }
+    return total, byKey, rows.Err()
+}
+
+// Последние температурные показания
+type realtimeTemperature struct {
+    SupplyTemp float64   `json:"supply_temp"`
+    ReturnTemp float64   `json:"return_temp"`
+    DeltaTemp  float64   `json:"delta_temp"`
+    Timestamp  time.Time `json:"timestamp"`
+}
+
+// Последние показания здания из БД: сумма последних показаний всех счетчиков и показания по ИТП (itps).
+// Показателя без данных нет в ответе (null, перечислен в missing), здание без показаний - 422 insufficient_data
+func (h *Handler) GetRealtimeData(c *gin.Context) {
+    buildingIDStr := c.Param("id")
+    buildingID, err := uuid.Parse(buildingIDStr)
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "invalid building ID"})
+        return
+    }
+
+    if !h.checkBuildingAccess(c, buildingID) {
+        return
+    }
+
+    ctx := c.Request.Context()
+    missing := []string{}
+
+    // Последние данные ГВС и ХВС по каждому счетчику; показания здания - их сумма
+    itps, err := h.realtimeITPs(ctx, buildingID)
+    if err != nil {
+        respondError(c, err)
+        return
+    }
+    hotWater, byITP, err := h.realtimeHotWater(ctx, buildingID)
+    if err != nil {
+        respondError(c, err)
+        return
+    }
+    if hotWater == nil {
+        missing = append(missing, service.MissingHotWater)
+    }
+
+    var coldWater *realtimeColdWater
+    for i := range itps {
+        if len(itps) == 1 {
+            itps[i].HotWater = hotWater
+        } else {
+            itps[i].HotWater = byITP[itps[i].ITPID.String()]
+        }
+        if cw := itps[i].ColdWater; cw != nil {
+            if coldWater == nil {
+                coldWater = &realtimeColdWater{}
+            }
+            coldWater.TotalFlowRate = models.RoundFlow(coldWater.TotalFlowRate + cw.TotalFlowRate)
+            if cw.Timestamp.After(coldWater.Timestamp) {
+                coldWater.Timestamp = cw.Timestamp
+            }
+        }
+    }
+    if coldWater == nil {
+        missing = append(missing, service.MissingColdWater)
+    }
+
+    // Температурные данные
+    var temperature *realtimeTemperature
+    var t realtimeTemperature
+    err = h.pool.QueryRow(ctx, `
         SELECT supply_temp, return_temp, delta_temp, timestamp
         FROM temperature_readings 
         WHERE building_id = $1 
-        AND timestamp >= $2
         ORDER BY timestamp DESC 
         LIMIT 1`, 
-        buildingID, timeFrom.Add(-30*time.Minute)).Scan( // Температура меняется реже
-        &tempData.SupplyTemp, &tempData.ReturnTemp, &tempData.DeltaTemp, &tempData.Timestamp)
+        buildingID).Scan(&t.SupplyTemp, &t.ReturnTemp, &t.DeltaTemp, &t.Timestamp)
+    switch {
+    case errors.Is(err, pgx.ErrNoRows):
+        missing = append(missing, service.MissingTemperature)
+    case err != nil:
+        respondError(c, err)
+        return
+    default:
+        temperature = &t
+    }
 
-    // Получаем историю за последние 30 минут для графика
-    chartData, err := h.getRealtimeChartData(buildingID, 30)
+    if hotWater == nil && coldWater == nil && temperature == nil {
+        respondError(c, &service.InsufficientDataError{Missing: missing})
+        return
+    }
+
+    // История за последние 30 минут для графика
+    chartData, err := h.getRealtimeChartData(ctx, buildingID, 30)
     if err != nil {
-        fmt.Printf("Error getting chart data: %v\n", err)
+        h.log.ErrorContext(ctx, "get chart data failed", "building_id", buildingID, logging.Err(err))
+        respondError(c, err)
+        return
     }
 
     c.JSON(http.StatusOK, gin.H{
-        "hot_water": hotWaterData,
-        "cold_water": coldWaterData,
-        "temperature": tempData,
+        "hot_water": hotWater,
+        "cold_water": coldWater,
+        "temperature": temperature,
+        "itps": itps,
         "chart_data": chartData,
+        "missing": missing,
         "timestamp": time.Now(),
         "building_id": buildingID,
-        "data_source": "database",
+        "data_source": service.DataSourceDatabase,
     })
 }
 
-// Данные для графика за последние N минут
-func (h *Handler) getRealtimeChartData(buildingID uuid.UUID, minutes int) (gin.H, error) {
+// Данные для графика за последние N минут: показания всех счетчиков здания суммируются по времени
+func (h *Handler) getRealtimeChartData(ctx context.Context, buildingID uuid.UUID, minutes int) (gin.H, error) {
     timeFrom := time.Now().Add(-time.Duration(minutes) * time.Minute)
 
     // Данные ГВС
-    rows, err := h.pool.Query(context.Background(), `
-        SELECT timestamp, flow_rate_ch1, flow_rate_ch2, (flow_rate_ch1 + flow_rate_ch2) as total_flow
+    rows, err := h.pool.Query(ctx, `
+        SELECT timestamp, SUM(flow_rate_ch1)::float8, SUM(flow_rate_ch2)::float8, SUM(flow_rate_ch1 + flow_rate_ch2)::float8 as total_flow
         FROM hot_water_meters 
         WHERE building_id = $1 
         AND timestamp >= $2
+        GROUP BY timestamp
         ORDER BY timestamp ASC`,
         buildingID, timeFrom)
     
@@ -279,11 +559,13 @@ func (h *Handler) getRealtimeChartData(buildingID uuid.UUID, minutes int) (gin.H
     }
     defer rows.Close()
 
-    var hotWaterData []gin.H
+    hotWaterData := []gin.H{}
     for rows.Next() {
         var timestamp time.Time
-        var ch1, ch2, total int
-        rows.Scan(&timestamp, &ch1, &ch2, &total)
+        var ch1, ch2, total float64
+        if err := rows.Scan(&timestamp, &ch1, &ch2, &total); err != nil {
+            return nil, fmt.Errorf("scan hot water chart: %w", err)
+        }
         hotWaterData = append(hotWaterData, gin.H{
             "timestamp": timestamp.Format("15:04"),
             "ch1": ch1,
@@ -291,14 +573,18 @@ func (h *Handler) getRealtimeChartData(buildingID uuid.UUID, minutes int) (gin.H
             "total": total,
         })
     }
+    if err := rows.Err(); err != nil {
+        return nil, err
+    }
 
     // Данные ХВС
-    rows, err = h.pool.Query(context.Background(), `
-        SELECT cwm.timestamp, cwm.flow_rate
+    rows, err = h.pool.Query(ctx, `
+        SELECT cwm.timestamp, SUM(cwm.flow_rate)::float8
         FROM cold_water_meters cwm
         JOIN itp i ON cwm.itp_id = i.id
         WHERE i.building_id = $1 
         AND cwm.timestamp >= $2
+        GROUP BY cwm.timestamp
         ORDER BY cwm.timestamp ASC`,
         buildingID, timeFrom)
     
@@ -307,16 +593,21 @@ func (h *Handler) getRealtimeChartData(buildingID uuid.UUID, minutes int) (gin.H
     }
     defer rows.Close()
 
-    var coldWaterData []gin.H
+    coldWaterData := []gin.H{}
     for rows.Next() {
         var timestamp time.Time
-        var flowRate int
-        rows.Scan(&timestamp, &flowRate)
+        var flowRate float64
+        if err := rows.Scan(&timestamp, &flowRate); err != nil {
+            return nil, fmt.Errorf("scan cold water chart: %w", err)
+        }
         coldWaterData = append(coldWaterData, gin.H{
             "timestamp": timestamp.Format("15:04"),
             "flow_rate": flowRate,
         })
     }
+    if err := rows.Err(); err != nil {
+        return nil, err
+    }
 
     return gin.H{
         "hot_water": hotWaterData,
@@ -327,7 +618,7 @@ func (h *Handler) getRealtimeChartData(buildingID uuid.UUID, minutes int) (gin.H
 
 // Остальные методы...
 func (h *Handler) SeedTestData(c *gin.Context) {
-    err := h.seedTestData()
+    err := h.seedTestData(c.Request.Context())
     if err != nil {
         c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
         return
@@ -336,7 +627,10 @@ func (h *Handler) SeedTestData(c *gin.Context) {
 }
 
 func (h *Handler) StartGenerator(c *gin.Context) {
-    // В реальной реализации здесь будет запуск генератора
+    before := gin.H{"running": h.generator.IsRunning()}
+    h.generator.StartContinuousGeneration(context.Background())
+    audit.SetChange(c, before, gin.H{"running": h.generator.IsRunning()})
+
     c.JSON(http.StatusOK, gin.H{
         "status": "started", 
         "message": "Continuous data generation started",
@@ -345,7 +639,10 @@ func (h *Handler) StartGenerator(c *gin.Context) {
 }
 
 func (h *Handler) StopGenerator(c *gin.Context) {
-    // В реальной реализации здесь будет остановка генератора
+    before := gin.H{"running": h.generator.IsRunning()}
+    h.generator.Stop()
+    audit.SetChange(c, before, gin.H{"running": h.generator.IsRunning()})
+
     c.JSON(http.StatusOK, gin.H{
         "status": "stopped", 
         "message": "Continuous data generation stopped",
@@ -354,17 +651,25 @@ func (h *Handler) StopGenerator(c *gin.Context) {
 }
 
 func (h *Handler) GetGeneratorStatus(c *gin.Context) {
-    // В реальной реализации здесь будет статус генератора
+    if !h.generator.IsRunning() {
+        c.JSON(http.StatusOK, gin.H{
+            "status": "stopped",
+            "message": "Generator is stopped",
+            "last_error": h.generator.LastError(),
+            "timestamp": time.Now().Format(time.RFC3339),
+        })
+        return
+    }
+
     c.JSON(http.StatusOK, gin.H{
         "status": "running", 
         "message": "Generator is running",
+        "last_error": h.generator.LastError(),
         "timestamp": time.Now().Format(time.RFC3339),
     })
 }
 
-func (h *Handler) seedTestData() error {
-    ctx := context.Background()
-    
+func (h *Handler) seedTestData(ctx context.Context) error {
     var count int
     err := h.pool.QueryRow(ctx, "SELECT COUNT(*) FROM buildings").Scan(&count)
     if err != nil {
@@ -372,7 +677,7 @@ func (h *Handler) seedTestData() error {
     }
     
     if count > 0 {
-        fmt.Println("База данных уже содержит данные, пропускаем заполнение")
+        h.log.InfoContext(ctx, "database already has buildings, skipping seed", "count", count)
         return nil
     }
     
@@ -418,11 +723,11 @@ func (h *Handler) seedTestData() error {
             VALUES ($1, $2, $3, NOW(), NOW())`,
             itpID, fmt.Sprintf("ИТП-%s", b.unomID), b.id)
         if err != nil {
-            fmt.Printf("Warning: failed to create ITP for building %s: %v\n", b.address, err)
+            h.log.WarnContext(ctx, "create ITP failed", "building_id", b.id, logging.Err(err))
         }
     }
 
-    fmt.Println("Тестовые данные успешно добавлены")
+    h.log.InfoContext(ctx, "test data seeded", "buildings", len(buildings))
     return nil
 }
 
@@ -435,34 +740,50 @@ func (h *Handler) DebugData(c *gin.Context) {
         return
     }
 
-    // Проверяем какие данные есть в БД
+    if !h.checkBuildingAccess(c, buildingID) {
+        return
+    }
+
+    ctx := c.Request.Context()
+
+    // Проверяем какие данные есть в БД; время последнего показания null, если данных нет
     var coldWaterCount, hotWaterCount, tempCount, pumpCount int
-    var latestColdWater, latestHotWater, latestTemp, latestPump time.Time
-    
+    var latestColdWater, latestHotWater, latestTemp, latestPump *time.Time
+
+    batch := &pgx.Batch{}
     // Данные по ХВС
-    h.pool.QueryRow(context.Background(), `
+    batch.Queue(`
         SELECT COUNT(*), MAX(timestamp) 
         FROM cold_water_meters cwm
         JOIN itp i ON cwm.itp_id = i.id
-        WHERE i.building_id = $1`, buildingID).Scan(&coldWaterCount, &latestColdWater)
-    
-    // Данные по ГВС  
-    h.pool.QueryRow(context.Background(), `
+        WHERE i.building_id = $1`, buildingID).QueryRow(func(row pgx.Row) error {
+        return row.Scan(&coldWaterCount, &latestColdWater)
+    })
+    // Данные по ГВС
+    batch.Queue(`
         SELECT COUNT(*), MAX(timestamp) 
         FROM hot_water_meters 
-        WHERE building_id = $1`, buildingID).Scan(&hotWaterCount, &latestHotWater)
-
+        WHERE building_id = $1`, buildingID).QueryRow(func(row pgx.Row) error {
+        return row.Scan(&hotWaterCount, &latestHotWater)
+    })
     // Данные по температуре
-    h.pool.QueryRow(context.Background(), `
+    batch.Queue(`
         SELECT COUNT(*), MAX(timestamp) 
         FROM temperature_readings 
-        WHERE building_id = $1`, buildingID).Scan(&tempCount, &latestTemp)
-
+        WHERE building_id = $1`, buildingID).QueryRow(func(row pgx.Row) error {
+        return row.Scan(&tempCount, &latestTemp)
+    })
     // Данные по насосам
-    h.pool.QueryRow(context.Background(), `
+    batch.Queue(`
         SELECT COUNT(*), MAX(timestamp) 
         FROM pump_data 
-        WHERE building_id = $1`, buildingID).Scan(&pumpCount, &latestPump)
+        WHERE building_id = $1`, buildingID).QueryRow(func(row pgx.Row) error {
+        return row.Scan(&pumpCount, &latestPump)
+    })
+    if err := h.pool.SendBatch(ctx, batch).Close(); err != nil {
+        respondError(c, err)
+        return
+    }
 
     c.JSON(http.StatusOK, gin.H{
         "building_id": buildingID,
@@ -480,7 +801,7 @@ func (h *Handler) DebugData(c *gin.Context) {
 
 // Создание тестовых зданий
 func (h *Handler) CreateTestBuildings(c *gin.Context) {
-    ctx := context.Background()
+    ctx := c.Request.Context()
     
     // Проверяем, есть ли уже здания
     var count int
@@ -539,7 +860,7 @@ func (h *Handler) CreateTestBuildings(c *gin.Context) {
             VALUES ($1, $2, $3, NOW(), NOW())`,
             itpID, fmt.Sprintf("ИТП-%s", b.unomID), b.id)
         if err != nil {
-            fmt.Printf("Warning: failed to create ITP for building %s: %v\n", b.address, err)
+            h.log.WarnContext(ctx, "create ITP failed", "building_id", b.id, logging.Err(err))
         }
     }
 
@@ -557,7 +878,7 @@ func (h *Handler) GenerateCompleteHistoricalData(c *gin.Context) {
         days = 30
     }
 
-    ctx := context.Background()
+    ctx := c.Request.Context()
     
     // Проверяем, есть ли здания
     var buildingCount int
@@ -569,7 +890,7 @@ func (h *Handler) GenerateCompleteHistoricalData(c *gin.Context) {
     
     // Если зданий нет, создаем их
     if buildingCount == 0 {
-        fmt.Println("No buildings found, creating test buildings...")
+        h.log.InfoContext(ctx, "no buildings found, creating test buildings")
         err = h.createTestBuildings(ctx)
         if err != nil {
             c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create buildings: " + err.Error()})
@@ -578,8 +899,10 @@ func (h *Handler) GenerateCompleteHistoricalData(c *gin.Context) {
         buildingCount = 3
     }
 
+    audit.SetChange(c, nil, gin.H{"days": days, "buildings": buildingCount})
+
     // Генерируем исторические данные
-    err = h.generateHistoricalData(days)
+    err = h.generator.GenerateCompleteHistoricalData(ctx, days)
     if err != nil {
         c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
         return
@@ -643,133 +966,11 @@ func (h *Handler) createTestBuildings(ctx context.Context) error {
             VALUES ($1, $2, $3, NOW(), NOW())`,
             itpID, fmt.Sprintf("ИТП-%s", b.unomID), b.id)
         if err != nil {
-            fmt.Printf("Warning: failed to create ITP for building %s: %v\n", b.address, err)
-        }
-    }
-
-    fmt.Printf("Created %d test buildings\n", len(buildings))
-    return nil
-}
-
-func (h *Handler) generateHistoricalData(days int) error {
-    ctx := context.Background()
-    
-    // Получаем все здания
-    rows, err := h.pool.Query(ctx, "SELECT id FROM buildings")
-    if err != nil {
-        return err
-    }
-    defer rows.Close()
-
-    var buildingIDs []uuid.UUID
-    for rows.Next() {
-        var id uuid.UUID
-        if err := rows.Scan(&id); err != nil {
-            continue
-        }
-        buildingIDs = append(buildingIDs, id)
-    }
-
-    if len(buildingIDs) == 0 {
-        return fmt.Errorf("no buildings found")
-    }
-
-    baseTime := time.Now().AddDate(0, 0, -days)
-    
-    fmt.Printf("Generating historical data for %d buildings over %d days...\n", len(buildingIDs), days)
-    
-    for _, buildingID := range buildingIDs {
-        // Получаем или создаем ITP для здания
-        var itpID uuid.UUID
-        err = h.pool.QueryRow(ctx, "SELECT id FROM itp WHERE building_id = $1 LIMIT 1", buildingID).Scan(&itpID)
-        if err != nil {
-            // Создаем ITP если нет
-            itpID = uuid.New()
-            _, err = h.pool.Exec(ctx, `
-                INSERT INTO itp (id, itp_number, building_id, created_at, updated_at)
-                VALUES ($1, $2, $3, NOW(), NOW())`,
-                itpID, fmt.Sprintf("ИТП-%s", buildingID.String()[:8]), buildingID)
-            if err != nil {
-                fmt.Printf("Error creating ITP: %v\n", err)
-                continue
-            }
-        }
-
-        // Генерируем данные за каждый день
-        for i := 0; i < days; i++ {
-            currentTime := baseTime.AddDate(0, 0, i)
-            
-            // Реалистичные данные для МКД
-            hotWaterFlow1 := 2 + rand.Intn(4)  // 2-5 м³/ч
-            hotWaterFlow2 := 1 + rand.Intn(3)  // 1-3 м³/ч
-            coldWaterFlow := 3 + rand.Intn(7)  // 3-9 м³/ч
-
-            // Данные ГВС
-            _, err = h.pool.Exec(ctx, `
-                INSERT INTO hot_water_meters (id, building_id, flow_rate_ch1, flow_rate_ch2, timestamp, created_at)
-                VALUES ($1, $2, $3, $4, $5, NOW())`,
-                uuid.New(), buildingID, hotWaterFlow1, hotWaterFlow2, currentTime)
-            
-            if err != nil {
-                fmt.Printf("Error inserting hot water data: %v\n", err)
-            }
-
-            // Данные ХВС
-            _, err = h.pool.Exec(ctx, `
-                INSERT INTO cold_water_meters (id, itp_id, flow_rate, timestamp, created_at)
-                VALUES ($1, $2, $3, $4, NOW())`,
-                uuid.New(), itpID, coldWaterFlow, currentTime)
-            
-            if err != nil {
-                fmt.Printf("Error inserting cold water data: %v\n", err)
-            }
-
-            // Температурные данные (раз в день)
-            supplyTemp := 65 + rand.Intn(5)    // 65-70°C
-            returnTemp := 42 + rand.Intn(4)    // 42-46°C
-            deltaTemp := supplyTemp - returnTemp
-            
-            _, err = h.pool.Exec(ctx, `
-                INSERT INTO temperature_readings (id, building_id, supply_temp, return_temp, delta_temp, timestamp, created_at)
-                VALUES ($1, $2, $3, $4, $5, $6, NOW())`,
-                uuid.New(), buildingID, supplyTemp, returnTemp, deltaTemp, currentTime)
-            
-            if err != nil {
-                fmt.Printf("Error inserting temperature data: %v\n", err)
-            }
-
-            // Данные насосов (раз в день)
-            numPumps := 2 + rand.Intn(2) // 2-3 насоса
-            for p := 1; p <= numPumps; p++ {
-                pumpNumber := fmt.Sprintf("Pump-%d", p)
-                status := "normal"
-                operatingHours := 1000 + rand.Intn(8000) + (i * 24)
-                
-                if operatingHours > 8000 && rand.Float32() < 0.3 {
-                    status = "warning"
-                } else if operatingHours > 12000 && rand.Float32() < 0.2 {
-                    status = "critical"
-                }
-                
-                pressureInput := 2 + rand.Intn(2)
-                pressureOutput := pressureInput + 1 + rand.Intn(2)
-                vibrationLevel := rand.Intn(10)
-                
-                _, err = h.pool.Exec(ctx, `
-                    INSERT INTO pump_data (id, building_id, pump_number, status, operating_hours, 
-                                         pressure_input, pressure_output, vibration_level, timestamp, created_at)
-                    VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, NOW())`,
-                    uuid.New(), buildingID, pumpNumber, status, operatingHours, 
-                    pressureInput, pressureOutput, vibrationLevel, currentTime)
-                
-                if err != nil {
-                    fmt.Printf("Error inserting pump data: %v\n", err)
-                }
-            }
+            h.log.WarnContext(ctx, "create ITP failed", "building_id", b.id, logging.Err(err))
         }
     }
 
-    fmt.Printf("Historical data generation completed for %d days\n", days)
+    h.log.InfoContext(ctx, "test buildings created", "count", len(buildings))
     return nil
 }
 
@@ -781,7 +982,9 @@ func (h *Handler) GenerateHistory(c *gin.Context) {
         days = 30
     }
 
-    err = h.generateHistoricalData(days)
+    audit.SetChange(c, nil, gin.H{"days": days})
+
+    err = h.generator.GenerateCompleteHistoricalData(c.Request.Context(), days)
     if err != nil {
         c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
         return
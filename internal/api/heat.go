@@ -0,0 +1,210 @@
+package api
+
+import (
+    "net/http"
+    "sort"
+    "time"
+
+    "service/internal/logging"
+    "service/internal/models"
+    "service/internal/tenant"
+    "service/internal/timeseries"
+
+    "github.com/gin-gonic/gin"
+    "github.com/google/uuid"
+    "github.com/jackc/pgx/v5"
+)
+
+// Строка отчета о теплопотреблении за сутки или месяц
+type heatRow struct {
+    Bucket       time.Time `json:"bucket"`
+    HeatGcal     float64   `json:"heat_gcal"`
+    HotWaterM3   float64   `json:"hot_water_m3"`
+    SpecificHeat *float64  `json:"specific_heat"` // Гкал/м³ ГВС; null без расхода ГВС
+    AvgDeltaTemp *float64  `json:"avg_delta_temp"`
+}
+
+// Теплопотребление здания за период отчета по всем зданиям
+type buildingHeat struct {
+    BuildingID   uuid.UUID `json:"building_id"`
+    Address      string    `json:"address"`
+    HeatGcal     float64   `json:"heat_gcal"`
+    HotWaterM3   float64   `json:"hot_water_m3"`
+    SpecificHeat *float64  `json:"specific_heat"`
+}
+
+func specificHeat(heat, hotWater float64) *float64 {
+    if hotWater <= 0 {
+        return nil
+    }
+    v := models.RoundHeat(heat / hotWater)
+    return &v
+}
+
+// Интервал отчета из from/to (RFC3339); по умолчанию до текущего момента за period
+func reportRange(c *gin.Context, period time.Duration) (from, to time.Time, ok bool) {
+    var err error
+    to = time.Now()
+    if v := c.Query("to"); v != "" {
+        if to, err = time.Parse(time.RFC3339, v); err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "invalid to, expected RFC3339"})
+            return from, to, false
+        }
+    }
+    from = to.Add(-period)
+    if v := c.Query("from"); v != "" {
+        if from, err = time.Parse(time.RFC3339, v); err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "invalid from, expected RFC3339"})
+            return from, to, false
+        }
+    }
+    if !from.Before(to) {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "from must be before to"})
+        return from, to, false
+    }
+    return from, to, true
+}
+
+// Отчет о теплопотреблении здания по суткам или месяцам (UTC).
+// GET /api/heat/:id?period=daily|monthly&from=&to=
+// По умолчанию за последние 30 суток (daily) или 365 суток (monthly)
+func (h *Handler) BuildingHeatReport(c *gin.Context) {
+    buildingID, err := uuid.Parse(c.Param("id"))
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "invalid building ID"})
+        return
+    }
+
+    period := c.DefaultQuery("period", timeseries.ResolutionDaily)
+    span := 30 * 24 * time.Hour
+    switch period {
+    case timeseries.ResolutionDaily:
+    case timeseries.ResolutionMonthly:
+        span = 365 * 24 * time.Hour
+    default:
+        c.JSON(http.StatusBadRequest, gin.H{"error": "period must be daily or monthly"})
+        return
+    }
+    from, to, ok := reportRange(c, span)
+    if !ok {
+        return
+    }
+
+    if !h.checkBuildingAccess(c, buildingID) {
+        return
+    }
+
+    ctx := c.Request.Context()
+    series := make(map[string][]timeseries.Point)
+    for _, metric := range []string{timeseries.MetricHeatEnergy, timeseries.MetricHotVolume, timeseries.MetricDeltaTemp} {
+        points, _, err := h.readings.Series(ctx, buildingID, metric, period, from, to)
+        if err != nil {
+            h.log.ErrorContext(ctx, "load heat report failed", "building_id", buildingID, logging.Err(err))
+            respondError(c, err)
+            return
+        }
+        series[metric] = points
+    }
+
+    rows := make(map[time.Time]*heatRow)
+    row := func(bucket time.Time) *heatRow {
+        if rows[bucket] == nil {
+            rows[bucket] = &heatRow{Bucket: bucket}
+        }
+        return rows[bucket]
+    }
+    for _, p := range series[timeseries.MetricHeatEnergy] {
+        row(p.Bucket).HeatGcal = models.RoundHeat(p.Sum)
+    }
+    for _, p := range series[timeseries.MetricHotVolume] {
+        row(p.Bucket).HotWaterM3 = models.RoundFlow(p.Sum)
+    }
+    for _, p := range series[timeseries.MetricDeltaTemp] {
+        avg := models.RoundTemp(p.Avg)
+        row(p.Bucket).AvgDeltaTemp = &avg
+    }
+
+    report := make([]heatRow, 0, len(rows))
+    var totalHeat, totalHotWater float64
+    for _, r := range rows {
+        r.SpecificHeat = specificHeat(r.HeatGcal, r.HotWaterM3)
+        totalHeat += r.HeatGcal
+        totalHotWater += r.HotWaterM3
+        report = append(report, *r)
+    }
+    sort.Slice(report, func(i, j int) bool { return report[i].Bucket.Before(report[j].Bucket) })
+
+    c.JSON(http.StatusOK, gin.H{
+        "building_id":   buildingID,
+        "period":        period,
+        "from":          from,
+        "to":            to,
+        "heat_gcal":     models.RoundHeat(totalHeat),
+        "hot_water_m3":  models.RoundFlow(totalHotWater),
+        "specific_heat": specificHeat(totalHeat, totalHotWater),
+        "rows":          report,
+    })
+}
+
+// Теплопотребление всех доступных зданий за период, по убыванию энергии.
+// GET /api/heat?from=&to= (по умолчанию за последние 30 суток)
+func (h *Handler) HeatReport(c *gin.Context) {
+    from, to, ok := reportRange(c, 30*24*time.Hour)
+    if !ok {
+        return
+    }
+
+    ctx := c.Request.Context()
+    rows, err := h.pool.Query(ctx, `
+        SELECT id, address FROM buildings
+        WHERE ($1::uuid IS NULL OR organization_id = $1)
+        ORDER BY address`, tenant.FromContext(c).Arg())
+    if err != nil {
+        respondError(c, err)
+        return
+    }
+    buildings, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (buildingHeat, error) {
+        var b buildingHeat
+        err := row.Scan(&b.BuildingID, &b.Address)
+        return b, err
+    })
+    if err != nil {
+        respondError(c, err)
+        return
+    }
+
+    // Агрегаты читаются пакетами, как в пакетном анализе
+    var totalHeat, totalHotWater float64
+    for start := 0; start < len(buildings); start += maxBatchAnalysis {
+        chunk := buildings[start:min(start+maxBatchAnalysis, len(buildings))]
+        ids := make([]uuid.UUID, len(chunk))
+        for i, b := range chunk {
+            ids[i] = b.BuildingID
+        }
+        stats, err := h.readings.Aggregate(ctx, ids, from, to, timeseries.MetricHeatEnergy, timeseries.MetricHotVolume)
+        if err != nil {
+            h.log.ErrorContext(ctx, "load heat report failed", logging.Err(err))
+            respondError(c, err)
+            return
+        }
+        for i := range chunk {
+            b := &chunk[i]
+            b.HeatGcal = models.RoundHeat(stats[b.BuildingID][timeseries.MetricHeatEnergy].Sum)
+            b.HotWaterM3 = models.RoundFlow(stats[b.BuildingID][timeseries.MetricHotVolume].Sum)
+            b.SpecificHeat = specificHeat(b.HeatGcal, b.HotWaterM3)
+            totalHeat += b.HeatGcal
+            totalHotWater += b.HotWaterM3
+        }
+    }
+    sort.SliceStable(buildings, func(i, j int) bool { return buildings[i].HeatGcal > buildings[j].HeatGcal })
+
+    c.JSON(http.StatusOK, gin.H{
+        "from":          from,
+        "to":            to,
+        "count":         len(buildings),
+        "heat_gcal":     models.RoundHeat(totalHeat),
+        "hot_water_m3":  models.RoundFlow(totalHotWater),
+        "specific_heat": specificHeat(totalHeat, totalHotWater),
+        "buildings":     buildings,
+    })
+}
@@ -0,0 +1,364 @@
+package api
+
+import (
+    "errors"
+    "net/http"
+    "time"
+
+    "service/internal/auth"
+    "service/internal/models"
+    "service/internal/service"
+    "service/internal/tenant"
+
+    "github.com/gin-gonic/gin"
+    "github.com/google/uuid"
+)
+
+// Максимальное число показаний в одном запросе
+const maxIngestBatch = 1000
+
+// IngestHandler - прием показаний от шлюзов телеметрии по API ключу
+type IngestHandler struct {
+    ingestor *service.Ingestor
+    orgs     *tenant.OrganizationStore
+}
+
+func NewIngestHandler(ingestor *service.Ingestor, orgs *tenant.OrganizationStore) *IngestHandler {
+    return &IngestHandler{ingestor: ingestor, orgs: orgs}
+}
+
+// itp_id - ИТП, через который подается ГВС, если в здании несколько ОДПУ ГВС
+type hotWaterReading struct {
+    BuildingID  uuid.UUID  `json:"building_id" binding:"required"`
+    ITPID       *uuid.UUID `json:"itp_id"`
+    FlowRateCh1 float64    `json:"flow_rate_ch1" binding:"min=0"`
+    FlowRateCh2 float64    `json:"flow_rate_ch2" binding:"min=0"`
+    Timestamp   time.Time  `json:"timestamp" binding:"required"`
+}
+
+type coldWaterReading struct {
+    ITPID     uuid.UUID `json:"itp_id" binding:"required"`
+    FlowRate  float64   `json:"flow_rate" binding:"min=0"`
+    Timestamp time.Time `json:"timestamp" binding:"required"`
+}
+
+type temperatureReading struct {
+    BuildingID uuid.UUID `json:"building_id" binding:"required"`
+    SupplyTemp float64   `json:"supply_temp"`
+    ReturnTemp float64   `json:"return_temp"`
+    DeltaTemp  float64   `json:"delta_temp"`
+    Timestamp  time.Time `json:"timestamp" binding:"required"`
+}
+
+// Накопительное показание канала ОДПУ ГВС
+type hotWaterTotal struct {
+    BuildingID uuid.UUID  `json:"building_id" binding:"required"`
+    ITPID      *uuid.UUID `json:"itp_id"`
+    Channel    string     `json:"channel" binding:"required,oneof=ch1 ch2"`
+    Total      float64    `json:"total" binding:"min=0"`
+    Capacity   *float64   `json:"capacity" binding:"omitempty,gt=0"`
+    Timestamp  time.Time  `json:"timestamp" binding:"required"`
+}
+
+// Накопительное показание счетчика ХВС в ИТП
+type coldWaterTotal struct {
+    ITPID     uuid.UUID `json:"itp_id" binding:"required"`
+    Total     float64   `json:"total" binding:"min=0"`
+    Capacity  *float64  `json:"capacity" binding:"omitempty,gt=0"`
+    Timestamp time.Time `json:"timestamp" binding:"required"`
+}
+
+type pumpReading struct {
+    BuildingID     uuid.UUID `json:"building_id" binding:"required"`
+    PumpNumber     string    `json:"pump_number" binding:"required"`
+    Status         string    `json:"status" binding:"required,oneof=normal warning critical"`
+    OperatingHours int       `json:"operating_hours" binding:"min=0"`
+    PressureInput  int       `json:"pressure_input"`
+    PressureOutput int       `json:"pressure_output"`
+    VibrationLevel int       `json:"vibration_level" binding:"min=0"`
+    Timestamp      time.Time `json:"timestamp" binding:"required"`
+}
+
+// Разбор массива показаний из тела запроса
+func bindReadings[T any](c *gin.Context, readings *[]T) bool {
+    if err := c.ShouldBindJSON(readings); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "invalid readings: " + err.Error()})
+        return false
+    }
+    if len(*readings) == 0 || len(*readings) > maxIngestBatch {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "readings count must be between 1 and 1000"})
+        return false
+    }
+    return true
+}
+
+func forbiddenObject(c *gin.Context, kind string, id uuid.UUID) {
+    c.JSON(http.StatusForbidden, gin.H{
+        "error": "api key is not allowed to write data for this " + kind,
+        kind:    id,
+    })
+}
+
+// Проверка, что здание принадлежит компании ключа. checked - кэш в пределах запроса
+func (h *IngestHandler) tenantAllows(c *gin.Context, key *auth.APIKey, buildingID uuid.UUID, checked map[uuid.UUID]bool) bool {
+    if key.OrganizationID == nil {
+        return true
+    }
+    if allowed, ok := checked[buildingID]; ok {
+        return allowed
+    }
+
+    err := h.orgs.CheckBuilding(c.Request.Context(), tenant.ForOrganization(*key.OrganizationID), buildingID)
+    if err != nil && !errors.Is(err, tenant.ErrBuildingNotFound) {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error: " + err.Error()})
+        c.Abort()
+        return false
+    }
+    checked[buildingID] = err == nil
+    return err == nil
+}
+
+// Полная проверка доступа ключа к зданию. Если ответ уже записан, возвращает false
+func (h *IngestHandler) allowBuilding(c *gin.Context, key *auth.APIKey, buildingID uuid.UUID, checked map[uuid.UUID]bool) bool {
+    if !key.AllowsBuilding(buildingID) || !h.tenantAllows(c, key, buildingID, checked) {
+        if !c.IsAborted() {
+            forbiddenObject(c, "building_id", buildingID)
+        }
+        return false
+    }
+    return true
+}
+
+// Проверка доступа ключа к ИТП; здание ИТП запоминается в itpBuildings.
+// Если ответ уже записан, возвращает false
+func (h *IngestHandler) allowITP(c *gin.Context, key *auth.APIKey, itpID uuid.UUID, itpBuildings map[uuid.UUID]uuid.UUID, checked map[uuid.UUID]bool) bool {
+    buildingID, ok := itpBuildings[itpID]
+    if !ok {
+        var err error
+        buildingID, err = h.ingestor.ITPBuilding(c.Request.Context(), itpID)
+        if errors.Is(err, service.ErrITPNotFound) {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "unknown itp_id", "itp_id": itpID})
+            return false
+        }
+        if err != nil {
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error: " + err.Error()})
+            return false
+        }
+        itpBuildings[itpID] = buildingID
+    }
+
+    if !key.AllowsITP(itpID, buildingID) || !h.tenantAllows(c, key, buildingID, checked) {
+        if !c.IsAborted() {
+            forbiddenObject(c, "itp_id", itpID)
+        }
+        return false
+    }
+    return true
+}
+
+// Проверка ИТП показания ОДПУ ГВС: ИТП должен быть в том же здании. Возвращает meter_key показания.
+// Если ответ уже записан, ok = false
+func (h *IngestHandler) hotWaterMeterKey(c *gin.Context, key *auth.APIKey, buildingID uuid.UUID, itpID *uuid.UUID, itpBuildings map[uuid.UUID]uuid.UUID, checked map[uuid.UUID]bool) (string, bool) {
+    if itpID == nil {
+        return "", true
+    }
+    if !h.allowITP(c, key, *itpID, itpBuildings, checked) {
+        return "", false
+    }
+    if itpBuildings[*itpID] != buildingID {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "itp_id does not belong to the building", "itp_id": *itpID})
+        return "", false
+    }
+    return itpID.String(), true
+}
+
+func ingestResult(c *gin.Context, received, inserted int, err error) {
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+    c.JSON(http.StatusAccepted, gin.H{
+        "received":   received,
+        "inserted":   inserted,
+        "duplicates": received - inserted,
+    })
+}
+
+// POST /api/ingest/hot-water
+func (h *IngestHandler) IngestHotWater(c *gin.Context) {
+    var req []hotWaterReading
+    if !bindReadings(c, &req) {
+        return
+    }
+
+    key := auth.APIKeyFromContext(c)
+    checked := make(map[uuid.UUID]bool)
+    itpBuildings := make(map[uuid.UUID]uuid.UUID)
+    readings := make([]models.HotWaterMeter, 0, len(req))
+    for _, r := range req {
+        if !h.allowBuilding(c, key, r.BuildingID, checked) {
+            return
+        }
+        meterKey, ok := h.hotWaterMeterKey(c, key, r.BuildingID, r.ITPID, itpBuildings, checked)
+        if !ok {
+            return
+        }
+        readings = append(readings, models.HotWaterMeter{
+            BuildingID:  r.BuildingID,
+            FlowRateCh1: r.FlowRateCh1,
+            FlowRateCh2: r.FlowRateCh2,
+            MeterKey:    meterKey,
+            Timestamp:   r.Timestamp,
+        })
+    }
+
+    inserted, err := h.ingestor.InsertHotWater(c.Request.Context(), readings)
+    ingestResult(c, len(readings), inserted, err)
+}
+
+// POST /api/ingest/cold-water
+func (h *IngestHandler) IngestColdWater(c *gin.Context) {
+    var req []coldWaterReading
+    if !bindReadings(c, &req) {
+        return
+    }
+
+    key := auth.APIKeyFromContext(c)
+    checked := make(map[uuid.UUID]bool)
+    itpBuildings := make(map[uuid.UUID]uuid.UUID)
+    readings := make([]models.ColdWaterMeter, 0, len(req))
+    for _, r := range req {
+        if !h.allowITP(c, key, r.ITPID, itpBuildings, checked) {
+            return
+        }
+        readings = append(readings, models.ColdWaterMeter{
+            ITPID:     r.ITPID,
+            FlowRate:  r.FlowRate,
+            Timestamp: r.Timestamp,
+        })
+    }
+
+    inserted, err := h.ingestor.InsertColdWater(c.Request.Context(), readings, itpBuildings)
+    ingestResult(c, len(readings), inserted, err)
+}
+
+// POST /api/ingest/temperature
+func (h *IngestHandler) IngestTemperature(c *gin.Context) {
+    var req []temperatureReading
+    if !bindReadings(c, &req) {
+        return
+    }
+
+    key := auth.APIKeyFromContext(c)
+    checked := make(map[uuid.UUID]bool)
+    readings := make([]models.TemperatureReading, 0, len(req))
+    for _, r := range req {
+        if !h.allowBuilding(c, key, r.BuildingID, checked) {
+            return
+        }
+        readings = append(readings, models.TemperatureReading{
+            BuildingID: r.BuildingID,
+            SupplyTemp: r.SupplyTemp,
+            ReturnTemp: r.ReturnTemp,
+            DeltaTemp:  r.DeltaTemp,
+            Timestamp:  r.Timestamp,
+        })
+    }
+
+    inserted, err := h.ingestor.InsertTemperature(c.Request.Context(), readings)
+    ingestResult(c, len(readings), inserted, err)
+}
+
+// POST /api/ingest/pumps
+func (h *IngestHandler) IngestPumpData(c *gin.Context) {
+    var req []pumpReading
+    if !bindReadings(c, &req) {
+        return
+    }
+
+    key := auth.APIKeyFromContext(c)
+    checked := make(map[uuid.UUID]bool)
+    readings := make([]models.PumpData, 0, len(req))
+    for _, r := range req {
+        if !h.allowBuilding(c, key, r.BuildingID, checked) {
+            return
+        }
+        readings = append(readings, models.PumpData{
+            BuildingID:     r.BuildingID,
+            PumpNumber:     r.PumpNumber,
+            Status:         r.Status,
+            OperatingHours: r.OperatingHours,
+            PressureInput:  r.PressureInput,
+            PressureOutput: r.PressureOutput,
+            VibrationLevel: r.VibrationLevel,
+            Timestamp:      r.Timestamp,
+        })
+    }
+
+    inserted, err := h.ingestor.InsertPumpData(c.Request.Context(), readings)
+    ingestResult(c, len(readings), inserted, err)
+}
+
+// POST /api/ingest/hot-water/totals - накопительные показания каналов ОДПУ ГВС
+func (h *IngestHandler) IngestHotWaterTotals(c *gin.Context) {
+    var req []hotWaterTotal
+    if !bindReadings(c, &req) {
+        return
+    }
+
+    key := auth.APIKeyFromContext(c)
+    checked := make(map[uuid.UUID]bool)
+    itpBuildings := make(map[uuid.UUID]uuid.UUID)
+    readings := make([]models.TotalizerReading, 0, len(req))
+    for _, r := range req {
+        if !h.allowBuilding(c, key, r.BuildingID, checked) {
+            return
+        }
+        meterKey, ok := h.hotWaterMeterKey(c, key, r.BuildingID, r.ITPID, itpBuildings, checked)
+        if !ok {
+            return
+        }
+        readings = append(readings, models.TotalizerReading{
+            BuildingID: r.BuildingID,
+            Source:     service.TotalizerHotWater,
+            MeterKey:   meterKey,
+            Channel:    r.Channel,
+            Total:      r.Total,
+            Capacity:   r.Capacity,
+            Timestamp:  r.Timestamp,
+        })
+    }
+
+    inserted, err := h.ingestor.InsertTotals(c.Request.Context(), readings)
+    ingestResult(c, len(readings), inserted, err)
+}
+
+// POST /api/ingest/cold-water/totals - накопительные показания счетчиков ХВС
+func (h *IngestHandler) IngestColdWaterTotals(c *gin.Context) {
+    var req []coldWaterTotal
+    if !bindReadings(c, &req) {
+        return
+    }
+
+    key := auth.APIKeyFromContext(c)
+    checked := make(map[uuid.UUID]bool)
+    itpBuildings := make(map[uuid.UUID]uuid.UUID)
+    readings := make([]models.TotalizerReading, 0, len(req))
+    for _, r := range req {
+        if !h.allowITP(c, key, r.ITPID, itpBuildings, checked) {
+            return
+        }
+        readings = append(readings, models.TotalizerReading{
+            BuildingID: itpBuildings[r.ITPID],
+            Source:     service.TotalizerColdWater,
+            MeterKey:   r.ITPID.String(),
+            Channel:    service.ColdWaterChannel,
+            Total:      r.Total,
+            Capacity:   r.Capacity,
+            Timestamp:  r.Timestamp,
+        })
+    }
+
+    inserted, err := h.ingestor.InsertTotals(c.Request.Context(), readings)
+    ingestResult(c, len(readings), inserted, err)
+}
@@ -0,0 +1,303 @@
+package api
+
+import (
+    "errors"
+    "net/http"
+    "time"
+
+    "service/internal/audit"
+    "service/internal/meter"
+    "service/internal/models"
+    "service/internal/service"
+    "service/internal/tenant"
+
+    "github.com/gin-gonic/gin"
+    "github.com/google/uuid"
+)
+
+// MeterHandler - реестр приборов учета: паспорт, поверка и замена счетчиков
+type MeterHandler struct {
+    meters   *meter.Store
+    ingestor *service.Ingestor
+    orgs     *tenant.OrganizationStore
+}
+
+func NewMeterHandler(meters *meter.Store, ingestor *service.Ingestor, orgs *tenant.OrganizationStore) *MeterHandler {
+    return &MeterHandler{meters: meters, ingestor: ingestor, orgs: orgs}
+}
+
+// Регистрация счетчика. itp_id обязателен для ХВС, для ОДПУ ГВС - ИТП, через который подается
+// горячая вода, если в здании несколько ИТП; датчики температуры к ИТП не привязываются
+type createMeterRequest struct {
+    Type            string            `json:"type" binding:"required,oneof=hot_water cold_water temperature"`
+    ITPID           *uuid.UUID        `json:"itp_id"`
+    SerialNumber    string            `json:"serial_number" binding:"max=64"`
+    Manufacturer    string            `json:"manufacturer" binding:"max=128"`
+    Model           string            `json:"model" binding:"max=128"`
+    Channels        map[string]string `json:"channels"`
+    Unit            string            `json:"unit" binding:"max=16"`
+    InstalledAt     *time.Time        `json:"installed_at"`
+    VerifiedAt      *string           `json:"verified_at" binding:"omitempty,datetime=2006-01-02"`
+    VerificationDue *string           `json:"verification_due" binding:"omitempty,datetime=2006-01-02"`
+}
+
+// Изменение паспорта: переданные поля заменяют текущие
+type updateMeterRequest struct {
+    SerialNumber    *string           `json:"serial_number" binding:"omitempty,max=64"`
+    Manufacturer    *string           `json:"manufacturer" binding:"omitempty,max=128"`
+    Model           *string           `json:"model" binding:"omitempty,max=128"`
+    Channels        map[string]string `json:"channels"`
+    Unit            *string           `json:"unit" binding:"omitempty,min=1,max=16"`
+    VerifiedAt      *string           `json:"verified_at" binding:"omitempty,datetime=2006-01-02"`
+    VerificationDue *string           `json:"verification_due" binding:"omitempty,datetime=2006-01-02"`
+}
+
+// Накопленное значение канала при замене: для регистров накопительных показаний
+type replacementTotal struct {
+    Channel  string   `json:"channel" binding:"omitempty,oneof=ch1 ch2"`
+    OldTotal *float64 `json:"old_total" binding:"omitempty,min=0"`
+    NewTotal float64  `json:"new_total" binding:"min=0"`
+}
+
+// Замена счетчика: паспорт нового счетчика и, для накопительных показаний, итоги по каналам
+type replaceMeterRequest struct {
+    ReplacedAt      time.Time          `json:"replaced_at" binding:"required"`
+    SerialNumber    string             `json:"serial_number" binding:"max=64"`
+    Manufacturer    string             `json:"manufacturer" binding:"max=128"`
+    Model           string             `json:"model" binding:"max=128"`
+    Channels        map[string]string  `json:"channels"`
+    Unit            string             `json:"unit" binding:"max=16"`
+    VerifiedAt      *string            `json:"verified_at" binding:"omitempty,datetime=2006-01-02"`
+    VerificationDue *string            `json:"verification_due" binding:"omitempty,datetime=2006-01-02"`
+    Totals          []replacementTotal `json:"totals" binding:"omitempty,dive"`
+}
+
+// Даты в формате 2006-01-02 сравниваются как строки
+func verificationOrderValid(verifiedAt, due *string) bool {
+    return verifiedAt == nil || due == nil || *verifiedAt < *due
+}
+
+// Ответ на ошибку реестра: конфликт состояния - 409, некорректные данные - 400
+func respondMeterError(c *gin.Context, err error) {
+    switch {
+    case errors.Is(err, meter.ErrNotActive), errors.Is(err, meter.ErrActiveExists):
+        c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+    case errors.Is(err, meter.ErrUnknownITP), errors.Is(err, meter.ErrInvalidChannels),
+        errors.Is(err, meter.ErrReplacedBeforeInstall):
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+    default:
+        respondError(c, err)
+    }
+}
+
+func parseMeterID(c *gin.Context) (uuid.UUID, bool) {
+    id, err := uuid.Parse(c.Param("id"))
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "invalid meter ID"})
+        return uuid.Nil, false
+    }
+    return id, true
+}
+
+// GET /api/buildings/:id/meters?all=true - счетчики здания; all - вместе с замененными
+func (h *MeterHandler) ListMeters(c *gin.Context) {
+    buildingID, err := uuid.Parse(c.Param("id"))
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "invalid building ID"})
+        return
+    }
+
+    meters, err := h.meters.List(c.Request.Context(), tenant.FromContext(c).Arg(), buildingID, c.Query("all") == "true")
+    if err != nil {
+        respondError(c, err)
+        return
+    }
+    c.JSON(http.StatusOK, gin.H{"building_id": buildingID, "meters": meters})
+}
+
+// GET /api/meters/:id/history - все счетчики, стоявшие на месте установки, от первого к действующему
+func (h *MeterHandler) MeterHistory(c *gin.Context) {
+    id, ok := parseMeterID(c)
+    if !ok {
+        return
+    }
+
+    history, err := h.meters.History(c.Request.Context(), tenant.FromContext(c).Arg(), id)
+    if err != nil {
+        respondError(c, err)
+        return
+    }
+    c.JSON(http.StatusOK, gin.H{"meter_id": id, "history": history})
+}
+
+// POST /api/buildings/:id/meters - регистрация счетчика на свободном месте установки
+func (h *MeterHandler) CreateMeter(c *gin.Context) {
+    buildingID, err := uuid.Parse(c.Param("id"))
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "invalid building ID"})
+        return
+    }
+    var req createMeterRequest
+    if err := c.ShouldBindJSON(&req); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "invalid meter: " + err.Error()})
+        return
+    }
+    if req.Type == meter.TypeColdWater && req.ITPID == nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "itp_id is required for cold_water meters"})
+        return
+    }
+    if req.Type == meter.TypeTemperature && req.ITPID != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "itp_id is not allowed for temperature sensors"})
+        return
+    }
+    if !verificationOrderValid(req.VerifiedAt, req.VerificationDue) {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "verification_due must be after verified_at"})
+        return
+    }
+
+    ctx := c.Request.Context()
+    if err := h.orgs.CheckBuilding(ctx, tenant.FromContext(c), buildingID); err != nil {
+        respondError(c, err)
+        return
+    }
+
+    created, err := h.meters.Create(ctx, meter.Meter{
+        BuildingID:      buildingID,
+        ITPID:           req.ITPID,
+        Type:            req.Type,
+        SerialNumber:    req.SerialNumber,
+        Manufacturer:    req.Manufacturer,
+        Model:           req.Model,
+        Channels:        req.Channels,
+        Unit:            req.Unit,
+        InstalledAt:     req.InstalledAt,
+        VerifiedAt:      req.VerifiedAt,
+        VerificationDue: req.VerificationDue,
+    })
+    if err != nil {
+        respondMeterError(c, err)
+        return
+    }
+
+    audit.SetTarget(c, "meter", created.ID.String())
+    audit.SetChange(c, nil, created)
+    c.JSON(http.StatusCreated, created)
+}
+
+// PATCH /api/meters/:id - паспортные данные и поверка счетчика
+func (h *MeterHandler) UpdateMeter(c *gin.Context) {
+    id, ok := parseMeterID(c)
+    if !ok {
+        return
+    }
+    var req updateMeterRequest
+    if err := c.ShouldBindJSON(&req); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "invalid meter: " + err.Error()})
+        return
+    }
+    if !verificationOrderValid(req.VerifiedAt, req.VerificationDue) {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "verification_due must be after verified_at"})
+        return
+    }
+
+    before, after, err := h.meters.Update(c.Request.Context(), tenant.FromContext(c).Arg(), id, meter.Passport{
+        SerialNumber:    req.SerialNumber,
+        Manufacturer:    req.Manufacturer,
+        Model:           req.Model,
+        Channels:        req.Channels,
+        Unit:            req.Unit,
+        VerifiedAt:      req.VerifiedAt,
+        VerificationDue: req.VerificationDue,
+    })
+    if err != nil {
+        respondMeterError(c, err)
+        return
+    }
+    audit.SetChange(c, before, after)
+    c.JSON(http.StatusOK, after)
+}
+
+// POST /api/meters/:id/replace - замена счетчика. Для счетчиков воды с накопительными показаниями
+// передаются итоги по каналам (totals), чтобы расход первого интервала после замены считался от нового счетчика
+func (h *MeterHandler) ReplaceMeter(c *gin.Context) {
+    id, ok := parseMeterID(c)
+    if !ok {
+        return
+    }
+    var req replaceMeterRequest
+    if err := c.ShouldBindJSON(&req); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "invalid replacement: " + err.Error()})
+        return
+    }
+    if !verificationOrderValid(req.VerifiedAt, req.VerificationDue) {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "verification_due must be after verified_at"})
+        return
+    }
+
+    ctx := c.Request.Context()
+    orgID := tenant.FromContext(c).Arg()
+    before, err := h.meters.Get(ctx, orgID, id)
+    if err != nil {
+        respondError(c, err)
+        return
+    }
+    if before.Status != meter.StatusActive {
+        respondMeterError(c, meter.ErrNotActive)
+        return
+    }
+    if before.InstalledAt != nil && !req.ReplacedAt.After(*before.InstalledAt) {
+        respondMeterError(c, meter.ErrReplacedBeforeInstall)
+        return
+    }
+    if len(req.Totals) > 0 && before.Type == meter.TypeTemperature {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "totals are not applicable to temperature sensors"})
+        return
+    }
+    for _, t := range req.Totals {
+        if before.Type == meter.TypeHotWater && t.Channel == "" {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "channel is required for hot_water totals"})
+            return
+        }
+    }
+
+    // Замена в регистрах накопительных показаний повторяемая, поэтому выполняется первой:
+    // при ошибке замены в реестре запрос можно повторить целиком
+    for _, t := range req.Totals {
+        replacement := models.MeterReplacement{
+            BuildingID: before.BuildingID,
+            Source:     before.Type,
+            Channel:    t.Channel,
+            ReplacedAt: req.ReplacedAt,
+            OldTotal:   t.OldTotal,
+            NewTotal:   t.NewTotal,
+        }
+        if before.ITPID != nil {
+            replacement.MeterKey = before.ITPID.String()
+        }
+        if before.Type == meter.TypeColdWater {
+            replacement.Channel = service.ColdWaterChannel
+        }
+        if err := h.ingestor.RecordReplacement(ctx, replacement); err != nil {
+            respondError(c, err)
+            return
+        }
+    }
+
+    old, installed, err := h.meters.Replace(ctx, orgID, id, req.ReplacedAt, meter.Meter{
+        SerialNumber:    req.SerialNumber,
+        Manufacturer:    req.Manufacturer,
+        Model:           req.Model,
+        Channels:        req.Channels,
+        Unit:            req.Unit,
+        VerifiedAt:      req.VerifiedAt,
+        VerificationDue: req.VerificationDue,
+    })
+    if err != nil {
+        respondMeterError(c, err)
+        return
+    }
+
+    result := gin.H{"replaced": old, "installed": installed}
+    audit.SetChange(c, before, result)
+    c.JSON(http.StatusCreated, result)
+}
@@ -0,0 +1,316 @@
+package api
+
+import (
+    "errors"
+    "net/http"
+    "strconv"
+
+    "service/internal/audit"
+    "service/internal/incident"
+    "service/internal/network"
+    "service/internal/service"
+    "service/internal/tenant"
+
+    "github.com/gin-gonic/gin"
+    "github.com/google/uuid"
+)
+
+// NetworkHandler - топология тепловой сети (источник -> ЦТП -> ИТП), координаты зданий,
+// сводный анализ по узлам и ситуации
+type NetworkHandler struct {
+    nodes     *network.Store
+    analyzer  *service.Analyzer
+    incidents *incident.Store
+    orgs      *tenant.OrganizationStore
+}
+
+func NewNetworkHandler(nodes *network.Store, analyzer *service.Analyzer, incidents *incident.Store, orgs *tenant.OrganizationStore) *NetworkHandler {
+    return &NetworkHandler{nodes: nodes, analyzer: analyzer, incidents: incidents, orgs: orgs}
+}
+
+// Узел сети. parent_id - источник, от которого питается ЦТП
+type nodeRequest struct {
+    Type     string     `json:"type" binding:"required,oneof=source ctp"`
+    Name     string     `json:"name" binding:"required,max=256"`
+    Address  string     `json:"address" binding:"max=512"`
+    ParentID *uuid.UUID `json:"parent_id"`
+}
+
+// Изменение узла: тип узла не меняется
+type updateNodeRequest struct {
+    Name     string     `json:"name" binding:"required,max=256"`
+    Address  string     `json:"address" binding:"max=512"`
+    ParentID *uuid.UUID `json:"parent_id"`
+}
+
+// Подключение ИТП: node_id null - отключить от сети
+type connectITPRequest struct {
+    NodeID *uuid.UUID `json:"node_id"`
+}
+
+// Координаты здания (WGS 84); null в обоих полях - удалить координаты
+type locationRequest struct {
+    Latitude  *float64 `json:"latitude" binding:"required_with=Longitude,omitempty,min=-90,max=90"`
+    Longitude *float64 `json:"longitude" binding:"required_with=Latitude,omitempty,min=-180,max=180"`
+}
+
+// Ответ на ошибку топологии: недопустимый родитель - 400, удаление источника с ЦТП - 409
+func respondNetworkError(c *gin.Context, err error) {
+    switch {
+    case errors.Is(err, network.ErrInvalidParent):
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+    case errors.Is(err, network.ErrHasChildren):
+        c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+    default:
+        respondError(c, err)
+    }
+}
+
+func parseNodeID(c *gin.Context) (uuid.UUID, bool) {
+    id, err := uuid.Parse(c.Param("id"))
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "invalid node ID"})
+        return uuid.Nil, false
+    }
+    return id, true
+}
+
+// GET /api/network/nodes - узлы сети с числом подключенных ИТП и зданий компании пользователя
+func (h *NetworkHandler) ListNodes(c *gin.Context) {
+    nodes, err := h.nodes.List(c.Request.Context(), tenant.FromContext(c).Arg())
+    if err != nil {
+        respondError(c, err)
+        return
+    }
+    c.JSON(http.StatusOK, gin.H{"count": len(nodes), "nodes": nodes})
+}
+
+// GET /api/network/nodes/:id - узел, его ЦТП и подключенные ИТП
+func (h *NetworkHandler) GetNode(c *gin.Context) {
+    id, ok := parseNodeID(c)
+    if !ok {
+        return
+    }
+    node, err := h.nodes.Get(c.Request.Context(), tenant.FromContext(c).Arg(), id)
+    if err != nil {
+        respondError(c, err)
+        return
+    }
+    c.JSON(http.StatusOK, node)
+}
+
+// GET /api/network/nodes/:id/analysis?days=30 - сводный анализ зданий узла и каждого его ЦТП.
+// Учитываются только здания компании пользователя
+func (h *NetworkHandler) AnalyzeNode(c *gin.Context) {
+    id, ok := parseNodeID(c)
+    if !ok {
+        return
+    }
+    days, err := strconv.Atoi(c.DefaultQuery("days", "30"))
+    if err != nil || days <= 0 {
+        days = 30
+    }
+
+    ctx := c.Request.Context()
+    org := tenant.FromContext(c).Arg()
+    if _, err := h.nodes.Get(ctx, org, id); err != nil {
+        respondError(c, err)
+        return
+    }
+    members, err := h.nodes.Members(ctx, org, id)
+    if err != nil {
+        respondError(c, err)
+        return
+    }
+
+    var buildingIDs []uuid.UUID
+    seen := make(map[uuid.UUID]bool)
+    for _, m := range members {
+        if !seen[m.BuildingID] {
+            seen[m.BuildingID] = true
+            buildingIDs = append(buildingIDs, m.BuildingID)
+        }
+    }
+
+    // Здания анализируются пакетами, как в пакетном анализе
+    results := make(map[uuid.UUID]*service.ConsumptionAnalysis, len(buildingIDs))
+    for start := 0; start < len(buildingIDs); start += maxBatchAnalysis {
+        chunk := buildingIDs[start:min(start+maxBatchAnalysis, len(buildingIDs))]
+        part, err := h.analyzer.AnalyzeBuildings(ctx, chunk, days)
+        if err != nil {
+            respondError(c, err)
+            return
+        }
+        for buildingID, a := range part {
+            results[buildingID] = a
+        }
+    }
+
+    c.JSON(http.StatusOK, gin.H{
+        "days":     days,
+        "analysis": network.Summarize(id, members, results),
+    })
+}
+
+// POST /api/network/nodes - создание источника или ЦТП
+func (h *NetworkHandler) CreateNode(c *gin.Context) {
+    var req nodeRequest
+    if err := c.ShouldBindJSON(&req); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "invalid node: " + err.Error()})
+        return
+    }
+
+    created, err := h.nodes.Create(c.Request.Context(), network.Node{
+        Type:     req.Type,
+        Name:     req.Name,
+        Address:  req.Address,
+        ParentID: req.ParentID,
+    })
+    if err != nil {
+        respondNetworkError(c, err)
+        return
+    }
+
+    audit.SetTarget(c, "network_node", created.ID.String())
+    audit.SetChange(c, nil, created)
+    c.JSON(http.StatusCreated, created)
+}
+
+// PUT /api/network/nodes/:id - название, адрес и источник ЦТП
+func (h *NetworkHandler) UpdateNode(c *gin.Context) {
+    id, ok := parseNodeID(c)
+    if !ok {
+        return
+    }
+    var req updateNodeRequest
+    if err := c.ShouldBindJSON(&req); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "invalid node: " + err.Error()})
+        return
+    }
+
+    before, after, err := h.nodes.Update(c.Request.Context(), id, req.Name, req.Address, req.ParentID)
+    if err != nil {
+        respondNetworkError(c, err)
+        return
+    }
+
+    audit.SetChange(c, before, after)
+    c.JSON(http.StatusOK, after)
+}
+
+// DELETE /api/network/nodes/:id - удаление узла; его ИТП остаются без подключения
+func (h *NetworkHandler) DeleteNode(c *gin.Context) {
+    id, ok := parseNodeID(c)
+    if !ok {
+        return
+    }
+
+    before, err := h.nodes.Delete(c.Request.Context(), id)
+    if err != nil {
+        respondNetworkError(c, err)
+        return
+    }
+
+    audit.SetChange(c, before, nil)
+    c.Status(http.StatusNoContent)
+}
+
+// PUT /api/itp/:id/node - подключение ИТП к источнику или ЦТП
+func (h *NetworkHandler) ConnectITP(c *gin.Context) {
+    itpID, err := uuid.Parse(c.Param("id"))
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "invalid ITP ID"})
+        return
+    }
+    var req connectITPRequest
+    if err := c.ShouldBindJSON(&req); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+
+    before, after, err := h.nodes.ConnectITP(c.Request.Context(), itpID, req.NodeID)
+    if err != nil {
+        respondNetworkError(c, err)
+        return
+    }
+
+    audit.SetChange(c, gin.H{"node_id": before}, gin.H{"node_id": after})
+    c.JSON(http.StatusOK, gin.H{"itp_id": itpID, "node_id": after})
+}
+
+// PUT /api/buildings/:id/location - координаты здания для группировки аномалий соседних зданий
+func (h *NetworkHandler) SetLocation(c *gin.Context) {
+    buildingID, err := uuid.Parse(c.Param("id"))
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "invalid building ID"})
+        return
+    }
+    var req locationRequest
+    if err := c.ShouldBindJSON(&req); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "invalid location: " + err.Error()})
+        return
+    }
+
+    ctx := c.Request.Context()
+    if err := h.orgs.CheckBuilding(ctx, tenant.FromContext(c), buildingID); err != nil {
+        respondError(c, err)
+        return
+    }
+    after := network.Location{Latitude: req.Latitude, Longitude: req.Longitude}
+    before, err := h.nodes.SetLocation(ctx, buildingID, after)
+    if err != nil {
+        respondError(c, err)
+        return
+    }
+
+    audit.SetChange(c, before, after)
+    c.JSON(http.StatusOK, gin.H{"building_id": buildingID, "latitude": after.Latitude, "longitude": after.Longitude})
+}
+
+// GET /api/situations?status=open&scope=&limit=100&offset=0 - ситуации, затрагивающие здания компании.
+// scope: node (узел сети) или area (соседние здания)
+func (h *NetworkHandler) ListSituations(c *gin.Context) {
+    status := c.DefaultQuery("status", incident.StatusOpen)
+    switch status {
+    case incident.StatusOpen, incident.StatusResolved, "all":
+    default:
+        c.JSON(http.StatusBadRequest, gin.H{"error": "invalid status, expected open, resolved or all"})
+        return
+    }
+    scope := c.Query("scope")
+    switch scope {
+    case "", incident.ScopeNode, incident.ScopeArea:
+    default:
+        c.JSON(http.StatusBadRequest, gin.H{"error": "invalid scope, expected node or area"})
+        return
+    }
+
+    limit, _ := strconv.Atoi(c.DefaultQuery("limit", "100"))
+    offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+    if offset < 0 {
+        offset = 0
+    }
+
+    situations, err := h.incidents.ListSituations(c.Request.Context(), tenant.FromContext(c).Arg(), status, scope, limit, offset)
+    if err != nil {
+        respondError(c, err)
+        return
+    }
+    c.JSON(http.StatusOK, gin.H{"count": len(situations), "situations": situations})
+}
+
+// GET /api/situations/:id - ситуация и инциденты зданий, отнесенные к ней
+func (h *NetworkHandler) GetSituation(c *gin.Context) {
+    id, err := uuid.Parse(c.Param("id"))
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "invalid situation ID"})
+        return
+    }
+
+    situation, err := h.incidents.GetSituation(c.Request.Context(), tenant.FromContext(c).Arg(), id)
+    if err != nil {
+        respondError(c, err)
+        return
+    }
+    c.JSON(http.StatusOK, situation)
+}
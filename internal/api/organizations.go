@@ -0,0 +1,99 @@
+package api
+
+import (
+    "errors"
+    "net/http"
+
+    "service/internal/audit"
+    "service/internal/tenant"
+
+    "github.com/gin-gonic/gin"
+    "github.com/google/uuid"
+)
+
+// OrganizationHandler - управляющие компании и распределение зданий между ними
+type OrganizationHandler struct {
+    orgs *tenant.OrganizationStore
+}
+
+func NewOrganizationHandler(orgs *tenant.OrganizationStore) *OrganizationHandler {
+    return &OrganizationHandler{orgs: orgs}
+}
+
+type createOrganizationRequest struct {
+    Name string  `json:"name" binding:"required"`
+    INN  *string `json:"inn"`
+}
+
+type assignBuildingRequest struct {
+    OrganizationID *uuid.UUID `json:"organization_id"` // null - снять привязку
+}
+
+// GET /api/organizations - суперпользователь видит все компании, остальные - свою
+func (h *OrganizationHandler) ListOrganizations(c *gin.Context) {
+    orgs, err := h.orgs.List(c.Request.Context(), tenant.FromContext(c))
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error: " + err.Error()})
+        return
+    }
+    c.JSON(http.StatusOK, orgs)
+}
+
+// POST /api/organizations (только суперпользователь)
+func (h *OrganizationHandler) CreateOrganization(c *gin.Context) {
+    var req createOrganizationRequest
+    if err := c.ShouldBindJSON(&req); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+
+    org, err := h.orgs.Create(c.Request.Context(), req.Name, req.INN)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+    audit.SetTarget(c, "organization", org.ID.String())
+    audit.SetChange(c, nil, org)
+    c.JSON(http.StatusCreated, org)
+}
+
+// PUT /api/buildings/:id/organization (только суперпользователь)
+func (h *OrganizationHandler) AssignBuilding(c *gin.Context) {
+    buildingID, err := uuid.Parse(c.Param("id"))
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "invalid building ID"})
+        return
+    }
+
+    var req assignBuildingRequest
+    if err := c.ShouldBindJSON(&req); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+
+    before, err := h.orgs.BuildingOrganization(c.Request.Context(), buildingID)
+    if errors.Is(err, tenant.ErrBuildingNotFound) {
+        c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+        return
+    }
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+
+    err = h.orgs.AssignBuilding(c.Request.Context(), buildingID, req.OrganizationID)
+    if errors.Is(err, tenant.ErrBuildingNotFound) || errors.Is(err, tenant.ErrOrganizationNotFound) {
+        c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+        return
+    }
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+
+    audit.SetChange(c, gin.H{"organization_id": before}, gin.H{"organization_id": req.OrganizationID})
+    c.JSON(http.StatusOK, gin.H{
+        "building_id":     buildingID,
+        "organization_id": req.OrganizationID,
+    })
+}
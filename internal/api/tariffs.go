@@ -0,0 +1,174 @@
+package api
+
+import (
+    "errors"
+    "net/http"
+    "time"
+
+    "service/internal/audit"
+    "service/internal/tariff"
+    "service/internal/tenant"
+
+    "github.com/gin-gonic/gin"
+    "github.com/google/uuid"
+)
+
+// TariffHandler - тарифы компаний и регионов, регион здания
+type TariffHandler struct {
+    tariffs *tariff.Store
+    orgs    *tenant.OrganizationStore
+}
+
+func NewTariffHandler(tariffs *tariff.Store, orgs *tenant.OrganizationStore) *TariffHandler {
+    return &TariffHandler{tariffs: tariffs, orgs: orgs}
+}
+
+// Новый тариф. Без organization_id и region - общий тариф. Администратор компании
+// создает только тарифы своей компании, organization_id подставляется автоматически
+type tariffRequest struct {
+    OrganizationID *uuid.UUID `json:"organization_id"`
+    Region         *string    `json:"region" binding:"omitempty,min=1,max=128"`
+    ColdWater      float64    `json:"cold_water" binding:"min=0"`
+    HotWater       float64    `json:"hot_water" binding:"min=0"`
+    Heat           float64    `json:"heat" binding:"min=0"`
+    EffectiveFrom  string     `json:"effective_from" binding:"required,datetime=2006-01-02"`
+}
+
+// Регион здания; null - удалить
+type regionRequest struct {
+    Region *string `json:"region" binding:"omitempty,min=1,max=128"`
+}
+
+// Ответ на ошибку тарифа: тариф того же уровня на ту же дату - 409, чужой уровень - 403
+func respondTariffError(c *gin.Context, err error) {
+    switch {
+    case errors.Is(err, tariff.ErrDuplicate):
+        c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+    case errors.Is(err, tariff.ErrNotEditable):
+        c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+    case errors.Is(err, tenant.ErrOrganizationNotFound):
+        c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+    default:
+        respondError(c, err)
+    }
+}
+
+// GET /api/tariffs - тарифы, которые могут применяться к зданиям компании: собственные, регионов и общие
+func (h *TariffHandler) ListTariffs(c *gin.Context) {
+    tariffs, err := h.tariffs.List(c.Request.Context(), tenant.FromContext(c).Arg())
+    if err != nil {
+        respondError(c, err)
+        return
+    }
+    c.JSON(http.StatusOK, gin.H{"count": len(tariffs), "tariffs": tariffs})
+}
+
+// GET /api/buildings/:id/tariff?at=2006-01-02 - тариф, действующий для здания на дату (по умолчанию сегодня).
+// tariff null - тариф не задан, стоимость и потери не оцениваются
+func (h *TariffHandler) BuildingTariff(c *gin.Context) {
+    buildingID, err := uuid.Parse(c.Param("id"))
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "invalid building ID"})
+        return
+    }
+    at := time.Now().UTC()
+    if v := c.Query("at"); v != "" {
+        if at, err = time.Parse("2006-01-02", v); err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "invalid at, expected YYYY-MM-DD"})
+            return
+        }
+    }
+
+    ctx := c.Request.Context()
+    if err := h.orgs.CheckBuilding(ctx, tenant.FromContext(c), buildingID); err != nil {
+        respondError(c, err)
+        return
+    }
+    t, err := h.tariffs.Resolve(ctx, buildingID, at)
+    if err != nil {
+        respondError(c, err)
+        return
+    }
+    c.JSON(http.StatusOK, gin.H{"building_id": buildingID, "at": at.Format("2006-01-02"), "tariff": t})
+}
+
+// POST /api/tariffs - новый тариф. Тарифы регионов и общие задает суперпользователь
+func (h *TariffHandler) CreateTariff(c *gin.Context) {
+    var req tariffRequest
+    if err := c.ShouldBindJSON(&req); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "invalid tariff: " + err.Error()})
+        return
+    }
+    if req.OrganizationID != nil && req.Region != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "invalid tariff: organization_id and region are mutually exclusive"})
+        return
+    }
+
+    scope := tenant.FromContext(c)
+    if !scope.All() {
+        if req.Region != nil || (req.OrganizationID != nil && *req.OrganizationID != *scope.OrganizationID) {
+            respondTariffError(c, tariff.ErrNotEditable)
+            return
+        }
+        req.OrganizationID = scope.OrganizationID
+    }
+
+    created, err := h.tariffs.Create(c.Request.Context(), tariff.Tariff{
+        OrganizationID: req.OrganizationID,
+        Region:         req.Region,
+        ColdWater:      req.ColdWater,
+        HotWater:       req.HotWater,
+        Heat:           req.Heat,
+        EffectiveFrom:  req.EffectiveFrom,
+    })
+    if err != nil {
+        respondTariffError(c, err)
+        return
+    }
+
+    audit.SetTarget(c, "tariff", created.ID.String())
+    audit.SetChange(c, nil, created)
+    c.JSON(http.StatusCreated, created)
+}
+
+// DELETE /api/tariffs/:id - удаление ошибочно заданного тарифа.
+// Изменение тарифа - новый тариф с более поздней датой начала действия
+func (h *TariffHandler) DeleteTariff(c *gin.Context) {
+    id, err := uuid.Parse(c.Param("id"))
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "invalid tariff ID"})
+        return
+    }
+
+    before, err := h.tariffs.Delete(c.Request.Context(), tenant.FromContext(c), id)
+    if err != nil {
+        respondTariffError(c, err)
+        return
+    }
+
+    audit.SetChange(c, before, nil)
+    c.Status(http.StatusNoContent)
+}
+
+// PUT /api/buildings/:id/region - регион здания для выбора тарифа региона
+func (h *TariffHandler) SetRegion(c *gin.Context) {
+    buildingID, err := uuid.Parse(c.Param("id"))
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "invalid building ID"})
+        return
+    }
+    var req regionRequest
+    if err := c.ShouldBindJSON(&req); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "invalid region: " + err.Error()})
+        return
+    }
+
+    before, err := h.tariffs.SetRegion(c.Request.Context(), buildingID, req.Region)
+    if err != nil {
+        respondError(c, err)
+        return
+    }
+
+    audit.SetChange(c, gin.H{"region": before}, gin.H{"region": req.Region})
+    c.JSON(http.StatusOK, gin.H{"building_id": buildingID, "region": req.Region})
+}
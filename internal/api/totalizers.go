@@ -0,0 +1,123 @@
+package api
+
+import (
+    "errors"
+    "net/http"
+    "strconv"
+    "time"
+
+    "service/internal/audit"
+    "service/internal/models"
+    "service/internal/service"
+    "service/internal/tenant"
+
+    "github.com/gin-gonic/gin"
+    "github.com/google/uuid"
+)
+
+// TotalizerHandler - накопительные счетчики зданий и замены счетчиков
+type TotalizerHandler struct {
+    ingestor *service.Ingestor
+    orgs     *tenant.OrganizationStore
+}
+
+func NewTotalizerHandler(ingestor *service.Ingestor, orgs *tenant.OrganizationStore) *TotalizerHandler {
+    return &TotalizerHandler{ingestor: ingestor, orgs: orgs}
+}
+
+// Замена счетчика. Для ХВС указывается itp_id, для ГВС - канал
+type replacementRequest struct {
+    Source     string     `json:"source" binding:"required,oneof=hot_water cold_water"`
+    ITPID      *uuid.UUID `json:"itp_id"`
+    Channel    string     `json:"channel" binding:"omitempty,oneof=ch1 ch2"`
+    ReplacedAt time.Time  `json:"replaced_at" binding:"required"`
+    OldTotal   *float64   `json:"old_total" binding:"omitempty,min=0"`
+    NewTotal   float64    `json:"new_total" binding:"min=0"`
+}
+
+// GET /api/totalizers/:id?days=30 - регистры накопительных счетчиков здания,
+// последние показания и число интервалов с уменьшением итога за days дней
+func (h *TotalizerHandler) BuildingTotalizers(c *gin.Context) {
+    buildingID, err := uuid.Parse(c.Param("id"))
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "invalid building ID"})
+        return
+    }
+    days, err := strconv.Atoi(c.DefaultQuery("days", "30"))
+    if err != nil || days < 1 || days > 365 {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "days must be between 1 and 365"})
+        return
+    }
+
+    totalizers, err := h.ingestor.BuildingTotalizers(c.Request.Context(), tenant.FromContext(c).Arg(),
+        buildingID, time.Now().AddDate(0, 0, -days))
+    if err != nil {
+        respondError(c, err)
+        return
+    }
+    c.JSON(http.StatusOK, gin.H{
+        "building_id": buildingID,
+        "days":        days,
+        "totalizers":  totalizers,
+    })
+}
+
+// POST /api/buildings/:id/meter-replacements - регистрация замены счетчика:
+// расход первого показания после замены считается от начального значения нового счетчика
+func (h *TotalizerHandler) RecordReplacement(c *gin.Context) {
+    buildingID, err := uuid.Parse(c.Param("id"))
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "invalid building ID"})
+        return
+    }
+    var req replacementRequest
+    if err := c.ShouldBindJSON(&req); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "invalid replacement: " + err.Error()})
+        return
+    }
+
+    ctx := c.Request.Context()
+    if err := h.orgs.CheckBuilding(ctx, tenant.FromContext(c), buildingID); err != nil {
+        respondError(c, err)
+        return
+    }
+
+    replacement := models.MeterReplacement{
+        BuildingID: buildingID,
+        Source:     req.Source,
+        Channel:    req.Channel,
+        ReplacedAt: req.ReplacedAt,
+        OldTotal:   req.OldTotal,
+        NewTotal:   req.NewTotal,
+    }
+    switch req.Source {
+    case service.TotalizerColdWater:
+        if req.ITPID == nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "itp_id is required for cold_water"})
+            return
+        }
+        itpBuilding, err := h.ingestor.ITPBuilding(ctx, *req.ITPID)
+        if errors.Is(err, service.ErrITPNotFound) || (err == nil && itpBuilding != buildingID) {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "unknown itp_id", "itp_id": req.ITPID})
+            return
+        }
+        if err != nil {
+            respondError(c, err)
+            return
+        }
+        replacement.MeterKey = req.ITPID.String()
+        replacement.Channel = service.ColdWaterChannel
+    default:
+        if req.Channel == "" {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "channel is required for hot_water"})
+            return
+        }
+    }
+
+    if err := h.ingestor.RecordReplacement(ctx, replacement); err != nil {
+        respondError(c, err)
+        return
+    }
+    audit.SetChange(c, nil, replacement)
+    c.JSON(http.StatusCreated, replacement)
+}
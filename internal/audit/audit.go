@@ -0,0 +1,196 @@
+package audit
+
+import (
+    "context"
+    "encoding/json"
+    "fmt"
+    "time"
+
+    "github.com/google/uuid"
+    "github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Типы инициаторов действий
+const (
+    ActorUser      = "user"
+    ActorAPIKey    = "api_key"
+    ActorSystem    = "system"
+    ActorAnonymous = "anonymous"
+)
+
+// Действия, попадающие в журнал
+const (
+    ActionLogin              = "auth.login"
+    ActionUserCreate         = "user.create"
+    ActionAPIKeyCreate       = "api_key.create"
+    ActionAPIKeyRotate       = "api_key.rotate"
+    ActionAPIKeyRevoke       = "api_key.revoke"
+    ActionOrganizationCreate = "organization.create"
+    ActionBuildingAssign     = "building.assign_organization"
+    ActionGeneratorStart     = "generator.start"
+    ActionGeneratorStop      = "generator.stop"
+    ActionDataSeed           = "data.seed"
+    ActionHistoryGenerate    = "data.generate_history"
+    ActionBuildingsCreate    = "data.create_test_buildings"
+    ActionIncidentAck        = "incident.acknowledge"
+    ActionIncidentResolve    = "incident.resolve"
+    ActionMeterReplace       = "meter.replace"
+    ActionMeterCreate        = "meter.create"
+    ActionMeterUpdate        = "meter.update"
+    ActionNetworkNodeCreate  = "network_node.create"
+    ActionNetworkNodeUpdate  = "network_node.update"
+    ActionNetworkNodeDelete  = "network_node.delete"
+    ActionITPConnect         = "itp.connect"
+    ActionBuildingLocate     = "building.set_location"
+    ActionTariffCreate       = "tariff.create"
+    ActionTariffDelete       = "tariff.delete"
+    ActionBuildingRegion     = "building.set_region"
+    ActionBuildingAttributes = "building.set_attributes"
+)
+
+// Инициатор действия
+type Actor struct {
+    Type           string     `json:"type"`
+    ID             *uuid.UUID `json:"id,omitempty"`
+    Name           string     `json:"name"`
+    OrganizationID *uuid.UUID `json:"organization_id,omitempty"`
+}
+
+// Системный инициатор (фоновые задачи, запуск сервиса)
+func System(component string) Actor {
+    return Actor{Type: ActorSystem, Name: component}
+}
+
+// Запись журнала
+type Entry struct {
+    ID         int64           `json:"id"`
+    OccurredAt time.Time       `json:"occurred_at"`
+    Actor      Actor           `json:"actor"`
+    Action     string          `json:"action"`
+    TargetType string          `json:"target_type,omitempty"`
+    TargetID   string          `json:"target_id,omitempty"`
+    Before     json.RawMessage `json:"before,omitempty"`
+    After      json.RawMessage `json:"after,omitempty"`
+    StatusCode *int            `json:"status_code,omitempty"`
+    IP         string          `json:"ip,omitempty"`
+    UserAgent  string          `json:"user_agent,omitempty"`
+}
+
+// Фильтр выборки журнала
+type Filter struct {
+    OrganizationID *uuid.UUID // nil - все компании
+    ActorID        *uuid.UUID
+    Action         string
+    TargetType     string
+    TargetID       string
+    From           *time.Time
+    To             *time.Time
+    Limit          int
+    Offset         int
+}
+
+// Recorder - запись и чтение журнала аудита
+type Recorder struct {
+    pool *pgxpool.Pool
+}
+
+func NewRecorder(pool *pgxpool.Pool) *Recorder {
+    return &Recorder{pool: pool}
+}
+
+// Сериализация состояния до/после; nil остается NULL
+func marshalState(v interface{}) ([]byte, error) {
+    if v == nil {
+        return nil, nil
+    }
+    if raw, ok := v.(json.RawMessage); ok {
+        return raw, nil
+    }
+    return json.Marshal(v)
+}
+
+// Добавление записи в журнал
+func (r *Recorder) Record(ctx context.Context, entry Entry) error {
+    if entry.Actor.Type == "" {
+        entry.Actor.Type = ActorAnonymous
+    }
+    if entry.OccurredAt.IsZero() {
+        entry.OccurredAt = time.Now()
+    }
+
+    _, err := r.pool.Exec(ctx, `
+        INSERT INTO audit_log (occurred_at, actor_type, actor_id, actor_name, organization_id, action,
+                               target_type, target_id, before, after, status_code, ip, user_agent)
+        VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7, ''), NULLIF($8, ''), $9, $10, $11, NULLIF($12, ''), NULLIF($13, ''))`,
+        entry.OccurredAt, entry.Actor.Type, entry.Actor.ID, entry.Actor.Name, entry.Actor.OrganizationID,
+        entry.Action, entry.TargetType, entry.TargetID, []byte(entry.Before), []byte(entry.After),
+        entry.StatusCode, entry.IP, entry.UserAgent)
+    if err != nil {
+        return fmt.Errorf("insert audit entry %s: %w", entry.Action, err)
+    }
+    return nil
+}
+
+// Запись системного действия с состоянием до/после
+func (r *Recorder) RecordSystem(ctx context.Context, component, action, targetType, targetID string, before, after interface{}) error {
+    beforeJSON, err := marshalState(before)
+    if err != nil {
+        return fmt.Errorf("marshal audit before: %w", err)
+    }
+    afterJSON, err := marshalState(after)
+    if err != nil {
+        return fmt.Errorf("marshal audit after: %w", err)
+    }
+
+    return r.Record(ctx, Entry{
+        Actor:      System(component),
+        Action:     action,
+        TargetType: targetType,
+        TargetID:   targetID,
+        Before:     beforeJSON,
+        After:      afterJSON,
+    })
+}
+
+// Выборка журнала по фильтру, новые записи первыми
+func (r *Recorder) List(ctx context.Context, f Filter) ([]Entry, error) {
+    if f.Limit <= 0 || f.Limit > 1000 {
+        f.Limit = 100
+    }
+
+    rows, err := r.pool.Query(ctx, `
+        SELECT id, occurred_at, actor_type, actor_id, actor_name, organization_id, action,
+               COALESCE(target_type, ''), COALESCE(target_id, ''), before, after, status_code,
+               COALESCE(ip, ''), COALESCE(user_agent, '')
+        FROM audit_log
+        WHERE ($1::uuid IS NULL OR organization_id = $1)
+        AND ($2::uuid IS NULL OR actor_id = $2)
+        AND ($3 = '' OR action = $3)
+        AND ($4 = '' OR target_type = $4)
+        AND ($5 = '' OR target_id = $5)
+        AND ($6::timestamptz IS NULL OR occurred_at >= $6)
+        AND ($7::timestamptz IS NULL OR occurred_at <= $7)
+        ORDER BY occurred_at DESC, id DESC
+        LIMIT $8 OFFSET $9`,
+        f.OrganizationID, f.ActorID, f.Action, f.TargetType, f.TargetID, f.From, f.To, f.Limit, f.Offset)
+    if err != nil {
+        return nil, fmt.Errorf("list audit log: %w", err)
+    }
+    defer rows.Close()
+
+    entries := []Entry{}
+    for rows.Next() {
+        var e Entry
+        var before, after []byte
+        err := rows.Scan(&e.ID, &e.OccurredAt, &e.Actor.Type, &e.Actor.ID, &e.Actor.Name, &e.Actor.OrganizationID,
+            &e.Action, &e.TargetType, &e.TargetID, &before, &after, &e.StatusCode, &e.IP, &e.UserAgent)
+        if err != nil {
+            return nil, fmt.Errorf("scan audit entry: %w", err)
+        }
+        e.Before = before
+        e.After = after
+        entries = append(entries, e)
+    }
+
+    return entries, rows.Err()
+}
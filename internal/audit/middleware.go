@@ -0,0 +1,101 @@
+package audit
+
+import (
+    "context"
+
+    "service/internal/auth"
+    "service/internal/logging"
+
+    "github.com/gin-gonic/gin"
+)
+
+const (
+    changeKey = "audit_change"
+    actorKey  = "audit_actor"
+    targetKey = "audit_target"
+)
+
+type change struct {
+    before interface{}
+    after  interface{}
+}
+
+type target struct {
+    kind string
+    id   string
+}
+
+// Сохранение состояния до/после для записи журнала текущего запроса
+func SetChange(c *gin.Context, before, after interface{}) {
+    c.Set(changeKey, change{before: before, after: after})
+}
+
+// Явное указание инициатора (например, при входе, когда токена еще нет)
+func SetActor(c *gin.Context, actor Actor) {
+    c.Set(actorKey, actor)
+}
+
+// Явное указание объекта действия, если он не совпадает с параметром :id
+func SetTarget(c *gin.Context, targetType, targetID string) {
+    c.Set(targetKey, target{kind: targetType, id: targetID})
+}
+
+// Инициатор текущего запроса: пользователь по JWT или API ключ
+func ActorFromContext(c *gin.Context) Actor {
+    if value, ok := c.Get(actorKey); ok {
+        return value.(Actor)
+    }
+    if claims := auth.ClaimsFromContext(c); claims != nil {
+        id := claims.UserID
+        return Actor{Type: ActorUser, ID: &id, Name: claims.Username, OrganizationID: claims.OrganizationID}
+    }
+    if key := auth.APIKeyFromContext(c); key != nil {
+        id := key.ID
+        return Actor{Type: ActorAPIKey, ID: &id, Name: key.Name, OrganizationID: key.OrganizationID}
+    }
+    return Actor{Type: ActorAnonymous, Name: "anonymous"}
+}
+
+// Middleware журнала: после выполнения обработчика записывает действие,
+// инициатора, объект (по умолчанию параметр :id), IP и результат запроса.
+// Состояние до/после обработчик передает через SetChange
+func (r *Recorder) Middleware(action, targetType string) gin.HandlerFunc {
+    logger := logging.Component("audit")
+
+    return func(c *gin.Context) {
+        c.Next()
+
+        entry := Entry{
+            Actor:      ActorFromContext(c),
+            Action:     action,
+            TargetType: targetType,
+            TargetID:   c.Param("id"),
+            IP:         c.ClientIP(),
+            UserAgent:  c.Request.UserAgent(),
+        }
+        status := c.Writer.Status()
+        entry.StatusCode = &status
+
+        if value, ok := c.Get(targetKey); ok {
+            t := value.(target)
+            entry.TargetType, entry.TargetID = t.kind, t.id
+        }
+
+        if value, ok := c.Get(changeKey); ok {
+            ch := value.(change)
+            var err error
+            if entry.Before, err = marshalState(ch.before); err != nil {
+                logger.WarnContext(c.Request.Context(), "marshal before state failed", "action", action, logging.Err(err))
+            }
+            if entry.After, err = marshalState(ch.after); err != nil {
+                logger.WarnContext(c.Request.Context(), "marshal after state failed", "action", action, logging.Err(err))
+            }
+        }
+
+        // Запрос уже завершен, поэтому запись не зависит от его отмены, но сохраняет request_id
+        ctx := context.WithoutCancel(c.Request.Context())
+        if err := r.Record(ctx, entry); err != nil {
+            logger.ErrorContext(ctx, "record audit entry failed", "action", action, logging.Err(err))
+        }
+    }
+}
@@ -0,0 +1,375 @@
+package auth
+
+import (
+    "context"
+    "crypto/rand"
+    "crypto/sha256"
+    "crypto/subtle"
+    "encoding/hex"
+    "errors"
+    "fmt"
+    "net/http"
+    "strings"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "github.com/google/uuid"
+    "github.com/jackc/pgx/v5"
+    "github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Заголовок, в котором клиенты телеметрии передают ключ
+const APIKeyHeader = "X-API-Key"
+
+const (
+    apiKeyMarker = "itk"
+    apiKeyCtxKey = "auth_api_key"
+)
+
+// Операции, доступные по API ключу. Ключи выдаются только для загрузки показаний
+const (
+    ScopeIngestHotWater    = "ingest:hot_water"
+    ScopeIngestColdWater   = "ingest:cold_water"
+    ScopeIngestTemperature = "ingest:temperature"
+    ScopeIngestPump        = "ingest:pump"
+)
+
+var knownScopes = map[string]bool{
+    ScopeIngestHotWater:    true,
+    ScopeIngestColdWater:   true,
+    ScopeIngestTemperature: true,
+    ScopeIngestPump:        true,
+}
+
+var (
+    ErrInvalidAPIKey  = errors.New("invalid api key")
+    ErrAPIKeyExpired  = errors.New("api key expired")
+    ErrAPIKeyRevoked  = errors.New("api key revoked")
+    ErrAPIKeyNotFound = errors.New("api key not found")
+    ErrUnknownScope   = errors.New("unknown scope")
+)
+
+// API ключ клиента телеметрии. Секрет в БД не хранится, только его хэш
+type APIKey struct {
+    ID             uuid.UUID   `json:"id"`
+    Name           string      `json:"name"`
+    Prefix         string      `json:"prefix"`
+    Scopes         []string    `json:"scopes"`
+    BuildingIDs    []uuid.UUID `json:"building_ids"`
+    ITPIDs         []uuid.UUID `json:"itp_ids"`
+    OrganizationID *uuid.UUID  `json:"organization_id,omitempty"`
+    ExpiresAt      *time.Time  `json:"expires_at,omitempty"`
+    LastUsedAt     *time.Time  `json:"last_used_at,omitempty"`
+    RevokedAt      *time.Time  `json:"revoked_at,omitempty"`
+    RotatedFrom    *uuid.UUID  `json:"rotated_from,omitempty"`
+    CreatedBy      *uuid.UUID  `json:"created_by,omitempty"`
+    CreatedAt      time.Time   `json:"created_at"`
+}
+
+// Параметры нового ключа
+type APIKeyParams struct {
+    Name           string
+    Scopes         []string
+    BuildingIDs    []uuid.UUID
+    ITPIDs         []uuid.UUID
+    OrganizationID *uuid.UUID
+    ExpiresAt      *time.Time
+}
+
+// Проверка разрешенной операции
+func (k *APIKey) HasScope(scope string) bool {
+    for _, s := range k.Scopes {
+        if s == scope {
+            return true
+        }
+    }
+    return false
+}
+
+// Проверка доступа к зданию. Ключ без ограничений по объектам допускает любое здание
+// (в пределах своей компании - это проверяется отдельно по organization_id здания)
+func (k *APIKey) AllowsBuilding(buildingID uuid.UUID) bool {
+    if len(k.BuildingIDs) == 0 && len(k.ITPIDs) == 0 {
+        return true
+    }
+    return containsUUID(k.BuildingIDs, buildingID)
+}
+
+// Проверка доступа к ИТП: разрешен сам ИТП или здание, к которому он относится
+func (k *APIKey) AllowsITP(itpID, buildingID uuid.UUID) bool {
+    if len(k.BuildingIDs) == 0 && len(k.ITPIDs) == 0 {
+        return true
+    }
+    return containsUUID(k.ITPIDs, itpID) || containsUUID(k.BuildingIDs, buildingID)
+}
+
+func containsUUID(ids []uuid.UUID, id uuid.UUID) bool {
+    for _, v := range ids {
+        if v == id {
+            return true
+        }
+    }
+    return false
+}
+
+// APIKeyStore - работа с таблицей api_keys
+type APIKeyStore struct {
+    pool *pgxpool.Pool
+}
+
+func NewAPIKeyStore(pool *pgxpool.Pool) *APIKeyStore {
+    return &APIKeyStore{pool: pool}
+}
+
+const apiKeyColumns = `id, name, prefix, scopes, building_ids, itp_ids, organization_id, expires_at,
+    last_used_at, revoked_at, rotated_from, created_by, created_at`
+
+func scanAPIKey(row pgx.Row) (*APIKey, error) {
+    var k APIKey
+    err := row.Scan(&k.ID, &k.Name, &k.Prefix, &k.Scopes, &k.BuildingIDs, &k.ITPIDs, &k.OrganizationID,
+        &k.ExpiresAt, &k.LastUsedAt, &k.RevokedAt, &k.RotatedFrom, &k.CreatedBy, &k.CreatedAt)
+    if err != nil {
+        return nil, err
+    }
+    return &k, nil
+}
+
+// Создание ключа. Возвращает ключ целиком - показать его можно только один раз
+func (s *APIKeyStore) Create(ctx context.Context, params APIKeyParams, createdBy *uuid.UUID) (*APIKey, string, error) {
+    return s.create(ctx, s.pool, params, createdBy, nil)
+}
+
+// Пул или транзакция, в которой создается ключ
+type queryRower interface {
+    QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+func (s *APIKeyStore) create(ctx context.Context, db queryRower, params APIKeyParams, createdBy, rotatedFrom *uuid.UUID) (*APIKey, string, error) {
+    if len(params.Scopes) == 0 {
+        return nil, "", fmt.Errorf("%w: at least one scope required", ErrUnknownScope)
+    }
+    for _, scope := range params.Scopes {
+        if !knownScopes[scope] {
+            return nil, "", fmt.Errorf("%w: %s", ErrUnknownScope, scope)
+        }
+    }
+    if params.BuildingIDs == nil {
+        params.BuildingIDs = []uuid.UUID{}
+    }
+    if params.ITPIDs == nil {
+        params.ITPIDs = []uuid.UUID{}
+    }
+
+    prefix, err := randomHex(4)
+    if err != nil {
+        return nil, "", err
+    }
+    secret, err := randomHex(32)
+    if err != nil {
+        return nil, "", err
+    }
+
+    row := db.QueryRow(ctx, `
+        INSERT INTO api_keys (id, name, prefix, key_hash, scopes, building_ids, itp_ids,
+                              organization_id, expires_at, rotated_from, created_by, created_at)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, NOW())
+        RETURNING `+apiKeyColumns,
+        uuid.New(), params.Name, prefix, hashSecret(secret), params.Scopes, params.BuildingIDs,
+        params.ITPIDs, params.OrganizationID, params.ExpiresAt, rotatedFrom, createdBy)
+
+    key, err := scanAPIKey(row)
+    if err != nil {
+        return nil, "", fmt.Errorf("insert api key: %w", err)
+    }
+
+    return key, fmt.Sprintf("%s_%s_%s", apiKeyMarker, prefix, secret), nil
+}
+
+// Список ключей компании (organizationID == nil - всех компаний)
+func (s *APIKeyStore) List(ctx context.Context, organizationID *uuid.UUID) ([]APIKey, error) {
+    rows, err := s.pool.Query(ctx, `
+        SELECT `+apiKeyColumns+` FROM api_keys
+        WHERE ($1::uuid IS NULL OR organization_id = $1)
+        ORDER BY created_at DESC`, organizationID)
+    if err != nil {
+        return nil, fmt.Errorf("list api keys: %w", err)
+    }
+    defer rows.Close()
+
+    keys := []APIKey{}
+    for rows.Next() {
+        key, err := scanAPIKey(rows)
+        if err != nil {
+            return nil, fmt.Errorf("scan api key: %w", err)
+        }
+        keys = append(keys, *key)
+    }
+
+    return keys, rows.Err()
+}
+
+// Получение ключа по ID
+func (s *APIKeyStore) Get(ctx context.Context, id uuid.UUID) (*APIKey, error) {
+    key, err := scanAPIKey(s.pool.QueryRow(ctx, `SELECT `+apiKeyColumns+` FROM api_keys WHERE id = $1`, id))
+    if errors.Is(err, pgx.ErrNoRows) {
+        return nil, ErrAPIKeyNotFound
+    }
+    if err != nil {
+        return nil, fmt.Errorf("get api key: %w", err)
+    }
+    return key, nil
+}
+
+// Отзыв ключа
+func (s *APIKeyStore) Revoke(ctx context.Context, id uuid.UUID) error {
+    tag, err := s.pool.Exec(ctx, `
+        UPDATE api_keys SET revoked_at = NOW()
+        WHERE id = $1 AND revoked_at IS NULL`, id)
+    if err != nil {
+        return fmt.Errorf("revoke api key: %w", err)
+    }
+    if tag.RowsAffected() == 0 {
+        return ErrAPIKeyNotFound
+    }
+    return nil
+}
+
+// Ротация ключа: выпускается новый ключ с теми же правами,
+// старый продолжает работать еще grace (0 - отзывается сразу)
+func (s *APIKeyStore) Rotate(ctx context.Context, id uuid.UUID, grace time.Duration, createdBy *uuid.UUID) (*APIKey, string, error) {
+    old, err := s.Get(ctx, id)
+    if err != nil {
+        return nil, "", err
+    }
+    if old.RevokedAt != nil {
+        return nil, "", ErrAPIKeyRevoked
+    }
+
+    // Новый ключ и срок действия старого записываются вместе: иначе при ошибке второго
+    // запроса оба ключа остались бы действующими без ограничения срока
+    tx, err := s.pool.Begin(ctx)
+    if err != nil {
+        return nil, "", err
+    }
+    defer tx.Rollback(ctx)
+
+    key, plain, err := s.create(ctx, tx, APIKeyParams{
+        Name:           old.Name,
+        Scopes:         old.Scopes,
+        BuildingIDs:    old.BuildingIDs,
+        ITPIDs:         old.ITPIDs,
+        OrganizationID: old.OrganizationID,
+        ExpiresAt:      old.ExpiresAt,
+    }, createdBy, &old.ID)
+    if err != nil {
+        return nil, "", err
+    }
+
+    if grace > 0 {
+        _, err = tx.Exec(ctx, `
+            UPDATE api_keys SET expires_at = LEAST(COALESCE(expires_at, $2), $2)
+            WHERE id = $1`, old.ID, time.Now().Add(grace))
+    } else {
+        _, err = tx.Exec(ctx, `UPDATE api_keys SET revoked_at = NOW() WHERE id = $1`, old.ID)
+    }
+    if err != nil {
+        return nil, "", fmt.Errorf("retire rotated api key: %w", err)
+    }
+    if err := tx.Commit(ctx); err != nil {
+        return nil, "", err
+    }
+
+    return key, plain, nil
+}
+
+// Проверка ключа из запроса и отметка об использовании
+func (s *APIKeyStore) Authenticate(ctx context.Context, raw string) (*APIKey, error) {
+    parts := strings.Split(raw, "_")
+    if len(parts) != 3 || parts[0] != apiKeyMarker {
+        return nil, ErrInvalidAPIKey
+    }
+    prefix, secret := parts[1], parts[2]
+
+    var keyHash string
+    var key APIKey
+    err := s.pool.QueryRow(ctx, `SELECT key_hash, `+apiKeyColumns+` FROM api_keys WHERE prefix = $1`, prefix).Scan(
+        &keyHash, &key.ID, &key.Name, &key.Prefix, &key.Scopes, &key.BuildingIDs, &key.ITPIDs,
+        &key.OrganizationID, &key.ExpiresAt, &key.LastUsedAt, &key.RevokedAt, &key.RotatedFrom, &key.CreatedBy, &key.CreatedAt)
+    if errors.Is(err, pgx.ErrNoRows) {
+        return nil, ErrInvalidAPIKey
+    }
+    if err != nil {
+        return nil, fmt.Errorf("get api key: %w", err)
+    }
+
+    if subtle.ConstantTimeCompare([]byte(keyHash), []byte(hashSecret(secret))) != 1 {
+        return nil, ErrInvalidAPIKey
+    }
+    if key.RevokedAt != nil {
+        return nil, ErrAPIKeyRevoked
+    }
+    if key.ExpiresAt != nil && time.Now().After(*key.ExpiresAt) {
+        return nil, ErrAPIKeyExpired
+    }
+
+    if _, err := s.pool.Exec(ctx, `UPDATE api_keys SET last_used_at = NOW() WHERE id = $1`, key.ID); err != nil {
+        return nil, fmt.Errorf("update api key usage: %w", err)
+    }
+
+    return &key, nil
+}
+
+// Middleware проверки API ключа из заголовка X-API-Key с требуемой операцией
+func (s *APIKeyStore) Middleware(scope string) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        raw := c.GetHeader(APIKeyHeader)
+        if raw == "" {
+            c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "api key required"})
+            return
+        }
+
+        key, err := s.Authenticate(c.Request.Context(), raw)
+        if errors.Is(err, ErrInvalidAPIKey) || errors.Is(err, ErrAPIKeyExpired) || errors.Is(err, ErrAPIKeyRevoked) {
+            c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+            return
+        }
+        if err != nil {
+            c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+            return
+        }
+
+        if !key.HasScope(scope) {
+            c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+                "error":          "api key scope does not allow this operation",
+                "required_scope": scope,
+            })
+            return
+        }
+
+        c.Set(apiKeyCtxKey, key)
+        c.Next()
+    }
+}
+
+// Получение API ключа текущего запроса
+func APIKeyFromContext(c *gin.Context) *APIKey {
+    value, ok := c.Get(apiKeyCtxKey)
+    if !ok {
+        return nil
+    }
+    key, _ := value.(*APIKey)
+    return key
+}
+
+func hashSecret(secret string) string {
+    sum := sha256.Sum256([]byte(secret))
+    return hex.EncodeToString(sum[:])
+}
+
+func randomHex(n int) (string, error) {
+    buf := make([]byte, n)
+    if _, err := rand.Read(buf); err != nil {
+        return "", fmt.Errorf("generate random: %w", err)
+    }
+    return hex.EncodeToString(buf), nil
+}
@@ -0,0 +1,106 @@
+package auth
+
+import (
+    "errors"
+    "fmt"
+    "time"
+
+    "github.com/golang-jwt/jwt/v5"
+    "github.com/google/uuid"
+)
+
+// Роль пользователя. Роли упорядочены: каждая следующая включает права предыдущей
+type Role string
+
+const (
+    RoleViewer     Role = "viewer"     // просмотр зданий, аналитики и мониторинга
+    RoleDispatcher Role = "dispatcher" // диспетчер: работа с ситуациями
+    RoleEngineer   Role = "engineer"   // инженер: управление генератором и диагностика
+    RoleAdmin      Role = "admin"      // администратор: пользователи и заполнение данных
+)
+
+var roleLevels = map[Role]int{
+    RoleViewer:     1,
+    RoleDispatcher: 2,
+    RoleEngineer:   3,
+    RoleAdmin:      4,
+}
+
+var (
+    ErrInvalidToken = errors.New("invalid token")
+    ErrInvalidRole  = errors.New("invalid role")
+)
+
+// Проверка, что роль известна
+func (r Role) Valid() bool {
+    _, ok := roleLevels[r]
+    return ok
+}
+
+// Проверка, что роль не ниже требуемой
+func (r Role) Allows(required Role) bool {
+    return roleLevels[r] >= roleLevels[required] && r.Valid()
+}
+
+// Claims - содержимое JWT токена
+type Claims struct {
+    UserID         uuid.UUID  `json:"uid"`
+    Username       string     `json:"username"`
+    Role           Role       `json:"role"`
+    OrganizationID *uuid.UUID `json:"org,omitempty"` // управляющая компания пользователя
+    Superuser      bool       `json:"su,omitempty"`  // доступ ко всем компаниям
+    jwt.RegisteredClaims
+}
+
+// TokenManager выпускает и проверяет JWT токены
+type TokenManager struct {
+    secret []byte
+    ttl    time.Duration
+}
+
+func NewTokenManager(secret string, ttl time.Duration) *TokenManager {
+    return &TokenManager{secret: []byte(secret), ttl: ttl}
+}
+
+// Выпуск токена для пользователя
+func (m *TokenManager) Issue(user *User) (string, time.Time, error) {
+    now := time.Now()
+    expiresAt := now.Add(m.ttl)
+
+    claims := Claims{
+        UserID:         user.ID,
+        Username:       user.Username,
+        Role:           user.Role,
+        OrganizationID: user.OrganizationID,
+        Superuser:      user.Superuser,
+        RegisteredClaims: jwt.RegisteredClaims{
+            Subject:   user.ID.String(),
+            IssuedAt:  jwt.NewNumericDate(now),
+            ExpiresAt: jwt.NewNumericDate(expiresAt),
+        },
+    }
+
+    token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(m.secret)
+    if err != nil {
+        return "", time.Time{}, fmt.Errorf("sign token: %w", err)
+    }
+
+    return token, expiresAt, nil
+}
+
+// Проверка токена и извлечение claims
+func (m *TokenManager) Parse(tokenStr string) (*Claims, error) {
+    var claims Claims
+    _, err := jwt.ParseWithClaims(tokenStr, &claims, func(t *jwt.Token) (interface{}, error) {
+        return m.secret, nil
+    }, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+    if err != nil {
+        return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+    }
+
+    if !claims.Role.Valid() {
+        return nil, ErrInvalidRole
+    }
+
+    return &claims, nil
+}
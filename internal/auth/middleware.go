@@ -0,0 +1,88 @@
+package auth
+
+import (
+    "net/http"
+    "strings"
+
+    "github.com/gin-gonic/gin"
+)
+
+const claimsKey = "auth_claims"
+
+// Middleware проверки JWT токена.
+// Токен берется из заголовка Authorization: Bearer <token>, а для WebSocket,
+// где браузер не может передать заголовок, - из параметра ?token=
+func (m *TokenManager) Middleware() gin.HandlerFunc {
+    return func(c *gin.Context) {
+        tokenStr := bearerToken(c)
+        if tokenStr == "" {
+            c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "authorization required"})
+            return
+        }
+
+        claims, err := m.Parse(tokenStr)
+        if err != nil {
+            c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid or expired token"})
+            return
+        }
+
+        c.Set(claimsKey, claims)
+        c.Next()
+    }
+}
+
+// Middleware проверки роли. Используется после TokenManager.Middleware
+func RequireRole(role Role) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        claims := ClaimsFromContext(c)
+        if claims == nil {
+            c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "authorization required"})
+            return
+        }
+
+        if !claims.Role.Allows(role) {
+            c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+                "error":         "insufficient permissions",
+                "required_role": role,
+            })
+            return
+        }
+
+        c.Next()
+    }
+}
+
+// Middleware доступа только для суперпользователя (управление компаниями)
+func RequireSuperuser() gin.HandlerFunc {
+    return func(c *gin.Context) {
+        claims := ClaimsFromContext(c)
+        if claims == nil || !claims.Superuser {
+            c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "superuser required"})
+            return
+        }
+        c.Next()
+    }
+}
+
+// Получение claims текущего запроса
+func ClaimsFromContext(c *gin.Context) *Claims {
+    value, ok := c.Get(claimsKey)
+    if !ok {
+        return nil
+    }
+    claims, _ := value.(*Claims)
+    return claims
+}
+
+func bearerToken(c *gin.Context) string {
+    header := c.GetHeader("Authorization")
+    if strings.HasPrefix(header, "Bearer ") {
+        return strings.TrimSpace(strings.TrimPrefix(header, "Bearer "))
+    }
+
+    if c.IsWebsocket() {
+        return c.Query("token")
+    }
+
+    return ""
+}
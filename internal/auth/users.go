@@ -0,0 +1,148 @@
+package auth
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "time"
+
+    "github.com/google/uuid"
+    "github.com/jackc/pgx/v5"
+    "github.com/jackc/pgx/v5/pgxpool"
+    "golang.org/x/crypto/bcrypt"
+)
+
+var ErrInvalidCredentials = errors.New("invalid username or password")
+
+// Пользователь сервиса
+type User struct {
+    ID             uuid.UUID  `json:"id"`
+    Username       string     `json:"username"`
+    Role           Role       `json:"role"`
+    OrganizationID *uuid.UUID `json:"organization_id,omitempty"`
+    Superuser      bool       `json:"is_superuser"`
+    CreatedAt      time.Time  `json:"created_at"`
+    UpdatedAt      time.Time  `json:"updated_at"`
+}
+
+// Параметры нового пользователя
+type UserParams struct {
+    Username       string
+    Password       string
+    Role           Role
+    OrganizationID *uuid.UUID
+    Superuser      bool
+}
+
+// UserStore - работа с таблицей users
+type UserStore struct {
+    pool *pgxpool.Pool
+}
+
+func NewUserStore(pool *pgxpool.Pool) *UserStore {
+    return &UserStore{pool: pool}
+}
+
+// Проверка логина и пароля
+func (s *UserStore) Authenticate(ctx context.Context, username, password string) (*User, error) {
+    var user User
+    var passwordHash string
+
+    err := s.pool.QueryRow(ctx, `
+        SELECT id, username, password_hash, role, organization_id, is_superuser, created_at, updated_at
+        FROM users WHERE username = $1`, username).Scan(
+        &user.ID, &user.Username, &passwordHash, &user.Role, &user.OrganizationID, &user.Superuser,
+        &user.CreatedAt, &user.UpdatedAt)
+    if errors.Is(err, pgx.ErrNoRows) {
+        return nil, ErrInvalidCredentials
+    }
+    if err != nil {
+        return nil, fmt.Errorf("get user: %w", err)
+    }
+
+    if err := bcrypt.CompareHashAndPassword([]byte(passwordHash), []byte(password)); err != nil {
+        return nil, ErrInvalidCredentials
+    }
+
+    return &user, nil
+}
+
+// Создание пользователя
+func (s *UserStore) Create(ctx context.Context, params UserParams) (*User, error) {
+    if !params.Role.Valid() {
+        return nil, ErrInvalidRole
+    }
+
+    hash, err := bcrypt.GenerateFromPassword([]byte(params.Password), bcrypt.DefaultCost)
+    if err != nil {
+        return nil, fmt.Errorf("hash password: %w", err)
+    }
+
+    user := User{
+        ID:             uuid.New(),
+        Username:       params.Username,
+        Role:           params.Role,
+        OrganizationID: params.OrganizationID,
+        Superuser:      params.Superuser,
+    }
+    err = s.pool.QueryRow(ctx, `
+        INSERT INTO users (id, username, password_hash, role, organization_id, is_superuser, created_at, updated_at)
+        VALUES ($1, $2, $3, $4, $5, $6, NOW(), NOW())
+        RETURNING created_at, updated_at`,
+        user.ID, user.Username, string(hash), user.Role, user.OrganizationID, user.Superuser).Scan(
+        &user.CreatedAt, &user.UpdatedAt)
+    if err != nil {
+        return nil, fmt.Errorf("insert user %s: %w", params.Username, err)
+    }
+
+    return &user, nil
+}
+
+// Список пользователей компании (organizationID == nil - всех компаний)
+func (s *UserStore) List(ctx context.Context, organizationID *uuid.UUID) ([]User, error) {
+    rows, err := s.pool.Query(ctx, `
+        SELECT id, username, role, organization_id, is_superuser, created_at, updated_at
+        FROM users
+        WHERE ($1::uuid IS NULL OR organization_id = $1)
+        ORDER BY username`, organizationID)
+    if err != nil {
+        return nil, fmt.Errorf("list users: %w", err)
+    }
+    defer rows.Close()
+
+    users := []User{}
+    for rows.Next() {
+        var u User
+        if err := rows.Scan(&u.ID, &u.Username, &u.Role, &u.OrganizationID, &u.Superuser,
+            &u.CreatedAt, &u.UpdatedAt); err != nil {
+            return nil, fmt.Errorf("scan user: %w", err)
+        }
+        users = append(users, u)
+    }
+
+    return users, rows.Err()
+}
+
+// Создание администратора-суперпользователя при первом запуске, если пользователей еще нет
+func (s *UserStore) EnsureAdmin(ctx context.Context, username, password string) (bool, error) {
+    var count int
+    if err := s.pool.QueryRow(ctx, "SELECT COUNT(*) FROM users").Scan(&count); err != nil {
+        return false, fmt.Errorf("count users: %w", err)
+    }
+
+    if count > 0 {
+        return false, nil
+    }
+
+    _, err := s.Create(ctx, UserParams{
+        Username:  username,
+        Password:  password,
+        Role:      RoleAdmin,
+        Superuser: true,
+    })
+    if err != nil {
+        return false, err
+    }
+
+    return true, nil
+}
@@ -0,0 +1,130 @@
+package benchmark
+
+import (
+    "context"
+    "errors"
+    "fmt"
+
+    "service/internal/tenant"
+
+    "github.com/google/uuid"
+    "github.com/jackc/pgx/v5"
+    "github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Минимальное число сопоставимых зданий с данными, при котором группа используется
+// для нормы соотношения ГВС/ХВС и оценки отклонений
+const MinPeers = 5
+
+// Здание без этажности или года постройки не входит ни в одну группу
+var ErrNoAttributes = errors.New("building floors and year_built are not set")
+
+// Характеристики здания; nil - не задано
+type Attributes struct {
+    Apartments *int     `json:"apartments"`
+    Floors     *int     `json:"floors"`
+    Residents  *int     `json:"residents"`
+    YearBuilt  *int     `json:"year_built"`
+    Area       *float64 `json:"area"` // общая площадь, м²
+}
+
+// Группа сопоставимых зданий по этажности и периоду постройки, например "floors_6_9/1960_1989".
+// nil - этажность или год постройки не заданы
+func PeerGroup(a Attributes) *string {
+    if a.Floors == nil || a.YearBuilt == nil {
+        return nil
+    }
+
+    var height string
+    switch floors := *a.Floors; {
+    case floors <= 5:
+        height = "floors_1_5"
+    case floors <= 9:
+        height = "floors_6_9"
+    case floors <= 16:
+        height = "floors_10_16"
+    default:
+        height = "floors_17"
+    }
+
+    var era string
+    switch year := *a.YearBuilt; {
+    case year < 1960:
+        era = "before_1960"
+    case year < 1990:
+        era = "1960_1989"
+    case year < 2010:
+        era = "1990_2009"
+    default:
+        era = "since_2010"
+    }
+
+    group := height + "/" + era
+    return &group
+}
+
+// Store - характеристики зданий
+type Store struct {
+    pool *pgxpool.Pool
+}
+
+func NewStore(pool *pgxpool.Pool) *Store {
+    return &Store{pool: pool}
+}
+
+// Замена характеристик здания с пересчетом группы сопоставимых зданий. Возвращает прежние характеристики
+func (s *Store) SetAttributes(ctx context.Context, buildingID uuid.UUID, a Attributes) (*Attributes, error) {
+    var before Attributes
+    err := s.pool.QueryRow(ctx, `
+        UPDATE buildings b SET apartments = $2, floors = $3, residents = $4, year_built = $5, area = $6,
+                               peer_group = $7, updated_at = NOW()
+        FROM buildings old
+        WHERE b.id = $1 AND old.id = b.id
+        RETURNING old.apartments, old.floors, old.residents, old.year_built, old.area::float8`,
+        buildingID, a.Apartments, a.Floors, a.Residents, a.YearBuilt, a.Area, PeerGroup(a)).
+        Scan(&before.Apartments, &before.Floors, &before.Residents, &before.YearBuilt, &before.Area)
+    if errors.Is(err, pgx.ErrNoRows) {
+        return nil, tenant.ErrBuildingNotFound
+    }
+    if err != nil {
+        return nil, fmt.Errorf("set building %s attributes: %w", buildingID, err)
+    }
+    return &before, nil
+}
+
+// Соотношение ГВС/ХВС сопоставимых зданий по последней проверке парка (building_status)
+type PeerRatios struct {
+    PeerGroup string
+    Peers     int // здания группы с данными, кроме самого здания
+    P10       float64
+    Median    float64
+    P90       float64
+}
+
+// Добавление выборки соотношений сопоставимых зданий в пакет запросов; здания без группы
+// или без сопоставимых зданий с данными в результат не входят
+func QueuePeerRatios(batch *pgx.Batch, buildingIDs []uuid.UUID) map[uuid.UUID]PeerRatios {
+    result := make(map[uuid.UUID]PeerRatios, len(buildingIDs))
+    batch.Queue(`
+        SELECT b.id, b.peer_group, COUNT(*),
+               percentile_cont(0.1) WITHIN GROUP (ORDER BY s.hot_to_cold_ratio),
+               percentile_cont(0.5) WITHIN GROUP (ORDER BY s.hot_to_cold_ratio),
+               percentile_cont(0.9) WITHIN GROUP (ORDER BY s.hot_to_cold_ratio)
+        FROM buildings b
+        JOIN buildings p ON p.peer_group = b.peer_group AND p.id <> b.id
+        JOIN building_status s ON s.building_id = p.id
+        WHERE b.id = ANY($1)
+        AND s.data_source = 'database' AND s.hot_to_cold_ratio > 0
+        GROUP BY b.id, b.peer_group`, buildingIDs).Query(func(rows pgx.Rows) error {
+        for rows.Next() {
+            var id uuid.UUID
+            var r PeerRatios
+            if err := rows.Scan(&id, &r.PeerGroup, &r.Peers, &r.P10, &r.Median, &r.P90); err != nil {
+                return fmt.Errorf("scan peer ratios: %w", err)
+            }
+            result[id] = r
+        }
+        return rows.Err()
+    })
+    return result
+}
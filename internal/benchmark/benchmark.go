@@ -0,0 +1,302 @@
+package benchmark
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "math"
+    "sort"
+    "time"
+
+    "service/internal/tenant"
+    "service/internal/timeseries"
+
+    "github.com/google/uuid"
+    "github.com/jackc/pgx/v5"
+    "github.com/jackc/pgx/v5/pgxpool"
+)
+
+// База удельного расхода
+const (
+    BasisPerCapita = "per_capita" // л/чел·сут
+    BasisPerArea   = "per_m2"     // л/м²·сут
+)
+
+// Показатели сравнения
+const (
+    IndicatorColdWater = "cold_water"
+    IndicatorHotWater  = "hot_water"
+    IndicatorRatio     = "hot_to_cold_ratio"
+    IndicatorDeltaTemp = "delta_temp"
+)
+
+var indicatorOrder = []string{IndicatorColdWater, IndicatorHotWater, IndicatorRatio, IndicatorDeltaTemp}
+
+// Модифицированная z-оценка (по медиане и MAD), выше которой показатель считается выбросом
+const OutlierScore = 3.5
+
+// Число зданий, агрегаты которых читаются одним запросом
+const chunkSize = 500
+
+// Показатель здания в сравнении с его группой
+type Indicator struct {
+    Name       string   `json:"name"`
+    Value      float64  `json:"value"`
+    Unit       string   `json:"unit"`
+    PeerMedian *float64 `json:"peer_median"` // null - в группе меньше MinPeers зданий с показателем
+    Percentile *float64 `json:"percentile"`  // доля зданий группы с меньшим значением, %
+    Score      *float64 `json:"score"`       // модифицированная z-оценка; null при нулевом разбросе группы
+    Outlier    bool     `json:"outlier"`
+}
+
+// Результат сравнения здания. Score - наибольшая по модулю z-оценка его показателей
+type Entry struct {
+    BuildingID uuid.UUID   `json:"building_id"`
+    Address    string      `json:"address"`
+    PeerGroup  string      `json:"peer_group"`
+    GroupSize  int         `json:"group_size"`
+    Indicators []Indicator `json:"indicators"`
+    Score      float64     `json:"score"`
+    Outlier    bool        `json:"outlier"`
+
+    organizationID *uuid.UUID
+}
+
+// Здание группы и его показатели до сравнения
+type member struct {
+    entry  *Entry
+    values map[string]float64
+}
+
+// Benchmarker - сравнение удельного потребления, соотношения ГВС/ХВС и ΔT зданий с сопоставимыми зданиями.
+// Группы строятся по всем зданиям с заданными характеристиками; компания видит только свои здания,
+// здания других компаний входят лишь в статистику группы
+type Benchmarker struct {
+    pool     *pgxpool.Pool
+    readings *timeseries.Reader
+}
+
+func NewBenchmarker(pool *pgxpool.Pool, readings *timeseries.Reader) *Benchmarker {
+    return &Benchmarker{pool: pool, readings: readings}
+}
+
+// Сравнение здания buildingID с его группой за последние days суток
+func (b *Benchmarker) Building(ctx context.Context, scope tenant.Scope, buildingID uuid.UUID, days int, basis string) (*Entry, error) {
+    var organizationID *uuid.UUID
+    var group *string
+    err := b.pool.QueryRow(ctx, "SELECT organization_id, peer_group FROM buildings WHERE id = $1", buildingID).
+        Scan(&organizationID, &group)
+    if errors.Is(err, pgx.ErrNoRows) || (err == nil && !scope.Allows(organizationID)) {
+        return nil, tenant.ErrBuildingNotFound
+    }
+    if err != nil {
+        return nil, fmt.Errorf("get building %s peer group: %w", buildingID, err)
+    }
+    if group == nil {
+        return nil, ErrNoAttributes
+    }
+
+    entries, err := b.compare(ctx, group, days, basis)
+    if err != nil {
+        return nil, err
+    }
+    for _, e := range entries {
+        if e.BuildingID == buildingID {
+            return e, nil
+        }
+    }
+    return nil, tenant.ErrBuildingNotFound
+}
+
+// Сравнение всех зданий компании с группами за последние days суток, по убыванию Score.
+// outliersOnly - только здания с выбросами
+func (b *Benchmarker) Rank(ctx context.Context, scope tenant.Scope, days int, basis string, outliersOnly bool) ([]*Entry, error) {
+    entries, err := b.compare(ctx, nil, days, basis)
+    if err != nil {
+        return nil, err
+    }
+
+    ranked := []*Entry{}
+    for _, e := range entries {
+        if scope.Allows(e.organizationID) && (!outliersOnly || e.Outlier) {
+            ranked = append(ranked, e)
+        }
+    }
+    sort.SliceStable(ranked, func(i, j int) bool { return ranked[i].Score > ranked[j].Score })
+    return ranked, nil
+}
+
+// Показатели зданий группы group (nil - всех групп) и их сравнение внутри групп
+func (b *Benchmarker) compare(ctx context.Context, group *string, days int, basis string) ([]*Entry, error) {
+    rows, err := b.pool.Query(ctx, `
+        SELECT id, address, organization_id, peer_group, residents, area::float8
+        FROM buildings
+        WHERE peer_group IS NOT NULL AND ($1::text IS NULL OR peer_group = $1)
+        ORDER BY peer_group, address`, group)
+    if err != nil {
+        return nil, fmt.Errorf("list peer buildings: %w", err)
+    }
+    type building struct {
+        entry     *Entry
+        residents *int
+        area      *float64
+    }
+    buildings, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (building, error) {
+        var bld building
+        bld.entry = &Entry{}
+        err := row.Scan(&bld.entry.BuildingID, &bld.entry.Address, &bld.entry.organizationID, &bld.entry.PeerGroup,
+            &bld.residents, &bld.area)
+        return bld, err
+    })
+    if err != nil {
+        return nil, fmt.Errorf("list peer buildings: %w", err)
+    }
+
+    to := time.Now()
+    from := to.AddDate(0, 0, -days)
+    groups := make(map[string][]member)
+    var entries []*Entry
+
+    for start := 0; start < len(buildings); start += chunkSize {
+        chunk := buildings[start:min(start+chunkSize, len(buildings))]
+        ids := make([]uuid.UUID, len(chunk))
+        for i, bld := range chunk {
+            ids[i] = bld.entry.BuildingID
+        }
+        stats, err := b.readings.Aggregate(ctx, ids, from, to,
+            timeseries.MetricColdVolume, timeseries.MetricHotVolume, timeseries.MetricDeltaTemp)
+        if err != nil {
+            return nil, err
+        }
+
+        for _, bld := range chunk {
+            var divisor *float64
+            switch basis {
+            case BasisPerCapita:
+                if bld.residents != nil && *bld.residents > 0 {
+                    d := float64(*bld.residents)
+                    divisor = &d
+                }
+            case BasisPerArea:
+                divisor = bld.area
+            }
+            values := indicatorValues(stats[bld.entry.BuildingID], divisor, days)
+            m := member{entry: bld.entry, values: values}
+            groups[bld.entry.PeerGroup] = append(groups[bld.entry.PeerGroup], m)
+            entries = append(entries, bld.entry)
+        }
+    }
+
+    for _, members := range groups {
+        scoreGroup(members, basis)
+    }
+    return entries, nil
+}
+
+// Показатели здания: удельный суточный расход ХВС и ГВС в литрах на divisor (без divisor не считается)
+// и соотношение ГВС/ХВС по объемам за период, средняя ΔT
+func indicatorValues(stats map[string]timeseries.Stats, divisor *float64, days int) map[string]float64 {
+    values := make(map[string]float64, len(indicatorOrder))
+    cold, hot := stats[timeseries.MetricColdVolume], stats[timeseries.MetricHotVolume]
+    if divisor != nil && *divisor > 0 && days > 0 {
+        if cold.Count > 0 {
+            values[IndicatorColdWater] = cold.Sum * 1000 / float64(days) / *divisor
+        }
+        if hot.Count > 0 {
+            values[IndicatorHotWater] = hot.Sum * 1000 / float64(days) / *divisor
+        }
+    }
+    if cold.Sum > 0 && hot.Count > 0 {
+        values[IndicatorRatio] = hot.Sum / cold.Sum * 100
+    }
+    if delta := stats[timeseries.MetricDeltaTemp]; delta.Count > 0 {
+        values[IndicatorDeltaTemp] = delta.Avg()
+    }
+    return values
+}
+
+func indicatorUnit(name, basis string) string {
+    switch name {
+    case IndicatorRatio:
+        return "%"
+    case IndicatorDeltaTemp:
+        return "°C"
+    }
+    if basis == BasisPerArea {
+        return "л/м²·сут"
+    }
+    return "л/чел·сут"
+}
+
+func roundIndicator(v float64) float64 {
+    return math.Round(v*10) / 10
+}
+
+func median(sorted []float64) float64 {
+    n := len(sorted)
+    if n%2 == 1 {
+        return sorted[n/2]
+    }
+    return (sorted[n/2-1] + sorted[n/2]) / 2
+}
+
+// Сравнение показателей зданий группы: медиана, перцентиль и модифицированная z-оценка
+// 0.6745 * (x - медиана) / MAD. Показатель оценивается, если он есть не меньше чем у MinPeers зданий
+func scoreGroup(members []member, basis string) {
+    for _, m := range members {
+        m.entry.GroupSize = len(members)
+        m.entry.Indicators = []Indicator{}
+    }
+
+    for _, name := range indicatorOrder {
+        var values []float64
+        for _, m := range members {
+            if v, ok := m.values[name]; ok {
+                values = append(values, v)
+            }
+        }
+        sort.Float64s(values)
+
+        var med, mad float64
+        scored := len(values) >= MinPeers
+        if scored {
+            med = median(values)
+            deviations := make([]float64, len(values))
+            for i, v := range values {
+                deviations[i] = math.Abs(v - med)
+            }
+            sort.Float64s(deviations)
+            mad = median(deviations)
+        }
+
+        for _, m := range members {
+            v, ok := m.values[name]
+            if !ok {
+                continue
+            }
+            ind := Indicator{Name: name, Value: roundIndicator(v), Unit: indicatorUnit(name, basis)}
+            if scored {
+                peerMedian := roundIndicator(med)
+                ind.PeerMedian = &peerMedian
+
+                below := sort.SearchFloat64s(values, v)
+                equal := sort.SearchFloat64s(values, math.Nextafter(v, math.Inf(1))) - below
+                percentile := roundIndicator((float64(below) + float64(equal)/2) / float64(len(values)) * 100)
+                ind.Percentile = &percentile
+
+                if mad > 0 {
+                    score := math.Round(0.6745*(v-med)/mad*100) / 100
+                    ind.Score = &score
+                    ind.Outlier = math.Abs(score) > OutlierScore
+                    if math.Abs(score) > m.entry.Score {
+                        m.entry.Score = math.Abs(score)
+                    }
+                }
+            }
+            if ind.Outlier {
+                m.entry.Outlier = true
+            }
+            m.entry.Indicators = append(m.entry.Indicators, ind)
+        }
+    }
+}
@@ -31,6 +31,7 @@ func NewPool(conf Config) (*pgxpool.Pool, error) {
 	poolConfig.MaxConns = 3000000
 	poolConfig.MinConns = 2
 	poolConfig.MaxConnLifetime = (5 * time.Second)
+	poolConfig.ConnConfig.Tracer = newQueryTracer()
 
 	pool, err := pgxpool.NewWithConfig(context.Background(), poolConfig)
 	if err != nil {
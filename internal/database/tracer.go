@@ -0,0 +1,125 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"time"
+
+	"service/internal/logging"
+	"service/internal/tracing"
+
+	"github.com/jackc/pgx/v5"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type queryStartKey struct{}
+
+type queryStart struct {
+	sql   string
+	start time.Time
+}
+
+// queryTracer пишет SQL запросы в журнал (успешные - на уровне debug, ошибки - на уровне error)
+// и создает для каждого запроса и пакета запросов спан OpenTelemetry.
+// request_id и родительский спан берутся из контекста запроса
+type queryTracer struct {
+	logger *slog.Logger
+	tracer trace.Tracer
+}
+
+func newQueryTracer() *queryTracer {
+	return &queryTracer{
+		logger: logging.Component("db"),
+		tracer: tracing.Tracer("database"),
+	}
+}
+
+func (t *queryTracer) TraceQueryStart(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	sql := compactSQL(data.SQL)
+	ctx, _ = t.tracer.Start(ctx, spanName(sql),
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(semconv.DBSystemPostgreSQL, semconv.DBQueryText(sql)))
+	return context.WithValue(ctx, queryStartKey{}, queryStart{sql: sql, start: time.Now()})
+}
+
+func (t *queryTracer) TraceQueryEnd(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryEndData) {
+	qs, _ := ctx.Value(queryStartKey{}).(queryStart)
+	duration := time.Since(qs.start)
+
+	span := trace.SpanFromContext(ctx)
+	defer span.End()
+
+	if data.Err != nil && !errors.Is(data.Err, pgx.ErrNoRows) {
+		span.RecordError(data.Err)
+		span.SetStatus(codes.Error, data.Err.Error())
+		t.logger.ErrorContext(ctx, "query failed",
+			slog.String("sql", qs.sql),
+			slog.Duration("duration", duration),
+			logging.Err(data.Err))
+		return
+	}
+
+	span.SetAttributes(attribute.Int64("db.rows_affected", data.CommandTag.RowsAffected()))
+	if t.logger.Enabled(ctx, slog.LevelDebug) {
+		t.logger.DebugContext(ctx, "query",
+			slog.String("sql", qs.sql),
+			slog.Int64("rows", data.CommandTag.RowsAffected()),
+			slog.Duration("duration", duration))
+	}
+}
+
+// Пакеты запросов (прием показаний) - один спан на пакет
+func (t *queryTracer) TraceBatchStart(ctx context.Context, _ *pgx.Conn, data pgx.TraceBatchStartData) context.Context {
+	size := 0
+	if data.Batch != nil {
+		size = data.Batch.Len()
+	}
+	ctx, _ = t.tracer.Start(ctx, "batch",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(semconv.DBSystemPostgreSQL, attribute.Int("db.batch.size", size)))
+	return context.WithValue(ctx, queryStartKey{}, queryStart{sql: "batch", start: time.Now()})
+}
+
+func (t *queryTracer) TraceBatchQuery(ctx context.Context, _ *pgx.Conn, data pgx.TraceBatchQueryData) {
+	if data.Err != nil {
+		trace.SpanFromContext(ctx).RecordError(data.Err)
+	}
+}
+
+func (t *queryTracer) TraceBatchEnd(ctx context.Context, _ *pgx.Conn, data pgx.TraceBatchEndData) {
+	qs, _ := ctx.Value(queryStartKey{}).(queryStart)
+
+	span := trace.SpanFromContext(ctx)
+	defer span.End()
+
+	if data.Err != nil {
+		span.SetStatus(codes.Error, data.Err.Error())
+		t.logger.ErrorContext(ctx, "batch failed", slog.Duration("duration", time.Since(qs.start)), logging.Err(data.Err))
+	}
+}
+
+// SQL в одну строку для журнала и спанов
+func compactSQL(sql string) string {
+	return strings.Join(strings.Fields(sql), " ")
+}
+
+// Имя спана - операция и таблица, например "SELECT hot_water_meters"
+func spanName(sql string) string {
+	fields := strings.Fields(sql)
+	if len(fields) == 0 {
+		return "query"
+	}
+	op := strings.ToUpper(fields[0])
+	for i, f := range fields[:len(fields)-1] {
+		switch strings.ToUpper(f) {
+		case "FROM", "INTO", "UPDATE":
+			return op + " " + strings.Trim(fields[i+1], "(),;")
+		}
+	}
+	return op
+}
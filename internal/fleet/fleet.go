@@ -0,0 +1,334 @@
+package fleet
+
+import (
+    "context"
+    "encoding/json"
+    "fmt"
+    "log/slog"
+    "time"
+
+    "service/internal/incident"
+    "service/internal/logging"
+    "service/internal/models"
+    "service/internal/network"
+    "service/internal/risk"
+    "service/internal/service"
+
+    "github.com/google/uuid"
+    "github.com/jackc/pgx/v5"
+    "github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Число зданий, анализируемых одним пакетом
+const chunkSize = 500
+
+// Период истории инцидентов, учитываемый в оценке риска
+const incidentHistory = 30 * 24 * time.Hour
+
+// Виды инцидентов, которые открывает и закрывает проверка парка
+var analysisKinds = []string{incident.KindWaterBalance, incident.KindTemperature, incident.KindPump}
+
+// Monitor - периодическая проверка всех зданий и сводка по парку для панели диспетчера
+type Monitor struct {
+    pool       *pgxpool.Pool
+    analyzer   *service.Analyzer
+    incidents  *incident.Store
+    correlator *network.Correlator
+    scorer     *risk.Scorer
+    weights    risk.Weights
+    days       int
+    staleAfter time.Duration
+    history    time.Duration
+    log        *slog.Logger
+}
+
+// days - период анализа, staleAfter - через сколько без показаний данные здания считаются устаревшими,
+// history - срок хранения истории оценки риска (0 - бессрочно). correlator группирует аномалии зданий в ситуации
+func NewMonitor(pool *pgxpool.Pool, analyzer *service.Analyzer, incidents *incident.Store, correlator *network.Correlator, weights risk.Weights,
+    days int, staleAfter, history time.Duration) (*Monitor, error) {
+    if days <= 0 {
+        return nil, fmt.Errorf("analysis period must be positive, got %d days", days)
+    }
+    if staleAfter <= 0 {
+        return nil, fmt.Errorf("stale threshold must be positive, got %s", staleAfter)
+    }
+    if history < 0 {
+        return nil, fmt.Errorf("risk history retention must not be negative, got %s", history)
+    }
+    return &Monitor{
+        pool:       pool,
+        analyzer:   analyzer,
+        incidents:  incidents,
+        correlator: correlator,
+        scorer:     risk.NewScorer(weights),
+        weights:    weights,
+        days:       days,
+        staleAfter: staleAfter,
+        history:    history,
+        log:        logging.Component("fleet"),
+    }, nil
+}
+
+// Проход фоновой задачи: анализ всех зданий пакетами, сохранение состояния
+// и оценки риска в building_status и risk_history, сверка инцидентов и ситуаций узлов сети
+func (m *Monitor) RunOnce(ctx context.Context) error {
+    rows, err := m.pool.Query(ctx, "SELECT id FROM buildings ORDER BY id")
+    if err != nil {
+        return fmt.Errorf("list buildings: %w", err)
+    }
+    buildingIDs, err := pgx.CollectRows(rows, pgx.RowTo[uuid.UUID])
+    if err != nil {
+        return fmt.Errorf("list buildings: %w", err)
+    }
+
+    // Ситуации сверяются после проверки всех пакетов: здания одной группы могут попасть в разные пакеты
+    var opened, resolved int
+    var checked []uuid.UUID
+    for start := 0; start < len(buildingIDs); start += chunkSize {
+        chunk := buildingIDs[start:min(start+chunkSize, len(buildingIDs))]
+        o, r, err := m.checkChunk(ctx, chunk, &checked)
+        if err != nil {
+            return err
+        }
+        opened += o
+        resolved += r
+    }
+
+    situationsOpened, situationsResolved, err := m.correlator.Run(ctx, checked)
+    if err != nil {
+        return err
+    }
+
+    if err := m.incidents.UpdateMetrics(ctx); err != nil {
+        return err
+    }
+
+    if m.history > 0 {
+        if _, err := m.pool.Exec(ctx, "DELETE FROM risk_history WHERE hour < $1", time.Now().Add(-m.history)); err != nil {
+            return fmt.Errorf("expire risk history: %w", err)
+        }
+    }
+
+    m.log.InfoContext(ctx, "fleet status refreshed",
+        "buildings", len(buildingIDs),
+        "incidents_opened", opened,
+        "incidents_resolved", resolved,
+        "situations_opened", situationsOpened,
+        "situations_resolved", situationsResolved)
+    return nil
+}
+
+// Проверка пакета зданий. Здания с данными добавляются в allChecked
+func (m *Monitor) checkChunk(ctx context.Context, buildingIDs []uuid.UUID, allChecked *[]uuid.UUID) (opened, resolved int, err error) {
+    results, err := m.analyzer.AnalyzeBuildings(ctx, buildingIDs, m.days)
+    if err != nil {
+        return 0, 0, err
+    }
+
+    now := time.Now()
+    history, err := m.incidents.CountsSince(ctx, buildingIDs, now.Add(-incidentHistory))
+    if err != nil {
+        return 0, 0, err
+    }
+    weights, err := json.Marshal(m.weights)
+    if err != nil {
+        return 0, 0, fmt.Errorf("marshal risk weights: %w", err)
+    }
+
+    var ids []uuid.UUID
+    var waterStatuses, tempStatuses, pumpStatuses, sources, factors []string
+    var ratios []float64
+    var anomalies, risks []int32
+
+    // Здания без данных не участвуют в сверке: отсутствие показаний не закрывает инциденты
+    var checked []uuid.UUID
+    detected := make(map[uuid.UUID][]incident.Detection)
+
+    for _, id := range buildingIDs {
+        a := results[id]
+        if a == nil {
+            continue
+        }
+        ids = append(ids, id)
+        waterStatuses = append(waterStatuses, a.WaterBalanceStatus)
+        tempStatuses = append(tempStatuses, a.TemperatureStatus)
+        pumpStatuses = append(pumpStatuses, a.PumpStatus)
+        sources = append(sources, a.DataSource)
+        ratios = append(ratios, a.HotToColdRatio)
+        anomalies = append(anomalies, int32(a.AnomalyCount))
+
+        assessment := m.scorer.Score(riskInputs(a, history[id]))
+        raw, err := json.Marshal(assessment.Factors)
+        if err != nil {
+            return 0, 0, fmt.Errorf("marshal risk factors: %w", err)
+        }
+        risks = append(risks, int32(assessment.Score))
+        factors = append(factors, string(raw))
+
+        if a.DataSource == service.DataSourceDatabase {
+            checked = append(checked, id)
+            if list := detect(a, m.days); len(list) > 0 {
+                detected[id] = list
+            }
+        }
+    }
+
+    // Текущее состояние и почасовая история оценки одним пакетом
+    batch := &pgx.Batch{}
+    batch.Queue(`
+        INSERT INTO building_status (building_id, water_balance_status, temperature_status, pump_status,
+                                     hot_to_cold_ratio, anomaly_count, data_source, risk_score, risk_factors, computed_at)
+        SELECT s.building_id, s.water, s.temp, s.pump, s.ratio, s.anomalies, s.source, s.risk, s.factors::jsonb, $10::timestamptz
+        FROM unnest($1::uuid[], $2::text[], $3::text[], $4::text[], $5::float8[], $6::int[], $7::text[], $8::int[], $9::text[])
+            AS s(building_id, water, temp, pump, ratio, anomalies, source, risk, factors)
+        ON CONFLICT (building_id) DO UPDATE SET
+            water_balance_status = EXCLUDED.water_balance_status,
+            temperature_status = EXCLUDED.temperature_status,
+            pump_status = EXCLUDED.pump_status,
+            hot_to_cold_ratio = EXCLUDED.hot_to_cold_ratio,
+            anomaly_count = EXCLUDED.anomaly_count,
+            data_source = EXCLUDED.data_source,
+            risk_score = EXCLUDED.risk_score,
+            risk_factors = EXCLUDED.risk_factors,
+            computed_at = EXCLUDED.computed_at`,
+        ids, waterStatuses, tempStatuses, pumpStatuses, ratios, anomalies, sources, risks, factors, now)
+    batch.Queue(`
+        INSERT INTO risk_history (building_id, hour, score, factors, weights, computed_at)
+        SELECT s.building_id, date_trunc('hour', $5::timestamptz AT TIME ZONE 'UTC') AT TIME ZONE 'UTC',
+               s.risk, s.factors::jsonb, $4::jsonb, $5
+        FROM unnest($1::uuid[], $2::int[], $3::text[]) AS s(building_id, risk, factors)
+        ON CONFLICT (building_id, hour) DO UPDATE SET
+            score = EXCLUDED.score,
+            factors = EXCLUDED.factors,
+            weights = EXCLUDED.weights,
+            computed_at = EXCLUDED.computed_at`,
+        ids, risks, factors, string(weights), now)
+    if err := m.pool.SendBatch(ctx, batch).Close(); err != nil {
+        return 0, 0, fmt.Errorf("save building status: %w", err)
+    }
+
+    opened, resolved, err = m.incidents.Reconcile(ctx, analysisKinds, checked, detected)
+    if err != nil {
+        return 0, 0, err
+    }
+    *allChecked = append(*allChecked, checked...)
+    return opened, resolved, nil
+}
+
+// Потери в сутки по стоимости cost за период анализа days; nil - потерь нет или тариф не задан
+func lossPerDay(cost float64, days int) *float64 {
+    if cost <= 0 {
+        return nil
+    }
+    v := models.RoundMoney(cost / float64(days))
+    return &v
+}
+
+// Условия анализа, по которым открываются инциденты (те же, что считаются аномалиями).
+// Инциденты баланса и температуры получают оценку потерь по тарифу здания
+func detect(a *service.ConsumptionAnalysis, days int) []incident.Detection {
+    var list []incident.Detection
+
+    var imbalanceLoss, heatLoss *float64
+    if a.Cost != nil {
+        imbalanceLoss = lossPerDay(a.Cost.ImbalanceCost, days)
+        heatLoss = lossPerDay(a.Cost.ExcessHeatCost, days)
+    }
+
+    switch a.WaterBalanceStatus {
+    case "leak":
+        list = append(list, incident.Detection{
+            Kind:       incident.KindWaterBalance,
+            Severity:   incident.SeverityCritical,
+            Title:      fmt.Sprintf("Возможная утечка: ГВС составляет %.1f%% от ХВС", a.HotToColdRatio),
+            Details:    map[string]interface{}{"hot_to_cold_ratio": a.HotToColdRatio, "ratio_norm": a.RatioNorm, "period": a.Period},
+            LossPerDay: imbalanceLoss,
+        })
+    case "error":
+        list = append(list, incident.Detection{
+            Kind:       incident.KindWaterBalance,
+            Severity:   incident.SeverityWarning,
+            Title:      fmt.Sprintf("Нарушен баланс ХВС/ГВС: ГВС составляет %.1f%% от ХВС", a.HotToColdRatio),
+            Details:    map[string]interface{}{"hot_to_cold_ratio": a.HotToColdRatio, "ratio_norm": a.RatioNorm, "period": a.Period},
+            LossPerDay: imbalanceLoss,
+        })
+    }
+
+    // В здании с несколькими ИТП баланс проверяется и по каждому ИТП: отклонения
+    // разных ИТП могут компенсировать друг друга в балансе здания
+    if len(a.ITPs) > 1 {
+        for _, itp := range a.ITPs {
+            details := map[string]interface{}{
+                "itp_id":            itp.ITPID,
+                "itp_number":        itp.ITPNumber,
+                "hot_to_cold_ratio": itp.HotToColdRatio,
+                "ratio_norm":        a.RatioNorm,
+                "period":            a.Period,
+            }
+            switch itp.WaterBalanceStatus {
+            case "leak":
+                list = append(list, incident.Detection{
+                    Kind:       incident.KindWaterBalance,
+                    Subject:    itp.ITPID.String(),
+                    Severity:   incident.SeverityCritical,
+                    Title:      fmt.Sprintf("%s: возможная утечка, ГВС составляет %.1f%% от ХВС", itp.ITPNumber, itp.HotToColdRatio),
+                    Details:    details,
+                    LossPerDay: lossPerDay(itp.LossCost, days),
+                })
+            case "error":
+                list = append(list, incident.Detection{
+                    Kind:       incident.KindWaterBalance,
+                    Subject:    itp.ITPID.String(),
+                    Severity:   incident.SeverityWarning,
+                    Title:      fmt.Sprintf("%s: нарушен баланс ХВС/ГВС, ГВС составляет %.1f%% от ХВС", itp.ITPNumber, itp.HotToColdRatio),
+                    Details:    details,
+                    LossPerDay: lossPerDay(itp.LossCost, days),
+                })
+            }
+        }
+    }
+
+    if a.TemperatureStatus == "critical" && a.TemperatureData != nil {
+        list = append(list, incident.Detection{
+            Kind:       incident.KindTemperature,
+            Severity:   incident.SeverityCritical,
+            Title:      fmt.Sprintf("ΔT вне нормы: %.1f°C при норме 17-23°C", a.TemperatureData.AvgDeltaTemp),
+            Details:    map[string]interface{}{"avg_delta_temp": a.TemperatureData.AvgDeltaTemp, "period": a.Period},
+            LossPerDay: heatLoss,
+        })
+    }
+
+    if a.PumpStatus == "critical" && a.PumpData != nil {
+        list = append(list, incident.Detection{
+            Kind:     incident.KindPump,
+            Severity: incident.SeverityCritical,
+            Title:    fmt.Sprintf("Критическое состояние насосов: %d из %d", a.PumpData.CriticalPumps, a.PumpData.TotalPumps),
+            Details:  map[string]interface{}{"critical_pumps": a.PumpData.CriticalPumps, "total_pumps": a.PumpData.TotalPumps},
+        })
+    }
+
+    return list
+}
+
+// Исходные данные оценки риска по результату анализа и истории инцидентов
+func riskInputs(a *service.ConsumptionAnalysis, incidents incident.Counts) risk.Inputs {
+    in := risk.Inputs{
+        HasWaterData:    a.DataSource == service.DataSourceDatabase,
+        HotToColdRatio:  a.HotToColdRatio,
+        RatioNormMin:    a.RatioNorm.Min,
+        RatioNormMax:    a.RatioNorm.Max,
+        DataCoverage:    a.DataCoverage,
+        RecentIncidents: incidents.Total,
+        RecentCritical:  incidents.Critical,
+    }
+    if a.TemperatureData != nil {
+        in.HasTemperatureData = true
+        in.AvgDeltaTemp = a.TemperatureData.AvgDeltaTemp
+    }
+    if a.PumpData != nil {
+        in.TotalPumps = a.PumpData.TotalPumps
+        in.WarningPumps = a.PumpData.WarningPumps
+        in.CriticalPumps = a.PumpData.CriticalPumps
+    }
+    return in
+}
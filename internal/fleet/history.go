@@ -0,0 +1,74 @@
+package fleet
+
+import (
+    "context"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "time"
+
+    "service/internal/tenant"
+
+    "github.com/google/uuid"
+    "github.com/jackc/pgx/v5"
+)
+
+// Оценка риска за час
+type RiskPoint struct {
+    Hour       time.Time       `json:"hour"`
+    Score      int             `json:"score"`
+    Factors    json.RawMessage `json:"factors"`
+    Weights    json.RawMessage `json:"weights"`
+    ComputedAt time.Time       `json:"computed_at"`
+}
+
+// Текущая оценка риска здания и ее история
+type RiskReport struct {
+    BuildingID uuid.UUID       `json:"building_id"`
+    Score      *int            `json:"score"` // nil - здание еще не проверялось
+    Factors    json.RawMessage `json:"factors,omitempty"`
+    ComputedAt *time.Time      `json:"computed_at,omitempty"`
+    History    []RiskPoint     `json:"history"`
+}
+
+// Оценка риска здания и почасовая история за [from, to].
+// Здание вне компании organizationID - tenant.ErrBuildingNotFound
+func (m *Monitor) RiskReport(ctx context.Context, organizationID *uuid.UUID, buildingID uuid.UUID, from, to time.Time) (*RiskReport, error) {
+    report := &RiskReport{BuildingID: buildingID, History: []RiskPoint{}}
+
+    var factors []byte
+    err := m.pool.QueryRow(ctx, `
+        SELECT s.risk_score, s.risk_factors, s.computed_at
+        FROM buildings b
+        LEFT JOIN building_status s ON s.building_id = b.id
+        WHERE b.id = $1 AND ($2::uuid IS NULL OR b.organization_id = $2)`,
+        buildingID, organizationID).Scan(&report.Score, &factors, &report.ComputedAt)
+    if errors.Is(err, pgx.ErrNoRows) {
+        return nil, tenant.ErrBuildingNotFound
+    }
+    if err != nil {
+        return nil, fmt.Errorf("load risk score %s: %w", buildingID, err)
+    }
+    report.Factors = factors
+
+    rows, err := m.pool.Query(ctx, `
+        SELECT hour, score, factors, weights, computed_at
+        FROM risk_history
+        WHERE building_id = $1 AND hour >= $2 AND hour <= $3
+        ORDER BY hour`, buildingID, from, to)
+    if err != nil {
+        return nil, fmt.Errorf("load risk history %s: %w", buildingID, err)
+    }
+    defer rows.Close()
+
+    for rows.Next() {
+        var p RiskPoint
+        var factors, weights []byte
+        if err := rows.Scan(&p.Hour, &p.Score, &factors, &weights, &p.ComputedAt); err != nil {
+            return nil, fmt.Errorf("scan risk history: %w", err)
+        }
+        p.Factors, p.Weights = factors, weights
+        report.History = append(report.History, p)
+    }
+    return report, rows.Err()
+}
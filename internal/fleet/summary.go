@@ -0,0 +1,184 @@
+package fleet
+
+import (
+    "context"
+    "encoding/json"
+    "fmt"
+    "time"
+
+    "github.com/google/uuid"
+)
+
+// Состояние здания в сводке по парку
+type BuildingSummary struct {
+    BuildingID         uuid.UUID       `json:"building_id"`
+    Address            string          `json:"address"`
+    OrganizationID     *uuid.UUID      `json:"organization_id,omitempty"`
+    WaterBalanceStatus string          `json:"water_balance_status"`
+    TemperatureStatus  string          `json:"temperature_status"`
+    PumpStatus         string          `json:"pump_status"`
+    HotToColdRatio     *float64        `json:"hot_to_cold_ratio"`
+    AnomalyCount       int             `json:"anomaly_count"`
+    DataSource         *string         `json:"data_source"`
+    RiskScore          *int            `json:"risk_score"` // nil - здание еще не проверялось
+    RiskFactors        json.RawMessage `json:"risk_factors,omitempty"`
+    OpenIncidents      int             `json:"open_incidents"`
+    CriticalIncidents  int             `json:"critical_incidents"`
+    MeterFaults        int             `json:"meter_faults"`  // открытые неисправности счетчиков
+    VerificationAlerts int             `json:"verification_alerts"` // счетчики с истекающей или истекшей поверкой
+    QualityScore       *int            `json:"quality_score"` // средняя оценка качества данных счетчиков
+    LastReadingAt      *time.Time      `json:"last_reading_at"`
+    Stale              bool            `json:"stale"`
+    StatusComputedAt   *time.Time      `json:"status_computed_at"`
+}
+
+// Сортировки сводки: выражение и направление по умолчанию
+var sorts = map[string]struct {
+    expr string
+    desc bool
+}{
+    "risk":      {"s.risk_score", true},
+    "incidents": {"COALESCE(i.open, 0)", true},
+    "freshness": {"COALESCE(f.last_reading_at, '-infinity')", false}, // самые давние данные первыми
+    "ratio":     {"s.hot_to_cold_ratio", true},
+    "quality":   {"q.score", false}, // худшее качество данных первым
+    "address":   {"b.address", false},
+}
+
+func ValidSort(name string) bool {
+    _, ok := sorts[name]
+    return ok
+}
+
+// Параметры выборки сводки. Пустые строки и nil не ограничивают выборку
+type Query struct {
+    OrganizationID     *uuid.UUID
+    WaterBalanceStatus string
+    TemperatureStatus  string
+    PumpStatus         string
+    MinRisk            int
+    HasIncidents       bool
+    Stale              *bool
+    Search             string // подстрока адреса
+    Sort               string
+    Order              string // asc, desc или пусто - по умолчанию для сортировки
+    Limit              int
+    Offset             int
+}
+
+// Страница сводки и общее число зданий, подходящих под фильтр
+type Summary struct {
+    Total      int               `json:"total"`
+    Limit      int               `json:"limit"`
+    Offset     int               `json:"offset"`
+    StaleAfter string            `json:"stale_after"`
+    Buildings  []BuildingSummary `json:"buildings"`
+}
+
+// Сводка по всем зданиям: последнее состояние из building_status, открытые инциденты,
+// качество данных счетчиков и время последнего показания. Выполняется одним запросом.
+// Инциденты процесса и неисправности счетчиков считаются раздельно
+func (m *Monitor) Summary(ctx context.Context, q Query) (*Summary, error) {
+    sort, ok := sorts[q.Sort]
+    if !ok {
+        sort = sorts["risk"]
+    }
+    desc := sort.desc
+    switch q.Order {
+    case "asc":
+        desc = false
+    case "desc":
+        desc = true
+    }
+    direction := "ASC"
+    if desc {
+        direction = "DESC"
+    }
+    if q.Limit <= 0 || q.Limit > 5000 {
+        q.Limit = 1000
+    }
+    if q.Offset < 0 {
+        q.Offset = 0
+    }
+
+    staleBefore := time.Now().Add(-m.staleAfter)
+
+    // Время последнего показания берется по индексам (здание/ИТП/регистр, время) каждой таблицы
+    rows, err := m.pool.Query(ctx, fmt.Sprintf(`
+        SELECT b.id, b.address, b.organization_id,
+               COALESCE(s.water_balance_status, 'unknown'),
+               COALESCE(s.temperature_status, 'unknown'),
+               COALESCE(s.pump_status, 'unknown'),
+               s.hot_to_cold_ratio, COALESCE(s.anomaly_count, 0), s.data_source, s.risk_score, s.risk_factors,
+               COALESCE(i.open, 0), COALESCE(i.critical, 0), COALESCE(i.meter_faults, 0), COALESCE(i.verification, 0), q.score,
+               f.last_reading_at, s.computed_at,
+               COUNT(*) OVER ()
+        FROM buildings b
+        LEFT JOIN building_status s ON s.building_id = b.id
+        LEFT JOIN (
+            SELECT building_id,
+                   COUNT(*) FILTER (WHERE category = 'process') AS open,
+                   COUNT(*) FILTER (WHERE category = 'process' AND severity = 'critical') AS critical,
+                   COUNT(*) FILTER (WHERE category = 'meter_fault') AS meter_faults,
+                   COUNT(*) FILTER (WHERE category = 'maintenance') AS verification
+            FROM incidents
+            WHERE status <> 'resolved'
+            GROUP BY building_id
+        ) i ON i.building_id = b.id
+        LEFT JOIN (
+            SELECT building_id, ROUND(AVG(score))::int AS score
+            FROM meter_quality
+            GROUP BY building_id
+        ) q ON q.building_id = b.id
+        CROSS JOIN LATERAL (
+            SELECT GREATEST(
+                (SELECT MAX(timestamp) FROM hot_water_meters WHERE building_id = b.id),
+                (SELECT MAX(timestamp) FROM temperature_readings WHERE building_id = b.id),
+                (SELECT MAX(c.last) FROM itp
+                 CROSS JOIN LATERAL (SELECT MAX(timestamp) AS last FROM cold_water_meters WHERE itp_id = itp.id) c
+                 WHERE itp.building_id = b.id),
+                (SELECT MAX(m.last) FROM totalizers t
+                 CROSS JOIN LATERAL (SELECT MAX(timestamp) AS last FROM meter_totals WHERE totalizer_id = t.id) m
+                 WHERE t.building_id = b.id)
+            ) AS last_reading_at
+        ) f
+        WHERE ($1::uuid IS NULL OR b.organization_id = $1)
+        AND ($2 = '' OR s.water_balance_status = $2)
+        AND ($3 = '' OR s.temperature_status = $3)
+        AND ($4 = '' OR s.pump_status = $4)
+        AND ($5 = 0 OR s.risk_score >= $5)
+        AND (NOT $6 OR i.open > 0)
+        AND ($7::boolean IS NULL OR (f.last_reading_at IS NULL OR f.last_reading_at < $8) = $7)
+        AND ($9 = '' OR b.address ILIKE '%%' || $9 || '%%')
+        ORDER BY %s %s NULLS LAST, b.address, b.id
+        LIMIT $10 OFFSET $11`, sort.expr, direction),
+        q.OrganizationID, q.WaterBalanceStatus, q.TemperatureStatus, q.PumpStatus, q.MinRisk,
+        q.HasIncidents, q.Stale, staleBefore, q.Search, q.Limit, q.Offset)
+    if err != nil {
+        return nil, fmt.Errorf("fleet summary: %w", err)
+    }
+    defer rows.Close()
+
+    summary := &Summary{
+        Limit:      q.Limit,
+        Offset:     q.Offset,
+        StaleAfter: m.staleAfter.String(),
+        Buildings:  []BuildingSummary{},
+    }
+    for rows.Next() {
+        var b BuildingSummary
+        var factors []byte
+        err := rows.Scan(&b.BuildingID, &b.Address, &b.OrganizationID,
+            &b.WaterBalanceStatus, &b.TemperatureStatus, &b.PumpStatus,
+            &b.HotToColdRatio, &b.AnomalyCount, &b.DataSource, &b.RiskScore, &factors,
+            &b.OpenIncidents, &b.CriticalIncidents, &b.MeterFaults, &b.VerificationAlerts, &b.QualityScore,
+            &b.LastReadingAt, &b.StatusComputedAt, &summary.Total)
+        if err != nil {
+            return nil, fmt.Errorf("scan fleet summary: %w", err)
+        }
+        b.RiskFactors = factors
+        b.Stale = b.LastReadingAt == nil || b.LastReadingAt.Before(staleBefore)
+        summary.Buildings = append(summary.Buildings, b)
+    }
+    return summary, rows.Err()
+}
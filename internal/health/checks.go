@@ -0,0 +1,84 @@
+package health
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "os"
+    "path/filepath"
+    "strconv"
+    "strings"
+
+    "github.com/jackc/pgx/v5"
+    "github.com/jackc/pgx/v5/pgconn"
+    "github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Проверка соединения с БД
+func DatabasePing(pool *pgxpool.Pool) Check {
+    return func(ctx context.Context) (string, error) {
+        if err := pool.Ping(ctx); err != nil {
+            return "", fmt.Errorf("ping database: %w", err)
+        }
+        stat := pool.Stat()
+        return fmt.Sprintf("%d/%d connections in use", stat.AcquiredConns(), stat.TotalConns()), nil
+    }
+}
+
+// Проверка версии схемы: версия в schema_migrations (golang-migrate) должна быть не ниже
+// последней миграции в каталоге dir и не помечена как dirty.
+// Если миграции применялись скриптом без golang-migrate, версия не отслеживается и проверка проходит
+func MigrationVersion(pool *pgxpool.Pool, dir string) Check {
+    expected, expectedErr := latestMigration(dir)
+
+    return func(ctx context.Context) (string, error) {
+        var version int64
+        var dirty bool
+        err := pool.QueryRow(ctx, "SELECT version, dirty FROM schema_migrations LIMIT 1").Scan(&version, &dirty)
+        var pgErr *pgconn.PgError
+        if errors.As(err, &pgErr) && pgErr.Code == "42P01" { // undefined_table
+            return "schema_migrations not found, version is not tracked", nil
+        }
+        if errors.Is(err, pgx.ErrNoRows) {
+            return "", fmt.Errorf("no migrations applied")
+        }
+        if err != nil {
+            return "", fmt.Errorf("read schema version: %w", err)
+        }
+
+        if dirty {
+            return "", fmt.Errorf("schema version %d is dirty", version)
+        }
+        if expectedErr != nil {
+            return fmt.Sprintf("version %d", version), nil
+        }
+        if version < expected {
+            return "", fmt.Errorf("schema version %d is behind expected %d", version, expected)
+        }
+        return fmt.Sprintf("version %d", version), nil
+    }
+}
+
+// Номер последней миграции в каталоге (файлы вида 000007_name.up.sql)
+func latestMigration(dir string) (int64, error) {
+    files, err := filepath.Glob(filepath.Join(dir, "*.up.sql"))
+    if err != nil {
+        return 0, err
+    }
+    if len(files) == 0 {
+        if _, statErr := os.Stat(dir); statErr != nil {
+            return 0, statErr
+        }
+        return 0, fmt.Errorf("no migrations in %s", dir)
+    }
+
+    var latest int64
+    for _, f := range files {
+        prefix, _, _ := strings.Cut(filepath.Base(f), "_")
+        n, err := strconv.ParseInt(prefix, 10, 64)
+        if err == nil && n > latest {
+            latest = n
+        }
+    }
+    return latest, nil
+}
@@ -0,0 +1,132 @@
+package health
+
+import (
+    "context"
+    "net/http"
+    "sync"
+    "time"
+
+    "github.com/gin-gonic/gin"
+)
+
+// Статусы проверок
+const (
+    StatusOK   = "ok"
+    StatusFail = "fail"
+)
+
+// Check - проверка зависимости. Возвращает пояснение (например, версию схемы) и ошибку
+type Check func(ctx context.Context) (string, error)
+
+// Result - результат одной проверки
+type Result struct {
+    Name      string  `json:"name"`
+    Status    string  `json:"status"`
+    Critical  bool    `json:"critical"`
+    LatencyMs float64 `json:"latency_ms"`
+    Detail    string  `json:"detail,omitempty"`
+    Error     string  `json:"error,omitempty"`
+}
+
+// Report - сводный результат набора проверок
+type Report struct {
+    Status    string    `json:"status"`
+    Checks    []Result  `json:"checks"`
+    Timestamp time.Time `json:"timestamp"`
+}
+
+type registered struct {
+    name     string
+    critical bool
+    check    Check
+}
+
+// Checker - набор проверок (liveness или readiness).
+// Проверки выполняются параллельно, каждая со своим таймаутом
+type Checker struct {
+    timeout time.Duration
+
+    mu     sync.RWMutex
+    checks []registered
+}
+
+func NewChecker(timeout time.Duration) *Checker {
+    return &Checker{timeout: timeout}
+}
+
+// Регистрация проверки. Неуспешная некритичная проверка видна в отчете, но не меняет общий статус
+func (ch *Checker) Register(name string, critical bool, check Check) {
+    ch.mu.Lock()
+    defer ch.mu.Unlock()
+    ch.checks = append(ch.checks, registered{name: name, critical: critical, check: check})
+}
+
+// Выполнение всех проверок
+func (ch *Checker) Run(ctx context.Context) Report {
+    ch.mu.RLock()
+    checks := append([]registered(nil), ch.checks...)
+    ch.mu.RUnlock()
+
+    results := make([]Result, len(checks))
+    var wg sync.WaitGroup
+    for i, rc := range checks {
+        wg.Add(1)
+        go func(i int, rc registered) {
+            defer wg.Done()
+            results[i] = ch.runOne(ctx, rc)
+        }(i, rc)
+    }
+    wg.Wait()
+
+    report := Report{Status: StatusOK, Checks: results, Timestamp: time.Now()}
+    for _, r := range results {
+        if r.Critical && r.Status != StatusOK {
+            report.Status = StatusFail
+        }
+    }
+    return report
+}
+
+func (ch *Checker) runOne(ctx context.Context, rc registered) Result {
+    ctx, cancel := context.WithTimeout(ctx, ch.timeout)
+    defer cancel()
+
+    type outcome struct {
+        detail string
+        err    error
+    }
+    done := make(chan outcome, 1)
+    start := time.Now()
+    go func() {
+        detail, err := rc.check(ctx)
+        done <- outcome{detail, err}
+    }()
+
+    result := Result{Name: rc.name, Status: StatusOK, Critical: rc.critical}
+    // Проверка, которая не уважает контекст, не должна задерживать ответ пробы
+    select {
+    case o := <-done:
+        result.Detail = o.detail
+        if o.err != nil {
+            result.Status = StatusFail
+            result.Error = o.err.Error()
+        }
+    case <-ctx.Done():
+        result.Status = StatusFail
+        result.Error = "timeout after " + ch.timeout.String()
+    }
+    result.LatencyMs = float64(time.Since(start).Microseconds()) / 1000
+    return result
+}
+
+// Обработчик пробы: 200 если критичные проверки прошли, иначе 503
+func (ch *Checker) Handler() gin.HandlerFunc {
+    return func(c *gin.Context) {
+        report := ch.Run(c.Request.Context())
+        status := http.StatusOK
+        if report.Status != StatusOK {
+            status = http.StatusServiceUnavailable
+        }
+        c.JSON(status, report)
+    }
+}
@@ -0,0 +1,365 @@
+package incident
+
+import (
+    "context"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "time"
+
+    "service/internal/metrics"
+
+    "github.com/google/uuid"
+    "github.com/jackc/pgx/v5"
+    "github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Виды инцидентов
+const (
+    KindWaterBalance = "water_balance"
+    KindTemperature  = "temperature"
+    KindPump         = "pump"
+    KindMeterFault   = "meter_fault"
+    KindVerification = "meter_verification"
+)
+
+// Категории: аномалии процесса, неисправности счетчиков и обслуживание (поверка) разбираются отдельно
+const (
+    CategoryProcess     = "process"
+    CategoryMeterFault  = "meter_fault"
+    CategoryMaintenance = "maintenance"
+)
+
+// Категория по виду инцидента
+func CategoryOf(kind string) string {
+    switch kind {
+    case KindMeterFault:
+        return CategoryMeterFault
+    case KindVerification:
+        return CategoryMaintenance
+    }
+    return CategoryProcess
+}
+
+// Критичность
+const (
+    SeverityWarning  = "warning"
+    SeverityCritical = "critical"
+)
+
+// Состояния инцидента
+const (
+    StatusOpen         = "open"
+    StatusAcknowledged = "acknowledged"
+    StatusResolved     = "resolved"
+)
+
+var (
+    ErrNotFound = errors.New("incident not found")
+    ErrResolved = errors.New("incident already resolved")
+)
+
+// Инцидент по зданию
+type Incident struct {
+    ID             uuid.UUID       `json:"id"`
+    BuildingID     uuid.UUID       `json:"building_id"`
+    Address        string          `json:"address"`
+    Category       string          `json:"category"`
+    Kind           string          `json:"kind"`
+    Subject        string          `json:"subject,omitempty"`
+    Severity       string          `json:"severity"`
+    Status         string          `json:"status"`
+    Title          string          `json:"title"`
+    Details        json.RawMessage `json:"details,omitempty"`
+    OpenedAt       time.Time       `json:"opened_at"`
+    LastSeenAt     time.Time       `json:"last_seen_at"`
+    AcknowledgedAt *time.Time      `json:"acknowledged_at,omitempty"`
+    AcknowledgedBy *uuid.UUID      `json:"acknowledged_by,omitempty"`
+    ResolvedAt     *time.Time      `json:"resolved_at,omitempty"`
+    SituationID    *uuid.UUID      `json:"situation_id,omitempty"`   // ситуация узла сети, к которой отнесен инцидент
+    LossPerDay     *float64        `json:"loss_per_day,omitempty"`   // оценка потерь по тарифу, ₽/сутки
+    EstimatedCost  *float64        `json:"estimated_cost,omitempty"` // потери за интервал аномалии, ₽
+}
+
+// Обнаруженное проверкой условие, по которому открывается инцидент
+type Detection struct {
+    Kind       string
+    Subject    string // объект внутри здания (например, счетчик); пусто - здание целиком
+    Severity   string
+    Title      string
+    Details    interface{}
+    LossPerDay *float64 // оценка потерь по тарифу, ₽/сутки; nil - не оценивается
+}
+
+// Фильтр выборки. Status: open, acknowledged, resolved, active (open и acknowledged) или all
+type Filter struct {
+    OrganizationID *uuid.UUID // nil - все компании
+    BuildingID     *uuid.UUID
+    Category       string // пусто - все категории
+    Status         string
+    Sort           string // SortCost - по оценке потерь; пусто - новые первыми
+    Limit          int
+    Offset         int
+}
+
+// Порядок выборки по убыванию оценки потерь (Filter.Sort)
+const SortCost = "cost"
+
+// Store - хранение инцидентов
+type Store struct {
+    pool *pgxpool.Pool
+}
+
+func NewStore(pool *pgxpool.Pool) *Store {
+    return &Store{pool: pool}
+}
+
+// Потери за интервал аномалии: от открытия до закрытия (для незакрытых - до текущего момента),
+// не менее суток - проверка обнаруживает аномалию по потреблению за период анализа
+const estimatedCostSQL = `ROUND(i.loss_per_day * GREATEST(
+    EXTRACT(EPOCH FROM COALESCE(i.resolved_at, NOW()) - i.opened_at)::numeric / 86400, 1), 2)`
+
+const selectIncident = `
+    SELECT i.id, i.building_id, b.address, i.category, i.kind, i.subject, i.severity, i.status, i.title, i.details,
+           i.opened_at, i.last_seen_at, i.acknowledged_at, i.acknowledged_by, i.resolved_at, i.situation_id,
+           i.loss_per_day::float8, (` + estimatedCostSQL + `)::float8
+    FROM incidents i
+    JOIN buildings b ON b.id = i.building_id`
+
+func scanIncident(row pgx.Row) (*Incident, error) {
+    var inc Incident
+    var details []byte
+    err := row.Scan(&inc.ID, &inc.BuildingID, &inc.Address, &inc.Category, &inc.Kind, &inc.Subject, &inc.Severity, &inc.Status, &inc.Title,
+        &details, &inc.OpenedAt, &inc.LastSeenAt, &inc.AcknowledgedAt, &inc.AcknowledgedBy, &inc.ResolvedAt, &inc.SituationID,
+        &inc.LossPerDay, &inc.EstimatedCost)
+    if err != nil {
+        return nil, err
+    }
+    inc.Details = details
+    return &inc, nil
+}
+
+// Сверка инцидентов с результатом проверки зданий buildingIDs:
+// по обнаруженным условиям открываются новые инциденты или обновляются незакрытые,
+// незакрытые инциденты видов kinds, условия которых больше не обнаружены, закрываются.
+// Инцидент определяется зданием, видом и объектом (Subject)
+func (s *Store) Reconcile(ctx context.Context, kinds []string, buildingIDs []uuid.UUID, detected map[uuid.UUID][]Detection) (opened, resolved int, err error) {
+    var ids []uuid.UUID
+    var detKinds, subjects, categories, severities, titles, details []string
+    var losses []*float64
+    for buildingID, list := range detected {
+        for _, d := range list {
+            raw, err := json.Marshal(d.Details)
+            if err != nil {
+                return 0, 0, fmt.Errorf("marshal incident details: %w", err)
+            }
+            ids = append(ids, buildingID)
+            detKinds = append(detKinds, d.Kind)
+            subjects = append(subjects, d.Subject)
+            categories = append(categories, CategoryOf(d.Kind))
+            severities = append(severities, d.Severity)
+            titles = append(titles, d.Title)
+            details = append(details, string(raw))
+            losses = append(losses, d.LossPerDay)
+        }
+    }
+
+    tx, err := s.pool.Begin(ctx)
+    if err != nil {
+        return 0, 0, err
+    }
+    defer tx.Rollback(ctx)
+
+    // Повышение критичности возвращает подтвержденный инцидент в состояние open
+    rows, err := tx.Query(ctx, `
+        INSERT INTO incidents (building_id, category, kind, subject, severity, title, details, loss_per_day)
+        SELECT d.building_id, d.category, d.kind, d.subject, d.severity, d.title, d.details::jsonb, d.loss
+        FROM unnest($1::uuid[], $2::text[], $3::text[], $4::text[], $5::text[], $6::text[], $7::text[], $8::float8[])
+            AS d(building_id, category, kind, subject, severity, title, details, loss)
+        ON CONFLICT (building_id, kind, subject) WHERE status <> 'resolved' DO UPDATE SET
+            severity = EXCLUDED.severity,
+            title = EXCLUDED.title,
+            details = EXCLUDED.details,
+            loss_per_day = EXCLUDED.loss_per_day,
+            last_seen_at = NOW(),
+            status = CASE
+                WHEN incidents.severity = 'warning' AND EXCLUDED.severity = 'critical' THEN 'open'
+                ELSE incidents.status
+            END
+        RETURNING xmax = 0`,
+        ids, categories, detKinds, subjects, severities, titles, details, losses)
+    if err != nil {
+        return 0, 0, fmt.Errorf("upsert incidents: %w", err)
+    }
+    inserted, err := pgx.CollectRows(rows, pgx.RowTo[bool])
+    if err != nil {
+        return 0, 0, fmt.Errorf("upsert incidents: %w", err)
+    }
+    for _, ok := range inserted {
+        if ok {
+            opened++
+        }
+    }
+
+    tag, err := tx.Exec(ctx, `
+        UPDATE incidents i SET status = 'resolved', resolved_at = NOW()
+        WHERE i.building_id = ANY($1)
+        AND i.kind = ANY($2)
+        AND i.status <> 'resolved'
+        AND NOT EXISTS (
+            SELECT 1 FROM unnest($3::uuid[], $4::text[], $5::text[]) AS d(building_id, kind, subject)
+            WHERE d.building_id = i.building_id AND d.kind = i.kind AND d.subject = i.subject)`,
+        buildingIDs, kinds, ids, detKinds, subjects)
+    if err != nil {
+        return 0, 0, fmt.Errorf("resolve incidents: %w", err)
+    }
+
+    if err := tx.Commit(ctx); err != nil {
+        return 0, 0, err
+    }
+    return opened, int(tag.RowsAffected()), nil
+}
+
+// Выборка инцидентов по фильтру: новые первыми или, с SortCost, по убыванию потерь за интервал аномалии
+// (инциденты без оценки - в конце)
+func (s *Store) List(ctx context.Context, f Filter) ([]*Incident, error) {
+    if f.Limit <= 0 || f.Limit > 1000 {
+        f.Limit = 100
+    }
+
+    rows, err := s.pool.Query(ctx, selectIncident+`
+        WHERE ($1::uuid IS NULL OR b.organization_id = $1)
+        AND ($2::uuid IS NULL OR i.building_id = $2)
+        AND CASE $3
+            WHEN 'all' THEN TRUE
+            WHEN 'active' THEN i.status <> 'resolved'
+            ELSE i.status = $3
+        END
+        AND ($4 = '' OR i.category = $4)
+        ORDER BY CASE WHEN $7 = 'cost' THEN `+estimatedCostSQL+` END DESC NULLS LAST, i.opened_at DESC, i.id
+        LIMIT $5 OFFSET $6`,
+        f.OrganizationID, f.BuildingID, f.Status, f.Category, f.Limit, f.Offset, f.Sort)
+    if err != nil {
+        return nil, fmt.Errorf("list incidents: %w", err)
+    }
+    defer rows.Close()
+
+    incidents := []*Incident{}
+    for rows.Next() {
+        inc, err := scanIncident(rows)
+        if err != nil {
+            return nil, fmt.Errorf("scan incident: %w", err)
+        }
+        incidents = append(incidents, inc)
+    }
+    return incidents, rows.Err()
+}
+
+// Инцидент в пределах видимости компании organizationID (nil - все компании)
+func (s *Store) Get(ctx context.Context, organizationID *uuid.UUID, id uuid.UUID) (*Incident, error) {
+    inc, err := scanIncident(s.pool.QueryRow(ctx, selectIncident+`
+        WHERE i.id = $1 AND ($2::uuid IS NULL OR b.organization_id = $2)`, id, organizationID))
+    if errors.Is(err, pgx.ErrNoRows) {
+        return nil, ErrNotFound
+    }
+    if err != nil {
+        return nil, fmt.Errorf("get incident %s: %w", id, err)
+    }
+    return inc, nil
+}
+
+// Подтверждение инцидента диспетчером. Возвращает состояние до и после
+func (s *Store) Acknowledge(ctx context.Context, organizationID *uuid.UUID, id, userID uuid.UUID) (before, after *Incident, err error) {
+    return s.transition(ctx, organizationID, id, `
+        UPDATE incidents SET status = 'acknowledged', acknowledged_at = NOW(), acknowledged_by = $2
+        WHERE id = $1 AND status <> 'resolved'`, userID)
+}
+
+// Закрытие инцидента вручную. Если условие сохраняется, проверка откроет новый инцидент
+func (s *Store) Resolve(ctx context.Context, organizationID *uuid.UUID, id uuid.UUID) (before, after *Incident, err error) {
+    return s.transition(ctx, organizationID, id, `
+        UPDATE incidents SET status = 'resolved', resolved_at = NOW()
+        WHERE id = $1 AND status <> 'resolved'`)
+}
+
+func (s *Store) transition(ctx context.Context, organizationID *uuid.UUID, id uuid.UUID, sql string, args ...interface{}) (before, after *Incident, err error) {
+    before, err = s.Get(ctx, organizationID, id)
+    if err != nil {
+        return nil, nil, err
+    }
+
+    tag, err := s.pool.Exec(ctx, sql, append([]interface{}{id}, args...)...)
+    if err != nil {
+        return nil, nil, fmt.Errorf("update incident %s: %w", id, err)
+    }
+    if tag.RowsAffected() == 0 {
+        return nil, nil, ErrResolved
+    }
+
+    after, err = s.Get(ctx, organizationID, id)
+    if err != nil {
+        return nil, nil, err
+    }
+    return before, after, nil
+}
+
+// Число инцидентов здания за период
+type Counts struct {
+    Total    int
+    Critical int
+}
+
+// Инциденты процесса, открытые с момента since, по зданиям (включая закрытые).
+// Неисправности счетчиков не учитываются
+func (s *Store) CountsSince(ctx context.Context, buildingIDs []uuid.UUID, since time.Time) (map[uuid.UUID]Counts, error) {
+    rows, err := s.pool.Query(ctx, `
+        SELECT building_id, COUNT(*), COUNT(*) FILTER (WHERE severity = 'critical')
+        FROM incidents
+        WHERE building_id = ANY($1) AND opened_at >= $2 AND category = 'process'
+        GROUP BY building_id`, buildingIDs, since)
+    if err != nil {
+        return nil, fmt.Errorf("count incidents: %w", err)
+    }
+    defer rows.Close()
+
+    counts := make(map[uuid.UUID]Counts, len(buildingIDs))
+    for rows.Next() {
+        var id uuid.UUID
+        var c Counts
+        if err := rows.Scan(&id, &c.Total, &c.Critical); err != nil {
+            return nil, fmt.Errorf("scan incident counts: %w", err)
+        }
+        counts[id] = c
+    }
+    return counts, rows.Err()
+}
+
+// Обновление метрики открытых инцидентов по критичности
+func (s *Store) UpdateMetrics(ctx context.Context) error {
+    rows, err := s.pool.Query(ctx, `
+        SELECT severity, COUNT(*) FROM incidents
+        WHERE status <> 'resolved'
+        GROUP BY severity`)
+    if err != nil {
+        return fmt.Errorf("count open incidents: %w", err)
+    }
+    defer rows.Close()
+
+    counts := map[string]float64{SeverityWarning: 0, SeverityCritical: 0}
+    for rows.Next() {
+        var severity string
+        var n int64
+        if err := rows.Scan(&severity, &n); err != nil {
+            return fmt.Errorf("scan incident count: %w", err)
+        }
+        counts[severity] = float64(n)
+    }
+    if err := rows.Err(); err != nil {
+        return err
+    }
+
+    for severity, n := range counts {
+        metrics.OpenIncidents.WithLabelValues(severity).Set(n)
+    }
+    return nil
+}
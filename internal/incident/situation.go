@@ -0,0 +1,230 @@
+package incident
+
+import (
+    "context"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "time"
+
+    "github.com/google/uuid"
+    "github.com/jackc/pgx/v5"
+)
+
+var ErrSituationNotFound = errors.New("situation not found")
+
+// Области ситуации: узел тепловой сети или группа соседних зданий без общего узла
+const (
+    ScopeNode = "node"
+    ScopeArea = "area"
+)
+
+// Ситуация: одновременные аномалии одного вида в нескольких зданиях, отнесенные к общему узлу сети
+// или к району. Инциденты зданий, отнесенные к ситуации, ссылаются на нее (Incident.SituationID)
+type Situation struct {
+    ID                uuid.UUID       `json:"id"`
+    Scope             string          `json:"scope"`
+    NodeID            *uuid.UUID      `json:"node_id,omitempty"`
+    NodeType          string          `json:"node_type,omitempty"`
+    NodeName          string          `json:"node_name,omitempty"`
+    Kind              string          `json:"kind"`
+    Severity          string          `json:"severity"`
+    Status            string          `json:"status"`
+    Title             string          `json:"title"`
+    Details           json.RawMessage `json:"details,omitempty"`
+    BuildingsAffected int             `json:"buildings_affected"`
+    BuildingsTotal    int             `json:"buildings_total"`
+    OpenedAt          time.Time       `json:"opened_at"`
+    LastSeenAt        time.Time       `json:"last_seen_at"`
+    ResolvedAt        *time.Time      `json:"resolved_at,omitempty"`
+}
+
+// Ситуация с инцидентами зданий
+type SituationDetails struct {
+    *Situation
+    Incidents []*Incident `json:"incidents"`
+}
+
+// Обнаруженная группа аномалий. NodeID - узел сети (nil для района), Incidents - инциденты зданий группы,
+// Affected - число зданий группы, Total - число проверенных зданий узла или района
+type SituationDetection struct {
+    NodeID    *uuid.UUID
+    Kind      string
+    Severity  string
+    Title     string
+    Details   interface{}
+    Incidents []uuid.UUID
+    Affected  int
+    Total     int
+}
+
+const selectSituation = `
+    SELECT s.id, s.scope, s.node_id, COALESCE(n.type, ''), COALESCE(n.name, ''), s.kind, s.severity, s.status, s.title, s.details,
+           s.buildings_affected, s.buildings_total, s.opened_at, s.last_seen_at, s.resolved_at
+    FROM situations s
+    LEFT JOIN network_nodes n ON n.id = s.node_id`
+
+// Ситуация видна компании, если к ней отнесен инцидент одного из ее зданий
+const situationVisible = `
+    ($1::uuid IS NULL OR EXISTS (
+        SELECT 1 FROM incidents i JOIN buildings b ON b.id = i.building_id
+        WHERE i.situation_id = s.id AND b.organization_id = $1))`
+
+func scanSituation(row pgx.Row) (*Situation, error) {
+    var s Situation
+    var details []byte
+    err := row.Scan(&s.ID, &s.Scope, &s.NodeID, &s.NodeType, &s.NodeName, &s.Kind, &s.Severity, &s.Status, &s.Title, &details,
+        &s.BuildingsAffected, &s.BuildingsTotal, &s.OpenedAt, &s.LastSeenAt, &s.ResolvedAt)
+    if err != nil {
+        return nil, err
+    }
+    s.Details = details
+    return &s, nil
+}
+
+// Сверка ситуаций с найденными группами аномалий. Ситуация узла определяется узлом и видом, ситуация района -
+// незакрытая ситуация района того же вида, к которой отнесено больше всего инцидентов группы. Инциденты группы
+// относятся к ситуации, вышедшие из группы - отвязываются; незакрытые ситуации видов kinds, которые больше
+// не обнаружены, закрываются
+func (s *Store) ReconcileSituations(ctx context.Context, kinds []string, detected []SituationDetection) (opened, resolved int, err error) {
+    tx, err := s.pool.Begin(ctx)
+    if err != nil {
+        return 0, 0, err
+    }
+    defer tx.Rollback(ctx)
+
+    active := make([]uuid.UUID, 0, len(detected))
+    for _, d := range detected {
+        raw, err := json.Marshal(d.Details)
+        if err != nil {
+            return 0, 0, fmt.Errorf("marshal situation details: %w", err)
+        }
+
+        var id uuid.UUID
+        if d.NodeID != nil {
+            err = tx.QueryRow(ctx, `
+                SELECT id FROM situations WHERE node_id = $1 AND kind = $2 AND status <> 'resolved'`,
+                *d.NodeID, d.Kind).Scan(&id)
+        } else {
+            err = tx.QueryRow(ctx, `
+                SELECT s.id FROM incidents i JOIN situations s ON s.id = i.situation_id
+                WHERE i.id = ANY($1) AND s.scope = 'area' AND s.kind = $2 AND s.status <> 'resolved'
+                AND s.id <> ALL($3)
+                GROUP BY s.id
+                ORDER BY COUNT(*) DESC, MIN(s.opened_at)
+                LIMIT 1`, d.Incidents, d.Kind, active).Scan(&id)
+        }
+        switch {
+        case errors.Is(err, pgx.ErrNoRows):
+            scope := ScopeNode
+            if d.NodeID == nil {
+                scope = ScopeArea
+            }
+            err = tx.QueryRow(ctx, `
+                INSERT INTO situations (scope, node_id, kind, severity, title, details, buildings_affected, buildings_total)
+                VALUES ($1, $2, $3, $4, $5, $6::jsonb, $7, $8)
+                RETURNING id`,
+                scope, d.NodeID, d.Kind, d.Severity, d.Title, string(raw), d.Affected, d.Total).Scan(&id)
+            if err != nil {
+                return 0, 0, fmt.Errorf("insert situation: %w", err)
+            }
+            opened++
+        case err != nil:
+            return 0, 0, fmt.Errorf("find situation: %w", err)
+        default:
+            _, err = tx.Exec(ctx, `
+                UPDATE situations SET severity = $2, title = $3, details = $4::jsonb,
+                    buildings_affected = $5, buildings_total = $6, last_seen_at = NOW()
+                WHERE id = $1`,
+                id, d.Severity, d.Title, string(raw), d.Affected, d.Total)
+            if err != nil {
+                return 0, 0, fmt.Errorf("update situation %s: %w", id, err)
+            }
+        }
+        active = append(active, id)
+
+        _, err = tx.Exec(ctx, `
+            UPDATE incidents SET situation_id = CASE WHEN id = ANY($2) THEN $1::uuid END
+            WHERE id = ANY($2) OR (situation_id = $1 AND status <> 'resolved')`,
+            id, d.Incidents)
+        if err != nil {
+            return 0, 0, fmt.Errorf("link incidents to situation %s: %w", id, err)
+        }
+    }
+
+    tag, err := tx.Exec(ctx, `
+        UPDATE situations SET status = 'resolved', resolved_at = NOW()
+        WHERE kind = ANY($1) AND status <> 'resolved' AND id <> ALL($2)`,
+        kinds, active)
+    if err != nil {
+        return 0, 0, fmt.Errorf("resolve situations: %w", err)
+    }
+
+    if err := tx.Commit(ctx); err != nil {
+        return 0, 0, err
+    }
+    return opened, int(tag.RowsAffected()), nil
+}
+
+// Ситуации, видимые компании organizationID (nil - все), новые первыми.
+// Status: open, resolved или all; scope: node, area или пусто - все
+func (s *Store) ListSituations(ctx context.Context, organizationID *uuid.UUID, status, scope string, limit, offset int) ([]*Situation, error) {
+    if limit <= 0 || limit > 1000 {
+        limit = 100
+    }
+
+    rows, err := s.pool.Query(ctx, selectSituation+`
+        WHERE`+situationVisible+`
+        AND ($2 = 'all' OR s.status = $2)
+        AND ($3 = '' OR s.scope = $3)
+        ORDER BY s.opened_at DESC, s.id
+        LIMIT $4 OFFSET $5`,
+        organizationID, status, scope, limit, offset)
+    if err != nil {
+        return nil, fmt.Errorf("list situations: %w", err)
+    }
+    defer rows.Close()
+
+    situations := []*Situation{}
+    for rows.Next() {
+        sit, err := scanSituation(rows)
+        if err != nil {
+            return nil, fmt.Errorf("scan situation: %w", err)
+        }
+        situations = append(situations, sit)
+    }
+    return situations, rows.Err()
+}
+
+// Ситуация с отнесенными к ней инцидентами. Инциденты других компаний не показываются
+func (s *Store) GetSituation(ctx context.Context, organizationID *uuid.UUID, id uuid.UUID) (*SituationDetails, error) {
+    sit, err := scanSituation(s.pool.QueryRow(ctx, selectSituation+`
+        WHERE`+situationVisible+` AND s.id = $2`, organizationID, id))
+    if errors.Is(err, pgx.ErrNoRows) {
+        return nil, ErrSituationNotFound
+    }
+    if err != nil {
+        return nil, fmt.Errorf("get situation %s: %w", id, err)
+    }
+
+    rows, err := s.pool.Query(ctx, selectIncident+`
+        WHERE i.situation_id = $1 AND ($2::uuid IS NULL OR b.organization_id = $2)
+        ORDER BY b.address, i.opened_at`, id, organizationID)
+    if err != nil {
+        return nil, fmt.Errorf("list situation incidents: %w", err)
+    }
+    defer rows.Close()
+
+    incidents := []*Incident{}
+    for rows.Next() {
+        inc, err := scanIncident(rows)
+        if err != nil {
+            return nil, fmt.Errorf("scan incident: %w", err)
+        }
+        incidents = append(incidents, inc)
+    }
+    if err := rows.Err(); err != nil {
+        return nil, err
+    }
+    return &SituationDetails{Situation: sit, Incidents: incidents}, nil
+}
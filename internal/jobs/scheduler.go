@@ -0,0 +1,167 @@
+package jobs
+
+import (
+    "context"
+    "fmt"
+    "log/slog"
+    "sort"
+    "strings"
+    "sync"
+    "time"
+
+    "service/internal/logging"
+    "service/internal/metrics"
+)
+
+// Job - периодическая фоновая задача
+type Job func(ctx context.Context) error
+
+// Status - состояние задачи для диагностики и проверки отставания
+type Status struct {
+    Name         string        `json:"name"`
+    Interval     time.Duration `json:"interval"`
+    LastStarted  time.Time     `json:"last_started"`
+    LastFinished time.Time     `json:"last_finished"`
+    LastDuration time.Duration `json:"last_duration"`
+    LastError    string        `json:"last_error,omitempty"`
+    Runs         int64         `json:"runs"`
+}
+
+type entry struct {
+    name     string
+    interval time.Duration
+    job      Job
+
+    mu     sync.Mutex
+    status Status
+}
+
+// Scheduler запускает задачи с заданным интервалом. Задача не перекрывает сама себя:
+// следующий запуск начинается не раньше, чем через interval после окончания предыдущего
+type Scheduler struct {
+    log     *slog.Logger
+    started time.Time
+
+    mu      sync.Mutex
+    entries []*entry
+}
+
+func NewScheduler() *Scheduler {
+    return &Scheduler{log: logging.Component("scheduler")}
+}
+
+// Регистрация задачи. Вызывается до Start
+func (s *Scheduler) Every(name string, interval time.Duration, job Job) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    s.entries = append(s.entries, &entry{
+        name:     name,
+        interval: interval,
+        job:      job,
+        status:   Status{Name: name, Interval: interval},
+    })
+}
+
+// Запуск всех задач до отмены ctx. Первый запуск каждой задачи - сразу
+func (s *Scheduler) Start(ctx context.Context) {
+    s.mu.Lock()
+    s.started = time.Now()
+    entries := append([]*entry(nil), s.entries...)
+    s.mu.Unlock()
+
+    for _, e := range entries {
+        go s.loop(ctx, e)
+    }
+}
+
+func (s *Scheduler) loop(ctx context.Context, e *entry) {
+    for {
+        s.run(ctx, e)
+
+        select {
+        case <-ctx.Done():
+            return
+        case <-time.After(e.interval):
+        }
+    }
+}
+
+func (s *Scheduler) run(ctx context.Context, e *entry) {
+    start := time.Now()
+    e.mu.Lock()
+    e.status.LastStarted = start
+    e.mu.Unlock()
+
+    err := e.job(ctx)
+    duration := time.Since(start)
+
+    result := "ok"
+    if err != nil {
+        result = "error"
+        s.log.Error("job failed", "job", e.name, "duration", duration, logging.Err(err))
+    } else {
+        s.log.Debug("job finished", "job", e.name, "duration", duration)
+    }
+    metrics.JobDuration.WithLabelValues(e.name, result).Observe(duration.Seconds())
+
+    e.mu.Lock()
+    e.status.LastFinished = time.Now()
+    e.status.LastDuration = duration
+    e.status.Runs++
+    e.status.LastError = ""
+    if err != nil {
+        e.status.LastError = err.Error()
+    }
+    e.mu.Unlock()
+}
+
+// Состояние всех задач
+func (s *Scheduler) Statuses() []Status {
+    s.mu.Lock()
+    entries := append([]*entry(nil), s.entries...)
+    s.mu.Unlock()
+
+    statuses := make([]Status, 0, len(entries))
+    for _, e := range entries {
+        e.mu.Lock()
+        statuses = append(statuses, e.status)
+        e.mu.Unlock()
+    }
+    sort.Slice(statuses, func(i, j int) bool { return statuses[i].Name < statuses[j].Name })
+    return statuses
+}
+
+// Проверка отставания: задача должна была завершиться не позднее interval + maxLag
+// после предыдущего запуска (или после старта планировщика, если еще не запускалась)
+func (s *Scheduler) CheckLag(maxLag time.Duration) func(ctx context.Context) (string, error) {
+    return func(context.Context) (string, error) {
+        s.mu.Lock()
+        started := s.started
+        s.mu.Unlock()
+        if started.IsZero() {
+            return "", fmt.Errorf("scheduler is not started")
+        }
+
+        var late []string
+        var worst time.Duration
+        now := time.Now()
+        for _, st := range s.Statuses() {
+            last := st.LastFinished
+            if last.IsZero() {
+                last = started
+            }
+            lag := now.Sub(last) - st.Interval
+            if lag > worst {
+                worst = lag
+            }
+            if lag > maxLag {
+                late = append(late, fmt.Sprintf("%s (%s)", st.Name, lag.Round(time.Second)))
+            }
+        }
+
+        if len(late) > 0 {
+            return "", fmt.Errorf("jobs are late: %s", strings.Join(late, ", "))
+        }
+        return fmt.Sprintf("max lag %s", worst.Round(time.Millisecond)), nil
+    }
+}
@@ -0,0 +1,84 @@
+package logging
+
+import (
+    "context"
+    "io"
+    "log/slog"
+    "os"
+    "strings"
+
+    "go.opentelemetry.io/otel/trace"
+)
+
+type requestIDKey struct{}
+
+// Настройка логгера по умолчанию: JSON в stdout с уровнем из LOG_LEVEL (debug, info, warn, error).
+// Стандартный пакет log после этого тоже пишет через slog
+func Setup(level string) {
+    slog.SetDefault(New(os.Stdout, ParseLevel(level)))
+}
+
+// Логгер в формате JSON, добавляющий request_id из контекста
+func New(w io.Writer, level slog.Level) *slog.Logger {
+    handler := slog.NewJSONHandler(w, &slog.HandlerOptions{Level: level})
+    return slog.New(contextHandler{handler})
+}
+
+func ParseLevel(level string) slog.Level {
+    switch strings.ToLower(level) {
+    case "debug":
+        return slog.LevelDebug
+    case "warn", "warning":
+        return slog.LevelWarn
+    case "error":
+        return slog.LevelError
+    default:
+        return slog.LevelInfo
+    }
+}
+
+// Логгер компонента (generator, analyzer, ws, ...)
+func Component(name string) *slog.Logger {
+    return slog.Default().With("component", name)
+}
+
+// Атрибут ошибки
+func Err(err error) slog.Attr {
+    return slog.Any("error", err)
+}
+
+func WithRequestID(ctx context.Context, id string) context.Context {
+    return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// Идентификатор запроса из контекста, пустая строка для фоновых задач
+func RequestID(ctx context.Context) string {
+    if ctx == nil {
+        return ""
+    }
+    id, _ := ctx.Value(requestIDKey{}).(string)
+    return id
+}
+
+// Обработчик, дописывающий request_id и trace_id к каждой записи, сделанной с контекстом запроса
+type contextHandler struct {
+    slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, r slog.Record) error {
+    if id := RequestID(ctx); id != "" {
+        r.AddAttrs(slog.String("request_id", id))
+    }
+    if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+        r.AddAttrs(slog.String("trace_id", sc.TraceID().String()))
+    }
+    return h.Handler.Handle(ctx, r)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+    return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+    return contextHandler{h.Handler.WithGroup(name)}
+}
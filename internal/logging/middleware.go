@@ -0,0 +1,59 @@
+package logging
+
+import (
+    "log/slog"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "github.com/google/uuid"
+)
+
+const RequestIDHeader = "X-Request-ID"
+
+// Middleware присваивает запросу идентификатор (из заголовка X-Request-ID или новый),
+// кладет его в контекст запроса и пишет строку журнала доступа после обработки.
+// Успешные запросы к quietPaths (пробы, /metrics) пишутся на уровне debug
+func Middleware(quietPaths ...string) gin.HandlerFunc {
+    logger := Component("http")
+    quiet := make(map[string]bool, len(quietPaths))
+    for _, p := range quietPaths {
+        quiet[p] = true
+    }
+
+    return func(c *gin.Context) {
+        start := time.Now()
+
+        id := c.GetHeader(RequestIDHeader)
+        if id == "" || len(id) > 128 {
+            id = uuid.NewString()
+        }
+        c.Header(RequestIDHeader, id)
+        c.Request = c.Request.WithContext(WithRequestID(c.Request.Context(), id))
+
+        c.Next()
+
+        status := c.Writer.Status()
+        level := slog.LevelInfo
+        switch {
+        case status >= 500:
+            level = slog.LevelError
+        case status >= 400:
+            level = slog.LevelWarn
+        case quiet[c.Request.URL.Path]:
+            level = slog.LevelDebug
+        }
+
+        attrs := []slog.Attr{
+            slog.String("method", c.Request.Method),
+            slog.String("path", c.Request.URL.Path),
+            slog.String("route", c.FullPath()),
+            slog.Int("status", status),
+            slog.Duration("latency", time.Since(start)),
+            slog.String("ip", c.ClientIP()),
+        }
+        if len(c.Errors) > 0 {
+            attrs = append(attrs, slog.String("errors", c.Errors.String()))
+        }
+        logger.LogAttrs(c.Request.Context(), level, "request", attrs...)
+    }
+}
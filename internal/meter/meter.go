@@ -0,0 +1,363 @@
+package meter
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "time"
+
+    "service/internal/tenant"
+
+    "github.com/google/uuid"
+    "github.com/jackc/pgx/v5"
+    "github.com/jackc/pgx/v5/pgconn"
+    "github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Виды счетчиков (meters.type)
+const (
+    TypeHotWater    = "hot_water"
+    TypeColdWater   = "cold_water"
+    TypeTemperature = "temperature"
+)
+
+// Состояния счетчика
+const (
+    StatusActive   = "active"
+    StatusReplaced = "replaced"
+)
+
+// Поля показаний, на которые могут отображаться каналы счетчика каждого вида
+var ReadingFields = map[string][]string{
+    TypeHotWater:    {"flow_rate_ch1", "flow_rate_ch2"},
+    TypeColdWater:   {"flow_rate"},
+    TypeTemperature: {"supply_temp", "return_temp"},
+}
+
+// Каналы и единицы по умолчанию; совпадают со значениями, которые использует reading_meter в БД
+var (
+    DefaultChannels = map[string]map[string]string{
+        TypeHotWater:    {"ch1": "flow_rate_ch1", "ch2": "flow_rate_ch2"},
+        TypeColdWater:   {"ch1": "flow_rate"},
+        TypeTemperature: {"t1": "supply_temp", "t2": "return_temp"},
+    }
+    DefaultUnits = map[string]string{
+        TypeHotWater:    "m3/h",
+        TypeColdWater:   "m3/h",
+        TypeTemperature: "°C",
+    }
+)
+
+// Таблицы показаний, ссылающихся на счетчик каждого вида
+var readingTables = map[string][]string{
+    TypeHotWater:    {"hot_water_meters", "meter_totals"},
+    TypeColdWater:   {"cold_water_meters", "meter_totals"},
+    TypeTemperature: {"temperature_readings"},
+}
+
+var (
+    ErrNotFound              = errors.New("meter not found")
+    ErrNotActive             = errors.New("meter is not active")
+    ErrActiveExists          = errors.New("an active meter is already installed at this position, use replace")
+    ErrUnknownITP            = errors.New("itp does not belong to the building")
+    ErrInvalidChannels       = errors.New("invalid channel mapping")
+    ErrReplacedBeforeInstall = errors.New("replacement time must be after the meter installation")
+)
+
+// Прибор учета. Место установки - здание, вид и ИТП (обязателен для ХВС, для ОДПУ ГВС - если ИТП несколько).
+// Даты поверки - в формате 2006-01-02
+type Meter struct {
+    ID              uuid.UUID         `json:"id"`
+    BuildingID      uuid.UUID         `json:"building_id"`
+    ITPID           *uuid.UUID        `json:"itp_id,omitempty"`
+    Type            string            `json:"type"`
+    SerialNumber    string            `json:"serial_number"`
+    Manufacturer    string            `json:"manufacturer"`
+    Model           string            `json:"model"`
+    Channels        map[string]string `json:"channels"`
+    Unit            string            `json:"unit"`
+    InstalledAt     *time.Time        `json:"installed_at"`
+    VerifiedAt      *string           `json:"verified_at"`
+    VerificationDue *string           `json:"verification_due"`
+    Status          string            `json:"status"`
+    RemovedAt       *time.Time        `json:"removed_at,omitempty"`
+    ReplacedBy      *uuid.UUID        `json:"replaced_by,omitempty"`
+    CreatedAt       time.Time         `json:"created_at"`
+    UpdatedAt       time.Time         `json:"updated_at"`
+}
+
+// Паспортные данные счетчика для изменения: nil - без изменений
+type Passport struct {
+    SerialNumber    *string
+    Manufacturer    *string
+    Model           *string
+    Channels        map[string]string
+    Unit            *string
+    VerifiedAt      *string
+    VerificationDue *string
+}
+
+// Проверка отображения каналов: каждый канал указывает на допустимое поле показаний, поле - не более одного раза
+func ValidateChannels(meterType string, channels map[string]string) error {
+    if len(channels) == 0 {
+        return fmt.Errorf("%w: no channels", ErrInvalidChannels)
+    }
+    allowed := make(map[string]bool)
+    for _, f := range ReadingFields[meterType] {
+        allowed[f] = true
+    }
+    used := make(map[string]bool)
+    for ch, field := range channels {
+        if ch == "" || !allowed[field] {
+            return fmt.Errorf("%w: channel %q -> %q", ErrInvalidChannels, ch, field)
+        }
+        if used[field] {
+            return fmt.Errorf("%w: field %q mapped twice", ErrInvalidChannels, field)
+        }
+        used[field] = true
+    }
+    return nil
+}
+
+// Store - реестр приборов учета
+type Store struct {
+    pool *pgxpool.Pool
+}
+
+func NewStore(pool *pgxpool.Pool) *Store {
+    return &Store{pool: pool}
+}
+
+const selectMeter = `
+    SELECT m.id, m.building_id, m.itp_id, m.type, m.serial_number, m.manufacturer, m.model, m.channels, m.unit,
+           m.installed_at, m.verified_at::text, m.verification_due::text, m.status, m.removed_at, m.replaced_by,
+           m.created_at, m.updated_at
+    FROM meters m
+    JOIN buildings b ON b.id = m.building_id`
+
+func scanMeter(row pgx.Row) (*Meter, error) {
+    var m Meter
+    err := row.Scan(&m.ID, &m.BuildingID, &m.ITPID, &m.Type, &m.SerialNumber, &m.Manufacturer, &m.Model, &m.Channels, &m.Unit,
+        &m.InstalledAt, &m.VerifiedAt, &m.VerificationDue, &m.Status, &m.RemovedAt, &m.ReplacedBy,
+        &m.CreatedAt, &m.UpdatedAt)
+    if err != nil {
+        return nil, err
+    }
+    return &m, nil
+}
+
+func collectMeters(rows pgx.Rows) ([]*Meter, error) {
+    defer rows.Close()
+    meters := []*Meter{}
+    for rows.Next() {
+        m, err := scanMeter(rows)
+        if err != nil {
+            return nil, fmt.Errorf("scan meter: %w", err)
+        }
+        meters = append(meters, m)
+    }
+    return meters, rows.Err()
+}
+
+// Счетчики здания; all - вместе с замененными. Здание вне компании organizationID - tenant.ErrBuildingNotFound
+func (s *Store) List(ctx context.Context, organizationID *uuid.UUID, buildingID uuid.UUID, all bool) ([]*Meter, error) {
+    var exists bool
+    err := s.pool.QueryRow(ctx, `
+        SELECT TRUE FROM buildings WHERE id = $1 AND ($2::uuid IS NULL OR organization_id = $2)`,
+        buildingID, organizationID).Scan(&exists)
+    if errors.Is(err, pgx.ErrNoRows) {
+        return nil, tenant.ErrBuildingNotFound
+    }
+    if err != nil {
+        return nil, fmt.Errorf("check building %s: %w", buildingID, err)
+    }
+
+    rows, err := s.pool.Query(ctx, selectMeter+`
+        WHERE m.building_id = $1 AND ($2 OR m.status = 'active')
+        ORDER BY m.type, m.itp_id, m.installed_at NULLS FIRST, m.created_at`, buildingID, all)
+    if err != nil {
+        return nil, fmt.Errorf("list meters %s: %w", buildingID, err)
+    }
+    return collectMeters(rows)
+}
+
+// Счетчик в пределах видимости компании organizationID (nil - все компании)
+func (s *Store) Get(ctx context.Context, organizationID *uuid.UUID, id uuid.UUID) (*Meter, error) {
+    m, err := scanMeter(s.pool.QueryRow(ctx, selectMeter+`
+        WHERE m.id = $1 AND ($2::uuid IS NULL OR b.organization_id = $2)`, id, organizationID))
+    if errors.Is(err, pgx.ErrNoRows) {
+        return nil, ErrNotFound
+    }
+    if err != nil {
+        return nil, fmt.Errorf("get meter %s: %w", id, err)
+    }
+    return m, nil
+}
+
+// История места установки счетчика: все счетчики, стоявшие на нем, от первого к действующему
+func (s *Store) History(ctx context.Context, organizationID *uuid.UUID, id uuid.UUID) ([]*Meter, error) {
+    m, err := s.Get(ctx, organizationID, id)
+    if err != nil {
+        return nil, err
+    }
+    rows, err := s.pool.Query(ctx, selectMeter+`
+        WHERE m.building_id = $1 AND m.type = $2 AND m.itp_id IS NOT DISTINCT FROM $3
+        ORDER BY m.installed_at NULLS FIRST, m.created_at`, m.BuildingID, m.Type, m.ITPID)
+    if err != nil {
+        return nil, fmt.Errorf("meter history %s: %w", id, err)
+    }
+    return collectMeters(rows)
+}
+
+// Регистрация счетчика на свободном месте установки. Доступ к зданию проверяет вызывающий.
+// Пустые каналы и единица заполняются значениями по умолчанию для вида счетчика
+func (s *Store) Create(ctx context.Context, m Meter) (*Meter, error) {
+    if m.Channels == nil {
+        m.Channels = DefaultChannels[m.Type]
+    }
+    if m.Unit == "" {
+        m.Unit = DefaultUnits[m.Type]
+    }
+    if err := ValidateChannels(m.Type, m.Channels); err != nil {
+        return nil, err
+    }
+
+    var id uuid.UUID
+    err := s.pool.QueryRow(ctx, `
+        INSERT INTO meters (building_id, itp_id, type, serial_number, manufacturer, model, channels, unit,
+                            installed_at, verified_at, verification_due)
+        SELECT $1::uuid, $2::uuid, $3, $4, $5, $6, $7::jsonb, $8, $9::timestamptz, $10::text::date, $11::text::date
+        WHERE $2::uuid IS NULL OR EXISTS (SELECT 1 FROM itp WHERE id = $2 AND building_id = $1)
+        RETURNING id`,
+        m.BuildingID, m.ITPID, m.Type, m.SerialNumber, m.Manufacturer, m.Model, m.Channels, m.Unit,
+        m.InstalledAt, m.VerifiedAt, m.VerificationDue).Scan(&id)
+    if errors.Is(err, pgx.ErrNoRows) {
+        return nil, ErrUnknownITP
+    }
+    if isUniqueViolation(err) {
+        return nil, ErrActiveExists
+    }
+    if err != nil {
+        return nil, fmt.Errorf("create meter: %w", err)
+    }
+    return s.Get(ctx, nil, id)
+}
+
+// Изменение паспортных данных (заводской номер, каналы, поверка). Возвращает состояние до и после
+func (s *Store) Update(ctx context.Context, organizationID *uuid.UUID, id uuid.UUID, p Passport) (before, after *Meter, err error) {
+    before, err = s.Get(ctx, organizationID, id)
+    if err != nil {
+        return nil, nil, err
+    }
+    // Отсутствующие каналы передаются как NULL, а не JSON null
+    var channels interface{}
+    if p.Channels != nil {
+        if err := ValidateChannels(before.Type, p.Channels); err != nil {
+            return nil, nil, err
+        }
+        channels = p.Channels
+    }
+
+    _, err = s.pool.Exec(ctx, `
+        UPDATE meters SET
+            serial_number = COALESCE($2, serial_number),
+            manufacturer = COALESCE($3, manufacturer),
+            model = COALESCE($4, model),
+            channels = COALESCE($5, channels),
+            unit = COALESCE($6, unit),
+            verified_at = COALESCE($7::text::date, verified_at),
+            verification_due = COALESCE($8::text::date, verification_due),
+            updated_at = NOW()
+        WHERE id = $1`,
+        id, p.SerialNumber, p.Manufacturer, p.Model, channels, p.Unit, p.VerifiedAt, p.VerificationDue)
+    if err != nil {
+        return nil, nil, fmt.Errorf("update meter %s: %w", id, err)
+    }
+
+    after, err = s.Get(ctx, organizationID, id)
+    if err != nil {
+        return nil, nil, err
+    }
+    return before, after, nil
+}
+
+// Замена счетчика в момент replacedAt: действующий счетчик переводится в replaced, на его место
+// ставится next (паспортные данные). Показания, записанные после replacedAt за старым счетчиком,
+// переносятся на новый. Возвращает старый счетчик после замены и новый
+func (s *Store) Replace(ctx context.Context, organizationID *uuid.UUID, id uuid.UUID, replacedAt time.Time, next Meter) (old, installed *Meter, err error) {
+    tx, err := s.pool.Begin(ctx)
+    if err != nil {
+        return nil, nil, err
+    }
+    defer tx.Rollback(ctx)
+
+    old, err = scanMeter(tx.QueryRow(ctx, selectMeter+`
+        WHERE m.id = $1 AND ($2::uuid IS NULL OR b.organization_id = $2)
+        FOR UPDATE OF m`, id, organizationID))
+    if errors.Is(err, pgx.ErrNoRows) {
+        return nil, nil, ErrNotFound
+    }
+    if err != nil {
+        return nil, nil, fmt.Errorf("get meter %s: %w", id, err)
+    }
+    if old.Status != StatusActive {
+        return nil, nil, ErrNotActive
+    }
+    if old.InstalledAt != nil && !replacedAt.After(*old.InstalledAt) {
+        return nil, nil, ErrReplacedBeforeInstall
+    }
+
+    if next.Channels == nil {
+        next.Channels = old.Channels
+    }
+    if next.Unit == "" {
+        next.Unit = old.Unit
+    }
+    if err := ValidateChannels(old.Type, next.Channels); err != nil {
+        return nil, nil, err
+    }
+
+    _, err = tx.Exec(ctx, `
+        UPDATE meters SET status = 'replaced', removed_at = $2, updated_at = NOW() WHERE id = $1`, id, replacedAt)
+    if err != nil {
+        return nil, nil, fmt.Errorf("replace meter %s: %w", id, err)
+    }
+    var newID uuid.UUID
+    err = tx.QueryRow(ctx, `
+        INSERT INTO meters (building_id, itp_id, type, serial_number, manufacturer, model, channels, unit,
+                            installed_at, verified_at, verification_due)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10::text::date, $11::text::date)
+        RETURNING id`,
+        old.BuildingID, old.ITPID, old.Type, next.SerialNumber, next.Manufacturer, next.Model, next.Channels, next.Unit,
+        replacedAt, next.VerifiedAt, next.VerificationDue).Scan(&newID)
+    if err != nil {
+        return nil, nil, fmt.Errorf("install meter: %w", err)
+    }
+    if _, err := tx.Exec(ctx, `UPDATE meters SET replaced_by = $2 WHERE id = $1`, id, newID); err != nil {
+        return nil, nil, fmt.Errorf("replace meter %s: %w", id, err)
+    }
+
+    for _, table := range readingTables[old.Type] {
+        _, err := tx.Exec(ctx, fmt.Sprintf(`
+            UPDATE %s SET meter_id = $2 WHERE meter_id = $1 AND timestamp >= $3`, table), id, newID, replacedAt)
+        if err != nil {
+            return nil, nil, fmt.Errorf("relink %s readings: %w", table, err)
+        }
+    }
+    if err := tx.Commit(ctx); err != nil {
+        return nil, nil, err
+    }
+
+    if old, err = s.Get(ctx, organizationID, id); err != nil {
+        return nil, nil, err
+    }
+    if installed, err = s.Get(ctx, organizationID, newID); err != nil {
+        return nil, nil, err
+    }
+    return old, installed, nil
+}
+
+func isUniqueViolation(err error) bool {
+    var pgErr *pgconn.PgError
+    return errors.As(err, &pgErr) && pgErr.Code == "23505"
+}
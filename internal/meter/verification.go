@@ -0,0 +1,124 @@
+package meter
+
+import (
+    "context"
+    "fmt"
+    "log/slog"
+    "math"
+    "time"
+
+    "service/internal/incident"
+    "service/internal/logging"
+
+    "github.com/google/uuid"
+    "github.com/jackc/pgx/v5"
+    "github.com/jackc/pgx/v5/pgxpool"
+)
+
+var typeTitles = map[string]string{
+    TypeHotWater:    "ОДПУ ГВС",
+    TypeColdWater:   "счетчик ХВС",
+    TypeTemperature: "датчик температуры ГВС",
+}
+
+// VerificationChecker - периодическая проверка сроков поверки действующих счетчиков:
+// за warnBefore до окончания открывается предупреждение, после окончания - критический инцидент
+type VerificationChecker struct {
+    pool       *pgxpool.Pool
+    incidents  *incident.Store
+    warnBefore time.Duration
+    log        *slog.Logger
+}
+
+func NewVerificationChecker(pool *pgxpool.Pool, incidents *incident.Store, warnBefore time.Duration) (*VerificationChecker, error) {
+    if warnBefore <= 0 {
+        return nil, fmt.Errorf("verification warning period must be positive")
+    }
+    return &VerificationChecker{
+        pool:       pool,
+        incidents:  incidents,
+        warnBefore: warnBefore,
+        log:        logging.Component("meters"),
+    }, nil
+}
+
+// Проход фоновой задачи: сверка инцидентов поверки по всем зданиям.
+// Замененный счетчик или внесенная новая поверка закрывают инцидент
+func (vc *VerificationChecker) RunOnce(ctx context.Context) error {
+    warnDays := int(math.Ceil(vc.warnBefore.Hours() / 24))
+
+    rows, err := vc.pool.Query(ctx, `
+        SELECT id, building_id, type, serial_number, verification_due::text, verification_due - CURRENT_DATE
+        FROM meters
+        WHERE status = 'active' AND verification_due IS NOT NULL AND verification_due <= CURRENT_DATE + $1::int`,
+        warnDays)
+    if err != nil {
+        return fmt.Errorf("check meter verification: %w", err)
+    }
+    detected := make(map[uuid.UUID][]incident.Detection)
+    expired, expiring := 0, 0
+    for rows.Next() {
+        var id, buildingID uuid.UUID
+        var meterType, serial, due string
+        var daysLeft int
+        if err := rows.Scan(&id, &buildingID, &meterType, &serial, &due, &daysLeft); err != nil {
+            rows.Close()
+            return fmt.Errorf("scan meter verification: %w", err)
+        }
+
+        name := typeTitles[meterType]
+        if serial != "" {
+            name += " №" + serial
+        }
+        d := incident.Detection{
+            Kind:     incident.KindVerification,
+            Subject:  id.String(),
+            Severity: incident.SeverityWarning,
+            Title:    fmt.Sprintf("Истекает поверка: %s (до %s)", name, due),
+            Details: map[string]interface{}{
+                "meter_id":         id,
+                "type":             meterType,
+                "serial_number":    serial,
+                "verification_due": due,
+                "days_left":        daysLeft,
+            },
+        }
+        // Поверка действительна по дату verification_due включительно
+        if daysLeft < 0 {
+            d.Severity = incident.SeverityCritical
+            d.Title = fmt.Sprintf("Истекла поверка: %s (%s)", name, due)
+            expired++
+        } else {
+            expiring++
+        }
+        detected[buildingID] = append(detected[buildingID], d)
+    }
+    rows.Close()
+    if err := rows.Err(); err != nil {
+        return fmt.Errorf("check meter verification: %w", err)
+    }
+
+    rows, err = vc.pool.Query(ctx, `SELECT id FROM buildings`)
+    if err != nil {
+        return fmt.Errorf("list buildings: %w", err)
+    }
+    buildings, err := pgx.CollectRows(rows, pgx.RowTo[uuid.UUID])
+    if err != nil {
+        return fmt.Errorf("list buildings: %w", err)
+    }
+
+    opened, resolved, err := vc.incidents.Reconcile(ctx, []string{incident.KindVerification}, buildings, detected)
+    if err != nil {
+        return err
+    }
+    if err := vc.incidents.UpdateMetrics(ctx); err != nil {
+        return err
+    }
+
+    vc.log.InfoContext(ctx, "meter verification checked",
+        "expiring", expiring,
+        "expired", expired,
+        "incidents_opened", opened,
+        "incidents_resolved", resolved)
+    return nil
+}
@@ -0,0 +1,161 @@
+package metrics
+
+import (
+    "net/http"
+    "strconv"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "github.com/prometheus/client_golang/prometheus"
+    "github.com/prometheus/client_golang/prometheus/collectors"
+    "github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "itp"
+
+// Таблицы показаний (значение метки table)
+const (
+    TableHotWater    = "hot_water_meters"
+    TableColdWater   = "cold_water_meters"
+    TableTemperature = "temperature_readings"
+    TablePump        = "pump_data"
+    TableMeterTotals = "meter_totals"
+)
+
+// Источники показаний (значение метки source)
+const (
+    SourceGenerator = "generator"
+    SourceHistory   = "history"
+    SourceIngest    = "ingest"
+)
+
+// Registry - отдельный реестр метрик сервиса (без глобального состояния client_golang)
+var Registry = prometheus.NewRegistry()
+
+var (
+    HTTPRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+        Namespace: namespace,
+        Name:      "http_request_duration_seconds",
+        Help:      "HTTP request latency by route.",
+        Buckets:   prometheus.DefBuckets,
+    }, []string{"method", "route", "status"})
+
+    ReadingsIngested = prometheus.NewCounterVec(prometheus.CounterOpts{
+        Namespace: namespace,
+        Name:      "readings_ingested_total",
+        Help:      "Readings written to the database by table and source.",
+    }, []string{"table", "source"})
+
+    ReadingsDuplicates = prometheus.NewCounterVec(prometheus.CounterOpts{
+        Namespace: namespace,
+        Name:      "readings_duplicates_total",
+        Help:      "Readings rejected at ingest as already stored, by table.",
+    }, []string{"table"})
+
+    TotalizerIntervals = prometheus.NewCounterVec(prometheus.CounterOpts{
+        Namespace: namespace,
+        Name:      "totalizer_intervals_total",
+        Help:      "Intervals derived from totalizer readings by status (ok, rollover, replaced, negative).",
+    }, []string{"status"})
+
+    GeneratorTicks = prometheus.NewCounterVec(prometheus.CounterOpts{
+        Namespace: namespace,
+        Name:      "generator_ticks_total",
+        Help:      "Data generator ticks by stream.",
+    }, []string{"stream"})
+
+    GeneratorErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+        Namespace: namespace,
+        Name:      "generator_errors_total",
+        Help:      "Data generator errors by stream.",
+    }, []string{"stream"})
+
+    AnalysisDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+        Namespace: namespace,
+        Name:      "analysis_duration_seconds",
+        Help:      "Duration of building consumption analysis.",
+        Buckets:   []float64{.01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10},
+    }, []string{"result"})
+
+    JobDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+        Namespace: namespace,
+        Name:      "job_duration_seconds",
+        Help:      "Duration of scheduled background jobs.",
+        Buckets:   []float64{.05, .1, .5, 1, 5, 15, 30, 60, 300},
+    }, []string{"job", "result"})
+
+    RetentionDeleted = prometheus.NewCounterVec(prometheus.CounterOpts{
+        Namespace: namespace,
+        Name:      "retention_deleted_rows_total",
+        Help:      "Rows deleted by the retention job.",
+    }, []string{"table"})
+
+    PartitionsExpired = prometheus.NewCounterVec(prometheus.CounterOpts{
+        Namespace: namespace,
+        Name:      "partitions_expired_total",
+        Help:      "Measurement partitions dropped or archived by retention.",
+    }, []string{"table", "mode"})
+
+    OpenIncidents = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+        Namespace: namespace,
+        Name:      "open_incidents",
+        Help:      "Open incidents by severity.",
+    }, []string{"severity"})
+)
+
+func init() {
+    Registry.MustRegister(
+        collectors.NewGoCollector(),
+        collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+        HTTPRequestDuration,
+        ReadingsIngested,
+        ReadingsDuplicates,
+        TotalizerIntervals,
+        GeneratorTicks,
+        GeneratorErrors,
+        AnalysisDuration,
+        JobDuration,
+        RetentionDeleted,
+        PartitionsExpired,
+        OpenIncidents,
+    )
+}
+
+// Число подключенных клиентов WebSocket, считывается при каждом опросе
+func RegisterWebSocketClients(count func() int) {
+    Registry.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+        Namespace: namespace,
+        Name:      "websocket_clients",
+        Help:      "Connected WebSocket clients.",
+    }, func() float64 {
+        return float64(count())
+    }))
+}
+
+// Учет показаний, записанных в таблицу
+func AddReadings(table, source string, n int) {
+    if n > 0 {
+        ReadingsIngested.WithLabelValues(table, source).Add(float64(n))
+    }
+}
+
+// Middleware замера времени обработки запросов. Маршрут берется из шаблона (/api/buildings/:id),
+// чтобы число рядов не зависело от идентификаторов в пути
+func Middleware() gin.HandlerFunc {
+    return func(c *gin.Context) {
+        start := time.Now()
+        c.Next()
+
+        route := c.FullPath()
+        if route == "" {
+            route = "unmatched"
+        }
+        HTTPRequestDuration.WithLabelValues(c.Request.Method, route, strconv.Itoa(c.Writer.Status())).
+            Observe(time.Since(start).Seconds())
+    }
+}
+
+// Обработчик /metrics в формате Prometheus
+func Handler() http.Handler {
+    return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
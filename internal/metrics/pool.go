@@ -0,0 +1,62 @@
+package metrics
+
+import (
+    "github.com/jackc/pgx/v5/pgxpool"
+    "github.com/prometheus/client_golang/prometheus"
+)
+
+// Сборщик статистики пула соединений pgx. Значения читаются из pool.Stat() при каждом опросе
+type poolCollector struct {
+    pool *pgxpool.Pool
+
+    acquiredConns        *prometheus.Desc
+    idleConns            *prometheus.Desc
+    totalConns           *prometheus.Desc
+    maxConns             *prometheus.Desc
+    acquireCount         *prometheus.Desc
+    acquireDuration      *prometheus.Desc
+    emptyAcquireCount    *prometheus.Desc
+    canceledAcquireCount *prometheus.Desc
+}
+
+func poolDesc(name, help string) *prometheus.Desc {
+    return prometheus.NewDesc(prometheus.BuildFQName(namespace, "db_pool", name), help, nil, nil)
+}
+
+// Регистрация метрик пула соединений
+func RegisterPool(pool *pgxpool.Pool) {
+    Registry.MustRegister(&poolCollector{
+        pool:                 pool,
+        acquiredConns:        poolDesc("acquired_conns", "Connections currently in use."),
+        idleConns:            poolDesc("idle_conns", "Idle connections."),
+        totalConns:           poolDesc("total_conns", "Total open connections."),
+        maxConns:             poolDesc("max_conns", "Maximum pool size."),
+        acquireCount:         poolDesc("acquire_total", "Successful connection acquires."),
+        acquireDuration:      poolDesc("acquire_duration_seconds_total", "Total time spent acquiring connections."),
+        emptyAcquireCount:    poolDesc("empty_acquire_total", "Acquires that had to wait for a connection."),
+        canceledAcquireCount: poolDesc("canceled_acquire_total", "Acquires canceled by context."),
+    })
+}
+
+func (pc *poolCollector) Describe(ch chan<- *prometheus.Desc) {
+    ch <- pc.acquiredConns
+    ch <- pc.idleConns
+    ch <- pc.totalConns
+    ch <- pc.maxConns
+    ch <- pc.acquireCount
+    ch <- pc.acquireDuration
+    ch <- pc.emptyAcquireCount
+    ch <- pc.canceledAcquireCount
+}
+
+func (pc *poolCollector) Collect(ch chan<- prometheus.Metric) {
+    stat := pc.pool.Stat()
+    ch <- prometheus.MustNewConstMetric(pc.acquiredConns, prometheus.GaugeValue, float64(stat.AcquiredConns()))
+    ch <- prometheus.MustNewConstMetric(pc.idleConns, prometheus.GaugeValue, float64(stat.IdleConns()))
+    ch <- prometheus.MustNewConstMetric(pc.totalConns, prometheus.GaugeValue, float64(stat.TotalConns()))
+    ch <- prometheus.MustNewConstMetric(pc.maxConns, prometheus.GaugeValue, float64(stat.MaxConns()))
+    ch <- prometheus.MustNewConstMetric(pc.acquireCount, prometheus.CounterValue, float64(stat.AcquireCount()))
+    ch <- prometheus.MustNewConstMetric(pc.acquireDuration, prometheus.CounterValue, stat.AcquireDuration().Seconds())
+    ch <- prometheus.MustNewConstMetric(pc.emptyAcquireCount, prometheus.CounterValue, float64(stat.EmptyAcquireCount()))
+    ch <- prometheus.MustNewConstMetric(pc.canceledAcquireCount, prometheus.CounterValue, float64(stat.CanceledAcquireCount()))
+}
@@ -1,18 +1,21 @@
 package models
 
 import (
+    "math"
     "time"
+
     "github.com/google/uuid"
 )
 
 // Тип таблицы строений МКД (Многоквартирный дом)
 type Building struct {
-    ID        uuid.UUID `json:"id" db:"id"`
-    Address   string    `json:"address" db:"address"`
-    FiasID    string    `json:"fias_id" db:"fias_id"`
-    UnomID    string    `json:"unom_id" db:"unom_id"`
-    CreatedAt time.Time `json:"created_at" db:"created_at"`
-    UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
+    ID             uuid.UUID  `json:"id" db:"id"`
+    Address        string     `json:"address" db:"address"`
+    FiasID         string     `json:"fias_id" db:"fias_id"`
+    UnomID         string     `json:"unom_id" db:"unom_id"`
+    OrganizationID *uuid.UUID `json:"organization_id,omitempty" db:"organization_id"` // управляющая компания
+    CreatedAt      time.Time  `json:"created_at" db:"created_at"`
+    UpdatedAt      time.Time  `json:"updated_at" db:"updated_at"`
 }
 
 // Структура ITP Индивидуального Теплового Пункта
@@ -28,7 +31,7 @@ type ITP struct {
 type ColdWaterMeter struct {
     ID        uuid.UUID `json:"id" db:"id"`
     ITPID     uuid.UUID `json:"itp_id" db:"itp_id"`
-    FlowRate  int       `json:"flow_rate" db:"flow_rate"`
+    FlowRate  float64   `json:"flow_rate" db:"flow_rate"` // м³, до 0.001
     Timestamp time.Time `json:"timestamp" db:"timestamp"`
     CreatedAt time.Time `json:"created_at" db:"created_at"`
 }
@@ -37,8 +40,9 @@ type ColdWaterMeter struct {
 type HotWaterMeter struct {
     ID          uuid.UUID `json:"id" db:"id"`
     BuildingID  uuid.UUID `json:"building_id" db:"building_id"`
-    FlowRateCh1 int       `json:"flow_rate_ch1" db:"flow_rate_ch1"`
-    FlowRateCh2 int       `json:"flow_rate_ch2" db:"flow_rate_ch2"`
+    FlowRateCh1 float64   `json:"flow_rate_ch1" db:"flow_rate_ch1"` // м³, до 0.001
+    FlowRateCh2 float64   `json:"flow_rate_ch2" db:"flow_rate_ch2"`
+    MeterKey    string    `json:"meter_key" db:"meter_key"` // ИТП, через который подается ГВС; пусто - ОДПУ здания
     Timestamp   time.Time `json:"timestamp" db:"timestamp"`
     CreatedAt   time.Time `json:"created_at" db:"created_at"`
 }
@@ -47,9 +51,9 @@ type HotWaterMeter struct {
 type TemperatureReading struct {
     ID         uuid.UUID `json:"id" db:"id"`
     BuildingID uuid.UUID `json:"building_id" db:"building_id"`
-    SupplyTemp int       `json:"supply_temp" db:"supply_temp"`   // температура подачи
-    ReturnTemp int       `json:"return_temp" db:"return_temp"`   // температура возврата
-    DeltaTemp  int       `json:"delta_temp" db:"delta_temp"`     // разница температур
+    SupplyTemp float64   `json:"supply_temp" db:"supply_temp"`   // температура подачи, °C до 0.1
+    ReturnTemp float64   `json:"return_temp" db:"return_temp"`   // температура возврата
+    DeltaTemp  float64   `json:"delta_temp" db:"delta_temp"`     // разница температур
     Timestamp  time.Time `json:"timestamp" db:"timestamp"`
     CreatedAt  time.Time `json:"created_at" db:"created_at"`
 }
@@ -66,4 +70,61 @@ type PumpData struct {
     VibrationLevel int       `json:"vibration_level" db:"vibration_level"`
     Timestamp      time.Time `json:"timestamp" db:"timestamp"`
     CreatedAt      time.Time `json:"created_at" db:"created_at"`
-}
\ No newline at end of file
+}
+
+// Накопительное показание (нарастающий итог) одного канала ОДПУ
+type TotalizerReading struct {
+    BuildingID uuid.UUID `json:"building_id"`
+    Source     string    `json:"source"`    // hot_water, cold_water
+    MeterKey   string    `json:"meter_key"` // ИТП счетчика; пусто для ОДПУ ГВС здания
+    Channel    string    `json:"channel"`   // ch1, ch2
+    Total      float64   `json:"total"`     // м³, до 0.001
+    Capacity   *float64  `json:"capacity,omitempty"` // значение перехода счетчика через ноль
+    Timestamp  time.Time `json:"timestamp"`
+}
+
+// Замена счетчика: показания нового счетчика отсчитываются от NewTotal
+type MeterReplacement struct {
+    BuildingID uuid.UUID `json:"building_id"`
+    Source     string    `json:"source"`
+    MeterKey   string    `json:"meter_key"`
+    Channel    string    `json:"channel"`
+    ReplacedAt time.Time `json:"replaced_at"`
+    OldTotal   *float64  `json:"old_total,omitempty"` // последнее значение снятого счетчика
+    NewTotal   float64   `json:"new_total"`
+}
+
+// Точность хранения показаний (знаков после запятой): расход в м³ и температура в °C.
+// Тепловая энергия (Гкал) не хранится, а рассчитывается; итоги округляются до HeatPrecision.
+// Стоимость в рублях округляется до копеек
+const (
+    FlowPrecision  = 3
+    TempPrecision  = 1
+    HeatPrecision  = 4
+    MoneyPrecision = 2
+)
+
+// Округление расхода до точности хранения
+func RoundFlow(v float64) float64 {
+    return round(v, FlowPrecision)
+}
+
+// Округление температуры до точности хранения
+func RoundTemp(v float64) float64 {
+    return round(v, TempPrecision)
+}
+
+// Округление тепловой энергии, Гкал
+func RoundHeat(v float64) float64 {
+    return round(v, HeatPrecision)
+}
+
+// Округление стоимости, ₽
+func RoundMoney(v float64) float64 {
+    return round(v, MoneyPrecision)
+}
+
+func round(v float64, places int) float64 {
+    scale := math.Pow(10, float64(places))
+    return math.Round(v*scale) / scale
+}
@@ -0,0 +1,458 @@
+package network
+
+import (
+    "context"
+    "fmt"
+    "log/slog"
+    "math"
+    "sort"
+    "time"
+
+    "service/internal/incident"
+    "service/internal/logging"
+
+    "github.com/google/uuid"
+    "github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Виды аномалий, которые могут быть вызваны узлом сети или общей причиной в районе: температурный режим
+// и баланс ХВС/ГВС. Насосы и счетчики относятся к самому ИТП
+var correlatedKinds = []string{incident.KindWaterBalance, incident.KindTemperature}
+
+var kindTitles = map[string]string{
+    incident.KindWaterBalance: "нарушен баланс ХВС/ГВС",
+    incident.KindTemperature:  "ΔT вне нормы",
+}
+
+var nodeTitles = map[string]string{
+    TypeSource: "Источник",
+    TypeCTP:    "ЦТП",
+}
+
+// Средний радиус Земли, м
+const earthRadius = 6371000.0
+
+// Параметры группировки аномалий
+type Config struct {
+    MinBuildings int           // минимум зданий в группе
+    MinShare     float64       // минимальная доля проверенных зданий узла, чтобы отнести группу к узлу
+    Window       time.Duration // аномалии, открытые в пределах окна друг от друга, считаются одновременными
+    Radius       float64       // расстояние между соседними зданиями, м; 0 - без группировки по соседству
+}
+
+func (c Config) Validate() error {
+    if c.MinBuildings < 2 {
+        return fmt.Errorf("situation needs at least 2 buildings, got %d", c.MinBuildings)
+    }
+    if c.MinShare <= 0 || c.MinShare > 1 {
+        return fmt.Errorf("building share must be in (0, 1], got %g", c.MinShare)
+    }
+    if c.Window <= 0 {
+        return fmt.Errorf("correlation window must be positive, got %s", c.Window)
+    }
+    if c.Radius < 0 {
+        return fmt.Errorf("correlation radius must not be negative, got %g", c.Radius)
+    }
+    return nil
+}
+
+// Correlator группирует одновременные аномалии нескольких зданий в ситуации: по общему узлу тепловой сети,
+// а аномалии без общего узла - по соседству зданий
+type Correlator struct {
+    pool      *pgxpool.Pool
+    incidents *incident.Store
+    cfg       Config
+    log       *slog.Logger
+}
+
+func NewCorrelator(pool *pgxpool.Pool, incidents *incident.Store, cfg Config) (*Correlator, error) {
+    if err := cfg.Validate(); err != nil {
+        return nil, err
+    }
+    return &Correlator{
+        pool:      pool,
+        incidents: incidents,
+        cfg:       cfg,
+        log:       logging.Component("network"),
+    }, nil
+}
+
+type nodeInfo struct {
+    id        uuid.UUID
+    typ       string
+    name      string
+    parentID  *uuid.UUID
+    buildings map[uuid.UUID]bool // здания, питающиеся от узла и его ЦТП
+}
+
+type location struct {
+    lat, lon float64
+}
+
+// Аномалия одного вида в здании: незакрытые инциденты вида, время первого из них и наибольшая критичность
+type event struct {
+    buildingID uuid.UUID
+    address    string
+    openedAt   time.Time
+    severity   string
+    incidents  []uuid.UUID
+}
+
+// Топология и координаты зданий на момент проверки
+type topology struct {
+    nodes     map[uuid.UUID]*nodeInfo
+    ancestors map[uuid.UUID]map[uuid.UUID]bool // здание -> узлы, от которых оно питается
+    locations map[uuid.UUID]location
+}
+
+func (c *Correlator) loadTopology(ctx context.Context) (*topology, error) {
+    t := &topology{
+        nodes:     make(map[uuid.UUID]*nodeInfo),
+        ancestors: make(map[uuid.UUID]map[uuid.UUID]bool),
+        locations: make(map[uuid.UUID]location),
+    }
+
+    rows, err := c.pool.Query(ctx, "SELECT id, type, name, parent_id FROM network_nodes")
+    if err != nil {
+        return nil, fmt.Errorf("list network nodes: %w", err)
+    }
+    for rows.Next() {
+        n := &nodeInfo{buildings: make(map[uuid.UUID]bool)}
+        if err := rows.Scan(&n.id, &n.typ, &n.name, &n.parentID); err != nil {
+            rows.Close()
+            return nil, fmt.Errorf("scan network node: %w", err)
+        }
+        t.nodes[n.id] = n
+    }
+    rows.Close()
+    if err := rows.Err(); err != nil {
+        return nil, err
+    }
+
+    rows, err = c.pool.Query(ctx, "SELECT DISTINCT building_id, node_id FROM itp WHERE node_id IS NOT NULL")
+    if err != nil {
+        return nil, fmt.Errorf("list itp connections: %w", err)
+    }
+    for rows.Next() {
+        var buildingID, nodeID uuid.UUID
+        if err := rows.Scan(&buildingID, &nodeID); err != nil {
+            rows.Close()
+            return nil, fmt.Errorf("scan itp connection: %w", err)
+        }
+        for n := t.nodes[nodeID]; n != nil; {
+            n.buildings[buildingID] = true
+            if t.ancestors[buildingID] == nil {
+                t.ancestors[buildingID] = make(map[uuid.UUID]bool)
+            }
+            t.ancestors[buildingID][n.id] = true
+            if n.parentID == nil {
+                break
+            }
+            n = t.nodes[*n.parentID]
+        }
+    }
+    rows.Close()
+    if err := rows.Err(); err != nil {
+        return nil, err
+    }
+
+    rows, err = c.pool.Query(ctx, "SELECT id, latitude, longitude FROM buildings WHERE latitude IS NOT NULL")
+    if err != nil {
+        return nil, fmt.Errorf("list building locations: %w", err)
+    }
+    defer rows.Close()
+    for rows.Next() {
+        var id uuid.UUID
+        var loc location
+        if err := rows.Scan(&id, &loc.lat, &loc.lon); err != nil {
+            return nil, fmt.Errorf("scan building location: %w", err)
+        }
+        t.locations[id] = loc
+    }
+    return t, rows.Err()
+}
+
+// Незакрытые инциденты группируемых видов по видам и зданиям, в порядке открытия
+func (c *Correlator) loadEvents(ctx context.Context) (map[string][]*event, error) {
+    rows, err := c.pool.Query(ctx, `
+        SELECT i.id, i.building_id, b.address, i.kind, i.severity, i.opened_at
+        FROM incidents i JOIN buildings b ON b.id = i.building_id
+        WHERE i.status <> 'resolved' AND i.kind = ANY($1)
+        ORDER BY i.opened_at, i.id`, correlatedKinds)
+    if err != nil {
+        return nil, fmt.Errorf("list active incidents: %w", err)
+    }
+    defer rows.Close()
+
+    events := make(map[string][]*event)
+    byBuilding := make(map[string]map[uuid.UUID]*event)
+    for rows.Next() {
+        var id, buildingID uuid.UUID
+        var address, kind, severity string
+        var openedAt time.Time
+        if err := rows.Scan(&id, &buildingID, &address, &kind, &severity, &openedAt); err != nil {
+            return nil, fmt.Errorf("scan active incident: %w", err)
+        }
+        if byBuilding[kind] == nil {
+            byBuilding[kind] = make(map[uuid.UUID]*event)
+        }
+        e := byBuilding[kind][buildingID]
+        if e == nil {
+            e = &event{buildingID: buildingID, address: address, openedAt: openedAt, severity: severity}
+            byBuilding[kind][buildingID] = e
+            events[kind] = append(events[kind], e)
+        }
+        if severity == incident.SeverityCritical {
+            e.severity = severity
+        }
+        e.incidents = append(e.incidents, id)
+    }
+    return events, rows.Err()
+}
+
+// Расстояние между зданиями по дуге большого круга, м
+func distance(a, b location) float64 {
+    lat1, lat2 := a.lat*math.Pi/180, b.lat*math.Pi/180
+    dLat := lat2 - lat1
+    dLon := (b.lon - a.lon) * math.Pi / 180
+    h := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLon/2)*math.Sin(dLon/2)
+    return 2 * earthRadius * math.Asin(math.Sqrt(h))
+}
+
+// Группы одновременных аномалий: события, открытые в пределах окна и связанные linked, объединяются
+// (цепочкой, как одиночная связь). events упорядочены по времени открытия
+func (c *Correlator) cluster(events []*event, linked func(a, b *event) bool) [][]*event {
+    parent := make([]int, len(events))
+    for i := range parent {
+        parent[i] = i
+    }
+    var find func(int) int
+    find = func(i int) int {
+        if parent[i] != i {
+            parent[i] = find(parent[i])
+        }
+        return parent[i]
+    }
+
+    for i := range events {
+        for j := i + 1; j < len(events) && events[j].openedAt.Sub(events[i].openedAt) <= c.cfg.Window; j++ {
+            if linked(events[i], events[j]) {
+                parent[find(j)] = find(i)
+            }
+        }
+    }
+
+    groups := make(map[int][]*event)
+    var order []int
+    for i, e := range events {
+        root := find(i)
+        if groups[root] == nil {
+            order = append(order, root)
+        }
+        groups[root] = append(groups[root], e)
+    }
+
+    var clusters [][]*event
+    for _, root := range order {
+        if len(groups[root]) >= c.cfg.MinBuildings {
+            clusters = append(clusters, groups[root])
+        }
+    }
+    return clusters
+}
+
+// Ситуация по группе: критичность, инциденты и границы окна
+func newDetection(kind, title string, group []*event, total int, details map[string]interface{}) incident.SituationDetection {
+    d := incident.SituationDetection{
+        Kind:     kind,
+        Severity: incident.SeverityWarning,
+        Title:    title,
+        Details:  details,
+        Affected: len(group),
+        Total:    total,
+    }
+    for _, e := range group {
+        if e.severity == incident.SeverityCritical {
+            d.Severity = incident.SeverityCritical
+        }
+        d.Incidents = append(d.Incidents, e.incidents...)
+    }
+    details["first_opened_at"] = group[0].openedAt
+    details["last_opened_at"] = group[len(group)-1].openedAt
+    return d
+}
+
+// Глубина узла в сети: число узлов над ним до источника
+func (t *topology) depth(n *nodeInfo) int {
+    d := 0
+    for n.parentID != nil && t.nodes[*n.parentID] != nil {
+        n = t.nodes[*n.parentID]
+        d++
+    }
+    return d
+}
+
+// Общий узел группы: самый глубокий из узлов, от которых питаются все здания группы (ЦТП нижнего уровня,
+// иначе вышестоящий ЦТП или источник); при равной глубине - с меньшим id.
+// Группа, связанная цепочкой через здания с ИТП на разных узлах, может не иметь общего узла (nil)
+func (t *topology) commonNode(group []*event) *nodeInfo {
+    var common *nodeInfo
+    commonDepth := -1
+    for id := range t.ancestors[group[0].buildingID] {
+        shared := true
+        for _, e := range group[1:] {
+            shared = shared && t.ancestors[e.buildingID][id]
+        }
+        if !shared {
+            continue
+        }
+        n := t.nodes[id]
+        d := t.depth(n)
+        if d > commonDepth || d == commonDepth && n.id.String() < common.id.String() {
+            common, commonDepth = n, d
+        }
+    }
+    return common
+}
+
+// Группы с общим узлом, объединенные по узлу: цепочки аномалий могут разорваться окном, но относиться
+// к одному узлу, а ситуация узла должна быть одна. Узлы - в порядке первой группы, события - по времени открытия
+func (t *topology) groupsByNode(groups [][]*event) ([]*nodeInfo, map[uuid.UUID][]*event) {
+    var nodes []*nodeInfo
+    merged := make(map[uuid.UUID][]*event)
+    for _, group := range groups {
+        node := t.commonNode(group)
+        if node == nil {
+            continue
+        }
+        if merged[node.id] == nil {
+            nodes = append(nodes, node)
+        }
+        merged[node.id] = append(merged[node.id], group...)
+    }
+    for _, group := range merged {
+        sort.SliceStable(group, func(i, j int) bool { return group[i].openedAt.Before(group[j].openedAt) })
+    }
+    return nodes, merged
+}
+
+// Группировка незакрытых инцидентов и сверка ситуаций. checked - здания с данными в последней проверке:
+// доля зданий узла или района считается от них
+func (c *Correlator) Run(ctx context.Context, checked []uuid.UUID) (opened, resolved int, err error) {
+    t, err := c.loadTopology(ctx)
+    if err != nil {
+        return 0, 0, err
+    }
+    events, err := c.loadEvents(ctx)
+    if err != nil {
+        return 0, 0, err
+    }
+
+    situations := c.detect(t, events, checked)
+    opened, resolved, err = c.incidents.ReconcileSituations(ctx, correlatedKinds, situations)
+    if err != nil {
+        return 0, 0, err
+    }
+    c.log.InfoContext(ctx, "situations reconciled",
+        "situations", len(situations),
+        "situations_opened", opened,
+        "situations_resolved", resolved)
+    return opened, resolved, nil
+}
+
+// Ситуации по аномалиям events (по видам). Сначала аномалии группируются по общему узлу сети
+// (группы одного узла объединяются); группа относится к узлу, если охватывает не меньше MinShare его зданий. Остальные аномалии
+// группируются по соседству зданий (не дальше Radius друг от друга) в ситуации района
+func (c *Correlator) detect(t *topology, events map[string][]*event, checked []uuid.UUID) []incident.SituationDetection {
+    isChecked := make(map[uuid.UUID]bool, len(checked))
+    for _, id := range checked {
+        isChecked[id] = true
+    }
+
+    var situations []incident.SituationDetection
+    for _, kind := range correlatedKinds {
+        used := make(map[uuid.UUID]bool)
+
+        byNode := c.cluster(events[kind], func(a, b *event) bool {
+            for id := range t.ancestors[a.buildingID] {
+                if t.ancestors[b.buildingID][id] {
+                    return true
+                }
+            }
+            return false
+        })
+        nodes, groups := t.groupsByNode(byNode)
+        for _, node := range nodes {
+            group := groups[node.id]
+            total := len(group)
+            for id := range node.buildings {
+                if isChecked[id] && !contains(group, id) {
+                    total++
+                }
+            }
+            if float64(len(group)) < c.cfg.MinShare*float64(total) {
+                continue
+            }
+
+            nodeID := node.id
+            d := newDetection(kind,
+                fmt.Sprintf("%s «%s»: %s в %d из %d зданий", nodeTitles[node.typ], node.name, kindTitles[kind], len(group), total),
+                group, total, map[string]interface{}{"node_type": node.typ, "share": float64(len(group)) / float64(total)})
+            d.NodeID = &nodeID
+            situations = append(situations, d)
+            for _, e := range group {
+                used[e.buildingID] = true
+            }
+        }
+
+        if c.cfg.Radius == 0 {
+            continue
+        }
+        var rest []*event
+        for _, e := range events[kind] {
+            if _, ok := t.locations[e.buildingID]; ok && !used[e.buildingID] {
+                rest = append(rest, e)
+            }
+        }
+        byArea := c.cluster(rest, func(a, b *event) bool {
+            return distance(t.locations[a.buildingID], t.locations[b.buildingID]) <= c.cfg.Radius
+        })
+        for _, group := range byArea {
+            // Проверенные здания в радиусе от зданий группы
+            total := len(group)
+            for id, loc := range t.locations {
+                if !isChecked[id] || contains(group, id) {
+                    continue
+                }
+                for _, e := range group {
+                    if distance(loc, t.locations[e.buildingID]) <= c.cfg.Radius {
+                        total++
+                        break
+                    }
+                }
+            }
+
+            var lat, lon float64
+            for _, e := range group {
+                lat += t.locations[e.buildingID].lat
+                lon += t.locations[e.buildingID].lon
+            }
+            situations = append(situations, newDetection(kind,
+                fmt.Sprintf("Соседние здания у «%s»: %s в %d из %d зданий", group[0].address, kindTitles[kind], len(group), total),
+                group, total, map[string]interface{}{
+                    "center":   map[string]float64{"latitude": lat / float64(len(group)), "longitude": lon / float64(len(group))},
+                    "radius_m": c.cfg.Radius,
+                }))
+        }
+    }
+    return situations
+}
+
+func contains(group []*event, buildingID uuid.UUID) bool {
+    for _, e := range group {
+        if e.buildingID == buildingID {
+            return true
+        }
+    }
+    return false
+}
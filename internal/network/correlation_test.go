@@ -0,0 +1,240 @@
+package network
+
+import (
+    "testing"
+    "time"
+
+    "service/internal/incident"
+
+    "github.com/google/uuid"
+)
+
+var testConfig = Config{MinBuildings: 2, MinShare: 0.5, Window: time.Hour, Radius: 300}
+
+// Источник с ЦТП и здания, подключенные к ЦТП
+type testNetwork struct {
+    topology  *topology
+    source    *nodeInfo
+    ctp       *nodeInfo
+    buildings []uuid.UUID
+}
+
+func newTestNetwork(buildings int) *testNetwork {
+    source := &nodeInfo{id: uuid.New(), typ: TypeSource, name: "ТЭЦ", buildings: make(map[uuid.UUID]bool)}
+    ctp := &nodeInfo{id: uuid.New(), typ: TypeCTP, name: "ЦТП-1", parentID: &source.id, buildings: make(map[uuid.UUID]bool)}
+    n := &testNetwork{
+        topology: &topology{
+            nodes:     map[uuid.UUID]*nodeInfo{source.id: source, ctp.id: ctp},
+            ancestors: make(map[uuid.UUID]map[uuid.UUID]bool),
+            locations: make(map[uuid.UUID]location),
+        },
+        source: source,
+        ctp:    ctp,
+    }
+    for i := 0; i < buildings; i++ {
+        id := uuid.New()
+        source.buildings[id] = true
+        ctp.buildings[id] = true
+        n.topology.ancestors[id] = map[uuid.UUID]bool{source.id: true, ctp.id: true}
+        n.buildings = append(n.buildings, id)
+    }
+    return n
+}
+
+func testEvent(buildingID uuid.UUID, openedAt time.Time) *event {
+    return &event{
+        buildingID: buildingID,
+        address:    buildingID.String(),
+        openedAt:   openedAt,
+        severity:   incident.SeverityWarning,
+        incidents:  []uuid.UUID{uuid.New()},
+    }
+}
+
+func TestDetectSiblingsUnderOneNode(t *testing.T) {
+    n := newTestNetwork(3)
+    start := time.Date(2026, 2, 1, 8, 0, 0, 0, time.UTC)
+    events := map[string][]*event{incident.KindWaterBalance: {
+        testEvent(n.buildings[0], start),
+        testEvent(n.buildings[1], start.Add(20*time.Minute)),
+        testEvent(n.buildings[2], start.Add(50*time.Minute)),
+    }}
+    events[incident.KindWaterBalance][2].severity = incident.SeverityCritical
+
+    c := &Correlator{cfg: testConfig}
+    situations := c.detect(n.topology, events, n.buildings)
+    if len(situations) != 1 {
+        t.Fatalf("got %d situations, want 1", len(situations))
+    }
+    s := situations[0]
+    if s.NodeID == nil || *s.NodeID != n.ctp.id {
+        t.Errorf("situation node = %v, want CTP %s", s.NodeID, n.ctp.id)
+    }
+    if s.Kind != incident.KindWaterBalance {
+        t.Errorf("kind = %q, want %q", s.Kind, incident.KindWaterBalance)
+    }
+    if s.Affected != 3 || s.Total != 3 {
+        t.Errorf("affected/total = %d/%d, want 3/3", s.Affected, s.Total)
+    }
+    if s.Severity != incident.SeverityCritical {
+        t.Errorf("severity = %q, want %q", s.Severity, incident.SeverityCritical)
+    }
+    if len(s.Incidents) != 3 {
+        t.Errorf("got %d incidents, want 3", len(s.Incidents))
+    }
+}
+
+func TestDetectSiblingsChainedWithinWindow(t *testing.T) {
+    // Каждое следующее событие в пределах окна от предыдущего: группа собирается цепочкой
+    n := newTestNetwork(3)
+    start := time.Date(2026, 2, 1, 8, 0, 0, 0, time.UTC)
+    events := map[string][]*event{incident.KindTemperature: {
+        testEvent(n.buildings[0], start),
+        testEvent(n.buildings[1], start.Add(50*time.Minute)),
+        testEvent(n.buildings[2], start.Add(100*time.Minute)),
+    }}
+
+    c := &Correlator{cfg: testConfig}
+    situations := c.detect(n.topology, events, n.buildings)
+    if len(situations) != 1 || situations[0].Affected != 3 {
+        t.Fatalf("got %+v, want one situation with 3 buildings", situations)
+    }
+}
+
+func TestDetectOutsideWindow(t *testing.T) {
+    n := newTestNetwork(2)
+    start := time.Date(2026, 2, 1, 8, 0, 0, 0, time.UTC)
+    events := map[string][]*event{incident.KindWaterBalance: {
+        testEvent(n.buildings[0], start),
+        testEvent(n.buildings[1], start.Add(testConfig.Window+time.Minute)),
+    }}
+
+    c := &Correlator{cfg: testConfig}
+    if situations := c.detect(n.topology, events, n.buildings); len(situations) != 0 {
+        t.Errorf("got %d situations for anomalies outside the window, want 0", len(situations))
+    }
+}
+
+func TestDetectSingleAnomaly(t *testing.T) {
+    n := newTestNetwork(3)
+    events := map[string][]*event{incident.KindWaterBalance: {
+        testEvent(n.buildings[0], time.Date(2026, 2, 1, 8, 0, 0, 0, time.UTC)),
+    }}
+
+    c := &Correlator{cfg: testConfig}
+    if situations := c.detect(n.topology, events, n.buildings); len(situations) != 0 {
+        t.Errorf("got %d situations for a single anomaly, want 0", len(situations))
+    }
+}
+
+func TestDetectShareBelowMinimum(t *testing.T) {
+    // 2 из 5 проверенных зданий узла - меньше MinShare
+    n := newTestNetwork(5)
+    start := time.Date(2026, 2, 1, 8, 0, 0, 0, time.UTC)
+    events := map[string][]*event{incident.KindWaterBalance: {
+        testEvent(n.buildings[0], start),
+        testEvent(n.buildings[1], start.Add(10*time.Minute)),
+    }}
+
+    c := &Correlator{cfg: testConfig}
+    if situations := c.detect(n.topology, events, n.buildings); len(situations) != 0 {
+        t.Errorf("got %d situations, want 0", len(situations))
+    }
+
+    // Непроверенные здания в долю не входят
+    situations := c.detect(n.topology, events, n.buildings[:3])
+    if len(situations) != 1 || situations[0].Total != 3 {
+        t.Errorf("got %+v, want one situation with 3 checked buildings", situations)
+    }
+}
+
+func TestDetectNeighbours(t *testing.T) {
+    // Здания без узла сети группируются по расстоянию
+    n := newTestNetwork(0)
+    near1, near2, far := uuid.New(), uuid.New(), uuid.New()
+    n.topology.locations[near1] = location{lat: 55.7500, lon: 37.6000}
+    n.topology.locations[near2] = location{lat: 55.7510, lon: 37.6000} // ~111 м
+    n.topology.locations[far] = location{lat: 55.7600, lon: 37.6000}   // ~1.1 км
+    start := time.Date(2026, 2, 1, 8, 0, 0, 0, time.UTC)
+    events := map[string][]*event{incident.KindTemperature: {
+        testEvent(near1, start),
+        testEvent(near2, start.Add(5*time.Minute)),
+        testEvent(far, start.Add(10*time.Minute)),
+    }}
+
+    c := &Correlator{cfg: testConfig}
+    situations := c.detect(n.topology, events, []uuid.UUID{near1, near2, far})
+    if len(situations) != 1 {
+        t.Fatalf("got %d situations, want 1", len(situations))
+    }
+    if s := situations[0]; s.NodeID != nil || s.Affected != 2 || s.Total != 2 {
+        t.Errorf("got node %v, affected/total %d/%d, want area situation 2/2", s.NodeID, s.Affected, s.Total)
+    }
+
+    noRadius := testConfig
+    noRadius.Radius = 0
+    c = &Correlator{cfg: noRadius}
+    if situations := c.detect(n.topology, events, []uuid.UUID{near1, near2, far}); len(situations) != 0 {
+        t.Errorf("got %d situations with radius 0, want 0", len(situations))
+    }
+}
+
+func TestDetectDeepestCommonNode(t *testing.T) {
+    // Источник -> ЦТП-1 -> ЦТП-2 -> здания: ситуация относится к нижнему ЦТП при любом порядке обхода узлов
+    n := newTestNetwork(0)
+    inner := &nodeInfo{id: uuid.New(), typ: TypeCTP, name: "ЦТП-2", parentID: &n.ctp.id, buildings: make(map[uuid.UUID]bool)}
+    n.topology.nodes[inner.id] = inner
+    for i := 0; i < 2; i++ {
+        id := uuid.New()
+        for _, node := range []*nodeInfo{n.source, n.ctp, inner} {
+            node.buildings[id] = true
+        }
+        n.topology.ancestors[id] = map[uuid.UUID]bool{n.source.id: true, n.ctp.id: true, inner.id: true}
+        n.buildings = append(n.buildings, id)
+    }
+    start := time.Date(2026, 2, 1, 8, 0, 0, 0, time.UTC)
+    events := map[string][]*event{incident.KindTemperature: {
+        testEvent(n.buildings[0], start),
+        testEvent(n.buildings[1], start.Add(10*time.Minute)),
+    }}
+
+    c := &Correlator{cfg: testConfig}
+    for i := 0; i < 20; i++ {
+        situations := c.detect(n.topology, events, n.buildings)
+        if len(situations) != 1 {
+            t.Fatalf("got %d situations, want 1", len(situations))
+        }
+        if s := situations[0]; s.NodeID == nil || *s.NodeID != inner.id {
+            t.Fatalf("situation node = %v, want inner CTP %s", s.NodeID, inner.id)
+        }
+    }
+}
+
+func TestDetectMergesGroupsOfOneNode(t *testing.T) {
+    // Две группы одного ЦТП, разделенные окном: одна ситуация со всеми инцидентами
+    n := newTestNetwork(4)
+    start := time.Date(2026, 2, 1, 8, 0, 0, 0, time.UTC)
+    events := map[string][]*event{incident.KindWaterBalance: {
+        testEvent(n.buildings[0], start),
+        testEvent(n.buildings[1], start.Add(10*time.Minute)),
+        testEvent(n.buildings[2], start.Add(3*time.Hour)),
+        testEvent(n.buildings[3], start.Add(3*time.Hour+10*time.Minute)),
+    }}
+
+    c := &Correlator{cfg: testConfig}
+    situations := c.detect(n.topology, events, n.buildings)
+    if len(situations) != 1 {
+        t.Fatalf("got %d situations, want 1", len(situations))
+    }
+    s := situations[0]
+    if s.NodeID == nil || *s.NodeID != n.ctp.id {
+        t.Errorf("situation node = %v, want CTP %s", s.NodeID, n.ctp.id)
+    }
+    if s.Affected != 4 || s.Total != 4 || len(s.Incidents) != 4 {
+        t.Errorf("affected/total %d/%d with %d incidents, want 4/4 with 4", s.Affected, s.Total, len(s.Incidents))
+    }
+    details := s.Details.(map[string]interface{})
+    if first, last := details["first_opened_at"], details["last_opened_at"]; first != start || last != start.Add(3*time.Hour+10*time.Minute) {
+        t.Errorf("window %v - %v, want %v - %v", first, last, start, start.Add(3*time.Hour+10*time.Minute))
+    }
+}
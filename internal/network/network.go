@@ -0,0 +1,306 @@
+package network
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "time"
+
+    "service/internal/tenant"
+
+    "github.com/google/uuid"
+    "github.com/jackc/pgx/v5"
+    "github.com/jackc/pgx/v5/pgconn"
+    "github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Виды узлов сети: источник тепла и центральный тепловой пункт
+const (
+    TypeSource = "source"
+    TypeCTP    = "ctp"
+)
+
+var (
+    ErrNotFound      = errors.New("network node not found")
+    ErrITPNotFound   = errors.New("itp not found")
+    ErrInvalidParent = errors.New("parent of a ctp must be a heat source, a source has no parent")
+    ErrHasChildren   = errors.New("network node has connected ctp")
+)
+
+// Узел тепловой сети. ITPs и Buildings - подключенные к узлу и его ЦТП ИТП и здания,
+// видимые пользователю
+type Node struct {
+    ID        uuid.UUID  `json:"id"`
+    Type      string     `json:"type"`
+    Name      string     `json:"name"`
+    Address   string     `json:"address"`
+    ParentID  *uuid.UUID `json:"parent_id"`
+    ITPs      int        `json:"itps"`
+    Buildings int        `json:"buildings"`
+    CreatedAt time.Time  `json:"created_at"`
+    UpdatedAt time.Time  `json:"updated_at"`
+}
+
+// ИТП, подключенный к узлу
+type ConnectedITP struct {
+    ITPID      uuid.UUID `json:"itp_id"`
+    ITPNumber  string    `json:"itp_number"`
+    BuildingID uuid.UUID `json:"building_id"`
+    Address    string    `json:"address"`
+}
+
+// Узел с подключенными ЦТП и ИТП
+type NodeDetails struct {
+    *Node
+    Children []*Node       `json:"children"`
+    ITPList  []ConnectedITP `json:"itp_list"`
+}
+
+// Здание и узел, к которому напрямую подключен его ИТП
+type Membership struct {
+    BuildingID uuid.UUID
+    NodeID     uuid.UUID
+}
+
+// Координаты здания (WGS 84), nil - не заданы
+type Location struct {
+    Latitude  *float64 `json:"latitude"`
+    Longitude *float64 `json:"longitude"`
+}
+
+// Store - узлы тепловой сети и подключение к ним ИТП
+type Store struct {
+    pool *pgxpool.Pool
+}
+
+func NewStore(pool *pgxpool.Pool) *Store {
+    return &Store{pool: pool}
+}
+
+// Узел и подключенные к нему объекты: ИТП самого узла и его ЦТП. Сеть двухуровневая (источник -> ЦТП),
+// поэтому дочерних узлов достаточно одного уровня
+const selectNode = `
+    SELECT n.id, n.type, n.name, n.address, n.parent_id, n.created_at, n.updated_at,
+           COUNT(i.id)::int, COUNT(DISTINCT i.building_id)::int
+    FROM network_nodes n
+    LEFT JOIN (
+        SELECT i.id, i.building_id, i.node_id FROM itp i JOIN buildings b ON b.id = i.building_id
+        WHERE $1::uuid IS NULL OR b.organization_id = $1
+    ) i ON i.node_id = n.id OR i.node_id IN (SELECT c.id FROM network_nodes c WHERE c.parent_id = n.id)`
+
+func scanNode(row pgx.Row) (*Node, error) {
+    var n Node
+    err := row.Scan(&n.ID, &n.Type, &n.Name, &n.Address, &n.ParentID, &n.CreatedAt, &n.UpdatedAt, &n.ITPs, &n.Buildings)
+    if err != nil {
+        return nil, err
+    }
+    return &n, nil
+}
+
+func (s *Store) queryNodes(ctx context.Context, organizationID *uuid.UUID, where string, args ...interface{}) ([]*Node, error) {
+    rows, err := s.pool.Query(ctx, selectNode+where+`
+        GROUP BY n.id
+        ORDER BY n.type DESC, n.name`, append([]interface{}{organizationID}, args...)...)
+    if err != nil {
+        return nil, fmt.Errorf("list network nodes: %w", err)
+    }
+    defer rows.Close()
+
+    nodes := []*Node{}
+    for rows.Next() {
+        n, err := scanNode(rows)
+        if err != nil {
+            return nil, fmt.Errorf("scan network node: %w", err)
+        }
+        nodes = append(nodes, n)
+    }
+    return nodes, rows.Err()
+}
+
+// Все узлы сети: источники, затем ЦТП
+func (s *Store) List(ctx context.Context, organizationID *uuid.UUID) ([]*Node, error) {
+    return s.queryNodes(ctx, organizationID, "")
+}
+
+func (s *Store) get(ctx context.Context, organizationID *uuid.UUID, id uuid.UUID) (*Node, error) {
+    nodes, err := s.queryNodes(ctx, organizationID, " WHERE n.id = $2", id)
+    if err != nil {
+        return nil, err
+    }
+    if len(nodes) == 0 {
+        return nil, ErrNotFound
+    }
+    return nodes[0], nil
+}
+
+// Узел с подключенными ЦТП и ИТП. ИТП других компаний не показываются
+func (s *Store) Get(ctx context.Context, organizationID *uuid.UUID, id uuid.UUID) (*NodeDetails, error) {
+    node, err := s.get(ctx, organizationID, id)
+    if err != nil {
+        return nil, err
+    }
+    children, err := s.queryNodes(ctx, organizationID, " WHERE n.parent_id = $2", id)
+    if err != nil {
+        return nil, err
+    }
+
+    rows, err := s.pool.Query(ctx, `
+        SELECT i.id, i.itp_number, b.id, b.address
+        FROM itp i JOIN buildings b ON b.id = i.building_id
+        WHERE i.node_id = $2 AND ($1::uuid IS NULL OR b.organization_id = $1)
+        ORDER BY b.address, i.itp_number`, organizationID, id)
+    if err != nil {
+        return nil, fmt.Errorf("list connected itps: %w", err)
+    }
+    defer rows.Close()
+
+    itps := []ConnectedITP{}
+    for rows.Next() {
+        var itp ConnectedITP
+        if err := rows.Scan(&itp.ITPID, &itp.ITPNumber, &itp.BuildingID, &itp.Address); err != nil {
+            return nil, fmt.Errorf("scan connected itp: %w", err)
+        }
+        itps = append(itps, itp)
+    }
+    if err := rows.Err(); err != nil {
+        return nil, err
+    }
+    return &NodeDetails{Node: node, Children: children, ITPList: itps}, nil
+}
+
+// Проверка родителя: у ЦТП - источник или нет, у источника родителя нет
+func (s *Store) checkParent(ctx context.Context, nodeType string, parentID *uuid.UUID) error {
+    if parentID == nil {
+        return nil
+    }
+    if nodeType != TypeCTP {
+        return ErrInvalidParent
+    }
+    var parentType string
+    err := s.pool.QueryRow(ctx, "SELECT type FROM network_nodes WHERE id = $1", *parentID).Scan(&parentType)
+    if errors.Is(err, pgx.ErrNoRows) || (err == nil && parentType != TypeSource) {
+        return ErrInvalidParent
+    }
+    return err
+}
+
+// Создание узла
+func (s *Store) Create(ctx context.Context, n Node) (*Node, error) {
+    if err := s.checkParent(ctx, n.Type, n.ParentID); err != nil {
+        return nil, err
+    }
+    var id uuid.UUID
+    err := s.pool.QueryRow(ctx, `
+        INSERT INTO network_nodes (type, name, address, parent_id)
+        VALUES ($1, $2, $3, $4)
+        RETURNING id`, n.Type, n.Name, n.Address, n.ParentID).Scan(&id)
+    if err != nil {
+        return nil, fmt.Errorf("insert network node: %w", err)
+    }
+    return s.get(ctx, nil, id)
+}
+
+// Изменение названия, адреса и родителя узла. Возвращает состояние до и после
+func (s *Store) Update(ctx context.Context, id uuid.UUID, name, address string, parentID *uuid.UUID) (before, after *Node, err error) {
+    before, err = s.get(ctx, nil, id)
+    if err != nil {
+        return nil, nil, err
+    }
+    if parentID != nil && *parentID == id {
+        return nil, nil, ErrInvalidParent
+    }
+    if err := s.checkParent(ctx, before.Type, parentID); err != nil {
+        return nil, nil, err
+    }
+
+    _, err = s.pool.Exec(ctx, `
+        UPDATE network_nodes SET name = $2, address = $3, parent_id = $4, updated_at = NOW()
+        WHERE id = $1`, id, name, address, parentID)
+    if err != nil {
+        return nil, nil, fmt.Errorf("update network node %s: %w", id, err)
+    }
+    after, err = s.get(ctx, nil, id)
+    if err != nil {
+        return nil, nil, err
+    }
+    return before, after, nil
+}
+
+// Удаление узла. ИТП узла отключаются, источник с подключенными ЦТП не удаляется
+func (s *Store) Delete(ctx context.Context, id uuid.UUID) (*Node, error) {
+    before, err := s.get(ctx, nil, id)
+    if err != nil {
+        return nil, err
+    }
+    _, err = s.pool.Exec(ctx, "DELETE FROM network_nodes WHERE id = $1", id)
+    var pgErr *pgconn.PgError
+    if errors.As(err, &pgErr) && pgErr.Code == "23503" {
+        return nil, ErrHasChildren
+    }
+    if err != nil {
+        return nil, fmt.Errorf("delete network node %s: %w", id, err)
+    }
+    return before, nil
+}
+
+// Подключение ИТП к узлу (nil - отключить). Возвращает прежний и новый узел ИТП
+func (s *Store) ConnectITP(ctx context.Context, itpID uuid.UUID, nodeID *uuid.UUID) (before, after *uuid.UUID, err error) {
+    if nodeID != nil {
+        if _, err := s.get(ctx, nil, *nodeID); err != nil {
+            return nil, nil, err
+        }
+    }
+    err = s.pool.QueryRow(ctx, `
+        UPDATE itp i SET node_id = $2, updated_at = NOW()
+        FROM itp old
+        WHERE i.id = $1 AND old.id = i.id
+        RETURNING old.node_id`, itpID, nodeID).Scan(&before)
+    if errors.Is(err, pgx.ErrNoRows) {
+        return nil, nil, ErrITPNotFound
+    }
+    if err != nil {
+        return nil, nil, fmt.Errorf("connect itp %s: %w", itpID, err)
+    }
+    return before, nodeID, nil
+}
+
+// Здания, питающиеся от узла и его ЦТП, с узлом прямого подключения. Здание с ИТП
+// на разных ЦТП узла встречается несколько раз
+func (s *Store) Members(ctx context.Context, organizationID *uuid.UUID, nodeID uuid.UUID) ([]Membership, error) {
+    rows, err := s.pool.Query(ctx, `
+        SELECT DISTINCT i.building_id, i.node_id
+        FROM itp i JOIN buildings b ON b.id = i.building_id
+        WHERE (i.node_id = $2 OR i.node_id IN (SELECT id FROM network_nodes WHERE parent_id = $2))
+        AND ($1::uuid IS NULL OR b.organization_id = $1)`, organizationID, nodeID)
+    if err != nil {
+        return nil, fmt.Errorf("list node buildings: %w", err)
+    }
+    defer rows.Close()
+
+    var members []Membership
+    for rows.Next() {
+        var m Membership
+        if err := rows.Scan(&m.BuildingID, &m.NodeID); err != nil {
+            return nil, fmt.Errorf("scan node building: %w", err)
+        }
+        members = append(members, m)
+    }
+    return members, rows.Err()
+}
+
+// Изменение координат здания. Возвращает прежние координаты
+func (s *Store) SetLocation(ctx context.Context, buildingID uuid.UUID, loc Location) (*Location, error) {
+    var before Location
+    err := s.pool.QueryRow(ctx, `
+        UPDATE buildings b SET latitude = $2, longitude = $3, updated_at = NOW()
+        FROM buildings old
+        WHERE b.id = $1 AND old.id = b.id
+        RETURNING old.latitude, old.longitude`, buildingID, loc.Latitude, loc.Longitude).Scan(&before.Latitude, &before.Longitude)
+    if errors.Is(err, pgx.ErrNoRows) {
+        return nil, tenant.ErrBuildingNotFound
+    }
+    if err != nil {
+        return nil, fmt.Errorf("set building %s location: %w", buildingID, err)
+    }
+    return &before, nil
+}
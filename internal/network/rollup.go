@@ -0,0 +1,106 @@
+package network
+
+import (
+    "service/internal/models"
+    "service/internal/service"
+
+    "github.com/google/uuid"
+)
+
+// Сводка анализа по зданиям узла сети
+type Rollup struct {
+    NodeID             uuid.UUID      `json:"node_id"`
+    Buildings          int            `json:"buildings"`
+    BuildingsWithData  int            `json:"buildings_with_data"`
+    TotalColdWater     float64        `json:"total_cold_water"` // м³
+    TotalHotWater      float64        `json:"total_hot_water"`
+    HotToColdRatio     float64        `json:"hot_to_cold_ratio"` // %
+    HeatGcal           float64        `json:"heat_gcal"`         // тепловая энергия ГВС
+    LossCost           float64        `json:"loss_cost"`         // оценка потерь по тарифам зданий, ₽
+    WaterBalance       map[string]int `json:"water_balance"` // число зданий по состоянию баланса
+    Temperature        map[string]int `json:"temperature"`
+    AvgDeltaTemp       *float64       `json:"avg_delta_temp,omitempty"` // среднее по зданиям с данными температуры
+    AnomalousBuildings int            `json:"anomalous_buildings"`
+}
+
+// Сводка по узлу и каждому из его ЦТП (Children). Здание с ИТП на разных ЦТП учитывается в каждом из них
+type NodeRollup struct {
+    Rollup
+    Children []Rollup `json:"children"`
+}
+
+func newRollup(nodeID uuid.UUID) Rollup {
+    return Rollup{NodeID: nodeID, WaterBalance: map[string]int{}, Temperature: map[string]int{}}
+}
+
+// Сводка по зданиям buildingIDs из результатов анализа results
+func summarize(nodeID uuid.UUID, buildingIDs []uuid.UUID, results map[uuid.UUID]*service.ConsumptionAnalysis) Rollup {
+    r := newRollup(nodeID)
+    var deltaSum float64
+    var deltaCount int
+    for _, id := range buildingIDs {
+        r.Buildings++
+        a := results[id]
+        if a == nil {
+            continue
+        }
+        if a.HasAnomalies {
+            r.AnomalousBuildings++
+        }
+        r.Temperature[a.TemperatureStatus]++
+        if a.Heat != nil {
+            r.HeatGcal += a.Heat.TotalGcal
+        }
+        if a.Cost != nil {
+            r.LossCost += a.Cost.LossCost
+        }
+        if a.TemperatureData != nil {
+            deltaSum += a.TemperatureData.AvgDeltaTemp
+            deltaCount++
+        }
+        if a.DataSource != service.DataSourceDatabase {
+            continue
+        }
+        r.BuildingsWithData++
+        r.TotalColdWater += a.TotalColdWater
+        r.TotalHotWater += a.TotalHotWater
+        r.WaterBalance[a.WaterBalanceStatus]++
+    }
+    if r.TotalColdWater > 0 {
+        r.HotToColdRatio = r.TotalHotWater / r.TotalColdWater * 100
+    }
+    r.HeatGcal = models.RoundHeat(r.HeatGcal)
+    r.LossCost = models.RoundMoney(r.LossCost)
+    if deltaCount > 0 {
+        avg := deltaSum / float64(deltaCount)
+        r.AvgDeltaTemp = &avg
+    }
+    return r
+}
+
+// Сводка анализа по узлу nodeID и его ЦТП по подключениям members
+func Summarize(nodeID uuid.UUID, members []Membership, results map[uuid.UUID]*service.ConsumptionAnalysis) NodeRollup {
+    var all []uuid.UUID
+    seen := make(map[uuid.UUID]bool)
+    children := make(map[uuid.UUID][]uuid.UUID)
+    var childOrder []uuid.UUID
+    for _, m := range members {
+        if !seen[m.BuildingID] {
+            seen[m.BuildingID] = true
+            all = append(all, m.BuildingID)
+        }
+        if m.NodeID == nodeID {
+            continue
+        }
+        if _, ok := children[m.NodeID]; !ok {
+            childOrder = append(childOrder, m.NodeID)
+        }
+        children[m.NodeID] = append(children[m.NodeID], m.BuildingID)
+    }
+
+    rollup := NodeRollup{Rollup: summarize(nodeID, all, results), Children: []Rollup{}}
+    for _, childID := range childOrder {
+        rollup.Children = append(rollup.Children, summarize(childID, children[childID], results))
+    }
+    return rollup
+}
@@ -0,0 +1,159 @@
+package partition
+
+import (
+    "context"
+    "fmt"
+    "log/slog"
+    "strings"
+    "time"
+
+    "service/internal/logging"
+    "service/internal/metrics"
+
+    "github.com/jackc/pgx/v5"
+    "github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Секционированные по месяцам таблицы показаний (миграции 000009, 000015)
+var Tables = []string{"hot_water_meters", "cold_water_meters", "temperature_readings", "pump_data", "meter_totals"}
+
+// Действия с партициями старше срока хранения
+const (
+    ModeDrop    = "drop"    // удалить партицию
+    ModeArchive = "archive" // отсоединить и перенести в схему archive
+)
+
+// Суффикс имени партиции: <таблица>_pYYYYMM
+const suffixLayout = "200601"
+
+// Manager создает партиции заранее и удаляет или архивирует устаревшие
+type Manager struct {
+    pool  *pgxpool.Pool
+    ahead int
+    mode  string
+    log   *slog.Logger
+}
+
+// ahead - на сколько месяцев вперед создавать партиции, mode - ModeDrop или ModeArchive
+func NewManager(pool *pgxpool.Pool, ahead int, mode string) (*Manager, error) {
+    if mode != ModeDrop && mode != ModeArchive {
+        return nil, fmt.Errorf("unknown partition mode %q", mode)
+    }
+    if ahead < 0 {
+        return nil, fmt.Errorf("partitions ahead must not be negative")
+    }
+    return &Manager{pool: pool, ahead: ahead, mode: mode, log: logging.Component("partition")}, nil
+}
+
+func monthStart(t time.Time) time.Time {
+    t = t.UTC()
+    return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+// Создание партиции за месяц; показания из партиции по умолчанию переносятся в нее
+func (m *Manager) ensure(ctx context.Context, table string, month time.Time) error {
+    var created bool
+    err := m.pool.QueryRow(ctx, "SELECT ensure_month_partition($1, $2::date)", table, month).Scan(&created)
+    if err != nil {
+        return fmt.Errorf("create partition %s %s: %w", table, month.Format(suffixLayout), err)
+    }
+    if created {
+        m.log.Info("partition created", "table", table, "month", month.Format("2006-01"))
+    }
+    return nil
+}
+
+// Партиции на текущий и следующие ahead месяцев, а также за месяцы,
+// показания которых попали в партицию по умолчанию (поздние или будущие данные)
+func (m *Manager) EnsureFuture(ctx context.Context) error {
+    current := monthStart(time.Now())
+    for _, table := range Tables {
+        for i := 0; i <= m.ahead; i++ {
+            if err := m.ensure(ctx, table, current.AddDate(0, i, 0)); err != nil {
+                return err
+            }
+        }
+
+        rows, err := m.pool.Query(ctx, fmt.Sprintf(`
+            SELECT DISTINCT date_trunc('month', timestamp AT TIME ZONE 'UTC')::date
+            FROM %s`, pgx.Identifier{table + "_default"}.Sanitize()))
+        if err != nil {
+            return fmt.Errorf("scan default partition of %s: %w", table, err)
+        }
+        months, err := pgx.CollectRows(rows, pgx.RowTo[time.Time])
+        if err != nil {
+            return fmt.Errorf("scan default partition of %s: %w", table, err)
+        }
+        for _, month := range months {
+            if err := m.ensure(ctx, table, month); err != nil {
+                return err
+            }
+        }
+    }
+    return nil
+}
+
+// Удаление (или архивирование) партиций таблицы, все показания которых старше cutoff.
+// Возвращает число обработанных партиций
+func (m *Manager) ExpireBefore(ctx context.Context, table string, cutoff time.Time) (int, error) {
+    rows, err := m.pool.Query(ctx, `
+        SELECT c.relname
+        FROM pg_inherits i
+        JOIN pg_class c ON c.oid = i.inhrelid
+        WHERE i.inhparent = to_regclass($1)`, table)
+    if err != nil {
+        return 0, fmt.Errorf("list partitions of %s: %w", table, err)
+    }
+    names, err := pgx.CollectRows(rows, pgx.RowTo[string])
+    if err != nil {
+        return 0, fmt.Errorf("list partitions of %s: %w", table, err)
+    }
+
+    expired := 0
+    for _, name := range names {
+        suffix, ok := strings.CutPrefix(name, table+"_p")
+        if !ok {
+            continue // партиция по умолчанию
+        }
+        month, err := time.Parse(suffixLayout, suffix)
+        if err != nil {
+            continue
+        }
+        if month.AddDate(0, 1, 0).After(cutoff) {
+            continue
+        }
+
+        if err := m.expire(ctx, table, name); err != nil {
+            return expired, err
+        }
+        expired++
+        metrics.PartitionsExpired.WithLabelValues(table, m.mode).Inc()
+        m.log.Info("partition expired", "table", table, "partition", name, "mode", m.mode)
+    }
+    return expired, nil
+}
+
+func (m *Manager) expire(ctx context.Context, table, name string) error {
+    parent, part := pgx.Identifier{table}.Sanitize(), pgx.Identifier{name}.Sanitize()
+
+    if m.mode == ModeDrop {
+        if _, err := m.pool.Exec(ctx, "DROP TABLE "+part); err != nil {
+            return fmt.Errorf("drop partition %s: %w", name, err)
+        }
+        return nil
+    }
+
+    tx, err := m.pool.Begin(ctx)
+    if err != nil {
+        return err
+    }
+    defer tx.Rollback(ctx)
+
+    if _, err := tx.Exec(ctx, fmt.Sprintf("ALTER TABLE %s DETACH PARTITION %s", parent, part)); err != nil {
+        return fmt.Errorf("detach partition %s: %w", name, err)
+    }
+    if _, err := tx.Exec(ctx, fmt.Sprintf("ALTER TABLE %s SET SCHEMA archive", part)); err != nil {
+        return fmt.Errorf("archive partition %s: %w", name, err)
+    }
+    return tx.Commit(ctx)
+}
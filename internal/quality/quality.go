@@ -0,0 +1,482 @@
+package quality
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "log/slog"
+    "math"
+    "strings"
+    "time"
+
+    "service/internal/incident"
+    "service/internal/logging"
+    "service/internal/tenant"
+
+    "github.com/google/uuid"
+    "github.com/jackc/pgx/v5"
+    "github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Источники показаний (значение meter_quality.source)
+const (
+    SourceHotWater    = "hot_water"
+    SourceColdWater   = "cold_water"
+    SourceTemperature = "temperature"
+    SourcePump        = "pump"
+)
+
+// Проблемы качества данных счетчика
+const (
+    IssueStale      = "stale"
+    IssueFrozen     = "frozen"
+    IssueNegative   = "negative"
+    IssueOutOfRange = "out_of_range"
+    IssueGaps       = "gaps"
+    IssueDuplicates = "duplicates"
+    IssueFuture     = "future_timestamps"
+)
+
+// Показания с временем позже текущего больше чем на futureSkew считаются ошибкой часов счетчика
+const futureSkew = 5 * time.Minute
+
+// Доля некорректных показаний, начиная с которой неисправность считается критической
+const criticalInvalidShare = 0.1
+
+// Поток показаний счетчика. Запрос возвращает building_id, meter_key, timestamp и значения
+// в виде массива; max - верхняя граница допустимых значений в том же порядке
+type source struct {
+    name        string
+    title       string
+    query       string
+    max         []float64
+    checkFrozen bool
+}
+
+var sources = []source{
+    {
+        name:        SourceHotWater,
+        title:       "ОДПУ ГВС",
+        query:       `SELECT building_id, meter_key, timestamp, ARRAY[flow_rate_ch1, flow_rate_ch2]::float8[] AS v FROM hot_water_meters`,
+        max:         []float64{500, 500},
+        checkFrozen: true,
+    },
+    {
+        name:        SourceColdWater,
+        title:       "счетчик ХВС",
+        query:       `SELECT i.building_id, c.itp_id::text AS meter_key, c.timestamp, ARRAY[c.flow_rate]::float8[] AS v FROM cold_water_meters c JOIN itp i ON i.id = c.itp_id`,
+        max:         []float64{500},
+        checkFrozen: true,
+    },
+    {
+        name:        SourceTemperature,
+        title:       "датчик температуры ГВС",
+        query:       `SELECT building_id, ''::text AS meter_key, timestamp, ARRAY[supply_temp, return_temp, delta_temp]::float8[] AS v FROM temperature_readings`,
+        max:         []float64{150, 150, 100},
+        checkFrozen: true,
+    },
+    {
+        // Давление и вибрация насоса могут подолгу не меняться, залипание не проверяется
+        name:  SourcePump,
+        title: "насос",
+        query: `SELECT building_id, pump_number AS meter_key, timestamp, ARRAY[pressure_input, pressure_output, vibration_level, operating_hours]::float8[] AS v FROM pump_data`,
+        max:   []float64{25, 25, 50, 200000},
+    },
+}
+
+var sourceTitles = func() map[string]string {
+    titles := make(map[string]string, len(sources))
+    for _, s := range sources {
+        titles[s.name] = s.title
+    }
+    return titles
+}()
+
+// Проверка потока за окно [$1, ...): интервалы между показаниями длиннее $2 секунд, некорректные значения,
+// показания из будущего ($4) и залипание значений с момента $3
+const checkSQL = `
+    WITH r AS (%s),
+    g AS (
+        SELECT building_id, meter_key, timestamp, v,
+               timestamp - LAG(timestamp) OVER (PARTITION BY building_id, meter_key ORDER BY timestamp) AS gap
+        FROM r
+        WHERE timestamp >= $1
+    )
+    SELECT building_id, meter_key,
+           MAX(timestamp) FILTER (WHERE timestamp <= $4),
+           COUNT(*)::int,
+           COUNT(*) FILTER (WHERE EXISTS (SELECT 1 FROM unnest(v) x WHERE x < 0))::int,
+           COUNT(*) FILTER (WHERE EXISTS (SELECT 1 FROM unnest(v, $5::float8[]) u(x, mx) WHERE x > mx))::int,
+           COUNT(*) FILTER (WHERE gap > $2::float8 * interval '1 second')::int,
+           COALESCE(EXTRACT(EPOCH FROM SUM(gap) FILTER (WHERE gap > $2::float8 * interval '1 second')), 0)::float8,
+           COUNT(*) FILTER (WHERE timestamp > $4)::int,
+           $6 AND COUNT(*) FILTER (WHERE timestamp >= $3 AND timestamp <= $4) >= 3
+              AND COUNT(DISTINCT v) FILTER (WHERE timestamp >= $3 AND timestamp <= $4) = 1
+    FROM g
+    GROUP BY building_id, meter_key`
+
+// Config - пороги проверки
+type Config struct {
+    Window      time.Duration // окно, за которое проверяются показания
+    StaleAfter  time.Duration // без показаний дольше - счетчик не передает данные
+    FrozenAfter time.Duration // одинаковые показания дольше - значение залипло
+    MaxGap      time.Duration // интервал между показаниями больше - пропуск данных
+}
+
+// Качество данных счетчика
+type MeterQuality struct {
+    BuildingID    uuid.UUID  `json:"building_id"`
+    Source        string     `json:"source"`
+    MeterKey      string     `json:"meter_key,omitempty"`
+    LastReadingAt *time.Time `json:"last_reading_at"`
+    Readings      int        `json:"readings"`
+    Stale         bool       `json:"stale"`
+    Frozen        bool       `json:"frozen"`
+    Negative      int        `json:"negative"`
+    OutOfRange    int        `json:"out_of_range"`
+    Gaps          int        `json:"gaps"`
+    GapSeconds    float64    `json:"gap_seconds"`
+    Duplicates    int        `json:"duplicates"`
+    Future        int        `json:"future"`
+    Score         int        `json:"score"`
+    Issues        []string   `json:"issues"`
+    CheckedAt     time.Time  `json:"checked_at"`
+}
+
+type meterKey struct {
+    buildingID uuid.UUID
+    source     string
+    key        string
+}
+
+// Объект инцидента неисправности: источник и, для ХВС и насосов, идентификатор счетчика
+func (q *MeterQuality) subject() string {
+    if q.MeterKey == "" {
+        return q.Source
+    }
+    return q.Source + ":" + q.MeterKey
+}
+
+func (q *MeterQuality) invalidShare() float64 {
+    if q.Readings == 0 {
+        return 0
+    }
+    return float64(q.Negative+q.OutOfRange) / float64(q.Readings)
+}
+
+// Checker - периодическая проверка качества показаний всех счетчиков
+type Checker struct {
+    pool      *pgxpool.Pool
+    incidents *incident.Store
+    cfg       Config
+    log       *slog.Logger
+}
+
+func NewChecker(pool *pgxpool.Pool, incidents *incident.Store, cfg Config) (*Checker, error) {
+    if cfg.Window <= 0 || cfg.StaleAfter <= 0 || cfg.FrozenAfter <= 0 || cfg.MaxGap <= 0 {
+        return nil, fmt.Errorf("quality thresholds must be positive")
+    }
+    if cfg.FrozenAfter > cfg.Window {
+        return nil, fmt.Errorf("frozen threshold %s exceeds check window %s", cfg.FrozenAfter, cfg.Window)
+    }
+    if cfg.MaxGap >= cfg.Window {
+        return nil, fmt.Errorf("gap threshold %s must be shorter than check window %s", cfg.MaxGap, cfg.Window)
+    }
+    return &Checker{
+        pool:      pool,
+        incidents: incidents,
+        cfg:       cfg,
+        log:       logging.Component("quality"),
+    }, nil
+}
+
+// Проход фоновой задачи: проверка показаний за окно, сохранение в meter_quality
+// и сверка инцидентов неисправности счетчиков
+func (ch *Checker) RunOnce(ctx context.Context) error {
+    now := time.Now()
+    windowStart := now.Add(-ch.cfg.Window)
+    meters := make(map[meterKey]*MeterQuality)
+
+    batch := &pgx.Batch{}
+    for _, s := range sources {
+        batch.Queue(fmt.Sprintf(checkSQL, s.query),
+            windowStart, ch.cfg.MaxGap.Seconds(), now.Add(-ch.cfg.FrozenAfter), now.Add(futureSkew), s.max, s.checkFrozen).
+            Query(func(rows pgx.Rows) error {
+                for rows.Next() {
+                    q := &MeterQuality{Source: s.name, CheckedAt: now}
+                    err := rows.Scan(&q.BuildingID, &q.MeterKey, &q.LastReadingAt, &q.Readings, &q.Negative,
+                        &q.OutOfRange, &q.Gaps, &q.GapSeconds, &q.Future, &q.Frozen)
+                    if err != nil {
+                        return fmt.Errorf("scan %s quality: %w", s.name, err)
+                    }
+                    meters[meterKey{q.BuildingID, q.Source, q.MeterKey}] = q
+                }
+                return rows.Err()
+            })
+    }
+
+    // Счетчики, проверенные ранее, но без показаний в окне, остаются в выборке как молчащие
+    batch.Queue(`SELECT building_id, source, meter_key, last_reading_at FROM meter_quality`).Query(func(rows pgx.Rows) error {
+        for rows.Next() {
+            q := &MeterQuality{CheckedAt: now}
+            if err := rows.Scan(&q.BuildingID, &q.Source, &q.MeterKey, &q.LastReadingAt); err != nil {
+                return fmt.Errorf("scan meter quality: %w", err)
+            }
+            if _, seen := meters[meterKey{q.BuildingID, q.Source, q.MeterKey}]; !seen {
+                meters[meterKey{q.BuildingID, q.Source, q.MeterKey}] = q
+            }
+        }
+        return rows.Err()
+    })
+
+    duplicates := make(map[meterKey]int)
+    batch.Queue(`
+        SELECT building_id, source, meter_key, SUM(count)::int
+        FROM ingest_duplicates
+        WHERE hour >= date_trunc('hour', $1::timestamptz AT TIME ZONE 'UTC') AT TIME ZONE 'UTC'
+        GROUP BY building_id, source, meter_key`, windowStart).Query(func(rows pgx.Rows) error {
+        for rows.Next() {
+            var k meterKey
+            var n int
+            if err := rows.Scan(&k.buildingID, &k.source, &k.key, &n); err != nil {
+                return fmt.Errorf("scan ingest duplicates: %w", err)
+            }
+            duplicates[k] = n
+        }
+        return rows.Err()
+    })
+
+    if err := ch.pool.SendBatch(ctx, batch).Close(); err != nil {
+        return fmt.Errorf("check meter quality: %w", err)
+    }
+
+    var ids []uuid.UUID
+    var srcs, keys, issues []string
+    var lastReadings []*time.Time
+    var readings, negative, outOfRange, gaps, dups, future, scores []int32
+    var stale, frozen []bool
+    var gapSeconds []float64
+
+    buildings := make(map[uuid.UUID]bool)
+    detected := make(map[uuid.UUID][]incident.Detection)
+    faults := 0
+    for k, q := range meters {
+        q.Duplicates = duplicates[k]
+        ch.evaluate(q, now)
+
+        buildings[q.BuildingID] = true
+        if d, ok := ch.detect(q); ok {
+            detected[q.BuildingID] = append(detected[q.BuildingID], d)
+            faults++
+        }
+
+        ids = append(ids, q.BuildingID)
+        srcs = append(srcs, q.Source)
+        keys = append(keys, q.MeterKey)
+        lastReadings = append(lastReadings, q.LastReadingAt)
+        readings = append(readings, int32(q.Readings))
+        stale = append(stale, q.Stale)
+        frozen = append(frozen, q.Frozen)
+        negative = append(negative, int32(q.Negative))
+        outOfRange = append(outOfRange, int32(q.OutOfRange))
+        gaps = append(gaps, int32(q.Gaps))
+        gapSeconds = append(gapSeconds, q.GapSeconds)
+        dups = append(dups, int32(q.Duplicates))
+        future = append(future, int32(q.Future))
+        scores = append(scores, int32(q.Score))
+        // Список проблем передается строкой через разделитель: unnest не разворачивает двумерные массивы
+        issues = append(issues, strings.Join(q.Issues, ","))
+    }
+
+    batch = &pgx.Batch{}
+    batch.Queue(`
+        INSERT INTO meter_quality (building_id, source, meter_key, last_reading_at, readings, stale, frozen,
+                                   negative, out_of_range, gaps, gap_seconds, duplicates, future, score, issues, checked_at)
+        SELECT m.building_id, m.source, m.meter_key, m.last_reading_at, m.readings, m.stale, m.frozen,
+               m.negative, m.out_of_range, m.gaps, m.gap_seconds, m.duplicates, m.future, m.score,
+               COALESCE(string_to_array(NULLIF(m.issues, ''), ','), '{}'), $16
+        FROM unnest($1::uuid[], $2::text[], $3::text[], $4::timestamptz[], $5::int[], $6::bool[], $7::bool[],
+                    $8::int[], $9::int[], $10::int[], $11::float8[], $12::int[], $13::int[], $14::int[], $15::text[])
+            AS m(building_id, source, meter_key, last_reading_at, readings, stale, frozen,
+                 negative, out_of_range, gaps, gap_seconds, duplicates, future, score, issues)
+        WHERE EXISTS (SELECT 1 FROM buildings b WHERE b.id = m.building_id)
+        ON CONFLICT (building_id, source, meter_key) DO UPDATE SET
+            last_reading_at = EXCLUDED.last_reading_at,
+            readings = EXCLUDED.readings,
+            stale = EXCLUDED.stale,
+            frozen = EXCLUDED.frozen,
+            negative = EXCLUDED.negative,
+            out_of_range = EXCLUDED.out_of_range,
+            gaps = EXCLUDED.gaps,
+            gap_seconds = EXCLUDED.gap_seconds,
+            duplicates = EXCLUDED.duplicates,
+            future = EXCLUDED.future,
+            score = EXCLUDED.score,
+            issues = EXCLUDED.issues,
+            checked_at = EXCLUDED.checked_at`,
+        ids, srcs, keys, lastReadings, readings, stale, frozen,
+        negative, outOfRange, gaps, gapSeconds, dups, future, scores, issues, now)
+    batch.Queue(`DELETE FROM ingest_duplicates WHERE hour < date_trunc('hour', $1::timestamptz AT TIME ZONE 'UTC') AT TIME ZONE 'UTC'`,
+        windowStart)
+    if err := ch.pool.SendBatch(ctx, batch).Close(); err != nil {
+        return fmt.Errorf("save meter quality: %w", err)
+    }
+
+    checked := make([]uuid.UUID, 0, len(buildings))
+    for id := range buildings {
+        checked = append(checked, id)
+    }
+    opened, resolved, err := ch.incidents.Reconcile(ctx, []string{incident.KindMeterFault}, checked, detected)
+    if err != nil {
+        return err
+    }
+    if err := ch.incidents.UpdateMetrics(ctx); err != nil {
+        return err
+    }
+
+    ch.log.InfoContext(ctx, "meter quality checked",
+        "meters", len(meters),
+        "faults", faults,
+        "incidents_opened", opened,
+        "incidents_resolved", resolved)
+    return nil
+}
+
+// Признаки проблем и оценка 0-100. Молчащий счетчик получает 0, остальные проблемы снижают оценку
+func (ch *Checker) evaluate(q *MeterQuality, now time.Time) {
+    q.Stale = q.LastReadingAt == nil || now.Sub(*q.LastReadingAt) > ch.cfg.StaleAfter
+    q.Issues = []string{}
+
+    score := 100.0
+    if q.Stale {
+        q.Issues = append(q.Issues, IssueStale)
+        score = 0
+    }
+    if q.Frozen {
+        q.Issues = append(q.Issues, IssueFrozen)
+        score -= 40
+    }
+    if q.Negative > 0 {
+        q.Issues = append(q.Issues, IssueNegative)
+    }
+    if q.OutOfRange > 0 {
+        q.Issues = append(q.Issues, IssueOutOfRange)
+    }
+    if q.Negative+q.OutOfRange > 0 {
+        score -= math.Max(10, math.Min(30, 100*q.invalidShare()))
+    }
+    if q.Gaps > 0 {
+        q.Issues = append(q.Issues, IssueGaps)
+        share := q.GapSeconds / ch.cfg.Window.Seconds()
+        score -= 20 * math.Min(1, 2*share)
+    }
+    if q.Duplicates > 0 {
+        q.Issues = append(q.Issues, IssueDuplicates)
+    }
+    if q.Future > 0 {
+        q.Issues = append(q.Issues, IssueFuture)
+    }
+    if q.Duplicates > 0 || q.Future > 0 {
+        score -= 10
+    }
+
+    q.Score = int(math.Round(math.Max(0, score)))
+}
+
+// Неисправность счетчика: нет данных, залипшие, некорректные значения или время из будущего.
+// Пропуски и повторы снижают оценку, но инцидент не открывают
+func (ch *Checker) detect(q *MeterQuality) (incident.Detection, bool) {
+    var reasons []string
+    if q.Stale {
+        if q.LastReadingAt == nil {
+            reasons = append(reasons, "нет показаний")
+        } else {
+            reasons = append(reasons, fmt.Sprintf("нет показаний с %s", q.LastReadingAt.UTC().Format("02.01.2006 15:04 UTC")))
+        }
+    }
+    if q.Frozen {
+        reasons = append(reasons, fmt.Sprintf("показания не меняются дольше %s", ch.cfg.FrozenAfter))
+    }
+    if n := q.Negative + q.OutOfRange; n > 0 {
+        reasons = append(reasons, fmt.Sprintf("некорректных значений %d из %d", n, q.Readings))
+    }
+    if q.Future > 0 {
+        reasons = append(reasons, fmt.Sprintf("показаний с временем из будущего %d", q.Future))
+    }
+    if len(reasons) == 0 {
+        return incident.Detection{}, false
+    }
+
+    severity := incident.SeverityWarning
+    if q.Stale || q.invalidShare() >= criticalInvalidShare {
+        severity = incident.SeverityCritical
+    }
+
+    title := "Неисправность: " + sourceTitles[q.Source]
+    if q.MeterKey != "" {
+        title += " " + q.MeterKey
+    }
+    return incident.Detection{
+        Kind:     incident.KindMeterFault,
+        Subject:  q.subject(),
+        Severity: severity,
+        Title:    title + ": " + strings.Join(reasons, ", "),
+        Details:  q,
+    }, true
+}
+
+// Качество данных здания: счетчики и средняя оценка
+type BuildingQuality struct {
+    BuildingID uuid.UUID      `json:"building_id"`
+    Score      *int           `json:"score"` // nil - счетчики еще не проверялись
+    Window     string         `json:"window"`
+    Meters     []MeterQuality `json:"meters"`
+}
+
+// Качество данных счетчиков здания по последней проверке.
+// Здание вне компании organizationID - tenant.ErrBuildingNotFound
+func (ch *Checker) BuildingQuality(ctx context.Context, organizationID *uuid.UUID, buildingID uuid.UUID) (*BuildingQuality, error) {
+    var exists bool
+    err := ch.pool.QueryRow(ctx, `
+        SELECT TRUE FROM buildings WHERE id = $1 AND ($2::uuid IS NULL OR organization_id = $2)`,
+        buildingID, organizationID).Scan(&exists)
+    if errors.Is(err, pgx.ErrNoRows) {
+        return nil, tenant.ErrBuildingNotFound
+    }
+    if err != nil {
+        return nil, fmt.Errorf("check building %s: %w", buildingID, err)
+    }
+
+    rows, err := ch.pool.Query(ctx, `
+        SELECT building_id, source, meter_key, last_reading_at, readings, stale, frozen, negative, out_of_range,
+               gaps, gap_seconds, duplicates, future, score, issues, checked_at
+        FROM meter_quality
+        WHERE building_id = $1
+        ORDER BY score, source, meter_key`, buildingID)
+    if err != nil {
+        return nil, fmt.Errorf("load meter quality %s: %w", buildingID, err)
+    }
+    defer rows.Close()
+
+    result := &BuildingQuality{BuildingID: buildingID, Window: ch.cfg.Window.String(), Meters: []MeterQuality{}}
+    total := 0
+    for rows.Next() {
+        var q MeterQuality
+        err := rows.Scan(&q.BuildingID, &q.Source, &q.MeterKey, &q.LastReadingAt, &q.Readings, &q.Stale, &q.Frozen,
+            &q.Negative, &q.OutOfRange, &q.Gaps, &q.GapSeconds, &q.Duplicates, &q.Future, &q.Score, &q.Issues, &q.CheckedAt)
+        if err != nil {
+            return nil, fmt.Errorf("scan meter quality: %w", err)
+        }
+        total += q.Score
+        result.Meters = append(result.Meters, q)
+    }
+    if err := rows.Err(); err != nil {
+        return nil, err
+    }
+
+    if len(result.Meters) > 0 {
+        score := int(math.Round(float64(total) / float64(len(result.Meters))))
+        result.Score = &score
+    }
+    return result, nil
+}
@@ -0,0 +1,225 @@
+package risk
+
+import (
+    "fmt"
+    "math"
+    "sort"
+    "strconv"
+    "strings"
+)
+
+// Факторы риска
+const (
+    FactorWaterBalance = "water_balance"
+    FactorTemperature  = "temperature"
+    FactorPump         = "pump"
+    FactorDataGaps     = "data_gaps"
+    FactorIncidents    = "incidents"
+)
+
+// Порядок факторов в разбивке
+var factorOrder = []string{FactorWaterBalance, FactorTemperature, FactorPump, FactorDataGaps, FactorIncidents}
+
+// Пороги оценки
+const (
+    ratioNormMin    = 40.0 // типовая норма ГВС/ХВС, %; у здания может быть своя (Inputs.RatioNormMin/Max)
+    ratioNormMax    = 70.0
+    ratioMaxDev     = 30.0 // отклонение от нормы, при котором фактор максимален, п.п.
+    deltaNormMin    = 17.0 // норма ΔT ГВС, °C
+    deltaNormMax    = 23.0
+    deltaMaxDev     = 6.0
+    incidentsForMax = 5.0 // инцидентов за период, при котором фактор максимален (критический считается дважды)
+)
+
+// Веса факторов; итоговая оценка нормируется на сумму весов
+type Weights map[string]float64
+
+// Веса по умолчанию, в сумме 100
+func DefaultWeights() Weights {
+    return Weights{
+        FactorWaterBalance: 35,
+        FactorTemperature:  25,
+        FactorPump:         20,
+        FactorDataGaps:     10,
+        FactorIncidents:    10,
+    }
+}
+
+// Разбор весов вида "water_balance=40,incidents=5". Не указанные факторы сохраняют вес по умолчанию
+func ParseWeights(s string) (Weights, error) {
+    weights := DefaultWeights()
+    for _, part := range strings.Split(s, ",") {
+        part = strings.TrimSpace(part)
+        if part == "" {
+            continue
+        }
+        name, value, ok := strings.Cut(part, "=")
+        if !ok {
+            return nil, fmt.Errorf("invalid weight %q, expected factor=weight", part)
+        }
+        name = strings.TrimSpace(name)
+        if _, known := weights[name]; !known {
+            return nil, fmt.Errorf("unknown risk factor %q", name)
+        }
+        w, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+        if err != nil || w < 0 {
+            return nil, fmt.Errorf("invalid weight for %s: %q", name, value)
+        }
+        weights[name] = w
+    }
+
+    var total float64
+    for _, w := range weights {
+        total += w
+    }
+    if total == 0 {
+        return nil, fmt.Errorf("risk weights must not all be zero")
+    }
+    return weights, nil
+}
+
+func (w Weights) String() string {
+    parts := make([]string, 0, len(w))
+    for _, name := range factorOrder {
+        parts = append(parts, fmt.Sprintf("%s=%g", name, w[name]))
+    }
+    return strings.Join(parts, ",")
+}
+
+// Исходные данные оценки здания
+type Inputs struct {
+    HasWaterData   bool
+    HotToColdRatio float64 // ГВС/ХВС, %
+    RatioNormMin   float64 // норма ГВС/ХВС здания; 0 в обеих границах - типовая норма
+    RatioNormMax   float64
+
+    HasTemperatureData bool
+    AvgDeltaTemp       float64
+
+    TotalPumps    int
+    WarningPumps  int
+    CriticalPumps int
+
+    DataCoverage float64 // доля часов периода с показаниями, 0..1
+
+    RecentIncidents int // инциденты, открытые за период истории
+    RecentCritical  int
+}
+
+// Вклад фактора: Value - доля максимального риска по фактору (0..1),
+// Score - вклад в итоговую оценку с учетом веса
+type Factor struct {
+    Name   string  `json:"name"`
+    Value  float64 `json:"value"`
+    Weight float64 `json:"weight"`
+    Score  float64 `json:"score"`
+    Detail string  `json:"detail"`
+}
+
+// Оценка риска 0-100 с разбивкой по факторам
+type Assessment struct {
+    Score   int      `json:"score"`
+    Factors []Factor `json:"factors"`
+}
+
+// Scorer - расчет оценки риска по весам факторов
+type Scorer struct {
+    weights Weights
+    total   float64
+}
+
+func NewScorer(weights Weights) *Scorer {
+    var total float64
+    for _, w := range weights {
+        total += w
+    }
+    return &Scorer{weights: weights, total: total}
+}
+
+// Отклонение от интервала [lo, hi], 0 внутри него
+func deviation(v, lo, hi float64) float64 {
+    switch {
+    case v < lo:
+        return lo - v
+    case v > hi:
+        return v - hi
+    }
+    return 0
+}
+
+func clamp01(v float64) float64 {
+    return math.Max(0, math.Min(1, v))
+}
+
+// Значения факторов 0..1 и пояснения
+func evaluate(in Inputs) map[string]Factor {
+    factors := make(map[string]Factor, len(factorOrder))
+
+    water := Factor{Name: FactorWaterBalance, Detail: "нет данных ХВС/ГВС"}
+    if in.HasWaterData {
+        lo, hi := in.RatioNormMin, in.RatioNormMax
+        if lo == 0 && hi == 0 {
+            lo, hi = ratioNormMin, ratioNormMax
+        }
+        dev := deviation(in.HotToColdRatio, lo, hi)
+        water.Value = clamp01(dev / ratioMaxDev)
+        water.Detail = fmt.Sprintf("ГВС/ХВС %.1f%%, отклонение от нормы %.1f-%.1f%%: %.1f п.п.",
+            in.HotToColdRatio, lo, hi, dev)
+    }
+    factors[FactorWaterBalance] = water
+
+    temp := Factor{Name: FactorTemperature, Detail: "нет температурных данных"}
+    if in.HasTemperatureData {
+        dev := deviation(in.AvgDeltaTemp, deltaNormMin, deltaNormMax)
+        temp.Value = clamp01(dev / deltaMaxDev)
+        temp.Detail = fmt.Sprintf("ΔT %.1f°C, отклонение от нормы %.0f-%.0f°C: %.1f°C",
+            in.AvgDeltaTemp, deltaNormMin, deltaNormMax, dev)
+    }
+    factors[FactorTemperature] = temp
+
+    pump := Factor{Name: FactorPump, Detail: "нет данных насосов"}
+    if in.TotalPumps > 0 {
+        pump.Value = clamp01((float64(in.CriticalPumps) + 0.5*float64(in.WarningPumps)) / float64(in.TotalPumps))
+        pump.Detail = fmt.Sprintf("насосов %d: критических %d, с предупреждением %d",
+            in.TotalPumps, in.CriticalPumps, in.WarningPumps)
+    }
+    factors[FactorPump] = pump
+
+    coverage := clamp01(in.DataCoverage)
+    factors[FactorDataGaps] = Factor{
+        Name:   FactorDataGaps,
+        Value:  1 - coverage,
+        Detail: fmt.Sprintf("показания есть в %.0f%% часов периода", coverage*100),
+    }
+
+    factors[FactorIncidents] = Factor{
+        Name:   FactorIncidents,
+        Value:  clamp01(float64(in.RecentIncidents+in.RecentCritical) / incidentsForMax),
+        Detail: fmt.Sprintf("инцидентов за период: %d, из них критических %d", in.RecentIncidents, in.RecentCritical),
+    }
+
+    return factors
+}
+
+// Оценка здания
+func (s *Scorer) Score(in Inputs) Assessment {
+    values := evaluate(in)
+
+    var sum float64
+    factors := make([]Factor, 0, len(factorOrder))
+    for _, name := range factorOrder {
+        f := values[name]
+        f.Weight = s.weights[name]
+        f.Score = math.Round(100*f.Value*f.Weight/s.total*10) / 10
+        sum += 100 * f.Value * f.Weight / s.total
+        factors = append(factors, f)
+    }
+
+    // Наибольший вклад первым
+    sort.SliceStable(factors, func(i, j int) bool { return factors[i].Score > factors[j].Score })
+
+    return Assessment{
+        Score:   int(math.Round(math.Min(sum, 100))),
+        Factors: factors,
+    }
+}
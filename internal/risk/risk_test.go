@@ -0,0 +1,188 @@
+package risk
+
+import (
+    "testing"
+)
+
+// Здание без отклонений: все данные в норме, покрытие полное
+func healthy() Inputs {
+    return Inputs{
+        HasWaterData:       true,
+        HotToColdRatio:     55,
+        HasTemperatureData: true,
+        AvgDeltaTemp:       20,
+        TotalPumps:         3,
+        DataCoverage:       1,
+    }
+}
+
+// Наихудшее здание: каждый фактор на максимуме
+func worst() Inputs {
+    return Inputs{
+        HasWaterData:       true,
+        HotToColdRatio:     100,
+        HasTemperatureData: true,
+        AvgDeltaTemp:       40,
+        TotalPumps:         2,
+        CriticalPumps:      2,
+        DataCoverage:       0,
+        RecentIncidents:    10,
+        RecentCritical:     10,
+    }
+}
+
+func TestScoreBounds(t *testing.T) {
+    doubled := DefaultWeights()
+    for name := range doubled {
+        doubled[name] *= 2
+    }
+
+    tests := []struct {
+        name    string
+        weights Weights
+        in      Inputs
+        want    int
+    }{
+        {name: "healthy", weights: DefaultWeights(), in: healthy(), want: 0},
+        {name: "worst", weights: DefaultWeights(), in: worst(), want: 100},
+        {name: "worst with weights above 100", weights: doubled, in: worst(), want: 100},
+        {
+            name:    "out of range inputs are clamped",
+            weights: DefaultWeights(),
+            in: Inputs{
+                HasWaterData: true, HotToColdRatio: 1000,
+                HasTemperatureData: true, AvgDeltaTemp: -50,
+                TotalPumps: 1, CriticalPumps: 5, WarningPumps: 5,
+                DataCoverage: -1, RecentIncidents: 100,
+            },
+            want: 100,
+        },
+        {
+            // Покрытие больше 1 не уменьшает оценку ниже нуля
+            name:    "coverage above one",
+            weights: DefaultWeights(),
+            in:      func() Inputs { in := healthy(); in.DataCoverage = 2; return in }(),
+            want:    0,
+        },
+        {
+            // Без данных воды, температуры и насосов эти факторы не начисляются, пропуски - полностью
+            name:    "no data",
+            weights: DefaultWeights(),
+            in:      Inputs{},
+            want:    10,
+        },
+        {
+            // Отклонение 15 п.п. из 30 - половина веса баланса (35)
+            name:    "half water factor",
+            weights: DefaultWeights(),
+            in:      func() Inputs { in := healthy(); in.HotToColdRatio = 85; return in }(),
+            want:    18,
+        },
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            got := NewScorer(tt.weights).Score(tt.in)
+            if got.Score != tt.want {
+                t.Errorf("score = %d, want %d (factors %+v)", got.Score, tt.want, got.Factors)
+            }
+            if got.Score < 0 || got.Score > 100 {
+                t.Errorf("score %d out of 0-100", got.Score)
+            }
+            for _, f := range got.Factors {
+                if f.Value < 0 || f.Value > 1 {
+                    t.Errorf("factor %s value %v out of 0-1", f.Name, f.Value)
+                }
+            }
+        })
+    }
+}
+
+func TestScoreRanking(t *testing.T) {
+    scorer := NewScorer(DefaultWeights())
+    with := func(change func(*Inputs)) Inputs {
+        in := healthy()
+        change(&in)
+        return in
+    }
+
+    // Каждая пара: first должна оцениваться выше second
+    tests := []struct {
+        name          string
+        first, second Inputs
+    }{
+        {
+            name:   "larger ratio deviation",
+            first:  with(func(in *Inputs) { in.HotToColdRatio = 90 }),
+            second: with(func(in *Inputs) { in.HotToColdRatio = 75 }),
+        },
+        {
+            name:   "critical pump over warning pump",
+            first:  with(func(in *Inputs) { in.CriticalPumps = 1 }),
+            second: with(func(in *Inputs) { in.WarningPumps = 1 }),
+        },
+        {
+            name:   "critical incidents count twice",
+            first:  with(func(in *Inputs) { in.RecentIncidents, in.RecentCritical = 2, 2 }),
+            second: with(func(in *Inputs) { in.RecentIncidents = 2 }),
+        },
+        {
+            name:   "water balance outweighs data gaps",
+            first:  with(func(in *Inputs) { in.HotToColdRatio = 100 }),
+            second: with(func(in *Inputs) { in.DataCoverage = 0 }),
+        },
+        {
+            name:   "low delta temp",
+            first:  with(func(in *Inputs) { in.AvgDeltaTemp = 12 }),
+            second: with(func(in *Inputs) { in.AvgDeltaTemp = 16 }),
+        },
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            first, second := scorer.Score(tt.first), scorer.Score(tt.second)
+            if first.Score <= second.Score {
+                t.Errorf("scores %d and %d, want first higher", first.Score, second.Score)
+            }
+        })
+    }
+}
+
+func TestScoreFactorOrder(t *testing.T) {
+    in := healthy()
+    in.HotToColdRatio = 85 // 17.5
+    in.DataCoverage = 0.5  // 5
+    in.CriticalPumps = 3   // 20
+
+    got := NewScorer(DefaultWeights()).Score(in)
+    want := []string{FactorPump, FactorWaterBalance, FactorDataGaps}
+    for i, name := range want {
+        if got.Factors[i].Name != name {
+            t.Fatalf("factor %d = %s, want %s (factors %+v)", i, got.Factors[i].Name, name, got.Factors)
+        }
+    }
+    if got.Score != 43 {
+        t.Errorf("score = %d, want 43", got.Score)
+    }
+}
+
+func TestParseWeights(t *testing.T) {
+    w, err := ParseWeights("water_balance=40, incidents=5")
+    if err != nil {
+        t.Fatal(err)
+    }
+    if w[FactorWaterBalance] != 40 || w[FactorIncidents] != 5 || w[FactorPump] != 20 {
+        t.Errorf("weights = %v", w)
+    }
+
+    for _, s := range []string{
+        "unknown=1",
+        "pump",
+        "pump=-1",
+        "water_balance=0,temperature=0,pump=0,data_gaps=0,incidents=0",
+    } {
+        if _, err := ParseWeights(s); err == nil {
+            t.Errorf("ParseWeights(%q) succeeded, want error", s)
+        }
+    }
+}
@@ -0,0 +1,82 @@
+package service
+
+import (
+    "math"
+
+    "service/internal/models"
+    "service/internal/tariff"
+
+    "github.com/google/uuid"
+)
+
+// Стоимость потребления и оценка потерь за период по тарифу здания, ₽.
+// Вода оценивается по объемам ХВС и ГВС за период (м³), ХВС - за вычетом воды, подогретой для ГВС;
+// тепловая энергия - по рассчитанной энергии ГВС.
+// Потери: объем вне нормы соотношения ГВС/ХВС здания и тепловая энергия сверх нормы ΔT
+type CostEstimate struct {
+    TariffID       uuid.UUID `json:"tariff_id"`
+    TariffLevel    string    `json:"tariff_level"`
+    EffectiveFrom  string    `json:"effective_from"`
+    ColdWater      float64   `json:"cold_water"`
+    HotWater       float64   `json:"hot_water"`
+    Heat           float64   `json:"heat"`
+    Total          float64   `json:"total"`
+    ImbalanceM3    float64   `json:"imbalance_m3"` // объем вне нормы соотношения ГВС/ХВС
+    ImbalanceCost  float64   `json:"imbalance_cost"`
+    ExcessHeatGcal float64   `json:"excess_heat_gcal"` // тепловая энергия сверх нормы ΔT
+    ExcessHeatCost float64   `json:"excess_heat_cost"`
+    LossCost       float64   `json:"loss_cost"`
+    LossPerDay     float64   `json:"loss_per_day"`
+}
+
+// Объем вне нормы соотношения ГВС/ХВС norm и его стоимость. Избыток ГВС сверх norm.Max оценивается
+// по тарифу ГВС с тепловой энергией по удельному расходу specificHeat (Гкал/м³),
+// избыток ХВС при доле ГВС ниже norm.Min - по тарифу ХВС
+func imbalanceLoss(cold, hot, specificHeat float64, norm RatioNorm, t *tariff.Tariff) (m3, cost float64) {
+    if cold <= 0 {
+        return 0, 0
+    }
+    switch ratio := hot / cold * 100; {
+    case ratio > norm.Max:
+        m3 = hot - cold*norm.Max/100
+        cost = m3 * (t.HotWater + specificHeat*t.Heat)
+    case ratio < norm.Min && norm.Min > 0:
+        m3 = cold - hot*100/norm.Min
+        cost = m3 * t.ColdWater
+    }
+    return models.RoundFlow(m3), models.RoundMoney(cost)
+}
+
+// Оценка стоимости анализа по тарифу t за период days суток
+func estimateCost(a *ConsumptionAnalysis, t *tariff.Tariff, days int) *CostEstimate {
+    est := CostEstimate{
+        TariffID:      t.ID,
+        TariffLevel:   t.Level,
+        EffectiveFrom: t.EffectiveFrom,
+        ColdWater:     models.RoundMoney(math.Max(a.TotalColdWater-a.TotalHotWater, 0) * t.ColdWater),
+        HotWater:      models.RoundMoney(a.TotalHotWater * t.HotWater),
+    }
+
+    var specificHeat float64
+    if a.Heat != nil {
+        specificHeat = a.Heat.SpecificHeat
+        est.Heat = models.RoundMoney(a.Heat.TotalGcal * t.Heat)
+
+        // Доля энергии, приходящаяся на ΔT сверх нормы
+        if a.TemperatureData != nil && a.TemperatureData.AvgDeltaTemp > tariff.NormDeltaTempMax {
+            delta := a.TemperatureData.AvgDeltaTemp
+            est.ExcessHeatGcal = models.RoundHeat(a.Heat.TotalGcal * (delta - tariff.NormDeltaTempMax) / delta)
+            est.ExcessHeatCost = models.RoundMoney(est.ExcessHeatGcal * t.Heat)
+        }
+    }
+    est.Total = models.RoundMoney(est.ColdWater + est.HotWater + est.Heat)
+
+    if a.DataSource == DataSourceDatabase {
+        est.ImbalanceM3, est.ImbalanceCost = imbalanceLoss(a.TotalColdWater, a.TotalHotWater, specificHeat, a.RatioNorm, t)
+    }
+    est.LossCost = models.RoundMoney(est.ImbalanceCost + est.ExcessHeatCost)
+    if days > 0 {
+        est.LossPerDay = models.RoundMoney(est.LossCost / float64(days))
+    }
+    return &est
+}
@@ -0,0 +1,207 @@
+package service
+
+import (
+    "testing"
+    "time"
+
+    "service/internal/tariff"
+    "service/internal/timeseries"
+
+    "github.com/google/uuid"
+)
+
+// Тариф: ХВС 40 ₽/м³, ГВС 200 ₽/м³, тепловая энергия 2500 ₽/Гкал
+var testTariff = &tariff.Tariff{Level: tariff.LevelDefault, ColdWater: 40, HotWater: 200, Heat: 2500, EffectiveFrom: "2026-01-01"}
+
+func TestImbalanceLoss(t *testing.T) {
+    tests := []struct {
+        name         string
+        cold, hot    float64
+        specificHeat float64
+        norm         RatioNorm
+        m3, cost     float64
+    }{
+        {name: "no cold water", cold: 0, hot: 50, norm: defaultRatioNorm()},
+        {name: "within norm", cold: 100, hot: 55, norm: defaultRatioNorm()},
+        {name: "at upper bound", cold: 100, hot: 70, norm: defaultRatioNorm()},
+        {
+            // 10 м³ сверх 70%: ГВС и тепловая энергия 0.02 Гкал/м³ - 10 * (200 + 0.02 * 2500)
+            name: "hot water excess", cold: 100, hot: 80, specificHeat: 0.02, norm: defaultRatioNorm(),
+            m3: 10, cost: 2500,
+        },
+        {
+            name: "hot water excess without heat", cold: 100, hot: 80, norm: defaultRatioNorm(),
+            m3: 10, cost: 2000,
+        },
+        {
+            // ГВС 30 м³ соответствует 75 м³ ХВС при норме 40%, избыток ХВС 25 м³
+            name: "cold water excess", cold: 100, hot: 30, norm: defaultRatioNorm(),
+            m3: 25, cost: 1000,
+        },
+        {
+            name: "peer norm", cold: 100, hot: 80, norm: RatioNorm{Min: 50, Max: 85, Source: NormPeers, Peers: 6},
+        },
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            m3, cost := imbalanceLoss(tt.cold, tt.hot, tt.specificHeat, tt.norm, testTariff)
+            if m3 != tt.m3 || cost != tt.cost {
+                t.Errorf("imbalanceLoss() = %v m³, %v ₽, want %v m³, %v ₽", m3, cost, tt.m3, tt.cost)
+            }
+        })
+    }
+}
+
+func TestEstimateCost(t *testing.T) {
+    analysis := func(cold, hot, deltaTemp float64, heat *HeatAnalysis) *ConsumptionAnalysis {
+        return &ConsumptionAnalysis{
+            TotalColdWater:  cold,
+            TotalHotWater:   hot,
+            DataSource:      DataSourceDatabase,
+            RatioNorm:       defaultRatioNorm(),
+            Heat:            heat,
+            TemperatureData: &TemperatureData{AvgDeltaTemp: deltaTemp, RecordsCount: 10},
+        }
+    }
+    heat := &HeatAnalysis{TotalGcal: 1.2, HotWaterM3: 50, SpecificHeat: 0.024}
+
+    tests := []struct {
+        name     string
+        analysis *ConsumptionAnalysis
+        days     int
+        want     CostEstimate
+    }{
+        {
+            name:     "normal consumption",
+            analysis: analysis(100, 50, 20, heat),
+            days:     10,
+            want:     CostEstimate{ColdWater: 2000, HotWater: 10000, Heat: 3000, Total: 15000},
+        },
+        {
+            name:     "delta temp at norm bound",
+            analysis: analysis(100, 50, tariff.NormDeltaTempMax, heat),
+            days:     10,
+            want:     CostEstimate{ColdWater: 2000, HotWater: 10000, Heat: 3000, Total: 15000},
+        },
+        {
+            // 2°C из 25°C сверх нормы: 1.2 * 2 / 25 = 0.096 Гкал
+            name:     "excess delta temp",
+            analysis: analysis(100, 50, 25, heat),
+            days:     10,
+            want: CostEstimate{
+                ColdWater: 2000, HotWater: 10000, Heat: 3000, Total: 15000,
+                ExcessHeatGcal: 0.096, ExcessHeatCost: 240, LossCost: 240, LossPerDay: 24,
+            },
+        },
+        {
+            // 10 м³ ГВС сверх нормы 70%: 10 * (200 + 0.024 * 2500) = 2600 ₽
+            name:     "hot water imbalance",
+            analysis: analysis(100, 80, 20, heat),
+            days:     4,
+            want: CostEstimate{
+                ColdWater: 800, HotWater: 16000, Heat: 3000, Total: 19800,
+                ImbalanceM3: 10, ImbalanceCost: 2600, LossCost: 2600, LossPerDay: 650,
+            },
+        },
+        {
+            name:     "no heat data",
+            analysis: analysis(100, 80, 25, nil),
+            days:     0,
+            want: CostEstimate{
+                ColdWater: 800, HotWater: 16000, Total: 16800,
+                ImbalanceM3: 10, ImbalanceCost: 2000, LossCost: 2000,
+            },
+        },
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            tt.want.TariffLevel = testTariff.Level
+            tt.want.EffectiveFrom = testTariff.EffectiveFrom
+            if got := estimateCost(tt.analysis, testTariff, tt.days); *got != tt.want {
+                t.Errorf("estimateCost() = %+v\nwant %+v", *got, tt.want)
+            }
+        })
+    }
+}
+
+func TestEstimateCostInsufficientData(t *testing.T) {
+    // Без оценки баланса потери по соотношению ГВС/ХВС не считаются
+    a := &ConsumptionAnalysis{
+        TotalColdWater: 100,
+        TotalHotWater:  90,
+        DataSource:     DataSourceInsufficient,
+        RatioNorm:      defaultRatioNorm(),
+    }
+    got := estimateCost(a, testTariff, 7)
+    if got.ImbalanceM3 != 0 || got.LossCost != 0 {
+        t.Errorf("imbalance %v m³, loss %v ₽, want no loss", got.ImbalanceM3, got.LossCost)
+    }
+}
+
+// Агрегаты n показаний мгновенного расхода rate (м³/ч) с шагом step так, как их сворачивает readings_raw:
+// расход - по каждому показанию, объем - rate * step по каждому показанию, кроме первого
+func flowSamples(rate float64, step time.Duration, n int) (flow, volume timeseries.Stats) {
+    for i := 0; i < n; i++ {
+        flow.Sum += rate
+        flow.Count++
+        if i > 0 {
+            volume.Sum += rate * step.Hours()
+            volume.Count++
+        }
+    }
+    flow.Min, flow.Max, volume.Min, volume.Max = rate, rate, rate*step.Hours(), rate*step.Hours()
+    return flow, volume
+}
+
+func TestAnalysisCostFromFlowSamples(t *testing.T) {
+    // Сутки показаний каждые 10 минут: ХВС 4 м³/ч - 96 м³, ГВС 3.2 м³/ч - 76.8 м³ (80%, норма 40-70%)
+    start := time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC)
+    end := start.Add(24 * time.Hour)
+    itp := itpInfo{id: uuid.New(), number: "1"}
+    coldFlow, coldVolume := flowSamples(4, 10*time.Minute, 145)
+    hotFlow, hotVolume := flowSamples(3.2, 10*time.Minute, 145)
+    data := &analysisData{
+        readings: map[string]timeseries.Stats{
+            timeseries.MetricColdWater:                                coldFlow,
+            timeseries.MetricHotWater:                                 hotFlow,
+            timeseries.MetricColdVolume:                               coldVolume,
+            timeseries.MetricHotVolume:                                hotVolume,
+            timeseries.ITPMetric(timeseries.MetricColdWater, itp.id):  coldFlow,
+            timeseries.ITPMetric(timeseries.MetricColdVolume, itp.id): coldVolume,
+        },
+        itps:   []itpInfo{itp},
+        tariff: testTariff,
+        norm:   defaultRatioNorm(),
+    }
+
+    analyzer := &Analyzer{}
+    st := analyzer.waterStage(data, start, end)
+    st.tempData, st.hasTempData = data.temperature()
+    st.pumpData, st.hasPumpData = data.pumpAnalysis()
+    a := analyzer.analyzeBuilding(uuid.New(), data, st, 1, start, end)
+    if a.DataSource != DataSourceDatabase {
+        t.Fatalf("data source = %q, want %q", a.DataSource, DataSourceDatabase)
+    }
+    if a.TotalColdWater != 96 || a.TotalHotWater != 76.8 {
+        t.Errorf("totals = %v/%v m³, want 96/76.8 m³ (sums of rates %v/%v)",
+            a.TotalColdWater, a.TotalHotWater, coldFlow.Sum, hotFlow.Sum)
+    }
+
+    // ХВС (96 - 76.8) * 40, ГВС 76.8 * 200; избыток ГВС 76.8 - 96 * 0.7 = 9.6 м³ по 200 ₽
+    want := CostEstimate{
+        TariffLevel: testTariff.Level, EffectiveFrom: testTariff.EffectiveFrom,
+        ColdWater: 768, HotWater: 15360, Total: 16128,
+        ImbalanceM3: 9.6, ImbalanceCost: 1920, LossCost: 1920, LossPerDay: 1920,
+    }
+    if a.Cost == nil || *a.Cost != want {
+        t.Fatalf("cost = %+v\nwant %+v", a.Cost, want)
+    }
+    if len(a.ITPs) != 1 {
+        t.Fatalf("got %d ITP balances, want 1", len(a.ITPs))
+    }
+    if b := a.ITPs[0]; b.TotalColdWater != 96 || b.TotalHotWater != 76.8 || b.ImbalanceM3 != 9.6 || b.LossCost != 1920 {
+        t.Errorf("ITP balance = %+v, want 96/76.8 m³ with 9.6 m³ and 1920 ₽ imbalance", b)
+    }
+}
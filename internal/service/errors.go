@@ -0,0 +1,56 @@
+package service
+
+import (
+    "context"
+    "errors"
+    "net"
+    "strings"
+
+    "github.com/jackc/pgx/v5/pgconn"
+)
+
+// Виды ошибок чтения и анализа данных; по ним API выбирает код ответа
+var (
+    ErrInsufficientData = errors.New("insufficient data")
+    ErrUnavailable      = errors.New("database unavailable")
+)
+
+// Недостаточно данных для ответа: какие показания отсутствуют
+type InsufficientDataError struct {
+    Missing []string
+}
+
+func (e *InsufficientDataError) Error() string {
+    return "insufficient data: missing " + strings.Join(e.Missing, ", ")
+}
+
+func (e *InsufficientDataError) Is(target error) bool {
+    return target == ErrInsufficientData
+}
+
+// Ошибка связи с БД (нет соединения, разрыв, таймаут, перегрузка), а не ошибка запроса
+func IsUnavailable(err error) bool {
+    if err == nil {
+        return false
+    }
+    if errors.Is(err, ErrUnavailable) || errors.Is(err, context.DeadlineExceeded) || pgconn.Timeout(err) {
+        return true
+    }
+
+    var connectErr *pgconn.ConnectError
+    if errors.As(err, &connectErr) {
+        return true
+    }
+    var netErr net.Error
+    if errors.As(err, &netErr) {
+        return true
+    }
+
+    // Класс 08 - ошибки соединения, 53 - нехватка ресурсов, 57P01-57P03 - остановка сервера
+    var pgErr *pgconn.PgError
+    if errors.As(err, &pgErr) {
+        return strings.HasPrefix(pgErr.Code, "08") || strings.HasPrefix(pgErr.Code, "53") ||
+            pgErr.Code == "57P01" || pgErr.Code == "57P02" || pgErr.Code == "57P03"
+    }
+    return false
+}
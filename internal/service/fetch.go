@@ -0,0 +1,306 @@
+package service
+
+import (
+    "context"
+    "fmt"
+    "math"
+    "time"
+
+    "service/internal/benchmark"
+    "service/internal/models"
+    "service/internal/tariff"
+    "service/internal/timeseries"
+
+    "github.com/google/uuid"
+    "github.com/jackc/pgx/v5"
+)
+
+// Показатели, которые нужны анализу потребления
+var analysisMetrics = []string{
+    timeseries.MetricColdWater,
+    timeseries.MetricHotWater,
+    timeseries.MetricSupplyTemp,
+    timeseries.MetricReturnTemp,
+    timeseries.MetricDeltaTemp,
+    timeseries.MetricHeatEnergy,
+    timeseries.MetricHotVolume,
+    timeseries.MetricColdVolume,
+}
+
+// Показатели, по которым оценивается полнота данных
+var coverageMetrics = []string{
+    timeseries.MetricColdWater,
+    timeseries.MetricHotWater,
+    timeseries.MetricDeltaTemp,
+}
+
+// Минимальное число показаний ХВС и ГВС за период для анализа баланса
+const minWaterRecords = 7
+
+// Отсутствующие данные (значение ConsumptionAnalysis.Missing)
+const (
+    MissingColdWater   = "cold_water"
+    MissingHotWater    = "hot_water"
+    MissingTemperature = "temperature"
+    MissingPumps       = "pumps"
+)
+
+// Последнее состояние насоса за период
+type pumpState struct {
+    number         string
+    status         string
+    operatingHours int
+    pressureInput  int
+    pressureOutput int
+    vibrationLevel int
+}
+
+// ИТП здания
+type itpInfo struct {
+    id     uuid.UUID
+    number string
+}
+
+// Данные здания для анализа
+type analysisData struct {
+    readings map[string]timeseries.Stats
+    coverage map[string]int // часы с показаниями
+    pumps    []pumpState
+    itps     []itpInfo
+    tariff   *tariff.Tariff // тариф на конец периода; nil - не задан
+    norm     RatioNorm      // норма соотношения ГВС/ХВС
+}
+
+// ИТП зданий в порядке номеров
+func (a *Analyzer) fetchITPs(ctx context.Context, buildingIDs []uuid.UUID) (map[uuid.UUID][]itpInfo, error) {
+    rows, err := a.pool.Query(ctx, `
+        SELECT building_id, id, itp_number FROM itp
+        WHERE building_id = ANY($1)
+        ORDER BY building_id, itp_number`, buildingIDs)
+    if err != nil {
+        return nil, fmt.Errorf("fetch itps: %w", err)
+    }
+    defer rows.Close()
+
+    itps := make(map[uuid.UUID][]itpInfo, len(buildingIDs))
+    for rows.Next() {
+        var buildingID uuid.UUID
+        var itp itpInfo
+        if err := rows.Scan(&buildingID, &itp.id, &itp.number); err != nil {
+            return nil, fmt.Errorf("scan itp: %w", err)
+        }
+        itps[buildingID] = append(itps[buildingID], itp)
+    }
+    return itps, rows.Err()
+}
+
+// Загрузка данных для анализа нескольких зданий: после списка ИТП агрегаты показаний
+// (здания и каждого ИТП), последние состояния насосов, тарифы и соотношения ГВС/ХВС сопоставимых зданий
+// отправляются одним пакетом
+func (a *Analyzer) fetchAnalysisData(ctx context.Context, buildingIDs []uuid.UUID, start, end time.Time) (map[uuid.UUID]*analysisData, error) {
+    itps, err := a.fetchITPs(ctx, buildingIDs)
+    if err != nil {
+        return nil, err
+    }
+    metrics := append([]string(nil), analysisMetrics...)
+    for _, list := range itps {
+        for _, itp := range list {
+            metrics = append(metrics,
+                timeseries.ITPMetric(timeseries.MetricColdWater, itp.id),
+                timeseries.ITPMetric(timeseries.MetricHotWater, itp.id),
+                timeseries.ITPMetric(timeseries.MetricColdVolume, itp.id),
+                timeseries.ITPMetric(timeseries.MetricHotVolume, itp.id))
+        }
+    }
+
+    batch := &pgx.Batch{}
+    readings := a.readings.QueueAggregate(batch, buildingIDs, start, end, metrics)
+    coverage := a.readings.QueueCoverage(batch, buildingIDs, start, end, coverageMetrics)
+    tariffs := tariff.QueueResolve(batch, buildingIDs, end)
+    peers := benchmark.QueuePeerRatios(batch, buildingIDs)
+
+    pumps := make(map[uuid.UUID][]pumpState, len(buildingIDs))
+    batch.Queue(`
+        SELECT DISTINCT ON (building_id, pump_number)
+            building_id, pump_number, status, operating_hours, pressure_input, pressure_output, vibration_level
+        FROM pump_data
+        WHERE building_id = ANY($1)
+        AND timestamp BETWEEN $2 AND $3
+        ORDER BY building_id, pump_number, timestamp DESC`,
+        buildingIDs, start, end).Query(func(rows pgx.Rows) error {
+        for rows.Next() {
+            var buildingID uuid.UUID
+            var p pumpState
+            err := rows.Scan(&buildingID, &p.number, &p.status, &p.operatingHours,
+                &p.pressureInput, &p.pressureOutput, &p.vibrationLevel)
+            if err != nil {
+                return fmt.Errorf("scan pump data: %w", err)
+            }
+            pumps[buildingID] = append(pumps[buildingID], p)
+        }
+        return rows.Err()
+    })
+
+    if err := a.pool.SendBatch(ctx, batch).Close(); err != nil {
+        return nil, fmt.Errorf("fetch analysis data: %w", err)
+    }
+
+    data := make(map[uuid.UUID]*analysisData, len(buildingIDs))
+    for _, id := range buildingIDs {
+        peerRatios, ok := peers[id]
+        data[id] = &analysisData{readings: readings[id], coverage: coverage[id], pumps: pumps[id], itps: itps[id],
+            tariff: tariffs[id], norm: ratioNorm(peerRatios, ok)}
+    }
+    return data, nil
+}
+
+// Объем ХВС и ГВС за период (м³) и число показаний расхода. Объем - сумма объемов за интервалы
+// показаний: сумма мгновенного расхода (м³/ч) объемом не является
+func (d *analysisData) water() (totalColdWater, totalHotWater float64, coldRecords, hotRecords int, hasEnoughData bool) {
+    cold, hot := d.readings[timeseries.MetricColdWater], d.readings[timeseries.MetricHotWater]
+    totalColdWater = models.RoundFlow(d.readings[timeseries.MetricColdVolume].Sum)
+    totalHotWater = models.RoundFlow(d.readings[timeseries.MetricHotVolume].Sum)
+    coldRecords, hotRecords = int(cold.Count), int(hot.Count)
+
+    hasEnoughData = coldRecords >= minWaterRecords && hotRecords >= minWaterRecords
+    return totalColdWater, totalHotWater, coldRecords, hotRecords, hasEnoughData
+}
+
+// Объем ХВС и ГВС через ИТП (м³) и число показаний расхода. В здании с одним ИТП вся горячая вода
+// подается через него, даже если ОДПУ ГВС не привязан к ИТП
+func (d *analysisData) itpWater(itp uuid.UUID) (coldM3, hotM3 float64, coldRecords, hotRecords int) {
+    coldM3 = d.readings[timeseries.ITPMetric(timeseries.MetricColdVolume, itp)].Sum
+    coldRecords = int(d.readings[timeseries.ITPMetric(timeseries.MetricColdWater, itp)].Count)
+    if len(d.itps) == 1 {
+        return coldM3, d.readings[timeseries.MetricHotVolume].Sum, coldRecords, int(d.readings[timeseries.MetricHotWater].Count)
+    }
+    return coldM3, d.readings[timeseries.ITPMetric(timeseries.MetricHotVolume, itp)].Sum,
+        coldRecords, int(d.readings[timeseries.ITPMetric(timeseries.MetricHotWater, itp)].Count)
+}
+
+// Данные, которых недостаточно за период: ХВС и ГВС - меньше minWaterRecords показаний,
+// температура и насосы - ни одного
+func (d *analysisData) missing() []string {
+    var missing []string
+    if d.readings[timeseries.MetricColdWater].Count < minWaterRecords {
+        missing = append(missing, MissingColdWater)
+    }
+    if d.readings[timeseries.MetricHotWater].Count < minWaterRecords {
+        missing = append(missing, MissingHotWater)
+    }
+    if d.readings[timeseries.MetricDeltaTemp].Count == 0 {
+        missing = append(missing, MissingTemperature)
+    }
+    if len(d.pumps) == 0 {
+        missing = append(missing, MissingPumps)
+    }
+    return missing
+}
+
+// Доля часов периода, в которых есть показания ХВС, ГВС и температуры (среднее по показателям)
+func (d *analysisData) dataCoverage(start, end time.Time) float64 {
+    expected := math.Ceil(end.Sub(start).Hours())
+    if expected <= 0 {
+        return 0
+    }
+    var total float64
+    for _, metric := range coverageMetrics {
+        total += math.Min(float64(d.coverage[metric]), expected) / expected
+    }
+    return total / float64(len(coverageMetrics))
+}
+
+// Температурные данные за период
+func (d *analysisData) temperature() (*TemperatureData, bool) {
+    delta := d.readings[timeseries.MetricDeltaTemp]
+    tempData := TemperatureData{
+        AvgSupplyTemp: models.RoundTemp(d.readings[timeseries.MetricSupplyTemp].Avg()),
+        AvgReturnTemp: models.RoundTemp(d.readings[timeseries.MetricReturnTemp].Avg()),
+        AvgDeltaTemp:  models.RoundTemp(delta.Avg()),
+        MinDeltaTemp:  models.RoundTemp(delta.Min),
+        MaxDeltaTemp:  models.RoundTemp(delta.Max),
+        RecordsCount:  int(delta.Count),
+    }
+    return &tempData, tempData.RecordsCount > 0
+}
+
+// Тепловая энергия ГВС за период. Энергия считается только по показаниям ГВС, для которых есть ΔT
+func (d *analysisData) heat() (*HeatAnalysis, bool) {
+    energy, hot := d.readings[timeseries.MetricHeatEnergy], d.readings[timeseries.MetricHotWater]
+    volume := d.readings[timeseries.MetricHotVolume]
+    if energy.Count == 0 || volume.Sum <= 0 {
+        return nil, false
+    }
+    heat := HeatAnalysis{
+        TotalGcal:    models.RoundHeat(energy.Sum),
+        HotWaterM3:   models.RoundFlow(volume.Sum),
+        SpecificHeat: models.RoundHeat(energy.Sum / volume.Sum),
+        CoveredShare: math.Min(float64(energy.Count)/float64(hot.Count), 1),
+    }
+    return &heat, true
+}
+
+// Сводка по последним состояниям насосов
+func (d *analysisData) pumpAnalysis() (*PumpAnalysis, bool) {
+    var pumpData PumpAnalysis
+    var totalOperatingHours int
+    var maxOperatingHours int
+    var pressureReadings, vibrationReadings int
+
+    for _, p := range d.pumps {
+        pumpData.TotalPumps++
+        totalOperatingHours += p.operatingHours
+
+        if p.operatingHours > maxOperatingHours {
+            maxOperatingHours = p.operatingHours
+        }
+
+        switch p.status {
+        case "normal":
+            pumpData.NormalPumps++
+        case "warning":
+            pumpData.WarningPumps++
+        case "critical":
+            pumpData.CriticalPumps++
+        }
+
+        // Анализ давления
+        pressureDiff := p.pressureOutput - p.pressureInput
+        if pressureDiff >= 1 && pressureDiff <= 3 {
+            pressureReadings++
+        }
+
+        // Анализ вибрации
+        if p.vibrationLevel <= 5 {
+            vibrationReadings++
+        }
+    }
+
+    if pumpData.TotalPumps > 0 {
+        pumpData.AvgOperatingHours = totalOperatingHours / pumpData.TotalPumps
+        pumpData.MaxOperatingHours = maxOperatingHours
+
+        // Определяем статус давления
+        pressureRatio := float64(pressureReadings) / float64(pumpData.TotalPumps)
+        if pressureRatio >= 0.8 {
+            pumpData.PressureStatus = "normal"
+        } else if pressureRatio >= 0.5 {
+            pumpData.PressureStatus = "warning"
+        } else {
+            pumpData.PressureStatus = "critical"
+        }
+
+        // Определяем статус вибрации
+        vibrationRatio := float64(vibrationReadings) / float64(pumpData.TotalPumps)
+        if vibrationRatio >= 0.8 {
+            pumpData.VibrationStatus = "normal"
+        } else if vibrationRatio >= 0.5 {
+            pumpData.VibrationStatus = "warning"
+        } else {
+            pumpData.VibrationStatus = "critical"
+        }
+    }
+
+    return &pumpData, pumpData.TotalPumps > 0
+}
+
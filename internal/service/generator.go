@@ -3,118 +3,221 @@ package service
 import (
     "context"
     "fmt"
+    "log/slog"
     "math/rand"
+    "sync"
+    "sync/atomic"
     "time"
 
+    "service/internal/logging"
+    "service/internal/metrics"
+    "service/internal/models"
+
     "github.com/gin-gonic/gin"
+    "github.com/jackc/pgx/v5"
     "github.com/jackc/pgx/v5/pgxpool"
     "github.com/google/uuid"
 )
 
+// Потоки генератора (метка stream в метриках)
+const (
+    streamRealtime    = "realtime"
+    streamWater       = "water"
+    streamTemperature = "temperature"
+    streamPump        = "pump"
+    streamBroadcast   = "broadcast"
+    streamHistory     = "history"
+)
+
 // Расширенный генератор данных для реального времени
 type DataGenerator struct {
     pool      *pgxpool.Pool
+    log       *slog.Logger
+    mu        sync.Mutex
     isRunning bool
     ctx       context.Context
     cancel    context.CancelFunc
+
+    // Последняя ошибка генерации (отдается в статусе генератора)
+    lastErr   *GeneratorError
+
+    // Число работающих циклов генерации и время последнего такта (для проверки живости)
+    loops     atomic.Int32
+    lastTick  atomic.Int64
+
+    // Получатель обновлений реального времени (рассылка по WebSocket)
+    OnRealtimeUpdate func(buildingID uuid.UUID, organizationID *uuid.UUID, data interface{})
+}
+
+// Ошибка генератора с потоком и временем возникновения
+type GeneratorError struct {
+    Stream  string    `json:"stream"`
+    Message string    `json:"message"`
+    At      time.Time `json:"at"`
 }
 
 func NewDataGenerator(pool *pgxpool.Pool) *DataGenerator {
-    return &DataGenerator{pool: pool}
+    return &DataGenerator{pool: pool, log: logging.Component("generator")}
+}
+
+// Учет ошибки генерации: журнал, метрика и последняя ошибка для статуса
+func (dg *DataGenerator) reportError(stream, op string, err error, attrs ...any) {
+    metrics.GeneratorErrors.WithLabelValues(stream).Inc()
+    dg.log.Error(op+" failed", append([]any{"stream", stream, logging.Err(err)}, attrs...)...)
+
+    dg.mu.Lock()
+    dg.lastErr = &GeneratorError{Stream: stream, Message: fmt.Sprintf("%s: %v", op, err), At: time.Now()}
+    dg.mu.Unlock()
+}
+
+// Последняя ошибка генерации, nil если ошибок не было
+func (dg *DataGenerator) LastError() *GeneratorError {
+    dg.mu.Lock()
+    defer dg.mu.Unlock()
+    return dg.lastErr
 }
 
 // Запуск непрерывной генерации данных
 func (dg *DataGenerator) StartContinuousGeneration(ctx context.Context) {
+    dg.mu.Lock()
+    defer dg.mu.Unlock()
+
     if dg.isRunning {
-        fmt.Println("Generator is already running")
+        dg.log.Info("generator is already running")
         return
     }
 
     dg.ctx, dg.cancel = context.WithCancel(ctx)
     dg.isRunning = true
 
-    fmt.Println("Starting continuous data generation...")
 
-    // Запускаем различные тикеры для разных типов данных
-    go dg.startWaterDataGeneration()
-    go dg.startTemperatureDataGeneration()
-    go dg.startPumpDataGeneration()
-    go dg.startRealtimeUpdates()
+    // Запускаем различные тикеры для разных типов данных.
+    // Каждый тикер получает свой done, чтобы после перезапуска старые горутины завершились
+    done := dg.ctx.Done()
+    dg.lastTick.Store(time.Now().UnixNano())
+    dg.spawn(dg.startWaterDataGeneration, done)
+    dg.spawn(dg.startTemperatureDataGeneration, done)
+    dg.spawn(dg.startPumpDataGeneration, done)
+    dg.spawn(dg.startRealtimeUpdates, done)
 
-    fmt.Println("Continuous data generation started")
+    dg.log.Info("continuous data generation started")
 }
 
 // Остановка генерации
 func (dg *DataGenerator) Stop() {
+    dg.mu.Lock()
+    defer dg.mu.Unlock()
+
     if dg.isRunning && dg.cancel != nil {
         dg.cancel()
         dg.isRunning = false
-        fmt.Println("Data generation stopped")
+        dg.log.Info("data generation stopped")
     }
 }
 
 // Получение статуса генератора
 func (dg *DataGenerator) IsRunning() bool {
+    dg.mu.Lock()
+    defer dg.mu.Unlock()
     return dg.isRunning
 }
 
+// Число циклов генерации, запускаемых StartContinuousGeneration
+const generatorLoops = 4
+
+// Максимальная пауза между тактами цикла реального времени (тикер раз в секунду)
+const maxTickGap = 2 * time.Minute
+
+// Запуск цикла генерации с учетом числа работающих горутин
+func (dg *DataGenerator) spawn(loop func(done <-chan struct{}), done <-chan struct{}) {
+    dg.loops.Add(1)
+    go func() {
+        defer dg.loops.Add(-1)
+        loop(done)
+    }()
+}
+
+// Проверка живости: если генератор запущен, все циклы должны работать,
+// а цикл реального времени - выполнять такты
+func (dg *DataGenerator) CheckAlive() (string, error) {
+    if !dg.IsRunning() {
+        return "stopped", nil
+    }
+
+    loops := dg.loops.Load()
+    if loops < generatorLoops {
+        return "", fmt.Errorf("only %d of %d generator loops are running", loops, generatorLoops)
+    }
+
+    gap := time.Since(time.Unix(0, dg.lastTick.Load()))
+    if gap > maxTickGap {
+        return "", fmt.Errorf("no generator ticks for %s", gap.Round(time.Second))
+    }
+    return fmt.Sprintf("%d loops, last tick %s ago", loops, gap.Round(time.Millisecond)), nil
+}
+
 
 // Генерация водных данных (каждые 30 секунд)
 // generator.go - в методе startWaterDataGeneration
-func (dg *DataGenerator) startWaterDataGeneration() {
+func (dg *DataGenerator) startWaterDataGeneration(done <-chan struct{}) {
     ticker := time.NewTicker(1 * time.Second) // Каждую секунду 
     defer ticker.Stop()
 
     for {
         select {
-        case <-dg.ctx.Done():
+        case <-done:
             return
         case <-ticker.C:
+            dg.lastTick.Store(time.Now().UnixNano())
+            metrics.GeneratorTicks.WithLabelValues(streamRealtime).Inc()
             dg.generateRealtimeData() // Используем новый метод
         }
     }
 }
 
 // Генерация температурных данных (каждые 2 минуты)
-func (dg *DataGenerator) startTemperatureDataGeneration() {
+func (dg *DataGenerator) startTemperatureDataGeneration(done <-chan struct{}) {
     ticker := time.NewTicker(2 * time.Minute)
     defer ticker.Stop()
 
     for {
         select {
-        case <-dg.ctx.Done():
+        case <-done:
             return
         case <-ticker.C:
+            metrics.GeneratorTicks.WithLabelValues(streamTemperature).Inc()
             dg.generateTemperatureDataForAllBuildings()
         }
     }
 }
 
 // Генерация данных насосов (каждые 5 минут)
-func (dg *DataGenerator) startPumpDataGeneration() {
+func (dg *DataGenerator) startPumpDataGeneration(done <-chan struct{}) {
     ticker := time.NewTicker(5 * time.Minute)
     defer ticker.Stop()
 
     for {
         select {
-        case <-dg.ctx.Done():
+        case <-done:
             return
         case <-ticker.C:
+            metrics.GeneratorTicks.WithLabelValues(streamPump).Inc()
             dg.generatePumpDataForAllBuildings()
         }
     }
 }
 
 // Уведомления о новых данных (для веб-сокетов)
-func (dg *DataGenerator) startRealtimeUpdates() {
+func (dg *DataGenerator) startRealtimeUpdates(done <-chan struct{}) {
     ticker := time.NewTicker(10 * time.Second)
     defer ticker.Stop()
 
     for {
         select {
-        case <-dg.ctx.Done():
+        case <-done:
             return
         case <-ticker.C:
+            metrics.GeneratorTicks.WithLabelValues(streamBroadcast).Inc()
             dg.broadcastDataUpdate()
         }
     }
@@ -124,7 +227,7 @@ func (dg *DataGenerator) startRealtimeUpdates() {
 func (dg *DataGenerator) generateWaterData() {
     buildings, err := dg.getBuildings()
     if err != nil {
-        fmt.Printf("Error getting buildings: %v\n", err)
+        dg.reportError(streamWater, "get buildings", err)
         return
     }
 
@@ -150,43 +253,55 @@ func (dg *DataGenerator) generateWaterData() {
             dailyMultiplier = 1.1
         }
 
-        hotWater1 := int(baseHotWater1 * dailyMultiplier)
-        hotWater2 := int(baseHotWater2 * dailyMultiplier)
-        coldWater := int(baseColdWater * dailyMultiplier)
+        hotWater1 := models.RoundFlow(baseHotWater1 * dailyMultiplier)
+        hotWater2 := models.RoundFlow(baseHotWater2 * dailyMultiplier)
+        coldWater := models.RoundFlow(baseColdWater * dailyMultiplier)
 
-        // Данные ГВС
-        _, err := dg.pool.Exec(dg.ctx, `
-            INSERT INTO hot_water_meters (id, building_id, flow_rate_ch1, flow_rate_ch2, timestamp, created_at)
-            VALUES ($1, $2, $3, $4, $5, NOW())`,
-            uuid.New(), building.ID, hotWater1, hotWater2, currentTime)
-        
+        itps, err := dg.getITPsForBuilding(dg.ctx, building.ID)
         if err != nil {
-            fmt.Printf("Error inserting hot water data: %v\n", err)
+            dg.reportError(streamWater, "get ITPs", err, "building_id", building.ID)
             continue
         }
 
-        // Данные ХВС
-        itpID, err := dg.getITPForBuilding(building.ID)
-        if err == nil {
+        // Данные ГВС: расход здания делится между ОДПУ
+        meterKeys := hotWaterMeterKeys(itps)
+        share := 1 / float64(len(meterKeys))
+        for _, meterKey := range meterKeys {
+            _, err := dg.pool.Exec(dg.ctx, `
+                INSERT INTO hot_water_meters (id, building_id, meter_key, flow_rate_ch1, flow_rate_ch2, timestamp, created_at, meter_id)
+                VALUES ($1, $2, $3, $4, $5, $6, NOW(), reading_meter($2, NULLIF($3, '')::uuid, 'hot_water', $6))`,
+                uuid.New(), building.ID, meterKey, models.RoundFlow(hotWater1*share), models.RoundFlow(hotWater2*share), currentTime)
+
+            if err != nil {
+                dg.reportError(streamWater, "insert hot water data", err, "building_id", building.ID)
+                continue
+            }
+            metrics.AddReadings(metrics.TableHotWater, metrics.SourceGenerator, 1)
+        }
+
+        // Данные ХВС по каждому ИТП
+        for _, itpID := range itps {
             _, err = dg.pool.Exec(dg.ctx, `
-                INSERT INTO cold_water_meters (id, itp_id, flow_rate, timestamp, created_at)
-                VALUES ($1, $2, $3, $4, NOW())`,
-                uuid.New(), itpID, coldWater, currentTime)
+                INSERT INTO cold_water_meters (id, itp_id, flow_rate, timestamp, created_at, meter_id)
+                VALUES ($1, $2, $3, $4, NOW(), reading_meter(NULL, $2, 'cold_water', $4))`,
+                uuid.New(), itpID, models.RoundFlow(coldWater/float64(len(itps))), currentTime)
             
             if err != nil {
-                fmt.Printf("Error inserting cold water data: %v\n", err)
+                dg.reportError(streamWater, "insert cold water data", err, "building_id", building.ID)
+            } else {
+                metrics.AddReadings(metrics.TableColdWater, metrics.SourceGenerator, 1)
             }
         }
     }
 
-    fmt.Printf("💧 Water data generated for %d buildings at %s\n", len(buildings), currentTime.Format("15:04:05"))
+    dg.log.Debug("water data generated", "buildings", len(buildings))
 }
 
 // Генерация температурных данных для всех зданий
 func (dg *DataGenerator) generateTemperatureDataForAllBuildings() {
     buildings, err := dg.getBuildings()
     if err != nil {
-        fmt.Printf("Error getting buildings: %v\n", err)
+        dg.reportError(streamTemperature, "get buildings", err)
         return
     }
 
@@ -195,7 +310,7 @@ func (dg *DataGenerator) generateTemperatureDataForAllBuildings() {
     for _, building := range buildings {
         // Реалистичные температурные данные с сезонными колебаниями
         month := currentTime.Month()
-        var seasonalAdjustment int
+        var seasonalAdjustment float64
         
         switch month {
         case time.December, time.January, time.February: // Зима
@@ -206,28 +321,30 @@ func (dg *DataGenerator) generateTemperatureDataForAllBuildings() {
             seasonalAdjustment = 0
         }
 
-        supplyTemp := 65 + seasonalAdjustment + rand.Intn(5)    // 65-70°C ± сезонная корректировка
-        returnTemp := 42 + seasonalAdjustment/2 + rand.Intn(4)  // 42-46°C
-        deltaTemp := supplyTemp - returnTemp
+        supplyTemp := models.RoundTemp(65 + seasonalAdjustment + rand.Float64()*5)    // 65-70°C ± сезонная корректировка
+        returnTemp := models.RoundTemp(42 + seasonalAdjustment/2 + rand.Float64()*4)  // 42-46°C
+        deltaTemp := models.RoundTemp(supplyTemp - returnTemp)
 
         _, err := dg.pool.Exec(dg.ctx, `
-            INSERT INTO temperature_readings (id, building_id, supply_temp, return_temp, delta_temp, timestamp, created_at)
-            VALUES ($1, $2, $3, $4, $5, $6, NOW())`,
+            INSERT INTO temperature_readings (id, building_id, supply_temp, return_temp, delta_temp, timestamp, created_at, meter_id)
+            VALUES ($1, $2, $3, $4, $5, $6, NOW(), reading_meter($2, NULL, 'temperature', $6))`,
             uuid.New(), building.ID, supplyTemp, returnTemp, deltaTemp, currentTime)
         
         if err != nil {
-            fmt.Printf("Error inserting temperature data: %v\n", err)
+            dg.reportError(streamTemperature, "insert temperature data", err, "building_id", building.ID)
+        } else {
+            metrics.AddReadings(metrics.TableTemperature, metrics.SourceGenerator, 1)
         }
     }
 
-    fmt.Printf("Temperature data generated for %d buildings at %s\n", len(buildings), currentTime.Format("15:04:05"))
+    dg.log.Debug("temperature data generated", "buildings", len(buildings))
 }
 
 // Генерация данных насосов для всех зданий
 func (dg *DataGenerator) generatePumpDataForAllBuildings() {
     buildings, err := dg.getBuildings()
     if err != nil {
-        fmt.Printf("Error getting buildings: %v\n", err)
+        dg.reportError(streamPump, "get buildings", err)
         return
     }
 
@@ -265,24 +382,26 @@ func (dg *DataGenerator) generatePumpDataForAllBuildings() {
                 pressureInput, pressureOutput, vibrationLevel, currentTime)
             
             if err != nil {
-                fmt.Printf("Error inserting pump data: %v\n", err)
+                dg.reportError(streamPump, "insert pump data", err, "building_id", building.ID)
+            } else {
+                metrics.AddReadings(metrics.TablePump, metrics.SourceGenerator, 1)
             }
         }
     }
 
-    fmt.Printf("Pump data generated for %d buildings at %s\n", len(buildings), currentTime.Format("15:04:05"))
+    dg.log.Debug("pump data generated", "buildings", len(buildings))
 }
 
 // Уведомление о новых данных (заглушка для веб-сокетов)
 func (dg *DataGenerator) broadcastDataUpdate() {
     // Здесь будет логика для веб-сокетов
     // Пока просто логируем
-    fmt.Printf("Data update broadcast at %s\n", time.Now().Format("15:04:05"))
+    dg.log.Debug("data update broadcast")
 }
 
 // Вспомогательные методы
 func (dg *DataGenerator) getBuildings() ([]Building, error) {
-    rows, err := dg.pool.Query(dg.ctx, "SELECT id, address, created_at FROM buildings")
+    rows, err := dg.pool.Query(dg.ctx, "SELECT id, address, organization_id, created_at FROM buildings")
     if err != nil {
         return nil, err
     }
@@ -291,7 +410,7 @@ func (dg *DataGenerator) getBuildings() ([]Building, error) {
     var buildings []Building
     for rows.Next() {
         var b Building
-        err := rows.Scan(&b.ID, &b.Address, &b.CreatedAt)
+        err := rows.Scan(&b.ID, &b.Address, &b.OrganizationID, &b.CreatedAt)
         if err != nil {
             continue
         }
@@ -301,18 +420,33 @@ func (dg *DataGenerator) getBuildings() ([]Building, error) {
     return buildings, nil
 }
 
-func (dg *DataGenerator) getITPForBuilding(buildingID uuid.UUID) (uuid.UUID, error) {
-    var itpID uuid.UUID
-    err := dg.pool.QueryRow(dg.ctx, 
-        "SELECT id FROM itp WHERE building_id = $1 LIMIT 1", buildingID).Scan(&itpID)
-    return itpID, err
+// ИТП здания в порядке номеров
+func (dg *DataGenerator) getITPsForBuilding(ctx context.Context, buildingID uuid.UUID) ([]uuid.UUID, error) {
+    rows, err := dg.pool.Query(ctx, "SELECT id FROM itp WHERE building_id = $1 ORDER BY itp_number", buildingID)
+    if err != nil {
+        return nil, err
+    }
+    return pgx.CollectRows(rows, pgx.RowTo[uuid.UUID])
+}
+
+// ОДПУ ГВС здания: при нескольких ИТП - по счетчику на каждом ИТП, иначе один счетчик здания
+func hotWaterMeterKeys(itps []uuid.UUID) []string {
+    if len(itps) < 2 {
+        return []string{""}
+    }
+    keys := make([]string, 0, len(itps))
+    for _, itpID := range itps {
+        keys = append(keys, itpID.String())
+    }
+    return keys
 }
 
 // Структура для зданий
 type Building struct {
-    ID        uuid.UUID
-    Address   string
-    CreatedAt time.Time
+    ID             uuid.UUID
+    Address        string
+    OrganizationID *uuid.UUID
+    CreatedAt      time.Time
 }
 
 // Старые методы для обратной совместимости
@@ -350,24 +484,29 @@ func (dg *DataGenerator) GenerateCompleteHistoricalData(ctx context.Context, day
 
     baseTime := time.Now().AddDate(0, 0, -days)
     
-    fmt.Printf("Generating complete historical data for %d buildings over %d days...\n", len(buildingIDs), days)
+    dg.log.InfoContext(ctx, "generating historical data", "buildings", len(buildingIDs), "days", days)
     
     for _, buildingID := range buildingIDs {
-        // Получаем ITP для здания
-        var itpID uuid.UUID
-        err = dg.pool.QueryRow(ctx, "SELECT id FROM itp WHERE building_id = $1 LIMIT 1", buildingID).Scan(&itpID)
+        // Получаем ITP здания
+        itps, err := dg.getITPsForBuilding(ctx, buildingID)
         if err != nil {
+            dg.reportError(streamHistory, "get ITPs", err, "building_id", buildingID)
+            continue
+        }
+        if len(itps) == 0 {
             // Создаем ITP если нет
-            itpID = uuid.New()
+            itpID := uuid.New()
             _, err = dg.pool.Exec(ctx, `
                 INSERT INTO itp (id, itp_number, building_id, created_at, updated_at)
                 VALUES ($1, $2, $3, NOW(), NOW())`,
                 itpID, fmt.Sprintf("ИТП-%s", buildingID.String()[:8]), buildingID)
             if err != nil {
-                fmt.Printf("Error creating ITP: %v\n", err)
+                dg.reportError(streamHistory, "create ITP", err, "building_id", buildingID)
                 continue
             }
+            itps = []uuid.UUID{itpID}
         }
+        meterKeys := hotWaterMeterKeys(itps)
 
         // Генерируем данные за каждый день
         for i := 0; i < days; i++ {
@@ -378,43 +517,54 @@ func (dg *DataGenerator) GenerateCompleteHistoricalData(ctx context.Context, day
                 currentTime := currentDay.Add(time.Duration(hour) * time.Hour)
 
                 // Водные данные
-                hotWaterFlow1 := 2 + rand.Intn(4)
-                hotWaterFlow2 := 1 + rand.Intn(3)
-                coldWaterFlow := 3 + rand.Intn(7)
-
-                // Данные ГВС
-                _, err = dg.pool.Exec(ctx, `
-                    INSERT INTO hot_water_meters (id, building_id, flow_rate_ch1, flow_rate_ch2, timestamp, created_at)
-                    VALUES ($1, $2, $3, $4, $5, NOW())`,
-                    uuid.New(), buildingID, hotWaterFlow1, hotWaterFlow2, currentTime)
-                
-                if err != nil {
-                    fmt.Printf("Error inserting hot water data: %v\n", err)
+                hotWaterFlow1 := models.RoundFlow(2 + rand.Float64()*3)
+                hotWaterFlow2 := models.RoundFlow(1 + rand.Float64()*2)
+                coldWaterFlow := models.RoundFlow(3 + rand.Float64()*6)
+
+                // Данные ГВС: расход здания делится между ОДПУ
+                share := 1 / float64(len(meterKeys))
+                for _, meterKey := range meterKeys {
+                    _, err = dg.pool.Exec(ctx, `
+                        INSERT INTO hot_water_meters (id, building_id, meter_key, flow_rate_ch1, flow_rate_ch2, timestamp, created_at, meter_id)
+                        VALUES ($1, $2, $3, $4, $5, $6, NOW(), reading_meter($2, NULLIF($3, '')::uuid, 'hot_water', $6))`,
+                        uuid.New(), buildingID, meterKey, models.RoundFlow(hotWaterFlow1*share), models.RoundFlow(hotWaterFlow2*share), currentTime)
+
+                    if err != nil {
+                        dg.reportError(streamHistory, "insert hot water data", err, "building_id", buildingID)
+                    } else {
+                        metrics.AddReadings(metrics.TableHotWater, metrics.SourceHistory, 1)
+                    }
                 }
 
-                // Данные ХВС
-                _, err = dg.pool.Exec(ctx, `
-                    INSERT INTO cold_water_meters (id, itp_id, flow_rate, timestamp, created_at)
-                    VALUES ($1, $2, $3, $4, NOW())`,
-                    uuid.New(), itpID, coldWaterFlow, currentTime)
-                
-                if err != nil {
-                    fmt.Printf("Error inserting cold water data: %v\n", err)
+                // Данные ХВС по каждому ИТП
+                for _, itpID := range itps {
+                    _, err = dg.pool.Exec(ctx, `
+                        INSERT INTO cold_water_meters (id, itp_id, flow_rate, timestamp, created_at, meter_id)
+                        VALUES ($1, $2, $3, $4, NOW(), reading_meter(NULL, $2, 'cold_water', $4))`,
+                        uuid.New(), itpID, models.RoundFlow(coldWaterFlow/float64(len(itps))), currentTime)
+
+                    if err != nil {
+                        dg.reportError(streamHistory, "insert cold water data", err, "building_id", buildingID)
+                    } else {
+                        metrics.AddReadings(metrics.TableColdWater, metrics.SourceHistory, 1)
+                    }
                 }
             }
 
             // Температурные данные (раз в день)
-            supplyTemp := 65 + rand.Intn(5)
-            returnTemp := 42 + rand.Intn(4)
-            deltaTemp := supplyTemp - returnTemp
+            supplyTemp := models.RoundTemp(65 + rand.Float64()*5)
+            returnTemp := models.RoundTemp(42 + rand.Float64()*4)
+            deltaTemp := models.RoundTemp(supplyTemp - returnTemp)
             
             _, err = dg.pool.Exec(ctx, `
-                INSERT INTO temperature_readings (id, building_id, supply_temp, return_temp, delta_temp, timestamp, created_at)
-                VALUES ($1, $2, $3, $4, $5, $6, NOW())`,
+                INSERT INTO temperature_readings (id, building_id, supply_temp, return_temp, delta_temp, timestamp, created_at, meter_id)
+                VALUES ($1, $2, $3, $4, $5, $6, NOW(), reading_meter($2, NULL, 'temperature', $6))`,
                 uuid.New(), buildingID, supplyTemp, returnTemp, deltaTemp, currentDay)
             
             if err != nil {
-                fmt.Printf("Error inserting temperature data: %v\n", err)
+                dg.reportError(streamHistory, "insert temperature data", err, "building_id", buildingID)
+            } else {
+                metrics.AddReadings(metrics.TableTemperature, metrics.SourceHistory, 1)
             }
 
             // Данные насосов (раз в день)
@@ -440,13 +590,15 @@ func (dg *DataGenerator) GenerateCompleteHistoricalData(ctx context.Context, day
                     pressureInput, pressureOutput, vibrationLevel, currentDay)
                 
                 if err != nil {
-                    fmt.Printf("Error inserting pump data: %v\n", err)
+                    dg.reportError(streamHistory, "insert pump data", err, "building_id", buildingID)
+                } else {
+                    metrics.AddReadings(metrics.TablePump, metrics.SourceHistory, 1)
                 }
             }
         }
     }
 
-    fmt.Printf("Complete historical data generation completed for %d days\n", days)
+    dg.log.InfoContext(ctx, "historical data generation completed", "days", days)
     return nil
 }
 
@@ -461,7 +613,7 @@ func (dg *DataGenerator) GenerateHistoricalData(ctx context.Context, days int) e
 func (dg *DataGenerator) generateRealtimeData() {
     buildings, err := dg.getBuildings()
     if err != nil {
-        fmt.Printf("Error getting buildings for realtime: %v\n", err)
+        dg.reportError(streamRealtime, "get buildings", err)
         return
     }
 
@@ -490,78 +642,103 @@ func (dg *DataGenerator) generateRealtimeData() {
         baseColdWater := (baseHotWater1 + baseHotWater2) * 1.3 // ХВС всегда больше ГВС
 
         // Применяем суточный коэффициент
-        hotWater1 := int(baseHotWater1 * activityMultiplier)
-        hotWater2 := int(baseHotWater2 * activityMultiplier)
-        coldWater := int(baseColdWater * activityMultiplier)
+        hotWater1 := models.RoundFlow(baseHotWater1 * activityMultiplier)
+        hotWater2 := models.RoundFlow(baseHotWater2 * activityMultiplier)
+        coldWater := models.RoundFlow(baseColdWater * activityMultiplier)
 
-        // Данные ГВС
-        _, err := dg.pool.Exec(dg.ctx, `
-            INSERT INTO hot_water_meters (id, building_id, flow_rate_ch1, flow_rate_ch2, timestamp, created_at)
-            VALUES ($1, $2, $3, $4, $5, NOW())`,
-            uuid.New(), building.ID, hotWater1, hotWater2, currentTime)
-        
+        itps, err := dg.getITPsForBuilding(dg.ctx, building.ID)
         if err != nil {
-            fmt.Printf("Error inserting realtime hot water data: %v\n", err)
+            dg.reportError(streamRealtime, "get ITPs", err, "building_id", building.ID)
             continue
         }
 
-        // Данные ХВС
-        itpID, err := dg.getITPForBuilding(building.ID)
-        if err == nil {
+        // Данные ГВС: расход здания делится между ОДПУ
+        meterKeys := hotWaterMeterKeys(itps)
+        share := 1 / float64(len(meterKeys))
+        written := 0
+        for _, meterKey := range meterKeys {
+            _, err := dg.pool.Exec(dg.ctx, `
+                INSERT INTO hot_water_meters (id, building_id, meter_key, flow_rate_ch1, flow_rate_ch2, timestamp, created_at, meter_id)
+                VALUES ($1, $2, $3, $4, $5, $6, NOW(), reading_meter($2, NULLIF($3, '')::uuid, 'hot_water', $6))`,
+                uuid.New(), building.ID, meterKey, models.RoundFlow(hotWater1*share), models.RoundFlow(hotWater2*share), currentTime)
+
+            if err != nil {
+                dg.reportError(streamRealtime, "insert hot water data", err, "building_id", building.ID)
+                continue
+            }
+            metrics.AddReadings(metrics.TableHotWater, metrics.SourceGenerator, 1)
+            written++
+        }
+        if written == 0 {
+            continue
+        }
+
+        // В обновление попадают только записанные показания
+        update := gin.H{
+            "hot_water": gin.H{
+                "flow_rate_ch1": hotWater1,
+                "flow_rate_ch2": hotWater2,
+                "timestamp":     currentTime,
+            },
+            "cold_water":  nil,
+            "temperature": nil,
+            "building_id": building.ID,
+            "timestamp":   currentTime,
+        }
+
+        // Данные ХВС по каждому ИТП
+        for _, itpID := range itps {
             _, err = dg.pool.Exec(dg.ctx, `
-                INSERT INTO cold_water_meters (id, itp_id, flow_rate, timestamp, created_at)
-                VALUES ($1, $2, $3, $4, NOW())`,
-                uuid.New(), itpID, coldWater, currentTime)
+                INSERT INTO cold_water_meters (id, itp_id, flow_rate, timestamp, created_at, meter_id)
+                VALUES ($1, $2, $3, $4, NOW(), reading_meter(NULL, $2, 'cold_water', $4))`,
+                uuid.New(), itpID, models.RoundFlow(coldWater/float64(len(itps))), currentTime)
             
             if err != nil {
-                fmt.Printf("Error inserting realtime cold water data: %v\n", err)
+                dg.reportError(streamRealtime, "insert cold water data", err, "building_id", building.ID)
+            } else {
+                metrics.AddReadings(metrics.TableColdWater, metrics.SourceGenerator, 1)
+                update["cold_water"] = gin.H{
+                    "total_flow_rate": coldWater,
+                    "timestamp":       currentTime,
+                }
             }
         }
 
         // Температурные данные (реже - раз в 2 минуты)
         if currentTime.Minute()%2 == 0 { // Каждую четную минуту
-            supplyTemp := 65 + rand.Intn(5)
-            returnTemp := 42 + rand.Intn(4)
-            deltaTemp := supplyTemp - returnTemp
+            supplyTemp := models.RoundTemp(65 + rand.Float64()*5)
+            returnTemp := models.RoundTemp(42 + rand.Float64()*4)
+            deltaTemp := models.RoundTemp(supplyTemp - returnTemp)
 
             _, err = dg.pool.Exec(dg.ctx, `
-                INSERT INTO temperature_readings (id, building_id, supply_temp, return_temp, delta_temp, timestamp, created_at)
-                VALUES ($1, $2, $3, $4, $5, $6, NOW())`,
+                INSERT INTO temperature_readings (id, building_id, supply_temp, return_temp, delta_temp, timestamp, created_at, meter_id)
+                VALUES ($1, $2, $3, $4, $5, $6, NOW(), reading_meter($2, NULL, 'temperature', $6))`,
                 uuid.New(), building.ID, supplyTemp, returnTemp, deltaTemp, currentTime)
             
             if err != nil {
-                fmt.Printf("Error inserting realtime temperature data: %v\n", err)
+                dg.reportError(streamRealtime, "insert temperature data", err, "building_id", building.ID)
+            } else {
+                metrics.AddReadings(metrics.TableTemperature, metrics.SourceGenerator, 1)
+                update["temperature"] = gin.H{
+                    "supply_temp": supplyTemp,
+                    "return_temp": returnTemp,
+                    "delta_temp":  deltaTemp,
+                    "timestamp":   currentTime,
+                }
             }
         }
 
         // Отправляем обновление через WebSocket
-        dg.broadcastRealtimeUpdate(building.ID, gin.H{
-            "hot_water": gin.H{
-                "flow_rate_ch1": hotWater1,
-                "flow_rate_ch2": hotWater2,
-                "timestamp":     currentTime,
-            },
-            "cold_water": gin.H{
-                "total_flow_rate": coldWater,
-                "timestamp":       currentTime,
-            },
-            "temperature": gin.H{
-                "supply_temp": 65 + rand.Intn(5),
-                "return_temp": 42 + rand.Intn(4),
-                "delta_temp":  23,
-                "timestamp":   currentTime,
-            },
-            "building_id": building.ID,
-            "timestamp":   currentTime,
-        })
+        dg.broadcastRealtimeUpdate(building, update)
     }
 
-    fmt.Printf("Realtime data generated for %d buildings at %s\n", 
-        len(buildings), currentTime.Format("15:04:05"))
+    dg.log.Debug("realtime data generated", "buildings", len(buildings))
 }
 
 // WebSocket broadcast для реального времени
-func (dg *DataGenerator) broadcastRealtimeUpdate(buildingID uuid.UUID, data interface{}) {
-    // Этот метод будет интегрирован с main.go через канал
-    fmt.Printf("📡 Broadcasting update for building %s\n", buildingID.String())
+func (dg *DataGenerator) broadcastRealtimeUpdate(building Building, data interface{}) {
+    dg.log.Debug("broadcasting realtime update", "building_id", building.ID)
+    if dg.OnRealtimeUpdate != nil {
+        dg.OnRealtimeUpdate(building.ID, building.OrganizationID, data)
+    }
 }
\ No newline at end of file
@@ -0,0 +1,170 @@
+package service
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "log/slog"
+    "time"
+
+    "service/internal/logging"
+    "service/internal/metrics"
+    "service/internal/models"
+
+    "github.com/google/uuid"
+    "github.com/jackc/pgx/v5"
+    "github.com/jackc/pgx/v5/pgxpool"
+)
+
+var ErrITPNotFound = errors.New("itp not found")
+
+// Ingestor - запись показаний, поступающих от систем телеметрии.
+// Повторно присланные показания (то же здание/ИТП и время) игнорируются
+// и учитываются в ingest_duplicates для проверки качества данных
+type Ingestor struct {
+    pool *pgxpool.Pool
+    log  *slog.Logger
+}
+
+func NewIngestor(pool *pgxpool.Pool) *Ingestor {
+    return &Ingestor{pool: pool, log: logging.Component("ingest")}
+}
+
+// Счетчик и время показания; по нему учитываются отброшенные повторы
+type readingKey struct {
+    buildingID uuid.UUID
+    source     string
+    meterKey   string
+    timestamp  time.Time
+}
+
+// Здание, к которому относится ИТП
+func (in *Ingestor) ITPBuilding(ctx context.Context, itpID uuid.UUID) (uuid.UUID, error) {
+    var buildingID uuid.UUID
+    err := in.pool.QueryRow(ctx, "SELECT building_id FROM itp WHERE id = $1", itpID).Scan(&buildingID)
+    if errors.Is(err, pgx.ErrNoRows) {
+        return uuid.Nil, ErrITPNotFound
+    }
+    return buildingID, err
+}
+
+// Показания ОДПУ ГВС. MeterKey - ИТП счетчика, если в здании их несколько
+func (in *Ingestor) InsertHotWater(ctx context.Context, readings []models.HotWaterMeter) (int, error) {
+    batch := &pgx.Batch{}
+    keys := make([]readingKey, 0, len(readings))
+    for _, r := range readings {
+        keys = append(keys, readingKey{r.BuildingID, "hot_water", r.MeterKey, r.Timestamp})
+        batch.Queue(`
+            INSERT INTO hot_water_meters (id, building_id, meter_key, flow_rate_ch1, flow_rate_ch2, timestamp, created_at, meter_id)
+            VALUES ($1, $2, $3, $4, $5, $6, NOW(), reading_meter($2, NULLIF($3, '')::uuid, 'hot_water', $6))
+            ON CONFLICT (building_id, meter_key, timestamp) DO NOTHING`,
+            uuid.New(), r.BuildingID, r.MeterKey, r.FlowRateCh1, r.FlowRateCh2, r.Timestamp)
+    }
+    return in.sendBatch(ctx, batch, keys, "hot water", metrics.TableHotWater)
+}
+
+// Показания счетчиков ХВС в ИТП. buildings - здания ИТП, уже известные вызывающему
+func (in *Ingestor) InsertColdWater(ctx context.Context, readings []models.ColdWaterMeter, buildings map[uuid.UUID]uuid.UUID) (int, error) {
+    batch := &pgx.Batch{}
+    keys := make([]readingKey, 0, len(readings))
+    for _, r := range readings {
+        keys = append(keys, readingKey{buildings[r.ITPID], "cold_water", r.ITPID.String(), r.Timestamp})
+        batch.Queue(`
+            INSERT INTO cold_water_meters (id, itp_id, flow_rate, timestamp, created_at, meter_id)
+            VALUES ($1, $2, $3, $4, NOW(), reading_meter(NULL, $2, 'cold_water', $4))
+            ON CONFLICT (itp_id, timestamp) DO NOTHING`,
+            uuid.New(), r.ITPID, r.FlowRate, r.Timestamp)
+    }
+    return in.sendBatch(ctx, batch, keys, "cold water", metrics.TableColdWater)
+}
+
+// Температурные показания. ΔT рассчитывается, если не передана
+func (in *Ingestor) InsertTemperature(ctx context.Context, readings []models.TemperatureReading) (int, error) {
+    batch := &pgx.Batch{}
+    keys := make([]readingKey, 0, len(readings))
+    for _, r := range readings {
+        keys = append(keys, readingKey{r.BuildingID, "temperature", "", r.Timestamp})
+        if r.DeltaTemp == 0 {
+            r.DeltaTemp = models.RoundTemp(r.SupplyTemp - r.ReturnTemp)
+        }
+        batch.Queue(`
+            INSERT INTO temperature_readings (id, building_id, supply_temp, return_temp, delta_temp, timestamp, created_at, meter_id)
+            VALUES ($1, $2, $3, $4, $5, $6, NOW(), reading_meter($2, NULL, 'temperature', $6))
+            ON CONFLICT (building_id, timestamp) DO NOTHING`,
+            uuid.New(), r.BuildingID, r.SupplyTemp, r.ReturnTemp, r.DeltaTemp, r.Timestamp)
+    }
+    return in.sendBatch(ctx, batch, keys, "temperature", metrics.TableTemperature)
+}
+
+// Данные насосов
+func (in *Ingestor) InsertPumpData(ctx context.Context, readings []models.PumpData) (int, error) {
+    batch := &pgx.Batch{}
+    keys := make([]readingKey, 0, len(readings))
+    for _, r := range readings {
+        keys = append(keys, readingKey{r.BuildingID, "pump", r.PumpNumber, r.Timestamp})
+        batch.Queue(`
+            INSERT INTO pump_data (id, building_id, pump_number, status, operating_hours,
+                                 pressure_input, pressure_output, vibration_level, timestamp, created_at)
+            VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, NOW())
+            ON CONFLICT (building_id, pump_number, timestamp) DO NOTHING`,
+            uuid.New(), r.BuildingID, r.PumpNumber, r.Status, r.OperatingHours,
+            r.PressureInput, r.PressureOutput, r.VibrationLevel, r.Timestamp)
+    }
+    return in.sendBatch(ctx, batch, keys, "pump", metrics.TablePump)
+}
+
+// Выполнение пакета вставок, возвращает число реально добавленных строк.
+// Пакет выполняется в одной транзакции, поэтому метрика учитывается только при успехе.
+// keys - счетчик и время каждой вставки в порядке пакета
+func (in *Ingestor) sendBatch(ctx context.Context, batch *pgx.Batch, keys []readingKey, kind, table string) (int, error) {
+    results := in.pool.SendBatch(ctx, batch)
+
+    inserted := 0
+    var duplicates []readingKey
+    for i := 0; i < batch.Len(); i++ {
+        tag, err := results.Exec()
+        if err != nil {
+            results.Close()
+            return inserted, fmt.Errorf("insert %s reading %d: %w", kind, i, err)
+        }
+        if tag.RowsAffected() == 0 {
+            duplicates = append(duplicates, keys[i])
+        }
+        inserted += int(tag.RowsAffected())
+    }
+    if err := results.Close(); err != nil {
+        return inserted, fmt.Errorf("insert %s readings: %w", kind, err)
+    }
+
+    metrics.AddReadings(table, metrics.SourceIngest, inserted)
+    if len(duplicates) > 0 {
+        metrics.ReadingsDuplicates.WithLabelValues(table).Add(float64(len(duplicates)))
+        // Показания уже записаны, ошибка учета повторов на ответ не влияет
+        if err := in.recordDuplicates(ctx, duplicates); err != nil {
+            in.log.WarnContext(ctx, "record ingest duplicates failed", "kind", kind, logging.Err(err))
+        }
+    }
+    return inserted, nil
+}
+
+// Учет отброшенных повторов по часам
+func (in *Ingestor) recordDuplicates(ctx context.Context, keys []readingKey) error {
+    ids := make([]uuid.UUID, len(keys))
+    sources := make([]string, len(keys))
+    meterKeys := make([]string, len(keys))
+    timestamps := make([]time.Time, len(keys))
+    for i, k := range keys {
+        ids[i], sources[i], meterKeys[i], timestamps[i] = k.buildingID, k.source, k.meterKey, k.timestamp
+    }
+
+    _, err := in.pool.Exec(ctx, `
+        INSERT INTO ingest_duplicates (building_id, source, meter_key, hour, count)
+        SELECT d.building_id, d.source, d.meter_key,
+               date_trunc('hour', d.ts AT TIME ZONE 'UTC') AT TIME ZONE 'UTC', COUNT(*)
+        FROM unnest($1::uuid[], $2::text[], $3::text[], $4::timestamptz[]) AS d(building_id, source, meter_key, ts)
+        GROUP BY 1, 2, 3, 4
+        ON CONFLICT (building_id, source, meter_key, hour) DO UPDATE SET
+            count = ingest_duplicates.count + EXCLUDED.count`,
+        ids, sources, meterKeys, timestamps)
+    return err
+}
@@ -0,0 +1,60 @@
+package service
+
+import (
+    "fmt"
+    "math"
+
+    "service/internal/benchmark"
+)
+
+// Типовая норма соотношения ГВС/ХВС для МКД, %
+const (
+    normRatioMin = 40.0
+    normRatioMax = 70.0
+)
+
+// Отклонение от нормы, в пределах которого баланс оценивается как warning, п.п.
+const ratioWarningMargin = 10.0
+
+// Источник нормы соотношения ГВС/ХВС
+const (
+    NormDefault = "default" // типовая норма МКД
+    NormPeers   = "peers"   // по сопоставимым зданиям
+)
+
+// Норма соотношения ГВС/ХВС здания, %
+type RatioNorm struct {
+    Min       float64 `json:"min"`
+    Max       float64 `json:"max"`
+    Source    string  `json:"source"`
+    PeerGroup string  `json:"peer_group,omitempty"`
+    Peers     int     `json:"peers,omitempty"`
+}
+
+func defaultRatioNorm() RatioNorm {
+    return RatioNorm{Min: normRatioMin, Max: normRatioMax, Source: NormDefault}
+}
+
+// Норма здания по соотношению ГВС/ХВС сопоставимых зданий: 10-90 перцентили группы,
+// не уже типовой нормы вокруг медианы. При числе зданий группы меньше benchmark.MinPeers - типовая норма
+func ratioNorm(peers benchmark.PeerRatios, ok bool) RatioNorm {
+    if !ok || peers.Peers < benchmark.MinPeers {
+        return defaultRatioNorm()
+    }
+    half := (normRatioMax - normRatioMin) / 2
+    return RatioNorm{
+        Min:       math.Round(math.Max(math.Min(peers.P10, peers.Median-half), 0)*10) / 10,
+        Max:       math.Round(math.Min(math.Max(peers.P90, peers.Median+half), 100)*10) / 10,
+        Source:    NormPeers,
+        PeerGroup: peers.PeerGroup,
+        Peers:     peers.Peers,
+    }
+}
+
+// Норма в тексте рекомендаций, например "40-70%" или "45.2-78.0% по 12 сопоставимым зданиям"
+func (n RatioNorm) String() string {
+    if n.Source == NormPeers {
+        return fmt.Sprintf("%.1f-%.1f%% по %d сопоставимым зданиям", n.Min, n.Max, n.Peers)
+    }
+    return fmt.Sprintf("%.0f-%.0f%%", n.Min, n.Max)
+}
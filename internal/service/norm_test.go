@@ -0,0 +1,88 @@
+package service
+
+import (
+    "testing"
+
+    "service/internal/benchmark"
+)
+
+func TestRatioNorm(t *testing.T) {
+    peers := func(n int, p10, median, p90 float64) benchmark.PeerRatios {
+        return benchmark.PeerRatios{PeerGroup: "9-16/1981-2000", Peers: n, P10: p10, Median: median, P90: p90}
+    }
+    peerNorm := func(min, max float64, n int) RatioNorm {
+        return RatioNorm{Min: min, Max: max, Source: NormPeers, PeerGroup: "9-16/1981-2000", Peers: n}
+    }
+
+    tests := []struct {
+        name  string
+        peers benchmark.PeerRatios
+        ok    bool
+        want  RatioNorm
+    }{
+        {
+            name: "no peer group",
+            want: defaultRatioNorm(),
+        },
+        {
+            name:  "fewer than MinPeers",
+            peers: peers(benchmark.MinPeers-1, 20, 50, 90),
+            ok:    true,
+            want:  defaultRatioNorm(),
+        },
+        {
+            name:  "wide spread uses P10-P90",
+            peers: peers(benchmark.MinPeers, 30, 55, 85),
+            ok:    true,
+            want:  peerNorm(30, 85, benchmark.MinPeers),
+        },
+        {
+            name:  "narrow spread widened around median",
+            peers: peers(12, 50, 55, 58),
+            ok:    true,
+            want:  peerNorm(40, 70, 12),
+        },
+        {
+            name:  "widened on one side only",
+            peers: peers(8, 20, 45, 52),
+            ok:    true,
+            want:  peerNorm(20, 60, 8),
+        },
+        {
+            name:  "clamped at 0",
+            peers: peers(6, 5, 8, 12),
+            ok:    true,
+            want:  peerNorm(0, 23, 6),
+        },
+        {
+            name:  "clamped at 100",
+            peers: peers(6, 88, 92, 95),
+            ok:    true,
+            want:  peerNorm(77, 100, 6),
+        },
+        {
+            name:  "rounded to tenths",
+            peers: peers(7, 33.333, 60.06, 88.888),
+            ok:    true,
+            want:  peerNorm(33.3, 88.9, 7),
+        },
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            if got := ratioNorm(tt.peers, tt.ok); got != tt.want {
+                t.Errorf("ratioNorm() = %+v, want %+v", got, tt.want)
+            }
+        })
+    }
+}
+
+func TestRatioNormString(t *testing.T) {
+    if got := defaultRatioNorm().String(); got != "40-70%" {
+        t.Errorf("default norm = %q", got)
+    }
+    n := RatioNorm{Min: 45.2, Max: 78, Source: NormPeers, Peers: 12}
+    if got := n.String(); got != "45.2-78.0% по 12 сопоставимым зданиям" {
+        t.Errorf("peer norm = %q", got)
+    }
+}
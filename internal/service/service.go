@@ -3,19 +3,31 @@ package service
 import (
     "context"
     "fmt"
-    "math/rand"
+    "log/slog"
+    "math"
+    "strings"
     "time"
 
+    "service/internal/logging"
+    "service/internal/metrics"
+    "service/internal/models"
+    "service/internal/tariff"
+    "service/internal/timeseries"
+    "service/internal/tracing"
+
     "github.com/jackc/pgx/v5/pgxpool"
     "github.com/google/uuid"
+    "go.opentelemetry.io/otel/attribute"
+    "go.opentelemetry.io/otel/codes"
+    "go.opentelemetry.io/otel/trace"
 )
 
 type ConsumptionAnalysis struct {
     BuildingID           uuid.UUID `json:"building_id"`
     Period               string    `json:"period"`
-    TotalColdWater       int       `json:"total_cold_water"`
-    TotalHotWater        int       `json:"total_hot_water"`
-    Difference           int       `json:"difference"`
+    TotalColdWater       float64   `json:"total_cold_water"` // м³
+    TotalHotWater        float64   `json:"total_hot_water"`
+    Difference           float64   `json:"difference"`
     DifferencePercent    float64   `json:"difference_percent"`
     HotToColdRatio       float64   `json:"hot_to_cold_ratio"` // Новое поле: соотношение ГВС/ХВС в %
     HasAnomalies         bool      `json:"has_anomalies"`
@@ -26,19 +38,56 @@ type ConsumptionAnalysis struct {
     PumpOperatingHours   int       `json:"pump_operating_hours"`
     Recommendations      []string  `json:"recommendations"`
     DataSource           string    `json:"data_source"`
+    DataCoverage         float64   `json:"data_coverage"` // доля часов периода с показаниями
+    Missing              []string  `json:"missing,omitempty"` // данные, которых нет за период
     TemperatureData      *TemperatureData `json:"temperature_data,omitempty"`
     PumpData             *PumpAnalysis    `json:"pump_data,omitempty"`
+    Heat                 *HeatAnalysis    `json:"heat,omitempty"` // тепловая энергия ГВС
+    RatioNorm            RatioNorm        `json:"ratio_norm"` // норма соотношения ГВС/ХВС здания
+    Cost                 *CostEstimate    `json:"cost,omitempty"` // стоимость и потери по тарифу здания
+    ITPs                 []ITPBalance     `json:"itps,omitempty"` // баланс по каждому ИТП здания
+    UnassignedHotWater   float64          `json:"unassigned_hot_water,omitempty"` // ГВС по ОДПУ без привязки к ИТП, м³
+}
+
+// Баланс ХВС/ГВС одного ИТП. В здании с одним ИТП совпадает с балансом здания
+type ITPBalance struct {
+    ITPID              uuid.UUID `json:"itp_id"`
+    ITPNumber          string    `json:"itp_number"`
+    TotalColdWater     float64   `json:"total_cold_water"` // м³
+    TotalHotWater      float64   `json:"total_hot_water"`
+    Difference         float64   `json:"difference"`
+    HotToColdRatio     float64   `json:"hot_to_cold_ratio"` // %
+    WaterBalanceStatus string    `json:"water_balance_status"`
+    ImbalanceM3        float64   `json:"imbalance_m3,omitempty"` // объем вне нормы соотношения ГВС/ХВС
+    LossCost           float64   `json:"loss_cost,omitempty"`    // стоимость объема вне нормы за период, ₽
 }
 
+// Источник результата анализа
+const (
+    DataSourceDatabase     = "database"          // анализ по показаниям из БД
+    DataSourceInsufficient = "insufficient_data" // показаний ХВС/ГВС недостаточно, баланс не оценивается
+)
+
 type TemperatureData struct {
-    AvgSupplyTemp int     `json:"avg_supply_temp"`
-    AvgReturnTemp int     `json:"avg_return_temp"`
-    AvgDeltaTemp  int     `json:"avg_delta_temp"`
-    MinDeltaTemp  int     `json:"min_delta_temp"`
-    MaxDeltaTemp  int     `json:"max_delta_temp"`
+    AvgSupplyTemp float64 `json:"avg_supply_temp"` // °C
+    AvgReturnTemp float64 `json:"avg_return_temp"`
+    AvgDeltaTemp  float64 `json:"avg_delta_temp"`
+    MinDeltaTemp  float64 `json:"min_delta_temp"`
+    MaxDeltaTemp  float64 `json:"max_delta_temp"`
     RecordsCount  int     `json:"records_count"`
 }
 
+// Тепловая энергия ГВС за период: Q = V * ΔT * ρ * c по каждому показанию (см. представление readings_raw)
+type HeatAnalysis struct {
+    TotalGcal    float64 `json:"total_gcal"`
+    HotWaterM3   float64 `json:"hot_water_m3"`
+    SpecificHeat float64 `json:"specific_heat"` // удельный расход тепла, Гкал/м³ ГВС
+    CoveredShare float64 `json:"covered_share"` // доля показаний ГВС, для которых есть ΔT и рассчитана энергия
+}
+
+// Доля показаний ГВС с рассчитанной энергией, ниже которой удельный расход тепла занижен
+const minHeatCoverage = 0.9
+
 type PumpAnalysis struct {
     TotalPumps        int     `json:"total_pumps"`
     NormalPumps       int     `json:"normal_pumps"`
@@ -51,42 +100,148 @@ type PumpAnalysis struct {
 }
 
 type Analyzer struct {
-    pool *pgxpool.Pool
+    pool     *pgxpool.Pool
+    readings *timeseries.Reader
+    log      *slog.Logger
+    tracer   trace.Tracer
 }
 
-func NewAnalyzer(pool *pgxpool.Pool) *Analyzer {
-    return &Analyzer{pool: pool}
+func NewAnalyzer(pool *pgxpool.Pool, readings *timeseries.Reader) *Analyzer {
+    return &Analyzer{
+        pool:     pool,
+        readings: readings,
+        log:      logging.Component("analyzer"),
+        tracer:   tracing.Tracer("analyzer"),
+    }
 }
 
+// Завершение спана этапа анализа с отметкой ошибки
+func endSpan(span trace.Span, err error) {
+    if err != nil {
+        span.RecordError(err)
+        span.SetStatus(codes.Error, err.Error())
+    }
+    span.End()
+}
+
+// Анализ потребления одного здания
 func (a *Analyzer) AnalyzeConsumption(ctx context.Context, buildingID uuid.UUID, days int) (*ConsumptionAnalysis, error) {
+    results, err := a.AnalyzeBuildings(ctx, []uuid.UUID{buildingID}, days)
+    if err != nil {
+        return nil, err
+    }
+    return results[buildingID], nil
+}
+
+// Пакетный анализ: данные всех зданий загружаются за один обмен с БД
+// (для сводки по всему парку зданий)
+func (a *Analyzer) AnalyzeBuildings(ctx context.Context, buildingIDs []uuid.UUID, days int) (results map[uuid.UUID]*ConsumptionAnalysis, err error) {
+    attrs := []attribute.KeyValue{
+        attribute.Int("analysis.buildings", len(buildingIDs)),
+        attribute.Int("analysis.days", days),
+    }
+    if len(buildingIDs) == 1 {
+        attrs = append(attrs, attribute.String("building.id", buildingIDs[0].String()))
+    }
+    ctx, span := a.tracer.Start(ctx, "analysis", trace.WithAttributes(attrs...))
+
+    defer func(start time.Time) {
+        endSpan(span, err)
+
+        result := "ok"
+        if err != nil {
+            result = "error"
+        }
+        metrics.AnalysisDuration.WithLabelValues(result).Observe(time.Since(start).Seconds())
+
+        if err != nil {
+            a.log.ErrorContext(ctx, "analysis failed", "buildings", len(buildingIDs), "days", days, logging.Err(err))
+            return
+        }
+        a.log.DebugContext(ctx, "analysis completed",
+            "buildings", len(buildingIDs),
+            "days", days,
+            "duration", time.Since(start))
+    }(time.Now())
+
     endDate := time.Now()
     startDate := endDate.AddDate(0, 0, -days)
 
-    // Получаем все данные из БД
-    totalColdWater, totalHotWater, coldRecords, hotRecords, hasWaterData, err := a.getWaterDataFromDB(ctx, buildingID, startDate, endDate)
+    // Агрегаты показаний и состояние насосов всех зданий одним пакетом запросов
+    stageCtx, stage := a.tracer.Start(ctx, "analysis.fetch")
+    data, err := a.fetchAnalysisData(stageCtx, buildingIDs, startDate, endDate)
+    endSpan(stage, err)
     if err != nil {
-        return nil, fmt.Errorf("get water data from DB: %w", err)
+        return nil, err
     }
 
-    // Получаем температурные данные из БД
-    tempData, hasTempData, err := a.getTemperatureData(ctx, buildingID, startDate, endDate)
-    if err != nil {
-        return nil, fmt.Errorf("get temperature data from DB: %w", err)
+    // Этапы обработки загруженных данных - отдельные спаны, каждый по всем зданиям
+    stages := make(map[uuid.UUID]*buildingStages, len(buildingIDs))
+    _, stage = a.tracer.Start(ctx, "analysis.water")
+    for _, buildingID := range buildingIDs {
+        stages[buildingID] = a.waterStage(data[buildingID], startDate, endDate)
     }
+    stage.End()
 
-    // Получаем данные насосов из БД
-    pumpData, hasPumpData, err := a.getPumpData(ctx, buildingID, startDate, endDate)
-    if err != nil {
-        return nil, fmt.Errorf("get pump data from DB: %w", err)
+    _, stage = a.tracer.Start(ctx, "analysis.temperature")
+    for _, buildingID := range buildingIDs {
+        st := stages[buildingID]
+        st.tempData, st.hasTempData = data[buildingID].temperature()
     }
+    stage.End()
+
+    _, stage = a.tracer.Start(ctx, "analysis.pump")
+    for _, buildingID := range buildingIDs {
+        st := stages[buildingID]
+        st.pumpData, st.hasPumpData = data[buildingID].pumpAnalysis()
+    }
+    stage.End()
+
+    _, stage = a.tracer.Start(ctx, "analysis.recommendations")
+    defer stage.End()
+
+    results = make(map[uuid.UUID]*ConsumptionAnalysis, len(buildingIDs))
+    for _, buildingID := range buildingIDs {
+        results[buildingID] = a.analyzeBuilding(buildingID, data[buildingID], stages[buildingID], days, startDate, endDate)
+    }
+    return results, nil
+}
+
+// Результаты этапов анализа здания: баланс воды (в том числе по ИТП), температура и насосы
+type buildingStages struct {
+    totalColdWater, totalHotWater float64
+    coldRecords, hotRecords       int
+    hasWaterData                  bool
+    itps                          []ITPBalance
+    unassignedHotWater            float64
+    tempData                      *TemperatureData
+    hasTempData                   bool
+    pumpData                      *PumpAnalysis
+    hasPumpData                   bool
+}
+
+// Баланс ХВС/ГВС здания и каждого ИТП
+func (a *Analyzer) waterStage(data *analysisData, startDate, endDate time.Time) *buildingStages {
+    var st buildingStages
+    st.totalColdWater, st.totalHotWater, st.coldRecords, st.hotRecords, st.hasWaterData = data.water()
+    st.itps, st.unassignedHotWater = a.itpBalances(data, startDate, endDate)
+    return &st
+}
+
+// Анализ здания по загруженным данным и результатам этапов
+func (a *Analyzer) analyzeBuilding(buildingID uuid.UUID, data *analysisData, st *buildingStages, days int, startDate, endDate time.Time) *ConsumptionAnalysis {
+    totalColdWater, totalHotWater := st.totalColdWater, st.totalHotWater
+    coldRecords, hotRecords, hasWaterData := st.coldRecords, st.hotRecords, st.hasWaterData
+    tempData, hasTempData := st.tempData, st.hasTempData
+    pumpData, hasPumpData := st.pumpData, st.hasPumpData
 
     var analysis *ConsumptionAnalysis
     var dataSource string
 
     if hasWaterData {
         // Используем реальные данные из БД
-        analysis = a.analyzeRealData(totalColdWater, totalHotWater, coldRecords, hotRecords, tempData, pumpData, buildingID, startDate, endDate)
-        dataSource = "database"
+        analysis = a.analyzeRealData(totalColdWater, totalHotWater, coldRecords, hotRecords, tempData, pumpData, data.norm, buildingID, startDate, endDate)
+        dataSource = DataSourceDatabase
         
         // Добавляем информацию о качестве данных
         infoMsg := fmt.Sprintf("Данные основаны на %d записях ХВС и %d записях ГВС из БД", coldRecords, hotRecords)
@@ -100,12 +255,19 @@ func (a *Analyzer) AnalyzeConsumption(ctx context.Context, buildingID uuid.UUID,
         analysis.Recommendations = append([]string{infoMsg}, analysis.Recommendations...)
         
     } else {
-        // Если данных нет, используем реалистичные оценки
-        analysis = a.analyzeEstimatedData(buildingID, days)
-        dataSource = "estimated"
+        // Без показаний ХВС и ГВС баланс не оценивается, остальное - по имеющимся данным
+        analysis = a.analyzeInsufficientData(coldRecords, hotRecords, tempData, pumpData, buildingID, startDate, endDate)
+        dataSource = DataSourceInsufficient
     }
 
     analysis.DataSource = dataSource
+    analysis.RatioNorm = data.norm
+    analysis.DataCoverage = data.dataCoverage(startDate, endDate)
+    analysis.Missing = data.missing()
+    analysis.ITPs, analysis.UnassignedHotWater = st.itps, st.unassignedHotWater
+    if len(analysis.ITPs) > 1 {
+        analysis.Recommendations = append(analysis.Recommendations, itpRecommendations(analysis.ITPs, analysis.UnassignedHotWater)...)
+    }
     
     // Добавляем детальные данные если они есть
     if hasTempData {
@@ -114,273 +276,80 @@ func (a *Analyzer) AnalyzeConsumption(ctx context.Context, buildingID uuid.UUID,
     if hasPumpData {
         analysis.PumpData = pumpData
     }
-
-    // Временная проверка для отладки
-    if analysis.HotToColdRatio > 95.0 {
-        // Вероятно ошибка в данных, исправляем статус
-        analysis.WaterBalanceStatus = "warning"
-        analysis.HasAnomalies = false
-        analysis.AnomalyCount = 0
-        analysis.Recommendations = append([]string{
-            "⚠️ Внимание: Обнаружены возможные некорректные данные. Соотношение ГВС/ХВС превышает реалистичные значения.",
-            "Рекомендуется проверить корректность показаний счетчиков.",
-        }, analysis.Recommendations...)
+    if heat, ok := data.heat(); ok {
+        analysis.Heat = heat
+        if heat.CoveredShare < minHeatCoverage {
+            analysis.Recommendations = append(analysis.Recommendations, fmt.Sprintf(
+                "Тепловая энергия рассчитана по %.0f%% показаний ГВС: для остальных нет показаний температуры, удельный расход тепла занижен",
+                heat.CoveredShare*100))
+        }
     }
 
-    return analysis, nil
-}
-
-// Получение суммарного расхода ХВС за период
-func (a *Analyzer) getTotalColdWater(ctx context.Context, buildingID uuid.UUID, start, end time.Time) (int, error) {
-    var totalFlow int
-    
-    err := a.pool.QueryRow(ctx, `
-        SELECT COALESCE(SUM(cwm.flow_rate), 0)
-        FROM cold_water_meters cwm
-        JOIN itp i ON cwm.itp_id = i.id
-        WHERE i.building_id = $1 
-        AND cwm.timestamp BETWEEN $2 AND $3`,
-        buildingID, start, end).Scan(&totalFlow)
-    
-    if err != nil {
-        return 0, fmt.Errorf("get total cold water: %w", err)
+    if data.tariff != nil {
+        a.applyTariff(analysis, data.tariff, days)
     }
-    
-    return totalFlow, nil
-}
 
-// Получение суммарного расхода ГВС за период
-func (a *Analyzer) getTotalHotWater(ctx context.Context, buildingID uuid.UUID, start, end time.Time) (int, error) {
-    var totalFlow int
-    
-    err := a.pool.QueryRow(ctx, `
-        SELECT COALESCE(SUM(flow_rate_ch1 + flow_rate_ch2), 0)
-        FROM hot_water_meters 
-        WHERE building_id = $1 
-        AND timestamp BETWEEN $2 AND $3`,
-        buildingID, start, end).Scan(&totalFlow)
-    
-    if err != nil {
-        return 0, fmt.Errorf("get total hot water: %w", err)
-    }
-    
-    return totalFlow, nil
+    return analysis
 }
 
-// Получение температурных данных из БД
-func (a *Analyzer) getTemperatureData(ctx context.Context, buildingID uuid.UUID, start, end time.Time) (*TemperatureData, bool, error) {
-    var tempData TemperatureData
-    
-    // Получаем средние температуры за период
-    err := a.pool.QueryRow(ctx, `
-        SELECT 
-            COALESCE(AVG(supply_temp), 0)::int,
-            COALESCE(AVG(return_temp), 0)::int,
-            COALESCE(AVG(delta_temp), 0)::int,
-            COALESCE(MIN(delta_temp), 0)::int,
-            COALESCE(MAX(delta_temp), 0)::int,
-            COUNT(*)
-        FROM temperature_readings 
-        WHERE building_id = $1 
-        AND timestamp BETWEEN $2 AND $3`,
-        buildingID, start, end).Scan(
-            &tempData.AvgSupplyTemp,
-            &tempData.AvgReturnTemp,
-            &tempData.AvgDeltaTemp,
-            &tempData.MinDeltaTemp,
-            &tempData.MaxDeltaTemp,
-            &tempData.RecordsCount)
-    
-    if err != nil {
-        return nil, false, fmt.Errorf("get temperature data: %w", err)
+// Стоимость и потери по тарифу здания, в том числе по каждому ИТП с оцененным балансом
+func (a *Analyzer) applyTariff(analysis *ConsumptionAnalysis, t *tariff.Tariff, days int) {
+    analysis.Cost = estimateCost(analysis, t, days)
+    if analysis.Cost.LossCost > 0 {
+        analysis.Recommendations = append(analysis.Recommendations, fmt.Sprintf(
+            "Оценка потерь за период: %.2f ₽ (%.2f ₽/сутки) по тарифу с %s",
+            analysis.Cost.LossCost, analysis.Cost.LossPerDay, t.EffectiveFrom))
     }
 
-    hasData := tempData.RecordsCount > 0
-    return &tempData, hasData, nil
-}
-
-// Получение данных насосов из БД
-func (a *Analyzer) getPumpData(ctx context.Context, buildingID uuid.UUID, start, end time.Time) (*PumpAnalysis, bool, error) {
-    var pumpData PumpAnalysis
-    
-    // Получаем последние данные по каждому насосу
-    rows, err := a.pool.Query(ctx, `
-        SELECT DISTINCT ON (pump_number)
-            pump_number, status, operating_hours, pressure_input, pressure_output, vibration_level
-        FROM pump_data 
-        WHERE building_id = $1 
-        AND timestamp BETWEEN $2 AND $3
-        ORDER BY pump_number, timestamp DESC`,
-        buildingID, start, end)
-    
-    if err != nil {
-        return nil, false, fmt.Errorf("get pump data: %w", err)
+    var specificHeat float64
+    if analysis.Heat != nil {
+        specificHeat = analysis.Heat.SpecificHeat
     }
-    defer rows.Close()
-
-    var totalOperatingHours int
-    var maxOperatingHours int
-    var pressureReadings, vibrationReadings int
-    
-    for rows.Next() {
-        var pumpNumber, status string
-        var operatingHours, pressureInput, pressureOutput, vibrationLevel int
-        
-        err := rows.Scan(&pumpNumber, &status, &operatingHours, &pressureInput, &pressureOutput, &vibrationLevel)
-        if err != nil {
+    for i := range analysis.ITPs {
+        itp := &analysis.ITPs[i]
+        if itp.WaterBalanceStatus == "unknown" {
             continue
         }
-        
-        pumpData.TotalPumps++
-        totalOperatingHours += operatingHours
-        
-        if operatingHours > maxOperatingHours {
-            maxOperatingHours = operatingHours
-        }
-        
-        switch status {
-        case "normal":
-            pumpData.NormalPumps++
-        case "warning":
-            pumpData.WarningPumps++
-        case "critical":
-            pumpData.CriticalPumps++
-        }
-        
-        // Анализ давления
-        pressureDiff := pressureOutput - pressureInput
-        if pressureDiff >= 1 && pressureDiff <= 3 {
-            pressureReadings++
-        }
-        
-        // Анализ вибрации
-        if vibrationLevel <= 5 {
-            vibrationReadings++
-        }
-    }
-    
-    if pumpData.TotalPumps > 0 {
-        pumpData.AvgOperatingHours = totalOperatingHours / pumpData.TotalPumps
-        pumpData.MaxOperatingHours = maxOperatingHours
-        
-        // Определяем статус давления
-        pressureRatio := float64(pressureReadings) / float64(pumpData.TotalPumps)
-        if pressureRatio >= 0.8 {
-            pumpData.PressureStatus = "normal"
-        } else if pressureRatio >= 0.5 {
-            pumpData.PressureStatus = "warning"
-        } else {
-            pumpData.PressureStatus = "critical"
-        }
-        
-        // Определяем статус вибрации
-        vibrationRatio := float64(vibrationReadings) / float64(pumpData.TotalPumps)
-        if vibrationRatio >= 0.8 {
-            pumpData.VibrationStatus = "normal"
-        } else if vibrationRatio >= 0.5 {
-            pumpData.VibrationStatus = "warning"
-        } else {
-            pumpData.VibrationStatus = "critical"
-        }
-    }
-    
-    hasData := pumpData.TotalPumps > 0
-    return &pumpData, hasData, nil
-}
-
-// Получение количества записей для анализа качества данных
-func (a *Analyzer) getDataQuality(ctx context.Context, buildingID uuid.UUID, start, end time.Time) (int, int, error) {
-    var coldRecords, hotRecords int
-    
-    err := a.pool.QueryRow(ctx, `
-        SELECT COUNT(*)
-        FROM cold_water_meters cwm
-        JOIN itp i ON cwm.itp_id = i.id
-        WHERE i.building_id = $1 
-        AND cwm.timestamp BETWEEN $2 AND $3`,
-        buildingID, start, end).Scan(&coldRecords)
-    
-    if err != nil {
-        return 0, 0, err
+        itp.ImbalanceM3, itp.LossCost = imbalanceLoss(itp.TotalColdWater, itp.TotalHotWater, specificHeat, analysis.RatioNorm, t)
     }
-    
-    err = a.pool.QueryRow(ctx, `
-        SELECT COUNT(*)
-        FROM hot_water_meters 
-        WHERE building_id = $1 
-        AND timestamp BETWEEN $2 AND $3`,
-        buildingID, start, end).Scan(&hotRecords)
-    
-    if err != nil {
-        return 0, 0, err
-    }
-    
-    return coldRecords, hotRecords, nil
-}
-
-// Получение водных данных из БД
-func (a *Analyzer) getWaterDataFromDB(ctx context.Context, buildingID uuid.UUID, start, end time.Time) (int, int, int, int, bool, error) {
-    totalColdWater, err := a.getTotalColdWater(ctx, buildingID, start, end)
-    if err != nil {
-        return 0, 0, 0, 0, false, err
-    }
-
-    totalHotWater, err := a.getTotalHotWater(ctx, buildingID, start, end)
-    if err != nil {
-        return 0, 0, 0, 0, false, err
-    }
-
-    coldRecords, hotRecords, err := a.getDataQuality(ctx, buildingID, start, end)
-    if err != nil {
-        return 0, 0, 0, 0, false, err
-    }
-
-    requiredRecords := 7
-    hasEnoughData := coldRecords >= requiredRecords && hotRecords >= requiredRecords
-    
-    return totalColdWater, totalHotWater, coldRecords, hotRecords, hasEnoughData, nil
 }
 
 // Анализ РЕАЛЬНЫХ данных из БД
-func (a *Analyzer) analyzeRealData(totalColdWater, totalHotWater, coldRecords, hotRecords int, 
-    tempData *TemperatureData, pumpData *PumpAnalysis, buildingID uuid.UUID, start, end time.Time) *ConsumptionAnalysis {
+func (a *Analyzer) analyzeRealData(totalColdWater, totalHotWater float64, coldRecords, hotRecords int, 
+    tempData *TemperatureData, pumpData *PumpAnalysis, norm RatioNorm, buildingID uuid.UUID, start, end time.Time) *ConsumptionAnalysis {
     
-    // Рассчитываем средние значения для анализа воды
-    avgColdWater := 0
-    if coldRecords > 0 {
-        hours := int(end.Sub(start).Hours())
-        if hours > 0 {
-            avgColdWater = totalColdWater / hours
-        }
+    // Рассчитываем средние значения для анализа воды (м³/ч)
+    hours := end.Sub(start).Hours()
+
+    var avgColdWater float64
+    if coldRecords > 0 && hours > 0 {
+        avgColdWater = totalColdWater / hours
     }
 
-    avgHotWater := 0
-    if hotRecords > 0 {
-        hours := int(end.Sub(start).Hours())
-        if hours > 0 {
-            avgHotWater = totalHotWater / hours
-        }
+    var avgHotWater float64
+    if hotRecords > 0 && hours > 0 {
+        avgHotWater = totalHotWater / hours
     }
 
-    difference := totalColdWater - totalHotWater
+    difference := models.RoundFlow(totalColdWater - totalHotWater)
     var differencePercent float64
     if totalColdWater > 0 {
-        differencePercent = (float64(difference) / float64(totalColdWater)) * 100
+        differencePercent = (difference / totalColdWater) * 100
     }
 
     // ПРАВИЛЬНО рассчитываем соотношение ГВС/ХВС в процентах
     var hotToColdRatioPercent float64
     if totalColdWater > 0 {
-        hotToColdRatioPercent = (float64(totalHotWater) / float64(totalColdWater)) * 100
+        hotToColdRatioPercent = (totalHotWater / totalColdWater) * 100
     }
 
     // Анализ на основе РЕАЛЬНЫХ данных
-    waterBalanceStatus := a.analyzeWaterBalanceReal(float64(avgColdWater), float64(avgHotWater), hotToColdRatioPercent, coldRecords, hotRecords)
+    waterBalanceStatus := a.analyzeWaterBalanceReal(avgColdWater, avgHotWater, hotToColdRatioPercent, coldRecords, hotRecords, norm)
     temperatureStatus := a.analyzeTemperatureReal(tempData)
     pumpStatus, operatingHours := a.analyzePumpConditionReal(pumpData)
     hasAnomalies, anomalyCount := a.detectAnomaliesReal(totalColdWater, totalHotWater, waterBalanceStatus, temperatureStatus, pumpStatus)
     recommendations := a.generateRecommendationsReal(waterBalanceStatus, temperatureStatus, pumpStatus, operatingHours, 
-        totalColdWater, totalHotWater, hotToColdRatioPercent, coldRecords, hotRecords, tempData, pumpData)
+        totalColdWater, totalHotWater, hotToColdRatioPercent, norm, coldRecords, hotRecords, tempData, pumpData)
 
     return &ConsumptionAnalysis{
         BuildingID:           buildingID,
@@ -400,8 +369,10 @@ func (a *Analyzer) analyzeRealData(totalColdWater, totalHotWater, coldRecords, h
     }
 }
 
-// Анализ баланса на основе РЕАЛЬНЫХ данных с правильной логикой
-func (a *Analyzer) analyzeWaterBalanceReal(avgColdWater, avgHotWater, hotToColdRatioPercent float64, coldRecords, hotRecords int) string {
+// Анализ баланса на основе РЕАЛЬНЫХ данных с правильной логикой.
+// norm - норма соотношения ГВС/ХВС здания: типовая или по сопоставимым зданиям
+func (a *Analyzer) analyzeWaterBalanceReal(avgColdWater, avgHotWater, hotToColdRatioPercent float64, coldRecords, hotRecords int,
+    norm RatioNorm) string {
     if coldRecords == 0 || hotRecords == 0 {
         return "unknown" // Нет данных для анализа
     }
@@ -417,23 +388,82 @@ func (a *Analyzer) analyzeWaterBalanceReal(avgColdWater, avgHotWater, hotToColdR
     }
 
     // 3. Анализируем по соотношению в процентах
-    // Реалистичные диапазоны для МКД:
-    // - Норма: 40-70% (ГВС составляет 40-70% от ХВС - это реально для МКД)
-    // - Предупреждение: 30-40% или 70-80%
-    // - Утечка/ошибка: <30% или >80%
+    // Диапазоны относительно нормы здания (типовая для МКД - 40-70%):
+    // - Норма: [Min, Max]
+    // - Предупреждение: до ratioWarningMargin п.п. ниже Min или выше Max
+    // - Утечка/ошибка: дальше от нормы
     
-    if hotToColdRatioPercent >= 40.0 && hotToColdRatioPercent <= 70.0 {
+    if hotToColdRatioPercent >= norm.Min && hotToColdRatioPercent <= norm.Max {
         return "normal" // Нормальный баланс для МКД
-    } else if (hotToColdRatioPercent >= 30.0 && hotToColdRatioPercent < 40.0) || 
-              (hotToColdRatioPercent > 70.0 && hotToColdRatioPercent <= 80.0) {
+    } else if (hotToColdRatioPercent >= norm.Min-ratioWarningMargin && hotToColdRatioPercent < norm.Min) || 
+              (hotToColdRatioPercent > norm.Max && hotToColdRatioPercent <= norm.Max+ratioWarningMargin) {
         return "warning" // Небольшое отклонение
-    } else if hotToColdRatioPercent < 30.0 {
+    } else if hotToColdRatioPercent < norm.Min-ratioWarningMargin {
         return "error" // Слишком мало ГВС
     } else {
         return "leak" // Слишком много ГВС
     }
 }
 
+// Баланс по каждому ИТП здания и объем ГВС, не отнесенный ни к одному ИТП.
+// Статус ИТП оценивается так же, как баланс здания, при minWaterRecords показаниях ХВС и ГВС
+func (a *Analyzer) itpBalances(data *analysisData, start, end time.Time) ([]ITPBalance, float64) {
+    hours := end.Sub(start).Hours()
+    balances := make([]ITPBalance, 0, len(data.itps))
+    var assigned float64
+    for _, itp := range data.itps {
+        cold, hot, coldRecords, hotRecords := data.itpWater(itp.id)
+        assigned += hot
+
+        b := ITPBalance{
+            ITPID:              itp.id,
+            ITPNumber:          itp.number,
+            TotalColdWater:     models.RoundFlow(cold),
+            TotalHotWater:      models.RoundFlow(hot),
+            Difference:         models.RoundFlow(cold - hot),
+            WaterBalanceStatus: "unknown",
+        }
+        if cold > 0 {
+            b.HotToColdRatio = hot / cold * 100
+        }
+        if coldRecords >= minWaterRecords && hotRecords >= minWaterRecords && hours > 0 {
+            b.WaterBalanceStatus = a.analyzeWaterBalanceReal(cold/hours, hot/hours, b.HotToColdRatio,
+                coldRecords, hotRecords, data.norm)
+        }
+        balances = append(balances, b)
+    }
+
+    if len(data.itps) < 2 {
+        return balances, 0
+    }
+    unassigned := models.RoundFlow(data.readings[timeseries.MetricHotVolume].Sum - assigned)
+    return balances, math.Max(unassigned, 0)
+}
+
+// Рекомендации по ИТП здания с несколькими ИТП: отклонения баланса отдельных ИТП
+// могут компенсировать друг друга в балансе здания
+func itpRecommendations(balances []ITPBalance, unassignedHotWater float64) []string {
+    var recommendations []string
+    for _, b := range balances {
+        switch b.WaterBalanceStatus {
+        case "leak", "error":
+            recommendations = append(recommendations,
+                fmt.Sprintf("%s: соотношение ГВС/ХВС %.1f%% - возможна утечка или ошибка показаний", b.ITPNumber, b.HotToColdRatio))
+        case "warning":
+            recommendations = append(recommendations,
+                fmt.Sprintf("%s: соотношение ГВС/ХВС %.1f%% - небольшое отклонение, требуется наблюдение", b.ITPNumber, b.HotToColdRatio))
+        case "unknown":
+            recommendations = append(recommendations,
+                fmt.Sprintf("%s: недостаточно показаний для баланса ИТП", b.ITPNumber))
+        }
+    }
+    if unassignedHotWater > 0 {
+        recommendations = append(recommendations,
+            fmt.Sprintf("%.3f м³ ГВС учтено ОДПУ без привязки к ИТП; рекомендуется указать ИТП счетчика", unassignedHotWater))
+    }
+    return recommendations
+}
+
 // Анализ температуры на основе РЕАЛЬНЫХ данных из БД
 func (a *Analyzer) analyzeTemperatureReal(tempData *TemperatureData) string {
     if tempData == nil || tempData.RecordsCount == 0 {
@@ -441,7 +471,7 @@ func (a *Analyzer) analyzeTemperatureReal(tempData *TemperatureData) string {
     }
 
     // Норма ΔT для ГВС: 17-23°C
-    if tempData.AvgDeltaTemp >= 17 && tempData.AvgDeltaTemp <= 23 {
+    if tempData.AvgDeltaTemp >= 17 && tempData.AvgDeltaTemp <= tariff.NormDeltaTempMax {
         return "normal"
     } else if tempData.AvgDeltaTemp >= 15 && tempData.AvgDeltaTemp <= 25 {
         return "warning"
@@ -467,7 +497,7 @@ func (a *Analyzer) analyzePumpConditionReal(pumpData *PumpAnalysis) (string, int
 }
 
 // Детектор аномалий на основе реальных данных
-func (a *Analyzer) detectAnomaliesReal(totalColdWater, totalHotWater int, waterBalance, temperatureStatus, pumpStatus string) (bool, int) {
+func (a *Analyzer) detectAnomaliesReal(totalColdWater, totalHotWater float64, waterBalance, temperatureStatus, pumpStatus string) (bool, int) {
     anomalyCount := 0
 
     // 1. Проверяем базовую корректность данных
@@ -505,7 +535,7 @@ func (a *Analyzer) detectAnomaliesReal(totalColdWater, totalHotWater int, waterB
 
 // Реальные рекомендации на основе данных
 func (a *Analyzer) generateRecommendationsReal(waterBalance, temperatureStatus, pumpStatus string, 
-    operatingHours, coldWater, hotWater int, hotToColdRatioPercent float64,
+    operatingHours int, coldWater, hotWater, hotToColdRatioPercent float64, norm RatioNorm,
     coldRecords, hotRecords int, tempData *TemperatureData, pumpData *PumpAnalysis) []string {
     
     var recommendations []string
@@ -524,17 +554,17 @@ func (a *Analyzer) generateRecommendationsReal(waterBalance, temperatureStatus,
         recommendations = append(recommendations, 
             "ВНИМАНИЕ: Возможна утечка или некорректные показания")
         recommendations = append(recommendations, 
-            fmt.Sprintf("Соотношение ГВС/ХВС: %.1f%% (норма: 40-70%%)", hotToColdRatioPercent))
+            fmt.Sprintf("Соотношение ГВС/ХВС: %.1f%% (норма: %s)", hotToColdRatioPercent, norm))
     case "error":
         recommendations = append(recommendations, 
             "Возможна ошибка в данных счетчиков")
         recommendations = append(recommendations, 
-            fmt.Sprintf("Соотношение ГВС/ХВС: %.1f%% (норма: 40-70%%)", hotToColdRatioPercent))
+            fmt.Sprintf("Соотношение ГВС/ХВС: %.1f%% (норма: %s)", hotToColdRatioPercent, norm))
     case "warning":
         recommendations = append(recommendations, 
             "Небольшое отклонение от нормы, требуется наблюдение")
         recommendations = append(recommendations, 
-            fmt.Sprintf("Соотношение ГВС/ХВС: %.1f%% (норма: 40-70%%)", hotToColdRatioPercent))
+            fmt.Sprintf("Соотношение ГВС/ХВС: %.1f%% (норма: %s)", hotToColdRatioPercent, norm))
     case "normal":
         recommendations = append(recommendations, 
             fmt.Sprintf("Баланс в норме. Соотношение ГВС/ХВС: %.1f%%", hotToColdRatioPercent))
@@ -548,13 +578,13 @@ func (a *Analyzer) generateRecommendationsReal(waterBalance, temperatureStatus,
         switch temperatureStatus {
         case "normal":
             recommendations = append(recommendations, 
-                fmt.Sprintf("Температурный режим в норме (ΔT=%d°C)", tempData.AvgDeltaTemp))
+                fmt.Sprintf("Температурный режим в норме (ΔT=%.1f°C)", tempData.AvgDeltaTemp))
         case "warning":
             recommendations = append(recommendations, 
-                fmt.Sprintf("Температурный режим требует внимания (ΔT=%d°C, норма: 17-23°C)", tempData.AvgDeltaTemp))
+                fmt.Sprintf("Температурный режим требует внимания (ΔT=%.1f°C, норма: 17-23°C)", tempData.AvgDeltaTemp))
         case "critical":
             recommendations = append(recommendations, 
-                fmt.Sprintf("Критическое отклонение температуры (ΔT=%d°C)", tempData.AvgDeltaTemp))
+                fmt.Sprintf("Критическое отклонение температуры (ΔT=%.1f°C)", tempData.AvgDeltaTemp))
         case "unknown":
             recommendations = append(recommendations, 
                 "Данные о температуре отсутствуют")
@@ -613,43 +643,36 @@ func (a *Analyzer) generateRecommendationsReal(waterBalance, temperatureStatus,
     return recommendations
 }
 
-// Резервный анализ если данных нет в БД
-func (a *Analyzer) analyzeEstimatedData(buildingID uuid.UUID, days int) *ConsumptionAnalysis {
-    // Реалистичные оценки для МКД
-    avgColdWater := 5 + rand.Intn(5)
-    avgHotWater := 3 + rand.Intn(3)
-    
-    hoursInPeriod := days * 24
-    totalColdWater := avgColdWater * hoursInPeriod
-    totalHotWater := avgHotWater * hoursInPeriod
-    
-    difference := totalColdWater - totalHotWater
-    var differencePercent float64
-    if totalColdWater > 0 {
-        differencePercent = (float64(difference) / float64(totalColdWater)) * 100
-    }
+// Результат при недостатке показаний ХВС/ГВС: баланс не оценивается (unknown),
+// температура и насосы анализируются по имеющимся данным
+func (a *Analyzer) analyzeInsufficientData(coldRecords, hotRecords int, tempData *TemperatureData, pumpData *PumpAnalysis,
+    buildingID uuid.UUID, start, end time.Time) *ConsumptionAnalysis {
 
-    // Реалистичное соотношение для оценок
-    var hotToColdRatio float64
-    if totalColdWater > 0 {
-        hotToColdRatio = (float64(totalHotWater) / float64(totalColdWater)) * 100
+    temperatureStatus := a.analyzeTemperatureReal(tempData)
+    pumpStatus, operatingHours := a.analyzePumpConditionReal(pumpData)
+    hasAnomalies, anomalyCount := a.detectAnomaliesReal(0, 0, "unknown", temperatureStatus, pumpStatus)
+
+    var lacking []string
+    if coldRecords < minWaterRecords {
+        lacking = append(lacking, fmt.Sprintf("ХВС (%d из %d)", coldRecords, minWaterRecords))
+    }
+    if hotRecords < minWaterRecords {
+        lacking = append(lacking, fmt.Sprintf("ГВС (%d из %d)", hotRecords, minWaterRecords))
     }
 
     return &ConsumptionAnalysis{
         BuildingID:         buildingID,
-        Period:             fmt.Sprintf("%d дней (оценка)", days),
-        TotalColdWater:     totalColdWater,
-        TotalHotWater:      totalHotWater,
-        Difference:         difference,
-        DifferencePercent:  differencePercent,
-        HotToColdRatio:     hotToColdRatio,
-        HasAnomalies:       false,
-        AnomalyCount:       0,
-        WaterBalanceStatus: "normal",
-        TemperatureStatus:  "normal",
-        PumpStatus:         "normal",
-        PumpOperatingHours: 5000 + rand.Intn(5000),
-        Recommendations:    []string{"Данные отсутствуют в системе. Показаны расчетные значения."},
+        Period:             fmt.Sprintf("%s to %s", start.Format("2006-01-02"), end.Format("2006-01-02")),
+        HasAnomalies:       hasAnomalies,
+        AnomalyCount:       anomalyCount,
+        WaterBalanceStatus: "unknown",
+        TemperatureStatus:  temperatureStatus,
+        PumpStatus:         pumpStatus,
+        PumpOperatingHours: operatingHours,
+        Recommendations: []string{
+            "Недостаточно показаний для анализа баланса ХВС/ГВС: " + strings.Join(lacking, ", ") +
+                ". Рекомендуется проверить работу счетчиков и передачу данных.",
+        },
     }
 }
 
@@ -669,7 +692,7 @@ func (a *Analyzer) getColdWaterData(ctx context.Context, buildingID uuid.UUID, s
 
     var data []map[string]interface{}
     for rows.Next() {
-        var flowRate int
+        var flowRate float64
         var timestamp time.Time
         err := rows.Scan(&flowRate, &timestamp)
         if err != nil {
@@ -698,7 +721,7 @@ func (a *Analyzer) getHotWaterData(ctx context.Context, buildingID uuid.UUID, st
 
     var data []map[string]interface{}
     for rows.Next() {
-        var flowRateCh1, flowRateCh2 int
+        var flowRateCh1, flowRateCh2 float64
         var timestamp time.Time
         err := rows.Scan(&flowRateCh1, &flowRateCh2, &timestamp)
         if err != nil {
@@ -707,7 +730,7 @@ func (a *Analyzer) getHotWaterData(ctx context.Context, buildingID uuid.UUID, st
         data = append(data, map[string]interface{}{
             "flow_rate_ch1": flowRateCh1,
             "flow_rate_ch2": flowRateCh2,
-            "total_flow":    flowRateCh1 + flowRateCh2,
+            "total_flow":    models.RoundFlow(flowRateCh1 + flowRateCh2),
             "timestamp":     timestamp,
         })
     }
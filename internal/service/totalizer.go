@@ -0,0 +1,455 @@
+package service
+
+import (
+    "bytes"
+    "context"
+    "errors"
+    "fmt"
+    "sort"
+    "time"
+
+    "service/internal/logging"
+    "service/internal/metrics"
+    "service/internal/models"
+    "service/internal/tenant"
+
+    "github.com/google/uuid"
+    "github.com/jackc/pgx/v5"
+)
+
+// Виды учета накопительных счетчиков (totalizers.source)
+const (
+    TotalizerHotWater  = "hot_water"
+    TotalizerColdWater = "cold_water"
+)
+
+// Счетчик ХВС в ИТП одноканальный
+const ColdWaterChannel = "ch1"
+
+// Статус интервала между накопительными показаниями (meter_totals.status)
+const (
+    IntervalFirst    = "first"    // предыдущего показания нет, расход не определен
+    IntervalOK       = "ok"
+    IntervalRollover = "rollover" // счетчик перешел через ноль
+    IntervalReplaced = "replaced" // между показаниями заменен счетчик
+    IntervalNegative = "negative" // итог уменьшился без перехода через ноль и замены - расход не учитывается
+)
+
+// Уменьшение итога считается переходом через ноль, если расход с учетом перехода
+// меньше этой доли емкости счетчика. Иначе это сбой или обратный ход счетчика
+const maxRolloverShare = 0.5
+
+// Регистр накопительного счетчика
+type totalizerKey struct {
+    buildingID uuid.UUID
+    source     string
+    meterKey   string
+    channel    string
+}
+
+func totalizerKeyOf(buildingID uuid.UUID, source, meterKey, channel string) totalizerKey {
+    return totalizerKey{buildingID: buildingID, source: source, meterKey: meterKey, channel: channel}
+}
+
+func (k totalizerKey) less(o totalizerKey) bool {
+    if c := bytes.Compare(k.buildingID[:], o.buildingID[:]); c != 0 {
+        return c < 0
+    }
+    if k.source != o.source {
+        return k.source < o.source
+    }
+    if k.meterKey != o.meterKey {
+        return k.meterKey < o.meterKey
+    }
+    return k.channel < o.channel
+}
+
+// Время с точностью хранения в БД (микросекунды, UTC): по нему показания
+// сопоставляются с прочитанными обратно строками
+func storedTime(t time.Time) time.Time {
+    return t.Round(time.Microsecond).UTC()
+}
+
+// Регистр для создания или обновления: первое известное время и емкость (nil - без изменений)
+type totalizerSpec struct {
+    key      totalizerKey
+    since    time.Time
+    capacity *float64
+}
+
+// Показание регистра, для которого нужно пересчитать расход (вместе со следующим)
+type totalRef struct {
+    totalizerID uuid.UUID
+    timestamp   time.Time
+}
+
+type totalPoint struct {
+    timestamp time.Time
+    total     float64
+}
+
+type replacementPoint struct {
+    replacedAt time.Time
+    oldTotal   *float64
+    newTotal   float64
+}
+
+// Расход за интервал между показаниями
+type interval struct {
+    delta    *float64 // м³
+    flowRate *float64 // м³/ч
+    status   string
+}
+
+// Расход между предыдущим (prev, может отсутствовать) и текущим показанием.
+// repl - замена счетчика между ними: расход нового счетчика считается от его начального значения,
+// старого - от предыдущего показания до значения при снятии (если оно известно)
+func deriveInterval(prev *totalPoint, repl *replacementPoint, cur totalPoint, capacity *float64) interval {
+    var delta float64
+    var from time.Time
+    status := IntervalOK
+
+    switch {
+    case repl != nil:
+        delta = cur.total - repl.newTotal
+        from = repl.replacedAt
+        if prev != nil && repl.oldTotal != nil {
+            delta += *repl.oldTotal - prev.total
+            from = prev.timestamp
+        }
+        status = IntervalReplaced
+    case prev == nil:
+        return interval{status: IntervalFirst}
+    default:
+        delta = cur.total - prev.total
+        from = prev.timestamp
+        if delta < 0 && capacity != nil && *capacity > 0 {
+            wrapped := *capacity - prev.total + cur.total
+            if wrapped >= 0 && wrapped < *capacity*maxRolloverShare {
+                delta, status = wrapped, IntervalRollover
+            }
+        }
+    }
+
+    if delta < 0 {
+        return interval{status: IntervalNegative}
+    }
+    delta = models.RoundFlow(delta)
+    result := interval{delta: &delta, status: status}
+    if hours := cur.timestamp.Sub(from).Hours(); hours > 0 {
+        flowRate := models.RoundFlow(delta / hours)
+        result.flowRate = &flowRate
+    }
+    return result
+}
+
+// Создание регистров (или обновление since и емкости) в одной транзакции с показаниями.
+// Строки регистров остаются заблокированными до конца транзакции, поэтому параллельные
+// пакеты одного счетчика выполняются по очереди; блокировки берутся в порядке ключей
+func upsertTotalizers(ctx context.Context, tx pgx.Tx, specs []totalizerSpec) (map[totalizerKey]uuid.UUID, error) {
+    sort.Slice(specs, func(i, j int) bool { return specs[i].key.less(specs[j].key) })
+
+    batch := &pgx.Batch{}
+    ids := make(map[totalizerKey]uuid.UUID, len(specs))
+    for _, s := range specs {
+        key := s.key
+        batch.Queue(`
+            INSERT INTO totalizers (building_id, source, meter_key, channel, capacity, since)
+            VALUES ($1, $2, $3, $4, $5, $6)
+            ON CONFLICT (building_id, source, meter_key, channel) DO UPDATE SET
+                capacity = COALESCE(EXCLUDED.capacity, totalizers.capacity),
+                since = LEAST(totalizers.since, EXCLUDED.since)
+            RETURNING id`,
+            key.buildingID, key.source, key.meterKey, key.channel, s.capacity, s.since).QueryRow(func(row pgx.Row) error {
+            var id uuid.UUID
+            if err := row.Scan(&id); err != nil {
+                return fmt.Errorf("upsert totalizer %s/%s: %w", key.source, key.channel, err)
+            }
+            ids[key] = id
+            return nil
+        })
+    }
+    if err := tx.SendBatch(ctx, batch).Close(); err != nil {
+        return nil, err
+    }
+    return ids, nil
+}
+
+// Пересчет расхода показаний refs и следующих за ними показаний того же регистра.
+// Возвращает статусы интервалов самих refs
+func deriveTotals(ctx context.Context, tx pgx.Tx, refs []totalRef) (map[totalRef]string, error) {
+    type row struct {
+        ref      totalRef
+        cur      totalPoint
+        prev     *totalPoint
+        repl     *replacementPoint
+        capacity *float64
+    }
+    if len(refs) == 0 {
+        return nil, nil
+    }
+    var derived []row
+    seen := make(map[totalRef]bool)
+
+    batch := &pgx.Batch{}
+    for _, ref := range refs {
+        batch.Queue(`
+            SELECT m.timestamp, m.total::float8, p.timestamp, p.total::float8,
+                   r.replaced_at, r.old_total::float8, r.new_total::float8, t.capacity::float8
+            FROM totalizers t
+            CROSS JOIN LATERAL (
+                SELECT timestamp, total FROM meter_totals
+                WHERE totalizer_id = t.id AND timestamp >= $2
+                ORDER BY timestamp LIMIT 2
+            ) m
+            LEFT JOIN LATERAL (
+                SELECT timestamp, total FROM meter_totals
+                WHERE totalizer_id = t.id AND timestamp < m.timestamp
+                ORDER BY timestamp DESC LIMIT 1
+            ) p ON TRUE
+            LEFT JOIN LATERAL (
+                SELECT replaced_at, old_total, new_total FROM meter_replacements
+                WHERE totalizer_id = t.id AND replaced_at <= m.timestamp
+                AND (p.timestamp IS NULL OR replaced_at > p.timestamp)
+                ORDER BY replaced_at DESC LIMIT 1
+            ) r ON TRUE
+            WHERE t.id = $1`,
+            ref.totalizerID, ref.timestamp).Query(func(rows pgx.Rows) error {
+            for rows.Next() {
+                r := row{ref: totalRef{totalizerID: ref.totalizerID}}
+                var prevAt, replacedAt *time.Time
+                var prevTotal, newTotal *float64
+                var repl replacementPoint
+                err := rows.Scan(&r.cur.timestamp, &r.cur.total, &prevAt, &prevTotal,
+                    &replacedAt, &repl.oldTotal, &newTotal, &r.capacity)
+                if err != nil {
+                    return fmt.Errorf("scan totalizer interval: %w", err)
+                }
+                r.cur.timestamp = r.cur.timestamp.UTC()
+                r.ref.timestamp = r.cur.timestamp
+                if seen[r.ref] {
+                    continue
+                }
+                seen[r.ref] = true
+                if prevAt != nil {
+                    r.prev = &totalPoint{timestamp: *prevAt, total: *prevTotal}
+                }
+                if replacedAt != nil {
+                    repl.replacedAt, repl.newTotal = *replacedAt, *newTotal
+                    r.repl = &repl
+                }
+                derived = append(derived, r)
+            }
+            return rows.Err()
+        })
+    }
+    if err := tx.SendBatch(ctx, batch).Close(); err != nil {
+        return nil, fmt.Errorf("load totalizer intervals: %w", err)
+    }
+
+    statuses := make(map[totalRef]string, len(refs))
+    batch = &pgx.Batch{}
+    for _, r := range derived {
+        iv := deriveInterval(r.prev, r.repl, r.cur, r.capacity)
+        statuses[r.ref] = iv.status
+        batch.Queue(`
+            UPDATE meter_totals SET delta = $3, flow_rate = $4, status = $5, derived_at = NOW()
+            WHERE totalizer_id = $1 AND timestamp = $2`,
+            r.ref.totalizerID, r.ref.timestamp, iv.delta, iv.flowRate, iv.status)
+    }
+    if err := tx.SendBatch(ctx, batch).Close(); err != nil {
+        return nil, fmt.Errorf("update totalizer intervals: %w", err)
+    }
+    return statuses, nil
+}
+
+// Накопительные показания. Регистры создаются при первом показании; для каждого нового
+// показания и следующего за ним вычисляются расход за интервал и средний расход.
+// Уменьшение итога без перехода через ноль или замены счетчика отмечается статусом negative
+// и в расход не входит
+func (in *Ingestor) InsertTotals(ctx context.Context, readings []models.TotalizerReading) (int, error) {
+    specs := make(map[totalizerKey]*totalizerSpec)
+    for i := range readings {
+        readings[i].Timestamp = storedTime(readings[i].Timestamp)
+        r := readings[i]
+        key := totalizerKeyOf(r.BuildingID, r.Source, r.MeterKey, r.Channel)
+        s, ok := specs[key]
+        if !ok {
+            s = &totalizerSpec{key: key, since: r.Timestamp}
+            specs[key] = s
+        }
+        if r.Timestamp.Before(s.since) {
+            s.since = r.Timestamp
+        }
+        if r.Capacity != nil {
+            s.capacity = r.Capacity
+        }
+    }
+    list := make([]totalizerSpec, 0, len(specs))
+    for _, s := range specs {
+        list = append(list, *s)
+    }
+
+    tx, err := in.pool.Begin(ctx)
+    if err != nil {
+        return 0, err
+    }
+    defer tx.Rollback(ctx)
+
+    ids, err := upsertTotalizers(ctx, tx, list)
+    if err != nil {
+        return 0, fmt.Errorf("insert totals: %w", err)
+    }
+
+    batch := &pgx.Batch{}
+    for _, r := range readings {
+        batch.Queue(`
+            INSERT INTO meter_totals (id, totalizer_id, total, timestamp, created_at, derived_at, meter_id)
+            VALUES ($1, $2, $3, $4, NOW(), NOW(), reading_meter($5, NULLIF($6, '')::uuid, $7, $4))
+            ON CONFLICT (totalizer_id, timestamp) DO NOTHING`,
+            uuid.New(), ids[totalizerKeyOf(r.BuildingID, r.Source, r.MeterKey, r.Channel)], r.Total, r.Timestamp,
+            r.BuildingID, r.MeterKey, r.Source)
+    }
+    results := tx.SendBatch(ctx, batch)
+    var refs []totalRef
+    var duplicates []readingKey
+    for i, r := range readings {
+        tag, err := results.Exec()
+        if err != nil {
+            results.Close()
+            return 0, fmt.Errorf("insert total %d: %w", i, err)
+        }
+        if tag.RowsAffected() == 0 {
+            duplicates = append(duplicates, readingKey{r.BuildingID, r.Source, r.MeterKey, r.Timestamp})
+            continue
+        }
+        refs = append(refs, totalRef{ids[totalizerKeyOf(r.BuildingID, r.Source, r.MeterKey, r.Channel)], r.Timestamp})
+    }
+    if err := results.Close(); err != nil {
+        return 0, fmt.Errorf("insert totals: %w", err)
+    }
+
+    statuses, err := deriveTotals(ctx, tx, refs)
+    if err != nil {
+        return 0, err
+    }
+    if err := tx.Commit(ctx); err != nil {
+        return 0, err
+    }
+
+    metrics.AddReadings(metrics.TableMeterTotals, metrics.SourceIngest, len(refs))
+    negative := 0
+    for _, ref := range refs {
+        status := statuses[ref]
+        if status == IntervalFirst {
+            continue
+        }
+        metrics.TotalizerIntervals.WithLabelValues(status).Inc()
+        if status == IntervalNegative {
+            negative++
+        }
+    }
+    if negative > 0 {
+        in.log.WarnContext(ctx, "negative totalizer deltas", "readings", negative)
+    }
+    if len(duplicates) > 0 {
+        metrics.ReadingsDuplicates.WithLabelValues(metrics.TableMeterTotals).Add(float64(len(duplicates)))
+        if err := in.recordDuplicates(ctx, duplicates); err != nil {
+            in.log.WarnContext(ctx, "record ingest duplicates failed", "kind", "totals", logging.Err(err))
+        }
+    }
+    return len(refs), nil
+}
+
+// Регистрация замены счетчика. Расход первого показания после замены пересчитывается
+func (in *Ingestor) RecordReplacement(ctx context.Context, r models.MeterReplacement) error {
+    tx, err := in.pool.Begin(ctx)
+    if err != nil {
+        return err
+    }
+    defer tx.Rollback(ctx)
+
+    r.ReplacedAt = storedTime(r.ReplacedAt)
+    key := totalizerKeyOf(r.BuildingID, r.Source, r.MeterKey, r.Channel)
+    ids, err := upsertTotalizers(ctx, tx, []totalizerSpec{{key: key, since: r.ReplacedAt}})
+    if err != nil {
+        return fmt.Errorf("record replacement: %w", err)
+    }
+
+    _, err = tx.Exec(ctx, `
+        INSERT INTO meter_replacements (totalizer_id, replaced_at, old_total, new_total)
+        VALUES ($1, $2, $3, $4)
+        ON CONFLICT (totalizer_id, replaced_at) DO UPDATE SET
+            old_total = EXCLUDED.old_total, new_total = EXCLUDED.new_total`,
+        ids[key], r.ReplacedAt, r.OldTotal, r.NewTotal)
+    if err != nil {
+        return fmt.Errorf("record replacement: %w", err)
+    }
+
+    if _, err := deriveTotals(ctx, tx, []totalRef{{ids[key], r.ReplacedAt}}); err != nil {
+        return err
+    }
+    return tx.Commit(ctx)
+}
+
+// Состояние регистра накопительного счетчика
+type Totalizer struct {
+    ID            uuid.UUID  `json:"id"`
+    Source        string     `json:"source"`
+    MeterKey      string     `json:"meter_key,omitempty"`
+    Channel       string     `json:"channel"`
+    Capacity      *float64   `json:"capacity"`
+    Since         time.Time  `json:"since"`
+    LastTotal     *float64   `json:"last_total"`
+    LastFlowRate  *float64   `json:"last_flow_rate"`
+    LastStatus    *string    `json:"last_status"`
+    LastReadingAt *time.Time `json:"last_reading_at"`
+    Negative      int        `json:"negative"` // интервалов с уменьшением итога за период
+    Replacements  int        `json:"replacements"`
+}
+
+// Регистры накопительных счетчиков здания с последним показанием и числом
+// интервалов negative с момента since. Здание вне компании organizationID - tenant.ErrBuildingNotFound
+func (in *Ingestor) BuildingTotalizers(ctx context.Context, organizationID *uuid.UUID, buildingID uuid.UUID, since time.Time) ([]Totalizer, error) {
+    var exists bool
+    err := in.pool.QueryRow(ctx, `
+        SELECT TRUE FROM buildings WHERE id = $1 AND ($2::uuid IS NULL OR organization_id = $2)`,
+        buildingID, organizationID).Scan(&exists)
+    if errors.Is(err, pgx.ErrNoRows) {
+        return nil, tenant.ErrBuildingNotFound
+    }
+    if err != nil {
+        return nil, fmt.Errorf("check building %s: %w", buildingID, err)
+    }
+
+    rows, err := in.pool.Query(ctx, `
+        SELECT t.id, t.source, t.meter_key, t.channel, t.capacity::float8, t.since,
+               l.total::float8, l.flow_rate::float8, l.status, l.timestamp,
+               (SELECT COUNT(*) FROM meter_totals n
+                WHERE n.totalizer_id = t.id AND n.status = 'negative' AND n.timestamp >= $2),
+               (SELECT COUNT(*) FROM meter_replacements r WHERE r.totalizer_id = t.id)
+        FROM totalizers t
+        LEFT JOIN LATERAL (
+            SELECT total, flow_rate, status, timestamp FROM meter_totals
+            WHERE totalizer_id = t.id
+            ORDER BY timestamp DESC LIMIT 1
+        ) l ON TRUE
+        WHERE t.building_id = $1
+        ORDER BY t.source, t.meter_key, t.channel`, buildingID, since)
+    if err != nil {
+        return nil, fmt.Errorf("load totalizers %s: %w", buildingID, err)
+    }
+    defer rows.Close()
+
+    result := []Totalizer{}
+    for rows.Next() {
+        var t Totalizer
+        err := rows.Scan(&t.ID, &t.Source, &t.MeterKey, &t.Channel, &t.Capacity, &t.Since,
+            &t.LastTotal, &t.LastFlowRate, &t.LastStatus, &t.LastReadingAt, &t.Negative, &t.Replacements)
+        if err != nil {
+            return nil, fmt.Errorf("scan totalizer: %w", err)
+        }
+        result = append(result, t)
+    }
+    return result, rows.Err()
+}
@@ -0,0 +1,125 @@
+package service
+
+import (
+    "testing"
+    "time"
+)
+
+func TestDeriveInterval(t *testing.T) {
+    base := time.Date(2026, 1, 10, 12, 0, 0, 0, time.UTC)
+    at := func(hours float64) time.Time {
+        return base.Add(time.Duration(hours * float64(time.Hour)))
+    }
+    ptr := func(v float64) *float64 { return &v }
+
+    tests := []struct {
+        name     string
+        prev     *totalPoint
+        repl     *replacementPoint
+        cur      totalPoint
+        capacity *float64
+        status   string
+        delta    *float64
+        flowRate *float64
+    }{
+        {
+            name:   "first reading",
+            cur:    totalPoint{timestamp: at(1), total: 120},
+            status: IntervalFirst,
+        },
+        {
+            name:     "regular interval",
+            prev:     &totalPoint{timestamp: at(0), total: 100},
+            cur:      totalPoint{timestamp: at(2), total: 106},
+            status:   IntervalOK,
+            delta:    ptr(6),
+            flowRate: ptr(3),
+        },
+        {
+            name:     "rollover at capacity",
+            prev:     &totalPoint{timestamp: at(0), total: 99998},
+            cur:      totalPoint{timestamp: at(1), total: 3},
+            capacity: ptr(100000),
+            status:   IntervalRollover,
+            delta:    ptr(5),
+            flowRate: ptr(5),
+        },
+        {
+            name:     "drop larger than rollover share",
+            prev:     &totalPoint{timestamp: at(0), total: 40000},
+            cur:      totalPoint{timestamp: at(1), total: 100},
+            capacity: ptr(100000),
+            status:   IntervalNegative,
+        },
+        {
+            name:   "negative delta without capacity",
+            prev:   &totalPoint{timestamp: at(0), total: 500},
+            cur:    totalPoint{timestamp: at(1), total: 480},
+            status: IntervalNegative,
+        },
+        {
+            name:     "replacement with known old total",
+            prev:     &totalPoint{timestamp: at(0), total: 500},
+            repl:     &replacementPoint{replacedAt: at(1), oldTotal: ptr(504), newTotal: 0},
+            cur:      totalPoint{timestamp: at(2), total: 2},
+            status:   IntervalReplaced,
+            delta:    ptr(6),
+            flowRate: ptr(3),
+        },
+        {
+            name:     "replacement with unknown old total",
+            prev:     &totalPoint{timestamp: at(0), total: 500},
+            repl:     &replacementPoint{replacedAt: at(1), newTotal: 10},
+            cur:      totalPoint{timestamp: at(3), total: 14},
+            status:   IntervalReplaced,
+            delta:    ptr(4),
+            flowRate: ptr(2),
+        },
+        {
+            name:     "replacement before first reading",
+            repl:     &replacementPoint{replacedAt: at(0), newTotal: 0},
+            cur:      totalPoint{timestamp: at(1), total: 1.5},
+            status:   IntervalReplaced,
+            delta:    ptr(1.5),
+            flowRate: ptr(1.5),
+        },
+        {
+            name:   "new meter total below initial value",
+            prev:   &totalPoint{timestamp: at(0), total: 500},
+            repl:   &replacementPoint{replacedAt: at(1), oldTotal: ptr(502), newTotal: 10},
+            cur:    totalPoint{timestamp: at(2), total: 5},
+            status: IntervalNegative,
+        },
+        {
+            name:   "same timestamp has no flow rate",
+            prev:   &totalPoint{timestamp: at(1), total: 100},
+            cur:    totalPoint{timestamp: at(1), total: 101},
+            status: IntervalOK,
+            delta:  ptr(1),
+        },
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            got := deriveInterval(tt.prev, tt.repl, tt.cur, tt.capacity)
+            if got.status != tt.status {
+                t.Errorf("status = %q, want %q", got.status, tt.status)
+            }
+            checkOptional(t, "delta", got.delta, tt.delta)
+            checkOptional(t, "flow rate", got.flowRate, tt.flowRate)
+        })
+    }
+}
+
+func checkOptional(t *testing.T, name string, got, want *float64) {
+    t.Helper()
+    switch {
+    case got == nil && want == nil:
+    case got == nil:
+        t.Errorf("%s = nil, want %v", name, *want)
+    case want == nil:
+        t.Errorf("%s = %v, want nil", name, *got)
+    case *got != *want:
+        t.Errorf("%s = %v, want %v", name, *got, *want)
+    }
+}
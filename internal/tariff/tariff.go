@@ -0,0 +1,214 @@
+package tariff
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "time"
+
+    "service/internal/tenant"
+
+    "github.com/google/uuid"
+    "github.com/jackc/pgx/v5"
+    "github.com/jackc/pgx/v5/pgconn"
+    "github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Уровни тарифа в порядке приоритета: тариф компании, региона, общий
+const (
+    LevelOrganization = "organization"
+    LevelRegion       = "region"
+    LevelDefault      = "default"
+)
+
+var (
+    ErrNotFound    = errors.New("tariff not found")
+    ErrDuplicate   = errors.New("tariff with the same level and effective date already exists")
+    ErrNotEditable = errors.New("tariff belongs to another level")
+)
+
+// Тариф: ХВС и ГВС в ₽/м³, тепловая энергия в ₽/Гкал. Действует с EffectiveFrom
+// до начала действия следующего тарифа того же уровня
+type Tariff struct {
+    ID             uuid.UUID  `json:"id"`
+    Level          string     `json:"level"`
+    OrganizationID *uuid.UUID `json:"organization_id,omitempty"`
+    Region         *string    `json:"region,omitempty"`
+    ColdWater      float64    `json:"cold_water"`     // ₽/м³
+    HotWater       float64    `json:"hot_water"`      // ₽/м³
+    Heat           float64    `json:"heat"`           // ₽/Гкал
+    EffectiveFrom  string     `json:"effective_from"` // 2006-01-02
+    CreatedAt      time.Time  `json:"created_at"`
+}
+
+// Верхняя граница нормы ΔT ГВС (норма температурного режима 17-23°C), °C. Тепловая энергия,
+// приходящаяся на ΔT сверх нее, оплачивается по тарифу Heat, но в оценке стоимости считается потерями
+const NormDeltaTempMax = 23.0
+
+// Store - тарифы и регионы зданий
+type Store struct {
+    pool *pgxpool.Pool
+}
+
+func NewStore(pool *pgxpool.Pool) *Store {
+    return &Store{pool: pool}
+}
+
+const tariffColumns = `t.id, t.organization_id, t.region, t.cold_water::float8, t.hot_water::float8, t.heat::float8,
+           t.effective_from::text, t.created_at`
+
+func scanTariff(row pgx.Row, dest ...interface{}) (*Tariff, error) {
+    var t Tariff
+    err := row.Scan(append(dest, &t.ID, &t.OrganizationID, &t.Region, &t.ColdWater, &t.HotWater, &t.Heat,
+        &t.EffectiveFrom, &t.CreatedAt)...)
+    if err != nil {
+        return nil, err
+    }
+    switch {
+    case t.OrganizationID != nil:
+        t.Level = LevelOrganization
+    case t.Region != nil:
+        t.Level = LevelRegion
+    default:
+        t.Level = LevelDefault
+    }
+    return &t, nil
+}
+
+// Тарифы, которые могут применяться к зданиям компании organizationID (nil - все тарифы):
+// тарифы компании, регионов и общие. Новые первыми в пределах уровня
+func (s *Store) List(ctx context.Context, organizationID *uuid.UUID) ([]*Tariff, error) {
+    rows, err := s.pool.Query(ctx, `
+        SELECT `+tariffColumns+`
+        FROM tariffs t
+        WHERE $1::uuid IS NULL OR t.organization_id IS NULL OR t.organization_id = $1
+        ORDER BY t.organization_id NULLS LAST, t.region NULLS LAST, t.effective_from DESC`, organizationID)
+    if err != nil {
+        return nil, fmt.Errorf("list tariffs: %w", err)
+    }
+    defer rows.Close()
+
+    tariffs := []*Tariff{}
+    for rows.Next() {
+        t, err := scanTariff(rows)
+        if err != nil {
+            return nil, fmt.Errorf("scan tariff: %w", err)
+        }
+        tariffs = append(tariffs, t)
+    }
+    return tariffs, rows.Err()
+}
+
+// Новый тариф. Тариф компании и тариф региона задаются раздельно (см. tariffs_level_check)
+func (s *Store) Create(ctx context.Context, t Tariff) (*Tariff, error) {
+    created, err := scanTariff(s.pool.QueryRow(ctx, `
+        INSERT INTO tariffs AS t (organization_id, region, cold_water, hot_water, heat, effective_from)
+        VALUES ($1, $2, $3, $4, $5, $6::date)
+        RETURNING `+tariffColumns,
+        t.OrganizationID, t.Region, t.ColdWater, t.HotWater, t.Heat, t.EffectiveFrom))
+    var pgErr *pgconn.PgError
+    if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+        return nil, ErrDuplicate
+    }
+    if errors.As(err, &pgErr) && pgErr.Code == "23503" {
+        return nil, tenant.ErrOrganizationNotFound
+    }
+    if err != nil {
+        return nil, fmt.Errorf("create tariff: %w", err)
+    }
+    return created, nil
+}
+
+// Удаление тарифа. Компания (scope не All) удаляет только собственные тарифы
+func (s *Store) Delete(ctx context.Context, scope tenant.Scope, id uuid.UUID) (*Tariff, error) {
+    before, err := scanTariff(s.pool.QueryRow(ctx, `
+        SELECT `+tariffColumns+` FROM tariffs t
+        WHERE t.id = $1 AND ($2::uuid IS NULL OR t.organization_id IS NULL OR t.organization_id = $2)`,
+        id, scope.Arg()))
+    if errors.Is(err, pgx.ErrNoRows) {
+        return nil, ErrNotFound
+    }
+    if err != nil {
+        return nil, fmt.Errorf("get tariff %s: %w", id, err)
+    }
+    if !scope.All() && before.OrganizationID == nil {
+        return nil, ErrNotEditable
+    }
+
+    if _, err := s.pool.Exec(ctx, "DELETE FROM tariffs WHERE id = $1", id); err != nil {
+        return nil, fmt.Errorf("delete tariff %s: %w", id, err)
+    }
+    return before, nil
+}
+
+// Тариф, действующий для каждого здания на дату at: тариф компании здания,
+// при его отсутствии - тариф региона здания, затем общий. Здания без тарифа в результат не входят
+const resolveSQL = `
+    SELECT b.id, ` + tariffColumns + `
+    FROM buildings b
+    JOIN LATERAL (
+        SELECT * FROM tariffs t
+        WHERE t.effective_from <= ($2::timestamptz AT TIME ZONE 'UTC')::date
+        AND (t.organization_id = b.organization_id
+             OR t.region = b.region
+             OR (t.organization_id IS NULL AND t.region IS NULL))
+        ORDER BY t.organization_id IS NOT NULL DESC, t.region IS NOT NULL DESC, t.effective_from DESC
+        LIMIT 1
+    ) t ON TRUE
+    WHERE b.id = ANY($1)`
+
+func scanResolved(rows pgx.Rows, result map[uuid.UUID]*Tariff) error {
+    for rows.Next() {
+        var buildingID uuid.UUID
+        t, err := scanTariff(rows, &buildingID)
+        if err != nil {
+            return fmt.Errorf("scan tariff: %w", err)
+        }
+        result[buildingID] = t
+    }
+    return rows.Err()
+}
+
+// Добавление выбора тарифов зданий в пакет запросов; результат заполняется при закрытии пакета
+func QueueResolve(batch *pgx.Batch, buildingIDs []uuid.UUID, at time.Time) map[uuid.UUID]*Tariff {
+    result := make(map[uuid.UUID]*Tariff, len(buildingIDs))
+    batch.Queue(resolveSQL, buildingIDs, at).Query(func(rows pgx.Rows) error {
+        if err := scanResolved(rows, result); err != nil {
+            return fmt.Errorf("resolve tariffs: %w", err)
+        }
+        return nil
+    })
+    return result
+}
+
+// Тариф, действующий для здания на дату at; nil - тариф не задан
+func (s *Store) Resolve(ctx context.Context, buildingID uuid.UUID, at time.Time) (*Tariff, error) {
+    rows, err := s.pool.Query(ctx, resolveSQL, []uuid.UUID{buildingID}, at)
+    if err != nil {
+        return nil, fmt.Errorf("resolve tariff: %w", err)
+    }
+    defer rows.Close()
+
+    result := make(map[uuid.UUID]*Tariff, 1)
+    if err := scanResolved(rows, result); err != nil {
+        return nil, fmt.Errorf("resolve tariff: %w", err)
+    }
+    return result[buildingID], nil
+}
+
+// Регион здания (nil - не задан). Возвращает прежнее значение
+func (s *Store) SetRegion(ctx context.Context, buildingID uuid.UUID, region *string) (*string, error) {
+    var before *string
+    err := s.pool.QueryRow(ctx, `
+        UPDATE buildings b SET region = $2, updated_at = NOW()
+        FROM buildings old
+        WHERE b.id = $1 AND old.id = b.id
+        RETURNING old.region`, buildingID, region).Scan(&before)
+    if errors.Is(err, pgx.ErrNoRows) {
+        return nil, tenant.ErrBuildingNotFound
+    }
+    if err != nil {
+        return nil, fmt.Errorf("set building %s region: %w", buildingID, err)
+    }
+    return before, nil
+}
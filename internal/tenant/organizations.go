@@ -0,0 +1,124 @@
+package tenant
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "time"
+
+    "github.com/google/uuid"
+    "github.com/jackc/pgx/v5"
+    "github.com/jackc/pgx/v5/pgxpool"
+)
+
+var (
+    ErrBuildingNotFound     = errors.New("building not found")
+    ErrOrganizationNotFound = errors.New("organization not found")
+)
+
+// Управляющая компания
+type Organization struct {
+    ID        uuid.UUID `json:"id"`
+    Name      string    `json:"name"`
+    INN       *string   `json:"inn,omitempty"`
+    CreatedAt time.Time `json:"created_at"`
+    UpdatedAt time.Time `json:"updated_at"`
+}
+
+// OrganizationStore - компании и принадлежность им зданий
+type OrganizationStore struct {
+    pool *pgxpool.Pool
+}
+
+func NewOrganizationStore(pool *pgxpool.Pool) *OrganizationStore {
+    return &OrganizationStore{pool: pool}
+}
+
+// Список компаний в пределах видимости
+func (s *OrganizationStore) List(ctx context.Context, scope Scope) ([]Organization, error) {
+    rows, err := s.pool.Query(ctx, `
+        SELECT id, name, inn, created_at, updated_at
+        FROM organizations
+        WHERE ($1::uuid IS NULL OR id = $1)
+        ORDER BY name`, scope.Arg())
+    if err != nil {
+        return nil, fmt.Errorf("list organizations: %w", err)
+    }
+    defer rows.Close()
+
+    orgs := []Organization{}
+    for rows.Next() {
+        var o Organization
+        if err := rows.Scan(&o.ID, &o.Name, &o.INN, &o.CreatedAt, &o.UpdatedAt); err != nil {
+            return nil, fmt.Errorf("scan organization: %w", err)
+        }
+        orgs = append(orgs, o)
+    }
+
+    return orgs, rows.Err()
+}
+
+// Создание компании
+func (s *OrganizationStore) Create(ctx context.Context, name string, inn *string) (*Organization, error) {
+    org := Organization{ID: uuid.New(), Name: name, INN: inn}
+    err := s.pool.QueryRow(ctx, `
+        INSERT INTO organizations (id, name, inn, created_at, updated_at)
+        VALUES ($1, $2, $3, NOW(), NOW())
+        RETURNING created_at, updated_at`,
+        org.ID, name, inn).Scan(&org.CreatedAt, &org.UpdatedAt)
+    if err != nil {
+        return nil, fmt.Errorf("insert organization %s: %w", name, err)
+    }
+    return &org, nil
+}
+
+// Передача здания компании (nil - снять привязку)
+func (s *OrganizationStore) AssignBuilding(ctx context.Context, buildingID uuid.UUID, organizationID *uuid.UUID) error {
+    if organizationID != nil {
+        var exists bool
+        err := s.pool.QueryRow(ctx, "SELECT EXISTS(SELECT 1 FROM organizations WHERE id = $1)", *organizationID).Scan(&exists)
+        if err != nil {
+            return fmt.Errorf("check organization: %w", err)
+        }
+        if !exists {
+            return ErrOrganizationNotFound
+        }
+    }
+
+    tag, err := s.pool.Exec(ctx, `
+        UPDATE buildings SET organization_id = $2, updated_at = NOW()
+        WHERE id = $1`, buildingID, organizationID)
+    if err != nil {
+        return fmt.Errorf("assign building: %w", err)
+    }
+    if tag.RowsAffected() == 0 {
+        return ErrBuildingNotFound
+    }
+    return nil
+}
+
+// Компания, которой принадлежит здание
+func (s *OrganizationStore) BuildingOrganization(ctx context.Context, buildingID uuid.UUID) (*uuid.UUID, error) {
+    var organizationID *uuid.UUID
+    err := s.pool.QueryRow(ctx, "SELECT organization_id FROM buildings WHERE id = $1", buildingID).Scan(&organizationID)
+    if errors.Is(err, pgx.ErrNoRows) {
+        return nil, ErrBuildingNotFound
+    }
+    if err != nil {
+        return nil, fmt.Errorf("get building organization: %w", err)
+    }
+    return organizationID, nil
+}
+
+// Проверка, что здание существует и видно в пределах scope.
+// Чужое здание неотличимо от несуществующего
+func (s *OrganizationStore) CheckBuilding(ctx context.Context, scope Scope, buildingID uuid.UUID) error {
+    organizationID, err := s.BuildingOrganization(ctx, buildingID)
+    if err != nil {
+        return err
+    }
+    if !scope.Allows(organizationID) {
+        return ErrBuildingNotFound
+    }
+    return nil
+}
@@ -0,0 +1,68 @@
+package tenant
+
+import (
+    "service/internal/auth"
+
+    "github.com/gin-gonic/gin"
+    "github.com/google/uuid"
+)
+
+// Scope - видимость данных для текущего пользователя.
+// OrganizationID == nil означает доступ ко всем компаниям (суперпользователь)
+type Scope struct {
+    OrganizationID *uuid.UUID
+}
+
+// Доступ ко всем компаниям
+func AllTenants() Scope {
+    return Scope{}
+}
+
+// Доступ к одной компании
+func ForOrganization(id uuid.UUID) Scope {
+    return Scope{OrganizationID: &id}
+}
+
+// Определение видимости по claims токена.
+// Пользователь без компании и без прав суперпользователя не видит ничего
+func FromClaims(claims *auth.Claims) Scope {
+    if claims == nil {
+        return ForOrganization(uuid.Nil)
+    }
+    if claims.Superuser {
+        return AllTenants()
+    }
+    if claims.OrganizationID != nil {
+        return ForOrganization(*claims.OrganizationID)
+    }
+    return ForOrganization(uuid.Nil)
+}
+
+// Видимость для текущего запроса. Суперпользователь может сузить выборку
+// до одной компании параметром ?organization_id=
+func FromContext(c *gin.Context) Scope {
+    scope := FromClaims(auth.ClaimsFromContext(c))
+    if scope.All() {
+        if id, err := uuid.Parse(c.Query("organization_id")); err == nil {
+            return ForOrganization(id)
+        }
+    }
+    return scope
+}
+
+func (s Scope) All() bool {
+    return s.OrganizationID == nil
+}
+
+// Проверка доступа к объекту компании organizationID (nil - объект не распределен)
+func (s Scope) Allows(organizationID *uuid.UUID) bool {
+    if s.All() {
+        return true
+    }
+    return organizationID != nil && *organizationID == *s.OrganizationID
+}
+
+// Параметр для SQL условия вида ($1::uuid IS NULL OR organization_id = $1)
+func (s Scope) Arg() *uuid.UUID {
+    return s.OrganizationID
+}
@@ -0,0 +1,303 @@
+package timeseries
+
+import (
+    "context"
+    "fmt"
+    "time"
+
+    "github.com/google/uuid"
+    "github.com/jackc/pgx/v5"
+    "github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Пределы длины интервала для автоматического выбора разрешения ряда
+const (
+    autoMinuteSpan = day
+    autoHourlySpan = 31 * day
+)
+
+// Агрегат показателя за интервал
+type Stats struct {
+    Sum   float64 `json:"sum"`
+    Count int64   `json:"count"`
+    Min   float64 `json:"min"`
+    Max   float64 `json:"max"`
+}
+
+// Среднее значение; 0, если показаний нет
+func (s Stats) Avg() float64 {
+    if s.Count == 0 {
+        return 0
+    }
+    return s.Sum / float64(s.Count)
+}
+
+// Точка временного ряда
+type Point struct {
+    Bucket time.Time `json:"bucket"`
+    Avg    float64   `json:"avg"`
+    Min    float64   `json:"min"`
+    Max    float64   `json:"max"`
+    Sum    float64   `json:"sum"`
+    Count  int64     `json:"count"`
+}
+
+// Reader читает показания из подходящего разрешения: суточные агрегаты там, где
+// почасовые уже удалены, почасовые - для свернутых часов, сырые данные - после границы агрегации.
+// Границы берутся из rollup_state, который ведет Manager
+type Reader struct {
+    pool *pgxpool.Pool
+}
+
+func NewReader(pool *pgxpool.Pool) *Reader {
+    return &Reader{pool: pool}
+}
+
+func later(a, b time.Time) time.Time {
+    if a.After(b) {
+        return a
+    }
+    return b
+}
+
+func earlier(a, b time.Time) time.Time {
+    if a.Before(b) {
+        return a
+    }
+    return b
+}
+
+// Агрегаты показателей по зданиям
+type BuildingStats map[uuid.UUID]map[string]Stats
+
+// Агрегаты показателей за интервал по нескольким зданиям одним запросом. Границы агрегации
+// читаются из rollup_state в том же запросе, поэтому его можно отправить в составе pgx.Batch.
+// Свернутые интервалы учитываются целиком, поэтому граница start округляется
+// вниз до часа (или до суток, если почасовые агрегаты уже удалены)
+const aggregateSQL = `
+    WITH st AS (
+        SELECT COALESCE(MAX(watermark) FILTER (WHERE resolution = 'hourly'), '-infinity') AS hourly,
+               COALESCE(MAX(watermark) FILTER (WHERE resolution = 'hourly_expired'), '-infinity') AS hourly_expired
+        FROM rollup_state
+    )
+    SELECT building_id, metric, COALESCE(SUM(s), 0), COALESCE(SUM(c), 0)::bigint, COALESCE(MIN(mn), 0), COALESCE(MAX(mx), 0)
+    FROM (
+        SELECT building_id, metric, sum AS s, count::bigint AS c, min AS mn, max AS mx
+        FROM readings_daily
+        WHERE building_id = ANY($1) AND metric = ANY($2)
+        AND bucket >= date_trunc('day', $3::timestamptz AT TIME ZONE 'UTC') AT TIME ZONE 'UTC'
+        AND bucket < LEAST((SELECT hourly_expired FROM st), $4)
+        UNION ALL
+        SELECT building_id, metric, sum, count, min, max
+        FROM readings_hourly
+        WHERE building_id = ANY($1) AND metric = ANY($2)
+        AND bucket >= GREATEST(date_trunc('hour', $3::timestamptz AT TIME ZONE 'UTC') AT TIME ZONE 'UTC', (SELECT hourly_expired FROM st))
+        AND bucket < LEAST((SELECT hourly FROM st), $4)
+        UNION ALL
+        SELECT building_id, metric, SUM(value), COUNT(*), MIN(value), MAX(value)
+        FROM readings_raw
+        WHERE building_id = ANY($1) AND metric = ANY($2)
+        AND timestamp >= GREATEST($3, (SELECT hourly FROM st)) AND timestamp <= $4
+        GROUP BY building_id, metric
+    ) parts
+    GROUP BY building_id, metric`
+
+// Заготовка результата: нулевые агрегаты для всех зданий и показателей
+func newBuildingStats(buildingIDs []uuid.UUID, metrics []string) BuildingStats {
+    result := make(BuildingStats, len(buildingIDs))
+    for _, id := range buildingIDs {
+        result[id] = make(map[string]Stats, len(metrics))
+        for _, metric := range metrics {
+            result[id][metric] = Stats{}
+        }
+    }
+    return result
+}
+
+func scanBuildingStats(rows pgx.Rows, result BuildingStats) error {
+    for rows.Next() {
+        var buildingID uuid.UUID
+        var metric string
+        var s Stats
+        if err := rows.Scan(&buildingID, &metric, &s.Sum, &s.Count, &s.Min, &s.Max); err != nil {
+            return fmt.Errorf("scan aggregate: %w", err)
+        }
+        if result[buildingID] != nil {
+            result[buildingID][metric] = s
+        }
+    }
+    return rows.Err()
+}
+
+// Добавление запроса агрегатов в пакет. Результат заполняется при чтении ответов пакета
+func (r *Reader) QueueAggregate(batch *pgx.Batch, buildingIDs []uuid.UUID, start, end time.Time, metrics []string) BuildingStats {
+    result := newBuildingStats(buildingIDs, metrics)
+    batch.Queue(aggregateSQL, buildingIDs, metrics, start, end).Query(func(rows pgx.Rows) error {
+        if err := scanBuildingStats(rows, result); err != nil {
+            return fmt.Errorf("aggregate readings: %w", err)
+        }
+        return nil
+    })
+    return result
+}
+
+// Агрегаты показателей зданий за интервал [start, end]
+func (r *Reader) Aggregate(ctx context.Context, buildingIDs []uuid.UUID, start, end time.Time, metrics ...string) (BuildingStats, error) {
+    rows, err := r.pool.Query(ctx, aggregateSQL, buildingIDs, metrics, start, end)
+    if err != nil {
+        return nil, fmt.Errorf("aggregate readings: %w", err)
+    }
+    defer rows.Close()
+
+    result := newBuildingStats(buildingIDs, metrics)
+    if err := scanBuildingStats(rows, result); err != nil {
+        return nil, fmt.Errorf("aggregate readings: %w", err)
+    }
+    return result, nil
+}
+
+// Число часов с показаниями по зданиям и показателям
+type BuildingCoverage map[uuid.UUID]map[string]int
+
+// Покрытие интервала показаниями: часы, в которых есть хотя бы одно показание.
+// Там, где остались только суточные агрегаты, сутки с данными считаются покрытыми целиком
+const coverageSQL = `
+    WITH st AS (
+        SELECT COALESCE(MAX(watermark) FILTER (WHERE resolution = 'hourly'), '-infinity') AS hourly,
+               COALESCE(MAX(watermark) FILTER (WHERE resolution = 'hourly_expired'), '-infinity') AS hourly_expired
+        FROM rollup_state
+    )
+    SELECT building_id, metric, SUM(hours)::int
+    FROM (
+        SELECT building_id, metric, 24 * COUNT(*) AS hours
+        FROM readings_daily
+        WHERE building_id = ANY($1) AND metric = ANY($2)
+        AND bucket >= date_trunc('day', $3::timestamptz AT TIME ZONE 'UTC') AT TIME ZONE 'UTC'
+        AND bucket < LEAST((SELECT hourly_expired FROM st), $4)
+        GROUP BY building_id, metric
+        UNION ALL
+        SELECT building_id, metric, COUNT(*)
+        FROM readings_hourly
+        WHERE building_id = ANY($1) AND metric = ANY($2)
+        AND bucket >= GREATEST(date_trunc('hour', $3::timestamptz AT TIME ZONE 'UTC') AT TIME ZONE 'UTC', (SELECT hourly_expired FROM st))
+        AND bucket < LEAST((SELECT hourly FROM st), $4)
+        GROUP BY building_id, metric
+        UNION ALL
+        SELECT building_id, metric, COUNT(DISTINCT date_trunc('hour', timestamp AT TIME ZONE 'UTC'))
+        FROM readings_raw
+        WHERE building_id = ANY($1) AND metric = ANY($2)
+        AND timestamp >= GREATEST($3, (SELECT hourly FROM st)) AND timestamp <= $4
+        GROUP BY building_id, metric
+    ) parts
+    GROUP BY building_id, metric`
+
+// Добавление запроса покрытия в пакет. Результат заполняется при чтении ответов пакета
+func (r *Reader) QueueCoverage(batch *pgx.Batch, buildingIDs []uuid.UUID, start, end time.Time, metrics []string) BuildingCoverage {
+    result := make(BuildingCoverage, len(buildingIDs))
+    for _, id := range buildingIDs {
+        result[id] = make(map[string]int, len(metrics))
+    }
+    batch.Queue(coverageSQL, buildingIDs, metrics, start, end).Query(func(rows pgx.Rows) error {
+        for rows.Next() {
+            var buildingID uuid.UUID
+            var metric string
+            var hours int
+            if err := rows.Scan(&buildingID, &metric, &hours); err != nil {
+                return fmt.Errorf("scan coverage: %w", err)
+            }
+            if result[buildingID] != nil {
+                result[buildingID][metric] = hours
+            }
+        }
+        return rows.Err()
+    })
+    return result
+}
+
+// Выбор разрешения ряда по длине интервала и наличию данных
+func (r *Reader) resolve(resolution string, from, to time.Time, st rollupState) string {
+    if resolution != ResolutionAuto {
+        return resolution
+    }
+    span := to.Sub(from)
+    switch {
+    case span <= autoMinuteSpan && !from.Before(st.rawExpired):
+        return ResolutionMinute
+    case span <= autoHourlySpan && !from.Before(st.hourlyExpired):
+        return ResolutionHourly
+    default:
+        return ResolutionDaily
+    }
+}
+
+// Точки ряда из суточных агрегатов ($4-$5), почасовых ($6-$7) и сырых показаний ($8-$9),
+// сгруппированные по единице $3. Имена столбцов подзапроса задает первая ветвь UNION
+const seriesSQL = `
+    SELECT bucket, SUM(s), SUM(c)::bigint, MIN(mn), MAX(mx)
+    FROM (
+        SELECT date_trunc($3, bucket AT TIME ZONE 'UTC') AT TIME ZONE 'UTC' AS bucket, sum AS s, count::bigint AS c, min AS mn, max AS mx
+        FROM readings_daily
+        WHERE building_id = $1 AND metric = $2 AND bucket >= $4 AND bucket < $5
+        UNION ALL
+        SELECT date_trunc($3, bucket AT TIME ZONE 'UTC') AT TIME ZONE 'UTC', sum, count, min, max
+        FROM readings_hourly
+        WHERE building_id = $1 AND metric = $2 AND bucket >= $6 AND bucket < $7
+        UNION ALL
+        SELECT date_trunc($3, timestamp AT TIME ZONE 'UTC') AT TIME ZONE 'UTC', value, 1, value, value
+        FROM readings_raw
+        WHERE building_id = $1 AND metric = $2 AND timestamp >= $8 AND timestamp <= $9
+    ) parts
+    GROUP BY bucket
+    ORDER BY bucket`
+
+// Временной ряд показателя. Возвращает точки и фактически использованное разрешение
+func (r *Reader) Series(ctx context.Context, buildingID uuid.UUID, metric, resolution string, from, to time.Time) ([]Point, string, error) {
+    st, err := loadState(ctx, r.pool)
+    if err != nil {
+        return nil, "", err
+    }
+    resolution = r.resolve(resolution, from, to, st)
+
+    // Интервалы источников; пустой интервал (from >= to) не дает строк
+    var unit string
+    var dailyFrom, dailyTo, hourlyFrom, hourlyTo time.Time
+    rawFrom := from
+    switch resolution {
+    case ResolutionMinute:
+        unit = "minute"
+    case ResolutionHourly:
+        unit = "hour"
+        hourlyFrom, hourlyTo = floorHour(from), earlier(st.hourly, to)
+        rawFrom = later(from, st.hourly)
+    case ResolutionDaily, ResolutionMonthly:
+        unit = "day"
+        if resolution == ResolutionMonthly {
+            unit = "month"
+        }
+        dailyFrom, dailyTo = floorDay(from), earlier(st.daily, to)
+        hourlyFrom, hourlyTo = later(floorHour(from), st.daily), earlier(st.hourly, to)
+        rawFrom = later(from, st.hourly)
+    default:
+        return nil, "", fmt.Errorf("unknown resolution %q", resolution)
+    }
+
+    rows, err := r.pool.Query(ctx, seriesSQL,
+        buildingID, metric, unit, dailyFrom, dailyTo, hourlyFrom, hourlyTo, rawFrom, to)
+    if err != nil {
+        return nil, "", fmt.Errorf("query %s series: %w", resolution, err)
+    }
+    defer rows.Close()
+
+    points := []Point{}
+    for rows.Next() {
+        var p Point
+        if err := rows.Scan(&p.Bucket, &p.Sum, &p.Count, &p.Min, &p.Max); err != nil {
+            return nil, "", fmt.Errorf("scan series point: %w", err)
+        }
+        if p.Count > 0 {
+            p.Avg = p.Sum / float64(p.Count)
+        }
+        points = append(points, p)
+    }
+    return points, resolution, rows.Err()
+}
@@ -0,0 +1,99 @@
+package timeseries
+
+import (
+    "context"
+    "os"
+    "reflect"
+    "strings"
+    "testing"
+    "time"
+
+    "github.com/google/uuid"
+    "github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Имена столбцов первой ветви UNION в подзапросе "FROM (": именно они видны внешнему запросу.
+// Столбец без псевдонима - простой идентификатор; выражение без псевдонима дает пустое имя
+func firstBranchColumns(t *testing.T, sql string) []string {
+    t.Helper()
+    start := strings.Index(sql, "FROM (")
+    if start < 0 {
+        t.Fatal("no subquery in SQL")
+    }
+    branch := sql[start+len("FROM ("):]
+    branch = branch[strings.Index(branch, "SELECT")+len("SELECT"):]
+    branch = branch[:strings.Index(branch, "\n")]
+
+    var columns []string
+    depth, from := 0, 0
+    split := func(expr string) {
+        expr = strings.TrimSpace(expr)
+        if i := strings.LastIndex(expr, " AS "); i >= 0 {
+            columns = append(columns, strings.TrimSpace(expr[i+len(" AS "):]))
+        } else if !strings.ContainsAny(expr, " ():") {
+            columns = append(columns, expr)
+        } else {
+            columns = append(columns, "")
+        }
+    }
+    for i, r := range branch {
+        switch r {
+        case '(':
+            depth++
+        case ')':
+            depth--
+        case ',':
+            if depth == 0 {
+                split(branch[from:i])
+                from = i + 1
+            }
+        }
+    }
+    split(branch[from:])
+    return columns
+}
+
+func TestReaderSQLColumns(t *testing.T) {
+    tests := []struct {
+        name string
+        sql  string
+        want []string
+    }{
+        {"series", seriesSQL, []string{"bucket", "s", "c", "mn", "mx"}},
+        {"aggregate", aggregateSQL, []string{"building_id", "metric", "s", "c", "mn", "mx"}},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            if got := firstBranchColumns(t, tt.sql); !reflect.DeepEqual(got, tt.want) {
+                t.Errorf("subquery columns = %q, want %q", got, tt.want)
+            }
+        })
+    }
+}
+
+// Запросы чтения на базе с примененными миграциями. Адрес базы - TEST_DATABASE_URL,
+// без него тест пропускается
+func TestReaderQueries(t *testing.T) {
+    url := os.Getenv("TEST_DATABASE_URL")
+    if url == "" {
+        t.Skip("TEST_DATABASE_URL is not set")
+    }
+    ctx := context.Background()
+    pool, err := pgxpool.New(ctx, url)
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer pool.Close()
+
+    r := NewReader(pool)
+    buildingID := uuid.New()
+    to := time.Now().UTC()
+    for _, resolution := range []string{ResolutionMinute, ResolutionHourly, ResolutionDaily, ResolutionMonthly, ResolutionAuto} {
+        if _, _, err := r.Series(ctx, buildingID, MetricHotWater, resolution, to.Add(-40*day), to); err != nil {
+            t.Errorf("Series(%s): %v", resolution, err)
+        }
+    }
+    if _, err := r.Aggregate(ctx, []uuid.UUID{buildingID}, to.Add(-7*day), to, MetricHotWater); err != nil {
+        t.Errorf("Aggregate: %v", err)
+    }
+}
@@ -0,0 +1,520 @@
+package timeseries
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "log/slog"
+    "time"
+
+    "service/internal/logging"
+    "service/internal/metrics"
+    "service/internal/partition"
+
+    "github.com/google/uuid"
+    "github.com/jackc/pgx/v5"
+    "github.com/jackc/pgx/v5/pgconn"
+    "github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+    // Размер шага агрегации: одна транзакция сворачивает не больше этого интервала
+    hourlyStep = day
+    dailyStep  = 31 * day
+    // Размер пачки при удалении, чтобы не держать долгие блокировки
+    deleteBatch = 10000
+    // Перекрытие окон поиска поздних показаний: created_at - время начала транзакции,
+    // поэтому строки незавершенных транзакций находятся при следующем проходе
+    lateOverlap = 5 * time.Minute
+)
+
+// Границы в rollup_state, кроме границ агрегации (ResolutionHourly, ResolutionDaily)
+const (
+    stateLate          = "late"
+    stateRawExpired    = "raw_expired"
+    stateHourlyExpired = "hourly_expired"
+)
+
+// Таблицы сырых показаний, из которых строится представление readings_raw
+var rawTables = []string{"hot_water_meters", "cold_water_meters", "temperature_readings", "meter_totals"}
+
+// Manager сворачивает сырые показания в почасовые и суточные агрегаты,
+// досчитывает агрегаты по поздним показаниям и удаляет данные старше срока хранения.
+// Целиком устаревшие партиции удаляются (или архивируются) через partitions, остаток - построчно
+type Manager struct {
+    pool       *pgxpool.Pool
+    retention  Retention
+    partitions *partition.Manager
+    log        *slog.Logger
+}
+
+func NewManager(pool *pgxpool.Pool, retention Retention, partitions *partition.Manager) *Manager {
+    return &Manager{pool: pool, retention: retention, partitions: partitions, log: logging.Component("retention")}
+}
+
+// Один проход: агрегация закрытых интервалов, досчет поздних показаний, удаление устаревших данных
+func (m *Manager) RunOnce(ctx context.Context) error {
+    // Время БД: с ним сравнивается created_at показаний
+    var scannedTo time.Time
+    if err := m.pool.QueryRow(ctx, "SELECT NOW()").Scan(&scannedTo); err != nil {
+        return fmt.Errorf("read database time: %w", err)
+    }
+
+    if err := m.rollupHourly(ctx); err != nil {
+        return err
+    }
+    if err := m.rollupDaily(ctx); err != nil {
+        return err
+    }
+    if err := m.refreshLate(ctx, scannedTo); err != nil {
+        return err
+    }
+    return m.enforceRetention(ctx, scannedTo)
+}
+
+// Состояние агрегации. Нулевое время - граница еще не установлена
+type rollupState struct {
+    hourly        time.Time // часы до границы свернуты в readings_hourly
+    daily         time.Time // сутки до границы свернуты в readings_daily
+    late          time.Time // поздние показания проверены до этого created_at
+    rawExpired    time.Time // сырые показания до границы удалены (начало часа)
+    hourlyExpired time.Time // почасовые агрегаты до границы удалены (начало суток)
+}
+
+func loadState(ctx context.Context, pool *pgxpool.Pool) (rollupState, error) {
+    rows, err := pool.Query(ctx, "SELECT resolution, watermark FROM rollup_state")
+    if err != nil {
+        return rollupState{}, fmt.Errorf("read rollup state: %w", err)
+    }
+    defer rows.Close()
+
+    var st rollupState
+    for rows.Next() {
+        var name string
+        var watermark time.Time
+        if err := rows.Scan(&name, &watermark); err != nil {
+            return rollupState{}, fmt.Errorf("scan rollup state: %w", err)
+        }
+        switch name {
+        case ResolutionHourly:
+            st.hourly = watermark.UTC()
+        case ResolutionDaily:
+            st.daily = watermark.UTC()
+        case stateLate:
+            st.late = watermark.UTC()
+        case stateRawExpired:
+            st.rawExpired = watermark.UTC()
+        case stateHourlyExpired:
+            st.hourlyExpired = watermark.UTC()
+        }
+    }
+    return st, rows.Err()
+}
+
+type execer interface {
+    Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+}
+
+// Сохранение границы
+func saveState(ctx context.Context, db execer, name string, watermark time.Time) error {
+    _, err := db.Exec(ctx, `
+        INSERT INTO rollup_state (resolution, watermark, updated_at)
+        VALUES ($1, $2, NOW())
+        ON CONFLICT (resolution) DO UPDATE SET watermark = EXCLUDED.watermark, updated_at = NOW()`,
+        name, watermark)
+    if err != nil {
+        return fmt.Errorf("update %s watermark: %w", name, err)
+    }
+    return nil
+}
+
+// Начальная граница агрегации - самое раннее показание (или почасовой агрегат)
+func (m *Manager) earliest(ctx context.Context, sql string) (time.Time, bool, error) {
+    var earliest *time.Time
+    if err := m.pool.QueryRow(ctx, sql).Scan(&earliest); err != nil {
+        return time.Time{}, false, err
+    }
+    if earliest == nil {
+        return time.Time{}, false, nil
+    }
+    return *earliest, true, nil
+}
+
+// Свертка интервала [from, to) в таблицу агрегатов и сдвиг границы в одной транзакции
+func (m *Manager) rollupStep(ctx context.Context, resolution, sql string, from, to time.Time) error {
+    tx, err := m.pool.Begin(ctx)
+    if err != nil {
+        return err
+    }
+    defer tx.Rollback(ctx)
+
+    if _, err := tx.Exec(ctx, sql, from, to); err != nil {
+        return fmt.Errorf("rollup %s %s..%s: %w", resolution, from.Format(time.RFC3339), to.Format(time.RFC3339), err)
+    }
+    if err := saveState(ctx, tx, resolution, to); err != nil {
+        return err
+    }
+    return tx.Commit(ctx)
+}
+
+// Свертка закрытых часов: от границы до начала текущего часа
+func (m *Manager) rollupHourly(ctx context.Context) error {
+    st, err := loadState(ctx, m.pool)
+    if err != nil {
+        return err
+    }
+
+    hourly := st.hourly
+    if hourly.IsZero() {
+        earliest, ok, err := m.earliest(ctx, `
+            SELECT LEAST(
+                (SELECT MIN(timestamp) FROM hot_water_meters),
+                (SELECT MIN(timestamp) FROM cold_water_meters),
+                (SELECT MIN(timestamp) FROM temperature_readings),
+                (SELECT MIN(timestamp) FROM meter_totals))`)
+        if err != nil {
+            return fmt.Errorf("find earliest reading: %w", err)
+        }
+        if !ok {
+            return nil // показаний еще нет
+        }
+        hourly = floorHour(earliest)
+    }
+
+    target := floorHour(time.Now())
+    for from := hourly; from.Before(target); {
+        to := from.Add(hourlyStep)
+        if to.After(target) {
+            to = target
+        }
+        err := m.rollupStep(ctx, ResolutionHourly, `
+            INSERT INTO readings_hourly (building_id, metric, bucket, sum, count, min, max)
+            SELECT building_id, metric, date_trunc('hour', timestamp AT TIME ZONE 'UTC') AT TIME ZONE 'UTC',
+                   SUM(value), COUNT(*), MIN(value), MAX(value)
+            FROM readings_raw
+            WHERE timestamp >= $1 AND timestamp < $2
+            GROUP BY 1, 2, 3
+            ON CONFLICT (building_id, metric, bucket) DO UPDATE
+            SET sum = EXCLUDED.sum, count = EXCLUDED.count, min = EXCLUDED.min, max = EXCLUDED.max`,
+            from, to)
+        if err != nil {
+            return err
+        }
+        m.log.Debug("hourly rollup done", "from", from, "to", to)
+        from = to
+    }
+    return nil
+}
+
+// Свертка закрытых суток из почасовых агрегатов
+func (m *Manager) rollupDaily(ctx context.Context) error {
+    st, err := loadState(ctx, m.pool)
+    if err != nil {
+        return err
+    }
+    if st.hourly.IsZero() {
+        return nil
+    }
+
+    daily := st.daily
+    if daily.IsZero() {
+        earliest, ok, err := m.earliest(ctx, "SELECT MIN(bucket) FROM readings_hourly")
+        if err != nil {
+            return fmt.Errorf("find earliest hourly bucket: %w", err)
+        }
+        if !ok {
+            return nil
+        }
+        daily = floorDay(earliest)
+    }
+
+    target := floorDay(st.hourly)
+    for from := daily; from.Before(target); {
+        to := from.Add(dailyStep)
+        if to.After(target) {
+            to = target
+        }
+        err := m.rollupStep(ctx, ResolutionDaily, `
+            INSERT INTO readings_daily (building_id, metric, bucket, sum, count, min, max)
+            SELECT building_id, metric, date_trunc('day', bucket AT TIME ZONE 'UTC') AT TIME ZONE 'UTC',
+                   SUM(sum), SUM(count), MIN(min), MAX(max)
+            FROM readings_hourly
+            WHERE bucket >= $1 AND bucket < $2
+            GROUP BY 1, 2, 3
+            ON CONFLICT (building_id, metric, bucket) DO UPDATE
+            SET sum = EXCLUDED.sum, count = EXCLUDED.count, min = EXCLUDED.min, max = EXCLUDED.max`,
+            from, to)
+        if err != nil {
+            return err
+        }
+        m.log.Debug("daily rollup done", "from", from, "to", to)
+        from = to
+    }
+    return nil
+}
+
+// Интервалы здания, затронутые поздними показаниями
+type dirtyBuckets struct {
+    buildings []uuid.UUID
+    buckets   []time.Time
+}
+
+func (d *dirtyBuckets) add(buildingID uuid.UUID, bucket time.Time) {
+    d.buildings = append(d.buildings, buildingID)
+    d.buckets = append(d.buckets, bucket)
+}
+
+// Агрегаты по интервалам из unnest($1, $2): source - источник строк с building_id и временем,
+// onConflict - замена агрегата (пересчет) или добавление к нему (досчет)
+const (
+    hourlyFromRaw = `
+        INSERT INTO readings_hourly (building_id, metric, bucket, sum, count, min, max)
+        SELECT r.building_id, r.metric, d.bucket, SUM(r.value), COUNT(*), MIN(r.value), MAX(r.value)
+        FROM unnest($1::uuid[], $2::timestamptz[]) AS d(building_id, bucket)
+        JOIN readings_raw r ON r.building_id = d.building_id
+            AND r.timestamp >= d.bucket AND r.timestamp < d.bucket + INTERVAL '1 hour'
+        GROUP BY r.building_id, r.metric, d.bucket`
+    dailyFromHourly = `
+        INSERT INTO readings_daily (building_id, metric, bucket, sum, count, min, max)
+        SELECT h.building_id, h.metric, d.bucket, SUM(h.sum), SUM(h.count), MIN(h.min), MAX(h.max)
+        FROM unnest($1::uuid[], $2::timestamptz[]) AS d(building_id, bucket)
+        JOIN readings_hourly h ON h.building_id = d.building_id
+            AND h.bucket >= d.bucket AND h.bucket < d.bucket + INTERVAL '1 day'
+        GROUP BY h.building_id, h.metric, d.bucket`
+    dailyFromRaw = `
+        INSERT INTO readings_daily (building_id, metric, bucket, sum, count, min, max)
+        SELECT r.building_id, r.metric, d.bucket, SUM(r.value), COUNT(*), MIN(r.value), MAX(r.value)
+        FROM unnest($1::uuid[], $2::timestamptz[]) AS d(building_id, bucket)
+        JOIN readings_raw r ON r.building_id = d.building_id
+            AND r.timestamp >= d.bucket AND r.timestamp < d.bucket + INTERVAL '1 day'
+        GROUP BY r.building_id, r.metric, d.bucket`
+
+    replaceOnConflict = `
+        ON CONFLICT (building_id, metric, bucket) DO UPDATE
+        SET sum = EXCLUDED.sum, count = EXCLUDED.count, min = EXCLUDED.min, max = EXCLUDED.max`
+    hourlyAddOnConflict = `
+        ON CONFLICT (building_id, metric, bucket) DO UPDATE
+        SET sum = readings_hourly.sum + EXCLUDED.sum, count = readings_hourly.count + EXCLUDED.count,
+            min = LEAST(readings_hourly.min, EXCLUDED.min), max = GREATEST(readings_hourly.max, EXCLUDED.max)`
+    dailyAddOnConflict = `
+        ON CONFLICT (building_id, metric, bucket) DO UPDATE
+        SET sum = readings_daily.sum + EXCLUDED.sum, count = readings_daily.count + EXCLUDED.count,
+            min = LEAST(readings_daily.min, EXCLUDED.min), max = GREATEST(readings_daily.max, EXCLUDED.max)`
+)
+
+// Досчет агрегатов по поздним показаниям: записанным после прошлой проверки,
+// но со временем в уже свернутом часе (догрузка истории, задержка шлюза телеметрии).
+// Если сырые показания часа еще хранятся, час пересчитывается целиком. Если уже удалены,
+// в таблице остались только поздние строки, и их агрегат добавляется к сохраненному
+// (сами строки удаляются в том же проходе, поэтому повторно не учитываются).
+// Для накопительных показаний вместо времени записи берется время расчета расхода:
+// расход уже записанного показания меняется, если перед ним пришло более раннее.
+// Позднее показание ГВС или ХВС меняет и объем следующего показания того же счетчика (интервал
+// до предыдущего показания не длиннее часа), поэтому пересчитывается и следующий час
+func (m *Manager) refreshLate(ctx context.Context, scannedTo time.Time) error {
+    st, err := loadState(ctx, m.pool)
+    if err != nil {
+        return err
+    }
+    if st.hourly.IsZero() || st.late.IsZero() {
+        // Проверка начинается с текущего момента: более ранние строки учтены обычной агрегацией
+        return saveState(ctx, m.pool, stateLate, scannedTo)
+    }
+
+    rows, err := m.pool.Query(ctx, `
+        SELECT DISTINCT building_id, date_trunc('hour', timestamp AT TIME ZONE 'UTC') AT TIME ZONE 'UTC'
+        FROM (
+            SELECT building_id, timestamp, created_at FROM hot_water_meters
+            UNION ALL
+            SELECT building_id, timestamp + INTERVAL '1 hour', created_at FROM hot_water_meters
+            UNION ALL
+            SELECT i.building_id, c.timestamp, c.created_at
+            FROM cold_water_meters c JOIN itp i ON i.id = c.itp_id
+            UNION ALL
+            SELECT i.building_id, c.timestamp + INTERVAL '1 hour', c.created_at
+            FROM cold_water_meters c JOIN itp i ON i.id = c.itp_id
+            UNION ALL
+            SELECT building_id, timestamp, created_at FROM temperature_readings
+            UNION ALL
+            SELECT t.building_id, mt.timestamp, mt.derived_at
+            FROM meter_totals mt JOIN totalizers t ON t.id = mt.totalizer_id
+        ) r
+        WHERE created_at >= $1 AND created_at < $2 AND timestamp < $3`,
+        st.late.Add(-lateOverlap), scannedTo, st.hourly)
+    if err != nil {
+        return fmt.Errorf("find late readings: %w", err)
+    }
+
+    var recompute, merge dirtyBuckets
+    days := make(map[uuid.UUID]map[time.Time]bool)
+    for rows.Next() {
+        var buildingID uuid.UUID
+        var hour time.Time
+        if err := rows.Scan(&buildingID, &hour); err != nil {
+            rows.Close()
+            return fmt.Errorf("scan late bucket: %w", err)
+        }
+        hour = hour.UTC()
+        if hour.Before(st.rawExpired) {
+            merge.add(buildingID, hour)
+        } else {
+            recompute.add(buildingID, hour)
+        }
+        if floorDay(hour).Before(st.daily) {
+            if days[buildingID] == nil {
+                days[buildingID] = make(map[time.Time]bool)
+            }
+            days[buildingID][floorDay(hour)] = true
+        }
+    }
+    rows.Close()
+    if err := rows.Err(); err != nil {
+        return fmt.Errorf("find late readings: %w", err)
+    }
+
+    // Сутки, почасовые агрегаты которых еще хранятся, пересчитываются из них,
+    // остальные досчитываются из поздних сырых строк
+    var dayRecompute, dayMerge dirtyBuckets
+    for buildingID, set := range days {
+        for d := range set {
+            if d.Before(st.hourlyExpired) {
+                dayMerge.add(buildingID, d)
+            } else {
+                dayRecompute.add(buildingID, d)
+            }
+        }
+    }
+
+    tx, err := m.pool.Begin(ctx)
+    if err != nil {
+        return err
+    }
+    defer tx.Rollback(ctx)
+
+    steps := []struct {
+        name string
+        sql  string
+        set  dirtyBuckets
+    }{
+        {"recompute hourly", hourlyFromRaw + replaceOnConflict, recompute},
+        {"merge hourly", hourlyFromRaw + hourlyAddOnConflict, merge},
+        {"recompute daily", dailyFromHourly + replaceOnConflict, dayRecompute},
+        {"merge daily", dailyFromRaw + dailyAddOnConflict, dayMerge},
+    }
+    for _, step := range steps {
+        if len(step.set.buckets) == 0 {
+            continue
+        }
+        if _, err := tx.Exec(ctx, step.sql, step.set.buildings, step.set.buckets); err != nil {
+            return fmt.Errorf("%s for late readings: %w", step.name, err)
+        }
+    }
+    if err := saveState(ctx, tx, stateLate, scannedTo); err != nil {
+        return err
+    }
+    if err := tx.Commit(ctx); err != nil {
+        return err
+    }
+
+    if n := len(recompute.buckets) + len(merge.buckets); n > 0 {
+        m.log.Info("late readings rolled up", "hours", n, "days", len(dayRecompute.buckets)+len(dayMerge.buckets))
+    }
+    return nil
+}
+
+// Удаление данных старше срока хранения. Сырые показания удаляются только
+// в пределах уже свернутых часов, почасовые агрегаты - в пределах свернутых суток.
+// Границы удаления выравниваются по часу и суткам, чтобы досчет поздних показаний
+// различал полностью удаленные интервалы
+func (m *Manager) enforceRetention(ctx context.Context, scannedTo time.Time) error {
+    st, err := loadState(ctx, m.pool)
+    if err != nil {
+        return err
+    }
+    now := time.Now()
+
+    // Удаление выполняется и без сдвига границы: поздние строки за удаленные часы,
+    // уже досчитанные в агрегаты, не должны попасть в следующую проверку
+    if cutoff := floorHour(retainedFrom(now, m.retention.Raw, st.hourly)); !cutoff.IsZero() {
+        for _, table := range rawTables {
+            // Строки, записанные после проверки, остаются до следующего прохода
+            if err := m.expireReadings(ctx, table, cutoff, scannedTo); err != nil {
+                return err
+            }
+        }
+        if cutoff.After(st.rawExpired) {
+            if err := saveState(ctx, m.pool, stateRawExpired, cutoff); err != nil {
+                return err
+            }
+        }
+    }
+    // Данные насосов не агрегируются, поэтому срок хранения не ограничен границей агрегации
+    if m.retention.Pump > 0 {
+        if err := m.expireReadings(ctx, "pump_data", now.Add(-m.retention.Pump), time.Time{}); err != nil {
+            return err
+        }
+    }
+    if cutoff := floorDay(retainedFrom(now, m.retention.Hourly, st.daily)); !cutoff.IsZero() {
+        if err := m.deleteBefore(ctx, "readings_hourly", "bucket", cutoff, time.Time{}); err != nil {
+            return err
+        }
+        if cutoff.After(st.hourlyExpired) {
+            if err := saveState(ctx, m.pool, stateHourlyExpired, cutoff); err != nil {
+                return err
+            }
+        }
+    }
+    if m.retention.Daily > 0 {
+        if err := m.deleteBefore(ctx, "readings_daily", "bucket", now.Add(-m.retention.Daily), time.Time{}); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+// Удаление показаний таблицы старше cutoff: сначала целые партиции, затем оставшиеся строки
+func (m *Manager) expireReadings(ctx context.Context, table string, cutoff, createdBefore time.Time) error {
+    if m.partitions != nil {
+        if _, err := m.partitions.ExpireBefore(ctx, table, cutoff); err != nil {
+            return err
+        }
+    }
+    return m.deleteBefore(ctx, table, "timestamp", cutoff, createdBefore)
+}
+
+// Удаление строк таблицы с column < cutoff пачками. Если задан createdBefore,
+// удаляются только строки, записанные раньше него.
+// ctid уникален только внутри партиции, поэтому строки отбираются по паре (tableoid, ctid)
+func (m *Manager) deleteBefore(ctx context.Context, table, column string, cutoff, createdBefore time.Time) error {
+    args := []any{cutoff}
+    filter := ""
+    if !createdBefore.IsZero() {
+        filter = " AND created_at < $2"
+        args = append(args, createdBefore)
+    }
+    sql := fmt.Sprintf(`
+        DELETE FROM %[1]s
+        WHERE (tableoid, ctid) IN (SELECT tableoid, ctid FROM %[1]s WHERE %[2]s < $1%[3]s LIMIT %[4]d)`,
+        pgx.Identifier{table}.Sanitize(), column, filter, deleteBatch)
+
+    var total int64
+    for {
+        tag, err := m.pool.Exec(ctx, sql, args...)
+        if err != nil {
+            return fmt.Errorf("delete from %s before %s: %w", table, cutoff.Format(time.RFC3339), err)
+        }
+        total += tag.RowsAffected()
+        metrics.RetentionDeleted.WithLabelValues(table).Add(float64(tag.RowsAffected()))
+        if tag.RowsAffected() < deleteBatch {
+            break
+        }
+        if err := ctx.Err(); err != nil {
+            return errors.Join(fmt.Errorf("delete from %s interrupted", table), err)
+        }
+    }
+
+    if total > 0 {
+        m.log.Info("expired rows deleted", "table", table, "before", cutoff, "rows", total)
+    }
+    return nil
+}
@@ -0,0 +1,125 @@
+package timeseries
+
+import (
+    "fmt"
+    "strconv"
+    "strings"
+    "time"
+
+    "github.com/google/uuid"
+)
+
+// Показатели, которые сворачиваются в агрегаты (см. представление readings_raw)
+const (
+    MetricHotWater    = "hot_water"
+    MetricHotWaterCh1 = "hot_water_ch1"
+    MetricHotWaterCh2 = "hot_water_ch2"
+    MetricColdWater   = "cold_water"
+    MetricSupplyTemp  = "supply_temp"
+    MetricReturnTemp  = "return_temp"
+    MetricDeltaTemp   = "delta_temp"
+    MetricHeatEnergy  = "heat_energy"       // тепловая энергия ГВС за интервал показания, Гкал
+    MetricHotVolume   = "hot_water_volume"  // объем ГВС за интервал показания (расход * время), м³
+    MetricColdVolume  = "cold_water_volume" // объем ХВС за интервал показания, м³
+)
+
+var knownMetrics = map[string]bool{
+    MetricHotWater: true, MetricHotWaterCh1: true, MetricHotWaterCh2: true, MetricColdWater: true,
+    MetricSupplyTemp: true, MetricReturnTemp: true, MetricDeltaTemp: true, MetricHeatEnergy: true,
+    MetricHotVolume: true, MetricColdVolume: true,
+}
+
+// Проверка названия показателя
+func ValidMetric(metric string) bool {
+    return knownMetrics[metric]
+}
+
+// Показатель одного ИТП здания: расход или объем ГВС или ХВС через этот ИТП
+func ITPMetric(metric string, itpID uuid.UUID) string {
+    return metric + ":" + itpID.String()
+}
+
+// Разрешения временных рядов. hourly и daily также названия границ в rollup_state
+const (
+    ResolutionAuto    = "auto"
+    ResolutionMinute  = "minute" // поминутные точки из сырых показаний
+    ResolutionHourly  = "hourly"
+    ResolutionDaily   = "daily"
+    ResolutionMonthly = "monthly" // по календарным месяцам (UTC) из суточных агрегатов; auto его не выбирает
+)
+
+// Проверка названия разрешения
+func ValidResolution(resolution string) bool {
+    switch resolution {
+    case ResolutionAuto, ResolutionMinute, ResolutionHourly, ResolutionDaily, ResolutionMonthly:
+        return true
+    }
+    return false
+}
+
+const day = 24 * time.Hour
+
+// Сроки хранения по разрешениям. Нулевой срок - хранить бессрочно
+type Retention struct {
+    Raw    time.Duration
+    Hourly time.Duration
+    Daily  time.Duration
+    Pump   time.Duration // данные насосов (не агрегируются)
+}
+
+// Сырые показания хранятся не дольше почасовых агрегатов: досчет поздних показаний
+// за сутки без почасовых агрегатов опирается на то, что сырых данных за них тоже нет
+func (r Retention) Validate() error {
+    if r.Raw < 0 || r.Hourly < 0 || r.Daily < 0 || r.Pump < 0 {
+        return fmt.Errorf("retention must not be negative")
+    }
+    if r.Hourly > 0 && r.Raw == 0 {
+        return fmt.Errorf("raw data cannot be kept forever while hourly aggregates expire")
+    }
+    if r.Hourly > 0 && r.Raw > r.Hourly {
+        return fmt.Errorf("raw retention %s must not exceed hourly retention %s", r.Raw, r.Hourly)
+    }
+    return nil
+}
+
+// Разбор срока хранения: "7d", "36h", "0" (бессрочно)
+func ParseRetention(value string) (time.Duration, error) {
+    value = strings.TrimSpace(value)
+    if value == "" || value == "0" {
+        return 0, nil
+    }
+    if days, ok := strings.CutSuffix(value, "d"); ok {
+        n, err := strconv.Atoi(days)
+        if err != nil || n < 0 {
+            return 0, fmt.Errorf("invalid retention %q", value)
+        }
+        return time.Duration(n) * day, nil
+    }
+    d, err := time.ParseDuration(value)
+    if err != nil || d < 0 {
+        return 0, fmt.Errorf("invalid retention %q", value)
+    }
+    return d, nil
+}
+
+// Начало суток в UTC: суточные агрегаты строятся по UTC
+func floorDay(t time.Time) time.Time {
+    return t.UTC().Truncate(day)
+}
+
+func floorHour(t time.Time) time.Time {
+    return t.UTC().Truncate(time.Hour)
+}
+
+// Граница, с которой еще хранятся сырые показания или почасовые агрегаты:
+// удаление никогда не заходит дальше границы агрегации watermark
+func retainedFrom(now time.Time, retention time.Duration, watermark time.Time) time.Time {
+    if retention <= 0 {
+        return time.Time{}
+    }
+    cutoff := now.Add(-retention)
+    if watermark.Before(cutoff) {
+        return watermark
+    }
+    return cutoff
+}
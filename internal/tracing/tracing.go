@@ -0,0 +1,104 @@
+package tracing
+
+import (
+    "context"
+    "fmt"
+    "io"
+    "os"
+    "strings"
+
+    "go.opentelemetry.io/otel"
+    "go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+    "go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+    "go.opentelemetry.io/otel/propagation"
+    "go.opentelemetry.io/otel/sdk/resource"
+    sdktrace "go.opentelemetry.io/otel/sdk/trace"
+    semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+    "go.opentelemetry.io/otel/trace"
+)
+
+const ServiceName = "itp-monitoring"
+
+// Экспортеры спанов
+const (
+    ExporterNone   = "none"
+    ExporterOTLP   = "otlp"
+    ExporterStdout = "stdout"
+    ExporterFile   = "file"
+)
+
+// Config - настройки трассировки
+type Config struct {
+    Exporter string // none, otlp, stdout, file
+    File     string // путь для экспортера file
+}
+
+// Setup настраивает глобальный TracerProvider. Для otlp адрес коллектора и заголовки
+// берутся из стандартных переменных OTEL_EXPORTER_OTLP_*; имя сервиса - из OTEL_SERVICE_NAME.
+// Возвращает функцию, которая отправляет накопленные спаны при остановке сервиса
+func Setup(ctx context.Context, cfg Config) (func(context.Context) error, error) {
+    otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+        propagation.TraceContext{}, propagation.Baggage{}))
+
+    exporterName := strings.ToLower(cfg.Exporter)
+    if exporterName == "" || exporterName == ExporterNone {
+        return func(context.Context) error { return nil }, nil
+    }
+
+    var exporter sdktrace.SpanExporter
+    var closer io.Closer
+    var err error
+    switch exporterName {
+    case ExporterOTLP:
+        exporter, err = otlptracehttp.New(ctx)
+    case ExporterStdout:
+        exporter, err = stdouttrace.New(stdouttrace.WithPrettyPrint())
+    case ExporterFile:
+        if cfg.File == "" {
+            return nil, fmt.Errorf("trace file path is required for the file exporter")
+        }
+        var f *os.File
+        f, err = os.OpenFile(cfg.File, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+        if err != nil {
+            return nil, fmt.Errorf("open trace file: %w", err)
+        }
+        closer = f
+        exporter, err = stdouttrace.New(stdouttrace.WithWriter(f))
+    default:
+        return nil, fmt.Errorf("unknown trace exporter %q", cfg.Exporter)
+    }
+    if err != nil {
+        return nil, fmt.Errorf("create %s trace exporter: %w", exporterName, err)
+    }
+
+    res, err := resource.Merge(resource.Default(), resource.NewSchemaless(semconv.ServiceName(ServiceName)))
+    if err != nil {
+        return nil, fmt.Errorf("build trace resource: %w", err)
+    }
+    // OTEL_SERVICE_NAME и OTEL_RESOURCE_ATTRIBUTES имеют приоритет над значениями по умолчанию
+    res, err = resource.Merge(res, resource.Environment())
+    if err != nil {
+        return nil, fmt.Errorf("build trace resource: %w", err)
+    }
+
+    provider := sdktrace.NewTracerProvider(
+        sdktrace.WithBatcher(exporter),
+        sdktrace.WithResource(res),
+    )
+    otel.SetTracerProvider(provider)
+
+    return func(ctx context.Context) error {
+        err := provider.Shutdown(ctx)
+        if closer != nil {
+            if cerr := closer.Close(); err == nil {
+                err = cerr
+            }
+        }
+        return err
+    }, nil
+}
+
+// Трассировщик компонента. Пока Setup не вызван, спаны не записываются
+func Tracer(name string) trace.Tracer {
+    return otel.Tracer("service/internal/" + name)
+}
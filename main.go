@@ -2,33 +2,167 @@ package main
 
 import (
     "context"
+    crand "crypto/rand"
+    "encoding/hex"
     "fmt"
-    "log"
-    "math/rand"
+    "log/slog"
     "net/http"
     "os"
+    "os/signal"
+    "strconv"
+    "strings"
+    "sync"
+    "syscall"
     "time"
 
     "service/internal/api"
+    "service/internal/audit"
+    "service/internal/auth"
+    "service/internal/benchmark"
     "service/internal/database"
+    "service/internal/fleet"
+    "service/internal/health"
+    "service/internal/incident"
+    "service/internal/jobs"
+    "service/internal/logging"
+    "service/internal/meter"
+    "service/internal/metrics"
+    "service/internal/network"
+    "service/internal/partition"
+    "service/internal/quality"
+    "service/internal/risk"
     "service/internal/service"
+    "service/internal/tariff"
+    "service/internal/tenant"
+    "service/internal/timeseries"
+    "service/internal/tracing"
 
     "github.com/gin-gonic/gin"
     "github.com/gin-contrib/cors"
     "github.com/gorilla/websocket"
     "github.com/jackc/pgx/v5/pgxpool"
     "github.com/google/uuid"
+    "go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
 )
 
-var upgrader = websocket.Upgrader{
-    CheckOrigin: func(r *http.Request) bool {
-        return true // В продакшене нужно ограничить домены
-    },
+// Origin проверяется по списку CORS_ALLOWED_ORIGINS (задается в main), чтобы чужой сайт
+// не мог открыть /ws с токеном из ?token= от имени пользователя
+var upgrader = websocket.Upgrader{}
+
+// Проверка Origin запроса WebSocket. Запросы без Origin (не из браузера) допускаются
+func allowOrigins(origins []string) func(r *http.Request) bool {
+    allowed := make(map[string]bool, len(origins))
+    for _, origin := range origins {
+        allowed[strings.ToLower(strings.TrimRight(strings.TrimSpace(origin), "/"))] = true
+    }
+    return func(r *http.Request) bool {
+        origin := r.Header.Get("Origin")
+        return origin == "" || allowed[strings.ToLower(origin)]
+    }
+}
+
+// Клиент WebSocket. Получает обновления только по зданиям своей управляющей компании
+type wsClient struct {
+    conn  *websocket.Conn
+    scope tenant.Scope
+    mu    sync.Mutex // gorilla/websocket не допускает параллельную запись в соединение
+}
+
+func (cl *wsClient) writeJSON(v interface{}) error {
+    cl.mu.Lock()
+    defer cl.mu.Unlock()
+    return cl.conn.WriteJSON(v)
 }
 
-var wsConnections = make(map[*websocket.Conn]bool)
+var wsConnections = make(map[*websocket.Conn]*wsClient)
+var wsMu sync.Mutex
+var wsLog *slog.Logger
 var dataGenerator *service.DataGenerator
 
+func wsClientCount() int {
+    wsMu.Lock()
+    defer wsMu.Unlock()
+    return len(wsConnections)
+}
+
+// Чтение переменной окружения со значением по умолчанию
+func getEnv(key, def string) string {
+    if value := os.Getenv(key); value != "" {
+        return value
+    }
+    return def
+}
+
+// Срок хранения из переменной окружения ("7d", "36h", "0" - бессрочно)
+func retentionEnv(key, def string) time.Duration {
+    d, err := timeseries.ParseRetention(getEnv(key, def))
+    if err != nil {
+        fatal("invalid "+key, err)
+    }
+    return d
+}
+
+// Положительная длительность из окружения (формат time.ParseDuration)
+func durationEnv(key, def string) time.Duration {
+    d, err := time.ParseDuration(getEnv(key, def))
+    if err == nil && d <= 0 {
+        err = fmt.Errorf("duration must be positive")
+    }
+    if err != nil {
+        fatal("invalid "+key, err)
+    }
+    return d
+}
+
+// Запись в журнал и завершение процесса
+func fatal(msg string, err error) {
+    slog.Error(msg, logging.Err(err))
+    os.Exit(1)
+}
+
+// Случайная строка для секретов, не заданных в окружении
+func randomSecret(n int) string {
+    buf := make([]byte, n)
+    if _, err := crand.Read(buf); err != nil {
+        fatal("failed to generate secret", err)
+    }
+    return hex.EncodeToString(buf)
+}
+
+// Создание администратора, если в системе еще нет пользователей.
+// Сгенерированный пароль записывается в файл ADMIN_PASSWORD_FILE (только для владельца), в журнал он не попадает
+func ensureAdminUser(users *auth.UserStore) {
+    username := getEnv("ADMIN_USERNAME", "admin")
+    password := os.Getenv("ADMIN_PASSWORD")
+    passwordFile := getEnv("ADMIN_PASSWORD_FILE", "admin_password")
+    generated := password == ""
+    if generated {
+        password = randomSecret(12)
+        // Файл пишется до создания пользователя, чтобы пароль не потерялся при ошибке записи
+        if err := os.WriteFile(passwordFile, []byte(password+"\n"), 0o600); err != nil {
+            slog.Error("could not write generated admin password, set ADMIN_PASSWORD", "file", passwordFile, logging.Err(err))
+            return
+        }
+    }
+
+    created, err := users.EnsureAdmin(context.Background(), username, password)
+    if generated && !created {
+        if err := os.Remove(passwordFile); err != nil {
+            slog.Warn("could not remove unused admin password file", "file", passwordFile, logging.Err(err))
+        }
+    }
+    if err != nil {
+        slog.Warn("could not create admin user", logging.Err(err))
+        return
+    }
+
+    if created && generated {
+        slog.Warn("created admin user with generated password", "username", username, "password_file", passwordFile)
+    } else if created {
+        slog.Info("created admin user", "username", username)
+    }
+}
+
 // Вспомогательная функция для создания тестовых зданий
 func createTestBuildings(pool *pgxpool.Pool) error {
     ctx := context.Background()
@@ -41,7 +175,7 @@ func createTestBuildings(pool *pgxpool.Pool) error {
     }
     
     if count > 0 {
-        log.Printf("Buildings already exist: %d", count)
+        slog.Info("buildings already exist", "count", count)
         return nil
     }
     
@@ -88,88 +222,28 @@ func createTestBuildings(pool *pgxpool.Pool) error {
             VALUES ($1, $2, $3, NOW(), NOW())`,
             itpID, fmt.Sprintf("ИТП-%s", b.unomID), b.id)
         if err != nil {
-            log.Printf("Warning: failed to create ITP for building %s: %v", b.address, err)
+            slog.Warn("failed to create ITP", "building_id", b.id, logging.Err(err))
         }
     }
 
-    log.Printf("Created %d test buildings", len(buildings))
+    slog.Info("created test buildings", "count", len(buildings))
     return nil
 }
 
-// Вспомогательная функция для генерации исторических данных
-func generateHistoricalData(pool *pgxpool.Pool, days int) error {
-    ctx := context.Background()
-    
-    // Получаем все здания
-    rows, err := pool.Query(ctx, "SELECT id FROM buildings")
+func main() {
+    // Структурированный журнал в формате JSON
+    logging.Setup(getEnv("LOG_LEVEL", "info"))
+    wsLog = logging.Component("ws")
+
+    // Трассировка OpenTelemetry: OTEL_TRACES_EXPORTER=otlp|stdout|file|none
+    shutdownTracing, err := tracing.Setup(context.Background(), tracing.Config{
+        Exporter: getEnv("OTEL_TRACES_EXPORTER", tracing.ExporterNone),
+        File:     getEnv("OTEL_TRACES_FILE", "traces.json"),
+    })
     if err != nil {
-        return err
+        fatal("failed to set up tracing", err)
     }
-    defer rows.Close()
-
-    var buildingIDs []uuid.UUID
-    for rows.Next() {
-        var id uuid.UUID
-        if err := rows.Scan(&id); err != nil {
-            continue
-        }
-        buildingIDs = append(buildingIDs, id)
-    }
-
-    if len(buildingIDs) == 0 {
-        return fmt.Errorf("no buildings found")
-    }
-
-    baseTime := time.Now().AddDate(0, 0, -days)
-    
-    log.Printf("Generating historical data for %d buildings over %d days...", len(buildingIDs), days)
-    
-    for _, buildingID := range buildingIDs {
-        // Получаем ITP для здания
-        var itpID uuid.UUID
-        err = pool.QueryRow(ctx, "SELECT id FROM itp WHERE building_id = $1 LIMIT 1", buildingID).Scan(&itpID)
-        if err != nil {
-            continue
-        }
-
-        // Генерируем данные за каждый день
-        for i := 0; i < days; i++ {
-            currentTime := baseTime.AddDate(0, 0, i)
-            
-            // Реалистичные данные для МКД
-            hotWaterFlow1 := 2 + rand.Intn(4)
-            hotWaterFlow2 := 1 + rand.Intn(3)
-            coldWaterFlow := 3 + rand.Intn(7)
-
-            // Данные ГВС
-            pool.Exec(ctx, `
-                INSERT INTO hot_water_meters (id, building_id, flow_rate_ch1, flow_rate_ch2, timestamp, created_at)
-                VALUES ($1, $2, $3, $4, $5, NOW())`,
-                uuid.New(), buildingID, hotWaterFlow1, hotWaterFlow2, currentTime)
-
-            // Данные ХВС
-            pool.Exec(ctx, `
-                INSERT INTO cold_water_meters (id, itp_id, flow_rate, timestamp, created_at)
-                VALUES ($1, $2, $3, $4, NOW())`,
-                uuid.New(), itpID, coldWaterFlow, currentTime)
-
-            // Температурные данные
-            supplyTemp := 65 + rand.Intn(5)
-            returnTemp := 42 + rand.Intn(4)
-            deltaTemp := supplyTemp - returnTemp
-            
-            pool.Exec(ctx, `
-                INSERT INTO temperature_readings (id, building_id, supply_temp, return_temp, delta_temp, timestamp, created_at)
-                VALUES ($1, $2, $3, $4, $5, $6, NOW())`,
-                uuid.New(), buildingID, supplyTemp, returnTemp, deltaTemp, currentTime)
-        }
-    }
-
-    log.Printf("Historical data generation completed for %d days", days)
-    return nil
-}
 
-func main() {
     // Конфигурация базы данных
     dbConfig := database.Config{
         Host:     "localhost",
@@ -183,18 +257,28 @@ func main() {
     // Подключение к базе данных
     pool, err := database.NewPool(dbConfig)
     if err != nil {
-        log.Fatalf("Failed to connect to database: %v", err)
+        fatal("failed to connect to database", err)
     }
     defer pool.Close()
 
     // Создаем генератор данных
     dataGenerator = service.NewDataGenerator(pool)
+    dataGenerator.OnRealtimeUpdate = func(buildingID uuid.UUID, organizationID *uuid.UUID, data interface{}) {
+        broadcastRealtimeData(buildingID.String(), organizationID, data)
+    }
+
+    // Журнал аудита
+    auditRec := audit.NewRecorder(pool)
 
     // Запускаем генерацию данных если включено
     if os.Getenv("ENABLE_DATA_GENERATION") == "true" {
         ctx := context.Background()
         dataGenerator.StartContinuousGeneration(ctx)
-        log.Println("Continuous data generation enabled")
+        slog.Info("continuous data generation enabled")
+        if err := auditRec.RecordSystem(ctx, "startup", audit.ActionGeneratorStart, "generator", "",
+            map[string]bool{"running": false}, map[string]bool{"running": true}); err != nil {
+            slog.Error("record audit entry failed", logging.Err(err))
+        }
     }
 
     // Заполняем начальные данные если нужно
@@ -202,29 +286,174 @@ func main() {
         // Создаем тестовые здания
         err := createTestBuildings(pool)
         if err != nil {
-            log.Printf("Warning: could not create test buildings: %v", err)
+            slog.Warn("could not create test buildings", logging.Err(err))
         } else {
-            log.Println("Test buildings created successfully")
+            slog.Info("test buildings created")
         }
         
         // Заполняем историческими данными
-        err = generateHistoricalData(pool, 7) // 7 дней данных
+        err = dataGenerator.GenerateCompleteHistoricalData(context.Background(), 7) // 7 дней данных
         if err != nil {
-            log.Printf("Warning: could not fill initial data: %v", err)
+            slog.Warn("could not fill initial data", logging.Err(err))
         } else {
-            log.Println("Initial data filled successfully")
+            slog.Info("initial data filled")
+            if err := auditRec.RecordSystem(context.Background(), "startup", audit.ActionHistoryGenerate, "", "",
+                nil, map[string]int{"days": 7}); err != nil {
+                slog.Error("record audit entry failed", logging.Err(err))
+            }
         }
     }
 
-    // Создание HTTP сервера
-    router := gin.Default()
+    // Аутентификация
+    jwtSecret := os.Getenv("JWT_SECRET")
+    if jwtSecret == "" {
+        jwtSecret = randomSecret(32)
+        slog.Warn("JWT_SECRET is not set, using a random secret (tokens will not survive restart)")
+    }
+    tokenTTL, err := time.ParseDuration(getEnv("JWT_TTL", "12h"))
+    if err != nil {
+        fatal("invalid JWT_TTL", err)
+    }
+    tokens := auth.NewTokenManager(jwtSecret, tokenTTL)
+    users := auth.NewUserStore(pool)
+    apiKeys := auth.NewAPIKeyStore(pool)
+    ensureAdminUser(users)
 
-    // Настройка CORS
+    // Проверки живости и готовности
+    probeTimeout, err := time.ParseDuration(getEnv("HEALTH_CHECK_TIMEOUT", "2s"))
+    if err != nil {
+        fatal("invalid HEALTH_CHECK_TIMEOUT", err)
+    }
+    liveness := health.NewChecker(probeTimeout)
+    liveness.Register("generator", true, func(context.Context) (string, error) {
+        return dataGenerator.CheckAlive()
+    })
+    readiness := health.NewChecker(probeTimeout)
+    readiness.Register("database", true, health.DatabasePing(pool))
+    readiness.Register("migrations", true, health.MigrationVersion(pool, getEnv("MIGRATIONS_DIR", "db/migration")))
+
+    // Агрегация показаний и срок хранения: сырые данные сворачиваются в почасовые и суточные агрегаты
+    retention := timeseries.Retention{
+        Raw:    retentionEnv("RAW_RETENTION", "7d"),
+        Hourly: retentionEnv("HOURLY_RETENTION", "90d"),
+        Daily:  retentionEnv("DAILY_RETENTION", "0"),
+        Pump:   retentionEnv("PUMP_RETENTION", "0"),
+    }
+    if err := retention.Validate(); err != nil {
+        fatal("invalid retention settings", err)
+    }
+    rollupInterval, err := time.ParseDuration(getEnv("ROLLUP_INTERVAL", "1m"))
+    if err == nil && rollupInterval <= 0 {
+        err = fmt.Errorf("interval must be positive")
+    }
+    if err != nil {
+        fatal("invalid ROLLUP_INTERVAL", err)
+    }
+    // Помесячные партиции таблиц показаний: создаются заранее, устаревшие удаляются или архивируются
+    partitionsAhead, err := strconv.Atoi(getEnv("PARTITIONS_AHEAD", "3"))
+    if err != nil {
+        fatal("invalid PARTITIONS_AHEAD", err)
+    }
+    partitions, err := partition.NewManager(pool, partitionsAhead, getEnv("PARTITION_EXPIRE_MODE", partition.ModeDrop))
+    if err != nil {
+        fatal("invalid partition settings", err)
+    }
+    readings := timeseries.NewReader(pool)
+    scheduler := jobs.NewScheduler()
+    scheduler.Every("partitions", time.Hour, partitions.EnsureFuture)
+    scheduler.Every("rollup", rollupInterval, timeseries.NewManager(pool, retention, partitions).RunOnce)
+    // Проверка парка зданий: состояние для сводки и открытие/закрытие инцидентов
+    fleetInterval, err := time.ParseDuration(getEnv("FLEET_INTERVAL", "5m"))
+    if err == nil && fleetInterval <= 0 {
+        err = fmt.Errorf("interval must be positive")
+    }
+    if err != nil {
+        fatal("invalid FLEET_INTERVAL", err)
+    }
+    fleetDays, err := strconv.Atoi(getEnv("FLEET_ANALYSIS_DAYS", "1"))
+    if err != nil {
+        fatal("invalid FLEET_ANALYSIS_DAYS", err)
+    }
+    staleAfter, err := time.ParseDuration(getEnv("FLEET_STALE_AFTER", "1h"))
+    if err != nil {
+        fatal("invalid FLEET_STALE_AFTER", err)
+    }
+    // Оценка риска: веса факторов (water_balance, temperature, pump, data_gaps, incidents) и срок хранения истории
+    riskWeights, err := risk.ParseWeights(os.Getenv("RISK_WEIGHTS"))
+    if err != nil {
+        fatal("invalid RISK_WEIGHTS", err)
+    }
+    slog.Info("risk score weights", "weights", riskWeights.String())
+    incidents := incident.NewStore(pool)
+    // Ситуации: одновременные (в пределах CORRELATION_WINDOW) аномалии не менее чем NETWORK_MIN_BUILDINGS зданий
+    // с общим узлом сети (не меньше доли NETWORK_MIN_SHARE его зданий) или соседних (не дальше CORRELATION_RADIUS м)
+    networkMinBuildings, err := strconv.Atoi(getEnv("NETWORK_MIN_BUILDINGS", "2"))
+    if err != nil {
+        fatal("invalid NETWORK_MIN_BUILDINGS", err)
+    }
+    networkMinShare, err := strconv.ParseFloat(getEnv("NETWORK_MIN_SHARE", "0.5"), 64)
+    if err != nil {
+        fatal("invalid NETWORK_MIN_SHARE", err)
+    }
+    correlationRadius, err := strconv.ParseFloat(getEnv("CORRELATION_RADIUS", "300"), 64)
+    if err != nil {
+        fatal("invalid CORRELATION_RADIUS", err)
+    }
+    correlator, err := network.NewCorrelator(pool, incidents, network.Config{
+        MinBuildings: networkMinBuildings,
+        MinShare:     networkMinShare,
+        Window:       durationEnv("CORRELATION_WINDOW", "1h"),
+        Radius:       correlationRadius,
+    })
+    if err != nil {
+        fatal("invalid correlation settings", err)
+    }
+    fleetMonitor, err := fleet.NewMonitor(pool, service.NewAnalyzer(pool, readings), incidents, correlator, riskWeights,
+        fleetDays, staleAfter, retentionEnv("RISK_HISTORY_RETENTION", "365d"))
+    if err != nil {
+        fatal("invalid fleet settings", err)
+    }
+    scheduler.Every("fleet", fleetInterval, fleetMonitor.RunOnce)
+    // Качество данных счетчиков: молчащие, залипшие, некорректные показания, пропуски и повторы
+    qualityChecker, err := quality.NewChecker(pool, incidents, quality.Config{
+        Window:      durationEnv("QUALITY_WINDOW", "2h"),
+        StaleAfter:  durationEnv("QUALITY_STALE_AFTER", "30m"),
+        FrozenAfter: durationEnv("QUALITY_FROZEN_AFTER", "1h"),
+        MaxGap:      durationEnv("QUALITY_MAX_GAP", "15m"),
+    })
+    if err != nil {
+        fatal("invalid quality settings", err)
+    }
+    scheduler.Every("quality", durationEnv("QUALITY_INTERVAL", "5m"), qualityChecker.RunOnce)
+    // Сроки поверки счетчиков: предупреждение заранее, критический инцидент после окончания
+    verificationChecker, err := meter.NewVerificationChecker(pool, incidents, durationEnv("METER_VERIFICATION_WARN", "720h"))
+    if err != nil {
+        fatal("invalid meter verification settings", err)
+    }
+    scheduler.Every("meters", durationEnv("METER_CHECK_INTERVAL", "1h"), verificationChecker.RunOnce)
+    // Отставание фоновых задач не мешает обслуживать запросы, поэтому проверка некритичная
+    readiness.Register("scheduler", false, scheduler.CheckLag(rollupInterval))
+    jobsCtx, stopJobs := context.WithCancel(context.Background())
+    defer stopJobs()
+    scheduler.Start(jobsCtx)
+
+    // Метрики Prometheus
+    metrics.RegisterPool(pool)
+    metrics.RegisterWebSocketClients(wsClientCount)
+
+    // Создание HTTP сервера. Журнал запросов пишет logging.Middleware вместо стандартного логгера gin
+    router := gin.New()
+    router.Use(gin.Recovery(), otelgin.Middleware(tracing.ServiceName), logging.Middleware("/livez", "/readyz", "/metrics"), metrics.Middleware())
+
+    // Настройка CORS: с credentials нельзя разрешать "*", поэтому домены задаются явно.
+    // Тот же список ограничивает Origin подключений WebSocket
+    allowedOrigins := strings.Split(getEnv("CORS_ALLOWED_ORIGINS", "http://localhost:8080"), ",")
+    upgrader.CheckOrigin = allowOrigins(allowedOrigins)
     router.Use(cors.New(cors.Config{
-        AllowOrigins:     []string{"*"},
+        AllowOrigins:     allowedOrigins,
         AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-        AllowHeaders:     []string{"Origin", "Content-Type", "Authorization"},
-        ExposeHeaders:    []string{"Content-Length"},
+        AllowHeaders:     []string{"Origin", "Content-Type", "Authorization", auth.APIKeyHeader, logging.RequestIDHeader},
+        ExposeHeaders:    []string{"Content-Length", logging.RequestIDHeader},
         AllowCredentials: true,
         MaxAge: 12 * time.Hour,
     }))
@@ -238,31 +467,123 @@ func main() {
     router.LoadHTMLGlob("./web/*.html")
 
     // Инициализация обработчиков
-    handler := api.NewHandler(pool)
+    handler := api.NewHandler(pool, dataGenerator, readings)
+    authHandler := api.NewAuthHandler(users, tokens)
+    apiKeyHandler := api.NewAPIKeyHandler(apiKeys)
+    orgs := tenant.NewOrganizationStore(pool)
+    ingestor := service.NewIngestor(pool)
+    ingestHandler := api.NewIngestHandler(ingestor, orgs)
+    totalizerHandler := api.NewTotalizerHandler(ingestor, orgs)
+    meterHandler := api.NewMeterHandler(meter.NewStore(pool), ingestor, orgs)
+    orgHandler := api.NewOrganizationHandler(orgs)
+    auditHandler := api.NewAuditHandler(auditRec)
+    fleetHandler := api.NewFleetHandler(fleetMonitor, incidents, qualityChecker)
+    networkHandler := api.NewNetworkHandler(network.NewStore(pool), service.NewAnalyzer(pool, readings), incidents, orgs)
+    tariffHandler := api.NewTariffHandler(tariff.NewStore(pool), orgs)
+    benchmarkHandler := api.NewBenchmarkHandler(benchmark.NewBenchmarker(pool, readings), benchmark.NewStore(pool), orgs)
 
     // Главная страница
     router.GET("/", func(c *gin.Context) {
         c.HTML(http.StatusOK, "index.html", nil)
     })
 
-    // WebSocket endpoint
-    router.GET("/ws", handleWebSocket)
+    // Метрики для Prometheus
+    router.GET("/metrics", gin.WrapH(metrics.Handler()))
+
+    // Пробы Kubernetes: /livez - процесс работоспособен, /readyz - готов принимать запросы
+    router.GET("/livez", liveness.Handler())
+    router.GET("/readyz", readiness.Handler())
+
+    // WebSocket endpoint (токен передается в ?token=)
+    router.GET("/ws", tokens.Middleware(), auth.RequireRole(auth.RoleViewer), handleWebSocket)
 
     // API маршруты
     apiGroup := router.Group("/api")
     {
-        apiGroup.GET("/buildings", handler.GetBuildings)
-        apiGroup.GET("/buildings/:id", handler.GetBuildingByID)
-        apiGroup.GET("/analysis/:id", handler.AnalyzeBuilding)
-        apiGroup.POST("/seed-data", handler.SeedTestData)
-        apiGroup.GET("/realtime/:id", handler.GetRealtimeData)
-        apiGroup.POST("/generator/start", handler.StartGenerator)
-        apiGroup.POST("/generator/stop", handler.StopGenerator)
-        apiGroup.GET("/generator/status", handler.GetGeneratorStatus)
-        apiGroup.GET("/debug/:id", handler.DebugData)
-        apiGroup.POST("/generate-history", handler.GenerateHistory)
-        apiGroup.POST("/create-test-buildings", handler.CreateTestBuildings)
-        apiGroup.POST("/generate-complete-history", handler.GenerateCompleteHistoricalData)
+        apiGroup.POST("/auth/login", auditRec.Middleware(audit.ActionLogin, "user"), authHandler.Login)
+
+        // Просмотр: любой аутентифицированный пользователь
+        viewer := apiGroup.Group("", tokens.Middleware(), auth.RequireRole(auth.RoleViewer))
+        viewer.GET("/auth/me", authHandler.Me)
+        viewer.GET("/buildings", handler.GetBuildings)
+        viewer.GET("/buildings/:id", handler.GetBuildingByID)
+        viewer.GET("/analysis/:id", handler.AnalyzeBuilding)
+        viewer.GET("/analysis", handler.AnalyzeBuildings)
+        viewer.GET("/realtime/:id", handler.GetRealtimeData)
+        viewer.GET("/timeseries/:id", handler.GetTimeSeries)
+        viewer.GET("/heat", handler.HeatReport)
+        viewer.GET("/heat/:id", handler.BuildingHeatReport)
+        viewer.GET("/generator/status", handler.GetGeneratorStatus)
+        viewer.GET("/organizations", orgHandler.ListOrganizations)
+        viewer.GET("/fleet/summary", fleetHandler.Summary)
+        viewer.GET("/risk/:id", fleetHandler.RiskReport)
+        viewer.GET("/quality/:id", fleetHandler.BuildingQuality)
+        viewer.GET("/totalizers/:id", totalizerHandler.BuildingTotalizers)
+        viewer.GET("/buildings/:id/meters", meterHandler.ListMeters)
+        viewer.GET("/meters/:id/history", meterHandler.MeterHistory)
+        viewer.GET("/incidents", fleetHandler.ListIncidents)
+        viewer.GET("/network/nodes", networkHandler.ListNodes)
+        viewer.GET("/network/nodes/:id", networkHandler.GetNode)
+        viewer.GET("/network/nodes/:id/analysis", networkHandler.AnalyzeNode)
+        viewer.GET("/situations", networkHandler.ListSituations)
+        viewer.GET("/situations/:id", networkHandler.GetSituation)
+        viewer.GET("/tariffs", tariffHandler.ListTariffs)
+        viewer.GET("/buildings/:id/tariff", tariffHandler.BuildingTariff)
+        viewer.GET("/benchmark", benchmarkHandler.Rank)
+        viewer.GET("/benchmark/:id", benchmarkHandler.Building)
+
+        // Диспетчер: работа с инцидентами
+        dispatcher := apiGroup.Group("", tokens.Middleware(), auth.RequireRole(auth.RoleDispatcher))
+        dispatcher.POST("/incidents/:id/acknowledge", auditRec.Middleware(audit.ActionIncidentAck, "incident"), fleetHandler.AcknowledgeIncident)
+        dispatcher.POST("/incidents/:id/resolve", auditRec.Middleware(audit.ActionIncidentResolve, "incident"), fleetHandler.ResolveIncident)
+
+        // Инженер: управление генератором и диагностика
+        engineer := apiGroup.Group("", tokens.Middleware(), auth.RequireRole(auth.RoleEngineer))
+        engineer.POST("/generator/start", auditRec.Middleware(audit.ActionGeneratorStart, "generator"), handler.StartGenerator)
+        engineer.POST("/generator/stop", auditRec.Middleware(audit.ActionGeneratorStop, "generator"), handler.StopGenerator)
+        engineer.GET("/debug/:id", handler.DebugData)
+        engineer.POST("/buildings/:id/meter-replacements", auditRec.Middleware(audit.ActionMeterReplace, "building"), totalizerHandler.RecordReplacement)
+        engineer.POST("/buildings/:id/meters", auditRec.Middleware(audit.ActionMeterCreate, "building"), meterHandler.CreateMeter)
+        engineer.PATCH("/meters/:id", auditRec.Middleware(audit.ActionMeterUpdate, "meter"), meterHandler.UpdateMeter)
+        engineer.POST("/meters/:id/replace", auditRec.Middleware(audit.ActionMeterReplace, "meter"), meterHandler.ReplaceMeter)
+        engineer.PUT("/buildings/:id/location", auditRec.Middleware(audit.ActionBuildingLocate, "building"), networkHandler.SetLocation)
+        engineer.PUT("/buildings/:id/attributes", auditRec.Middleware(audit.ActionBuildingAttributes, "building"), benchmarkHandler.SetAttributes)
+
+        // Администратор: пользователи и операции, изменяющие данные
+        admin := apiGroup.Group("", tokens.Middleware(), auth.RequireRole(auth.RoleAdmin))
+        admin.GET("/users", authHandler.ListUsers)
+        admin.POST("/users", auditRec.Middleware(audit.ActionUserCreate, "user"), authHandler.CreateUser)
+        admin.GET("/api-keys", apiKeyHandler.ListAPIKeys)
+        admin.POST("/api-keys", auditRec.Middleware(audit.ActionAPIKeyCreate, "api_key"), apiKeyHandler.CreateAPIKey)
+        admin.POST("/api-keys/:id/rotate", auditRec.Middleware(audit.ActionAPIKeyRotate, "api_key"), apiKeyHandler.RotateAPIKey)
+        admin.DELETE("/api-keys/:id", auditRec.Middleware(audit.ActionAPIKeyRevoke, "api_key"), apiKeyHandler.RevokeAPIKey)
+        admin.POST("/seed-data", auditRec.Middleware(audit.ActionDataSeed, ""), handler.SeedTestData)
+        admin.POST("/generate-history", auditRec.Middleware(audit.ActionHistoryGenerate, ""), handler.GenerateHistory)
+        admin.POST("/create-test-buildings", auditRec.Middleware(audit.ActionBuildingsCreate, ""), handler.CreateTestBuildings)
+        admin.POST("/generate-complete-history", auditRec.Middleware(audit.ActionHistoryGenerate, ""), handler.GenerateCompleteHistoricalData)
+        admin.GET("/audit", auditHandler.ListAudit)
+        admin.POST("/tariffs", auditRec.Middleware(audit.ActionTariffCreate, "tariff"), tariffHandler.CreateTariff)
+        admin.DELETE("/tariffs/:id", auditRec.Middleware(audit.ActionTariffDelete, "tariff"), tariffHandler.DeleteTariff)
+
+        // Суперпользователь: управляющие компании и распределение зданий
+        superuser := admin.Group("", auth.RequireSuperuser())
+        superuser.POST("/organizations", auditRec.Middleware(audit.ActionOrganizationCreate, "organization"), orgHandler.CreateOrganization)
+        superuser.PUT("/buildings/:id/organization", auditRec.Middleware(audit.ActionBuildingAssign, "building"), orgHandler.AssignBuilding)
+        // Узлы тепловой сети - общая инфраструктура, не принадлежат компании
+        superuser.POST("/network/nodes", auditRec.Middleware(audit.ActionNetworkNodeCreate, "network_node"), networkHandler.CreateNode)
+        superuser.PUT("/network/nodes/:id", auditRec.Middleware(audit.ActionNetworkNodeUpdate, "network_node"), networkHandler.UpdateNode)
+        superuser.DELETE("/network/nodes/:id", auditRec.Middleware(audit.ActionNetworkNodeDelete, "network_node"), networkHandler.DeleteNode)
+        superuser.PUT("/itp/:id/node", auditRec.Middleware(audit.ActionITPConnect, "itp"), networkHandler.ConnectITP)
+        superuser.PUT("/buildings/:id/region", auditRec.Middleware(audit.ActionBuildingRegion, "building"), tariffHandler.SetRegion)
+
+        // Прием показаний от шлюзов телеметрии по API ключу (заголовок X-API-Key)
+        ingest := apiGroup.Group("/ingest")
+        ingest.POST("/hot-water", apiKeys.Middleware(auth.ScopeIngestHotWater), ingestHandler.IngestHotWater)
+        ingest.POST("/cold-water", apiKeys.Middleware(auth.ScopeIngestColdWater), ingestHandler.IngestColdWater)
+        ingest.POST("/hot-water/totals", apiKeys.Middleware(auth.ScopeIngestHotWater), ingestHandler.IngestHotWaterTotals)
+        ingest.POST("/cold-water/totals", apiKeys.Middleware(auth.ScopeIngestColdWater), ingestHandler.IngestColdWaterTotals)
+        ingest.POST("/temperature", apiKeys.Middleware(auth.ScopeIngestTemperature), ingestHandler.IngestTemperature)
+        ingest.POST("/pumps", apiKeys.Middleware(auth.ScopeIngestPump), ingestHandler.IngestPumpData)
         
         // Простой тестовый эндпоинт
         apiGroup.GET("/test", func(c *gin.Context) {
@@ -273,60 +594,70 @@ func main() {
             })
         })
         
-        // Health check
+        // Health check: сводка готовности для людей (пробы Kubernetes используют /livez и /readyz)
         apiGroup.GET("/health", func(c *gin.Context) {
-            // Проверяем соединение с БД
-            var dbStatus string
-            var buildingCount int
-            
-            err := pool.QueryRow(context.Background(), "SELECT COUNT(*) FROM buildings").Scan(&buildingCount)
-            if err != nil {
-                dbStatus = "error: " + err.Error()
-                buildingCount = 0
-            } else {
-                dbStatus = "connected"
+            report := readiness.Run(c.Request.Context())
+            status := http.StatusOK
+            if report.Status != health.StatusOK {
+                status = http.StatusServiceUnavailable
             }
-            
-            c.JSON(http.StatusOK, gin.H{
-                "status": "ok",
-                "database": dbStatus,
-                "buildings_count": buildingCount,
-                "generator_running": dataGenerator != nil && dataGenerator.IsRunning(),
-                "websocket_connections": len(wsConnections),
-                "timestamp": time.Now().Format(time.RFC3339),
+
+            c.JSON(status, gin.H{
+                "status": report.Status,
+                "checks": report.Checks,
+                "generator_running": dataGenerator.IsRunning(),
+                "websocket_connections": wsClientCount(),
+                "timestamp": report.Timestamp.Format(time.RFC3339),
             })
         })
     }
 
     // Запуск сервера
-    log.Println("Server starting on :8080")
-    log.Println("Available endpoints:")
-    log.Println("  http://localhost:8080/ - Frontend")
-    log.Println("  http://localhost:8080/ws - WebSocket")
-    log.Println("  http://localhost:8080/api/buildings - Buildings API")
-    log.Println("  http://localhost:8080/api/test - Test API")
-    log.Println("  http://localhost:8080/api/health - Health check")
-    log.Println("  http://localhost:8080/api/realtime/:id - Real-time data")
-    log.Println("  http://localhost:8080/api/analysis/:id - Intelligent analysis")
-    
-    if err := router.Run(":8080"); err != nil {
-        log.Fatalf("Failed to start server: %v", err)
+    srv := &http.Server{Addr: ":8080", Handler: router}
+    go func() {
+        slog.Info("server starting", "addr", srv.Addr)
+        if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+            fatal("failed to start server", err)
+        }
+    }()
+
+    // Остановка по сигналу: дожидаемся текущих запросов и отправляем накопленные спаны
+    stop, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+    defer cancel()
+    <-stop.Done()
+
+    slog.Info("shutting down")
+    dataGenerator.Stop()
+    stopJobs()
+    shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), 10*time.Second)
+    defer cancelShutdown()
+    if err := srv.Shutdown(shutdownCtx); err != nil {
+        slog.Error("server shutdown failed", logging.Err(err))
+    }
+    if err := shutdownTracing(shutdownCtx); err != nil {
+        slog.Error("tracing shutdown failed", logging.Err(err))
     }
 }
 
 func handleWebSocket(c *gin.Context) {
+    scope := tenant.FromContext(c)
+
     conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
     if err != nil {
-        log.Printf("WebSocket upgrade error: %v", err)
+        wsLog.WarnContext(c.Request.Context(), "upgrade failed", logging.Err(err))
         return
     }
     defer conn.Close()
 
-    wsConnections[conn] = true
-    log.Printf("WebSocket client connected. Total connections: %d", len(wsConnections))
+    client := &wsClient{conn: conn, scope: scope}
+    wsMu.Lock()
+    wsConnections[conn] = client
+    total := len(wsConnections)
+    wsMu.Unlock()
+    wsLog.InfoContext(c.Request.Context(), "client connected", "connections", total)
 
     // Отправляем начальные данные
-    conn.WriteJSON(gin.H{
+    client.writeJSON(gin.H{
         "type": "connected",
         "message": "WebSocket connected successfully",
         "timestamp": time.Now().Format(time.RFC3339),
@@ -337,9 +668,11 @@ func handleWebSocket(c *gin.Context) {
         var message map[string]interface{}
         err := conn.ReadJSON(&message)
         if err != nil {
-            log.Printf("WebSocket read error: %v", err)
+            wsMu.Lock()
             delete(wsConnections, conn)
-            log.Printf("WebSocket client disconnected. Total connections: %d", len(wsConnections))
+            total := len(wsConnections)
+            wsMu.Unlock()
+            wsLog.InfoContext(c.Request.Context(), "client disconnected", "connections", total, "reason", err.Error())
             break
         }
 
@@ -347,12 +680,12 @@ func handleWebSocket(c *gin.Context) {
         if msgType, ok := message["type"].(string); ok {
             switch msgType {
             case "ping":
-                conn.WriteJSON(gin.H{
+                client.writeJSON(gin.H{
                     "type": "pong",
                     "timestamp": time.Now().Format(time.RFC3339),
                 })
             case "subscribe":
-                conn.WriteJSON(gin.H{
+                client.writeJSON(gin.H{
                     "type": "subscribed",
                     "message": "Subscribed to realtime updates",
                     "channels": message["channels"],
@@ -362,20 +695,33 @@ func handleWebSocket(c *gin.Context) {
     }
 }
 
-// Функция для рассылки обновлений всем подключенным клиентам
-func broadcastUpdate(data interface{}) {
-    for conn := range wsConnections {
-        err := conn.WriteJSON(data)
+// Функция для рассылки обновлений подключенным клиентам компании organizationID
+// (nil - здание не распределено, обновление получают только суперпользователи)
+func broadcastUpdate(organizationID *uuid.UUID, data interface{}) {
+    wsMu.Lock()
+    clients := make([]*wsClient, 0, len(wsConnections))
+    for _, client := range wsConnections {
+        if client.scope.Allows(organizationID) {
+            clients = append(clients, client)
+        }
+    }
+    wsMu.Unlock()
+
+    for _, client := range clients {
+        err := client.writeJSON(data)
         if err != nil {
-            conn.Close()
-            delete(wsConnections, conn)
-            log.Printf("Removed disconnected WebSocket client. Total connections: %d", len(wsConnections))
+            client.conn.Close()
+            wsMu.Lock()
+            delete(wsConnections, client.conn)
+            total := len(wsConnections)
+            wsMu.Unlock()
+            wsLog.Info("removed disconnected client", "connections", total, logging.Err(err))
         }
     }
 }
 
 // Функция для отправки данных реального времени
-func broadcastRealtimeData(buildingID string, data interface{}) {
+func broadcastRealtimeData(buildingID string, organizationID *uuid.UUID, data interface{}) {
     updateMessage := gin.H{
         "type": "realtime_update",
         "building_id": buildingID,
@@ -383,5 +729,5 @@ func broadcastRealtimeData(buildingID string, data interface{}) {
         "timestamp": time.Now().Format(time.RFC3339),
         "update_id": time.Now().Unix(),
     }
-    broadcastUpdate(updateMessage)
+    broadcastUpdate(organizationID, updateMessage)
 }
\ No newline at end of file
@@ -5,20 +5,57 @@ class WaterMonitoringAPI {
         this.baseUrl = baseUrl;
     }
 
-    async request(endpoint, options = {}) {
+    getToken() {
+        return localStorage.getItem('authToken');
+    }
+
+    // Вход по логину и паролю, токен сохраняется в localStorage
+    async login() {
+        const username = window.prompt('Логин:');
+        const password = username ? window.prompt('Пароль:') : null;
+        if (!username || !password) {
+            return false;
+        }
+
+        const response = await fetch(`${this.baseUrl}/auth/login`, {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify({ username, password })
+        });
+        if (!response.ok) {
+            alert('Неверный логин или пароль');
+            return false;
+        }
+
+        const data = await response.json();
+        localStorage.setItem('authToken', data.token);
+        return true;
+    }
+
+    async request(endpoint, options = {}, retried = false) {
         const url = `${this.baseUrl}${endpoint}`;
         console.log(` API запрос: ${url}`);
         
         try {
+            const token = this.getToken();
             const response = await fetch(url, {
+                ...options,
                 headers: {
                     'Content-Type': 'application/json',
+                    ...(token ? { 'Authorization': `Bearer ${token}` } : {}),
                     ...options.headers
-                },
-                ...options
+                }
             });
 
             console.log(` Статус ответа: ${response.status}`);
+
+            // Токен отсутствует или истек - запрашиваем вход и повторяем запрос
+            if (response.status === 401 && !retried) {
+                localStorage.removeItem('authToken');
+                if (await this.login()) {
+                    return this.request(endpoint, options, true);
+                }
+            }
             
             if (!response.ok) {
                 throw new Error(`Ошибка HTTP! статус: ${response.status}`);
@@ -83,7 +120,8 @@ class RealtimeManager {
     connect() {
         try {
             const protocol = window.location.protocol === 'https:' ? 'wss:' : 'ws:';
-            const wsUrl = `${protocol}//${window.location.host}/ws`;
+            const token = encodeURIComponent(localStorage.getItem('authToken') || '');
+            const wsUrl = `${protocol}//${window.location.host}/ws?token=${token}`;
             
             this.ws = new WebSocket(wsUrl);
             
@@ -343,12 +381,13 @@ class WaterMonitoringApp {
                     this.currentBuilding = buildings[0].id;
                 }
             } else {
-                this.showTestData();
+                this.showNoBuildings();
             }
             
         } catch (error) {
             console.error(" Ошибка загрузки:", error);
-            this.showTestData();
+            this.showNoBuildings();
+            this.showError('Ошибка загрузки объектов: ' + error.message);
         }
     }
 
@@ -457,10 +496,17 @@ class WaterMonitoringApp {
         if (!container) return;
 
         let htmlContent = '';
-        if (analysis.data_source === 'estimated') {
+        if (analysis.data_source === 'insufficient_data') {
+            const missingNames = {
+                cold_water: 'ХВС',
+                hot_water: 'ГВС',
+                temperature: 'температура',
+                pumps: 'насосы'
+            };
+            const missing = (analysis.missing || []).map(m => missingNames[m] || m).join(', ');
             htmlContent = `
                 <div class="warning-banner" style="background: #fff3cd; border: 1px solid #ffeaa7; padding: 15px; border-radius: 4px; margin-bottom: 20px; color: #856404;">
-                     Внимание: используются расчетные данные. Реальные данные отсутствуют в системе.
+                     Недостаточно данных для анализа баланса. Нет показаний: ${this.escapeHtml(missing)}.
                 </div>
             `;
         }
@@ -674,7 +720,7 @@ class WaterMonitoringApp {
 
         if (!this.currentBuilding) {
             console.log("Нет здания для мониторинга");
-            this.displayDemoRealtimeData();
+            this.displayNoRealtimeData();
             return;
         }
 
@@ -683,34 +729,27 @@ class WaterMonitoringApp {
             this.displayRealtimeData(data);
         } catch (error) {
             console.error("Ошибка обновления реального времени:", error);
-            this.displayDemoRealtimeData();
+            this.displayNoRealtimeData();
         }
     }
 
     displayRealtimeData(data) {
-        // Холодная вода - подача
-        const coldWaterIn = data.cold_water?.total_flow_rate || data.coldWaterIn || 0;
+        // Показатель без данных приходит как null и отображается прочерком
+        const coldWaterIn = data.cold_water ? data.cold_water.total_flow_rate : null;
         this.updateMetric('coldWaterIn', coldWaterIn, 'м³/ч');
         
-        // Горячая вода - канал 1
-        const hotWaterCh1 = data.hot_water?.flow_rate_ch1 || data.hotWaterCh1 || 0;
+        const hotWaterCh1 = data.hot_water ? data.hot_water.flow_rate_ch1 : null;
         this.updateMetric('hotWaterCh1', hotWaterCh1, 'м³/ч');
         
-        // Горячая вода - канал 2  
-        const hotWaterCh2 = data.hot_water?.flow_rate_ch2 || data.hotWaterCh2 || 0;
+        const hotWaterCh2 = data.hot_water ? data.hot_water.flow_rate_ch2 : null;
         this.updateMetric('hotWaterCh2', hotWaterCh2, 'м³/ч');
         
-        // Холодная вода - возврат (примерно 80% от подачи)
-        const coldWaterOut = Math.round(coldWaterIn * 0.8);
+        // Счетчика возврата ХВС нет - значение не показываем
+        const coldWaterOut = null;
         this.updateMetric('coldWaterOut', coldWaterOut, 'м³/ч');
         
         // Температурные данные
-        if (data.temperature) {
-            this.updateTemperatureData(data.temperature);
-        }
-        
-        // Обновляем тренды
-        this.updateTrends();
+        this.updateTemperatureData(data.temperature);
         
         // Обновляем график
         this.updateRealtimeChart(coldWaterIn, coldWaterOut, hotWaterCh1, hotWaterCh2);
@@ -725,13 +764,15 @@ class WaterMonitoringApp {
     updateMetric(elementId, value, unit) {
         const element = document.getElementById(elementId);
         if (element) {
-            element.textContent = `${value} ${unit}`;
+            element.textContent = `${value === null || value === undefined ? '—' : value} ${unit}`;
         }
     }
 
     updateTemperatureData(tempData) {
         const tempElement = document.getElementById('temperatureData');
-        if (tempElement && tempData.supply_temp) {
+        if (tempElement && !tempData) {
+            tempElement.innerHTML = '';
+        } else if (tempElement) {
             tempElement.innerHTML = `
                 <div style="display: flex; justify-content: space-around; margin-top: 10px; font-size: 12px; color: #666;">
                     <span>Подача: ${tempData.supply_temp}°C</span>
@@ -742,37 +783,14 @@ class WaterMonitoringApp {
         }
     }
 
-    displayDemoRealtimeData() {
-        console.log("🎮 Использование демо-данных реального времени");
-        
-        // Демо-данные когда API недоступно
-        const coldWaterIn = 50 + Math.floor(Math.random() * 50);
-        const hotWaterCh1 = 20 + Math.floor(Math.random() * 30);
-        const hotWaterCh2 = 10 + Math.floor(Math.random() * 20);
-        const coldWaterOut = Math.round(coldWaterIn * 0.8);
-    
-        this.updateMetric('coldWaterIn', coldWaterIn, 'м³/ч');
-        this.updateMetric('coldWaterOut', coldWaterOut, 'м³/ч');
-        this.updateMetric('hotWaterCh1', hotWaterCh1, 'м³/ч');
-        this.updateMetric('hotWaterCh2', hotWaterCh2, 'м³/ч');
-        
-        this.updateTrends();
-        this.updateDemoChart(coldWaterIn, coldWaterOut, hotWaterCh1, hotWaterCh2);
-    }
-
-    updateTrends() {
-        const trends = [
-            { class: 'up', text: '+' + (1 + Math.floor(Math.random() * 10)) + '%' },
-            { class: 'down', text: '-' + (1 + Math.floor(Math.random() * 5)) + '%' },
-            { class: 'stable', text: '0%' }
-        ];
-        
-        const trendElements = document.querySelectorAll('.trend');
-        trendElements.forEach((element, index) => {
-            const trend = trends[Math.floor(Math.random() * trends.length)];
-            element.className = 'trend ' + trend.class;
-            element.textContent = trend.text;
-        });
+    // Показаний нет или API недоступно - прочерки вместо значений
+    displayNoRealtimeData() {
+        ['coldWaterIn', 'coldWaterOut', 'hotWaterCh1', 'hotWaterCh2'].forEach(id => this.updateMetric(id, null, 'м³/ч'));
+        this.updateTemperatureData(null);
+        if (this.realtimeChart) {
+            this.realtimeChart.data.datasets[0].data = [null, null, null, null];
+            this.realtimeChart.update('active');
+        }
     }
 
     updateRealtimeChart(coldWaterIn, coldWaterOut, hotWaterCh1, hotWaterCh2) {
@@ -782,13 +800,6 @@ class WaterMonitoringApp {
         this.createOrUpdateChart(ctx, coldWaterIn, coldWaterOut, hotWaterCh1, hotWaterCh2);
     }
 
-    updateDemoChart(coldWaterIn, coldWaterOut, hotWaterCh1, hotWaterCh2) {
-        const ctx = document.getElementById('realtimeChart');
-        if (!ctx) return;
-        
-        this.createOrUpdateChart(ctx, coldWaterIn, coldWaterOut, hotWaterCh1, hotWaterCh2);
-    }
-
     createOrUpdateChart(ctx, coldWaterIn, coldWaterOut, hotWaterCh1, hotWaterCh2) {
         if (!this.realtimeChart) {
             this.realtimeChart = new Chart(ctx, {
@@ -934,22 +945,10 @@ class WaterMonitoringApp {
         }
     }
 
-    showTestData() {
-        console.log("Используем тестовые данные");
-        const testBuildings = [
-            {
-                id: 'test-1',
-                address: 'г. Москва, ул. Ленина, д. 10',
-                fias_id: 'fias-001',
-                unom_id: 'unom-1001',
-                created_at: new Date().toISOString(),
-                updated_at: new Date().toISOString()
-            }
-        ];
-        
-        this.buildings = testBuildings;
-        this.renderBuildings(testBuildings);
-        this.populateBuildingSelect(testBuildings);
+    showNoBuildings() {
+        this.buildings = [];
+        this.renderBuildings([]);
+        this.populateBuildingSelect([]);
     }
 
     escapeHtml(text) {